@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultActor は話者を指定しなかった場合に使う話者名です
+const defaultActor = "ずんだもん"
+
+// actorsFlag は --actor を複数回指定できるようにする flag.Value です。
+// 既定の話者を names に入れて作成し、最初に指定されたときに置き換えます
+type actorsFlag struct {
+	names []string
+	set   bool
+}
+
+func (f *actorsFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return strings.Join(f.names, ",")
+}
+
+// Set は話者名を追加します。最初の指定で既定の話者を置き換えます
+func (f *actorsFlag) Set(value string) error {
+	if !f.set {
+		f.names = nil
+		f.set = true
+	}
+	f.names = append(f.names, value)
+	return nil
+}
+
+// addList はカンマ区切りの話者名 (--actors) を追加します
+func (f *actorsFlag) addList(list string) {
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			f.Set(name)
+		}
+	}
+}
+
+// list は指定された話者名の一覧を返します
+func (f *actorsFlag) list() []string {
+	if len(f.names) == 0 {
+		return []string{defaultActor}
+	}
+	return f.names
+}
+
+// ActorsOptions は複数の話者で同じテキストを合成するときの共通の設定です
+type ActorsOptions struct {
+	Exact       bool
+	Input       string // 入力ファイルのパス ({input} の展開に使います)
+	Output      string // 出力ファイル名のテンプレート ({actor} などで話者ごとに区別します)
+	Format      string
+	KanaMode    bool
+	Params      SynthesisParams
+	Post        PostProcess
+	Mkdir       bool
+	Overwrite   OverwritePolicy
+	Interactive bool
+	Quiet       bool
+}
+
+// synthesizeActors は同じ区間の並びを複数の話者で合成し、話者ごとに別のファイルへ保存します。
+// 話者の一覧は1回だけ取得して全員の解決に使い、失敗した話者があっても残りの話者を続けます
+func synthesizeActors(client *Client, names []string, segments []Segment, opts ActorsOptions) ([]BatchResult, error) {
+	speakers, err := client.Speakers()
+	if err != nil {
+		return nil, err
+	}
+
+	startTime := time.Now()
+	results := make([]BatchResult, len(names))
+	for i, name := range names {
+		if client.requestContext().Err() != nil {
+			results[i] = BatchResult{Label: name, Skipped: true, Reason: "中断したため処理していません"}
+			continue
+		}
+		logInfo("--- [%d/%d] %s ---", i+1, len(names), name)
+		results[i] = BatchResult{Label: name}
+		selection, err := selectSpeaker(speakers, client.resolveAlias(name), opts.Exact, client.StyleType, client.Style)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		client.checkSpeakerVersion(selection)
+
+		path := expandOutputName(opts.Output, NameContext{
+			Input:     opts.Input,
+			Actor:     selection.Speaker.Name,
+			Style:     selection.Style.Name,
+			SpeakerID: selection.Style.ID,
+			Time:      startTime,
+		})
+		results[i].Output = path
+		if !confirmOverwrite(path, opts.Overwrite, opts.Interactive) {
+			results[i].Skipped = true
+			results[i].Reason = "既に存在します"
+			continue
+		}
+		results[i].Err = synthesizeActorTo(client, selection, segments, path, opts)
+		if errors.Is(results[i].Err, context.Canceled) {
+			results[i].Err = errInterrupted
+		}
+	}
+	return results, nil
+}
+
+// synthesizeActorTo は1人の話者で合成した音声を path に保存します
+func synthesizeActorTo(client *Client, selection *SpeakerSelection, segments []Segment, path string, opts ActorsOptions) error {
+	wavData, err := synthesizeSegments(client, segments, selection.Style.ID, opts.KanaMode, opts.Params, opts.Quiet)
+	if err != nil {
+		return err
+	}
+	if wavData, err = opts.Post.apply(wavData); err != nil {
+		return err
+	}
+	encoded, err := encodeOutput(wavData, opts.Format)
+	if err != nil {
+		return err
+	}
+	return writeOutputFile(path, encoded, opts.Mkdir)
+}
+
+// checkActorsOutput は複数の話者を指定した場合に、出力ファイル名が話者ごとに区別できるかを確認します
+func checkActorsOutput(tmpl string) error {
+	if tmpl == "" {
+		return fmt.Errorf("複数の話者を指定した場合は -o が必要です")
+	}
+	if tmpl == stdioPath {
+		return fmt.Errorf("複数の話者を指定した場合は -o - (標準出力への出力) は使えません")
+	}
+	if !strings.Contains(tmpl, "{actor}") && !strings.Contains(tmpl, "{id}") {
+		return fmt.Errorf("複数の話者を指定した場合は、-o に {actor} か {id} を含めて話者ごとにファイル名を区別してください")
+	}
+	return nil
+}
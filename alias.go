@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+)
+
+// aliasesPath は話者のエイリアス ({"zun": "ずんだもん"} の形式) を定義するJSONファイルのパスを返します
+func aliasesPath() (string, error) {
+	return configFilePath("aliases.json")
+}
+
+// loadAliases は定義済みのエイリアスを読み込みます。ファイルが無い場合は空の一覧を返します
+func loadAliases() (map[string]string, error) {
+	path, err := aliasesPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, &FileError{Msg: "エイリアスの読み込みに失敗しました", Err: err}
+	}
+	aliases := map[string]string{}
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return nil, &FileError{Msg: fmt.Sprintf("エイリアス '%s' の解析に失敗しました", path), Err: err}
+	}
+	return aliases, nil
+}
+
+// useAliases は定義済みのエイリアスを読み込み、以降の話者の解決で使います
+func (c *Client) useAliases() error {
+	aliases, err := loadAliases()
+	if err != nil {
+		return err
+	}
+	c.Aliases = aliases
+	return nil
+}
+
+// resolveAlias はエイリアスを話者の実名に変換します。エイリアスでない名前はそのまま返します
+func (c *Client) resolveAlias(name string) string {
+	if real, ok := c.Aliases[name]; ok {
+		return real
+	}
+	return name
+}
+
+// listAliases は定義済みのエイリアスの一覧を表示します
+func listAliases() error {
+	aliases, err := loadAliases()
+	if err != nil {
+		return err
+	}
+	path, err := aliasesPath()
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(aliases))
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Println("--- 定義済みのエイリアス ---")
+	if len(names) == 0 {
+		fmt.Println("(エイリアスはありません)")
+	}
+	for _, name := range names {
+		fmt.Printf("%s => %s\n", name, aliases[name])
+	}
+	fmt.Println("----------------------------")
+	fmt.Printf("エイリアスは '%s' に {\"zun\": \"ずんだもん\"} の形式で定義します。\n", path)
+	return nil
+}
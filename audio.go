@@ -0,0 +1,488 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// maxSample16 は16bit PCMの最大振幅です
+const maxSample16 = 32767
+
+// parsePCM16 はWAVデータを解析し、16bit PCMであることを確認します
+func parsePCM16(b []byte) (*WAV, error) {
+	wav, err := parseWAV(b)
+	if err != nil {
+		return nil, err
+	}
+	if wav.Format.AudioFormat != 1 || wav.Format.BitsPerSample != 16 {
+		return nil, fmt.Errorf("16bit PCMのWAVのみ対応しています (フォーマット: %d, %dbit)", wav.Format.AudioFormat, wav.Format.BitsPerSample)
+	}
+	return wav, nil
+}
+
+// decodeSamples16 は16bit PCMデータをサンプル値の並びに変換します（ステレオの場合は左右交互）
+func decodeSamples16(pcm []byte) []int16 {
+	samples := make([]int16, len(pcm)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(pcm[i*2:]))
+	}
+	return samples
+}
+
+// encodeSamples16 はサンプル値の並びを16bit PCMデータに変換します
+func encodeSamples16(samples []int16) []byte {
+	pcm := make([]byte, len(samples)*2)
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(pcm[i*2:], uint16(s))
+	}
+	return pcm
+}
+
+// clampSample16 は値を16bit PCMの範囲に収めます
+func clampSample16(v float64) int16 {
+	v = math.Round(v)
+	if v > maxSample16 {
+		return maxSample16
+	}
+	if v < -maxSample16-1 {
+		return -maxSample16 - 1
+	}
+	return int16(v)
+}
+
+// toDBFS は振幅 (0〜1) をdBFSに換算します
+func toDBFS(amplitude float64) float64 {
+	if amplitude <= 0 {
+		return math.Inf(-1)
+	}
+	return 20 * math.Log10(amplitude)
+}
+
+// fromDBFS はdBFSを振幅 (0〜1) に換算します
+func fromDBFS(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+// peakAndRMS はサンプルのピークとRMSを振幅 (0〜1) で返します
+func peakAndRMS(samples []int16) (peak, rms float64) {
+	if len(samples) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, s := range samples {
+		v := math.Abs(float64(s)) / maxSample16
+		peak = math.Max(peak, v)
+		sum += v * v
+	}
+	return peak, math.Sqrt(sum / float64(len(samples)))
+}
+
+// normalizeWAV は16bit PCMのWAVの音量を、RMSが targetDB (dBFS) になるよう揃えます。
+// ゲインを掛けるとピークが 0dBFS を超える場合は、クリッピングしない範囲までゲインを抑えます
+func normalizeWAV(b []byte, targetDB float64) ([]byte, error) {
+	wav, err := parsePCM16(b)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := decodeSamples16(wav.Data)
+	peak, rms := peakAndRMS(samples)
+	if rms == 0 {
+		// 無音はそのまま返します
+		return b, nil
+	}
+
+	gain := fromDBFS(targetDB) / rms
+	if peak*gain > 1.0 {
+		gain = 1.0 / peak
+	}
+
+	for i, s := range samples {
+		samples[i] = clampSample16(float64(s) * gain)
+	}
+	return encodeWAV(wav.Format, encodeSamples16(samples)), nil
+}
+
+// applyFade は16bit PCMのWAVの先頭に fadeInMs、末尾に fadeOutMs ミリ秒のフェードを掛けます。
+// 振幅は線形に変化させます。フェードの長さが音声より長い場合は音声全体に掛けます
+func applyFade(b []byte, fadeInMs, fadeOutMs int) ([]byte, error) {
+	if fadeInMs < 0 || fadeOutMs < 0 {
+		return nil, fmt.Errorf("フェードの長さは0以上で指定してください")
+	}
+	wav, err := parsePCM16(b)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := int(wav.Format.Channels)
+	if channels < 1 {
+		channels = 1
+	}
+	samples := decodeSamples16(wav.Data)
+	frames := len(samples) / channels
+	fadeFrames := func(ms int) int {
+		return min(int(int64(ms)*int64(wav.Format.SampleRate)/1000), frames)
+	}
+	in, out := fadeFrames(fadeInMs), fadeFrames(fadeOutMs)
+
+	for f := 0; f < frames; f++ {
+		gain := 1.0
+		if f < in {
+			gain *= float64(f) / float64(in)
+		}
+		if rest := frames - 1 - f; rest < out {
+			gain *= float64(rest) / float64(out)
+		}
+		if gain == 1.0 {
+			continue
+		}
+		for c := 0; c < channels; c++ {
+			i := f*channels + c
+			samples[i] = clampSample16(float64(samples[i]) * gain)
+		}
+	}
+	return encodeWAV(wav.Format, encodeSamples16(samples)), nil
+}
+
+// echoFloorDB は applyEcho でエコーの余韻を残す下限のレベル (dBFS) です。エコーがこれを下回るまで音声を延長します
+const echoFloorDB = -60.0
+
+// maxEchoTailMs は applyEcho で延長する余韻の最大の長さ (ミリ秒) です
+const maxEchoTailMs = 10000
+
+// applyEcho は16bit PCMのWAVに、delayMs ミリ秒ごとに decay 倍ずつ減衰しながら繰り返すエコーを掛けます。
+// 余韻が途切れないよう、エコーが echoFloorDB まで減衰する長さ (最大 maxEchoTailMs) だけ末尾を延長します。
+// 重ねた結果のピークが 0dBFS を超える場合は、クリッピングしないよう全体の音量を下げます
+func applyEcho(b []byte, delayMs int, decay float64) ([]byte, error) {
+	if delayMs <= 0 || decay <= 0 || decay >= 1 {
+		return nil, fmt.Errorf("エコーの遅延は正のミリ秒、減衰は0より大きく1未満で指定してください")
+	}
+	wav, err := parsePCM16(b)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := max(int(wav.Format.Channels), 1)
+	delay := int(int64(delayMs)*int64(wav.Format.SampleRate)/1000) * channels
+	if delay == 0 {
+		return b, nil
+	}
+	repeats := int(math.Ceil(echoFloorDB / toDBFS(decay)))
+	repeats = max(min(repeats, maxEchoTailMs/delayMs), 1)
+
+	samples := decodeSamples16(wav.Data)
+	mixed := make([]float64, len(samples)+delay*repeats)
+	for i, s := range samples {
+		mixed[i] = float64(s)
+	}
+	// 遅延させた出力を入力に戻すことで、減衰しながら繰り返すエコーにします
+	peak := 0.0
+	for i := range mixed {
+		if i >= delay {
+			mixed[i] += decay * mixed[i-delay]
+		}
+		peak = max(peak, math.Abs(mixed[i]))
+	}
+
+	gain := 1.0
+	if peak > maxSample16 {
+		gain = maxSample16 / peak
+	}
+	out := make([]int16, len(mixed))
+	for i, v := range mixed {
+		out[i] = clampSample16(v * gain)
+	}
+	return encodeWAV(wav.Format, encodeSamples16(out)), nil
+}
+
+// silenceThresholdDB は解析で無音とみなすRMSレベル (dBFS) です
+const silenceThresholdDB = -50.0
+
+// WAVStats はWAVの音量の解析結果を表します
+type WAVStats struct {
+	Duration     time.Duration
+	PeakDB       float64 // ピーク (dBFS)
+	RMSDB        float64 // RMS (dBFS)
+	LUFS         float64 // 統合ラウドネス (LUFS)
+	TruePeakDB   float64 // トゥルーピーク (dBTP)
+	Clipped      int     // 最大振幅に張り付いたサンプル数
+	SilenceRatio float64 // 無音区間 (10ミリ秒ごとのRMSが silenceThresholdDB 未満) の割合 (0〜1)
+}
+
+// analyzeWAV は16bit PCMのWAVのピーク・RMS・ラウドネス・クリッピング・無音区間の割合を解析します
+func analyzeWAV(b []byte) (WAVStats, error) {
+	wav, err := parsePCM16(b)
+	if err != nil {
+		return WAVStats{}, err
+	}
+
+	samples := decodeSamples16(wav.Data)
+	peak, rms := peakAndRMS(samples)
+	stats := WAVStats{
+		Duration: pcmDuration(wav.Format, len(wav.Data)),
+		PeakDB:   toDBFS(peak),
+		RMSDB:    toDBFS(rms),
+	}
+	if stats.LUFS, err = measureLUFS(b); err != nil {
+		return WAVStats{}, err
+	}
+	if stats.TruePeakDB, err = measureTruePeak(b); err != nil {
+		return WAVStats{}, err
+	}
+	for _, s := range samples {
+		if s >= maxSample16 || s <= -maxSample16-1 {
+			stats.Clipped++
+		}
+	}
+
+	window := max(int(wav.Format.SampleRate)/100*int(max(wav.Format.Channels, 1)), 1)
+	var windows, silent int
+	for start := 0; start < len(samples); start += window {
+		_, r := peakAndRMS(samples[start:min(start+window, len(samples))])
+		windows++
+		if toDBFS(r) < silenceThresholdDB {
+			silent++
+		}
+	}
+	if windows > 0 {
+		stats.SilenceRatio = float64(silent) / float64(windows)
+	}
+	return stats, nil
+}
+
+// printWAVStats はWAVの解析結果を表示します
+func printWAVStats(name string, stats WAVStats) {
+	fmt.Printf("--- 音量の解析結果: %s ---\n", name)
+	fmt.Printf("長さ        : %.2f 秒\n", stats.Duration.Seconds())
+	fmt.Printf("ピーク      : %.1f dBFS\n", stats.PeakDB)
+	fmt.Printf("RMS         : %.1f dBFS\n", stats.RMSDB)
+	fmt.Printf("ラウドネス  : %.1f LUFS\n", stats.LUFS)
+	fmt.Printf("トゥルーピーク: %.1f dBTP\n", stats.TruePeakDB)
+	if stats.Clipped > 0 {
+		fmt.Printf("クリッピング: あり (%d サンプル)\n", stats.Clipped)
+	} else {
+		fmt.Println("クリッピング: なし")
+	}
+	fmt.Printf("無音の割合  : %.1f%% (%.0f dBFS 未満)\n", stats.SilenceRatio*100, silenceThresholdDB)
+}
+
+// resampleWAV は16bit PCMのWAVを targetRate (Hz) に線形補間で再サンプリングします。
+// ヘッダのサンプリングレートとバイトレートも更新します
+func resampleWAV(b []byte, targetRate int) ([]byte, error) {
+	if targetRate <= 0 {
+		return nil, fmt.Errorf("サンプリングレートは正の値で指定してください: %d", targetRate)
+	}
+	wav, err := parsePCM16(b)
+	if err != nil {
+		return nil, err
+	}
+	srcRate := int(wav.Format.SampleRate)
+	if srcRate == targetRate {
+		return b, nil
+	}
+	if srcRate == 0 {
+		return nil, fmt.Errorf("サンプリングレートが 0 のWAVは変換できません")
+	}
+
+	channels := int(max(wav.Format.Channels, 1))
+	src := decodeSamples16(wav.Data)
+	srcFrames := len(src) / channels
+	dstFrames := int(int64(srcFrames) * int64(targetRate) / int64(srcRate))
+	dst := make([]int16, dstFrames*channels)
+
+	ratio := float64(srcRate) / float64(targetRate)
+	for f := 0; f < dstFrames; f++ {
+		pos := float64(f) * ratio
+		i := int(pos)
+		frac := pos - float64(i)
+		next := min(i+1, srcFrames-1)
+		for c := 0; c < channels; c++ {
+			lo := float64(src[i*channels+c])
+			hi := float64(src[next*channels+c])
+			dst[f*channels+c] = clampSample16(lo + (hi-lo)*frac)
+		}
+	}
+
+	format := wav.Format
+	format.SampleRate = uint32(targetRate)
+	format.ByteRate = uint32(targetRate) * uint32(format.BlockAlign)
+	return encodeWAV(format, encodeSamples16(dst)), nil
+}
+
+// convertChannels は16bit PCMのWAVをステレオ (stereo が true) またはモノラルに変換します。
+// ステレオ化は左右に同じ信号を複製し、モノラル化は左右の平均を取ります。既に目的のチャンネル数ならそのまま返します
+func convertChannels(b []byte, stereo bool) ([]byte, error) {
+	wav, err := parsePCM16(b)
+	if err != nil {
+		return nil, err
+	}
+	channels := 1
+	if stereo {
+		channels = 2
+	}
+	switch {
+	case int(wav.Format.Channels) == channels:
+		return b, nil
+	case wav.Format.Channels != 1 && wav.Format.Channels != 2:
+		return nil, fmt.Errorf("モノラルかステレオのWAVのみ変換できます (チャンネル数: %d)", wav.Format.Channels)
+	}
+
+	src := decodeSamples16(wav.Data)
+	var dst []int16
+	if stereo {
+		dst = make([]int16, len(src)*2)
+		for i, s := range src {
+			dst[i*2], dst[i*2+1] = s, s
+		}
+	} else {
+		dst = make([]int16, len(src)/2)
+		for i := range dst {
+			dst[i] = clampSample16((float64(src[i*2]) + float64(src[i*2+1])) / 2)
+		}
+	}
+	return encodeWAV(pcm16Format(int(wav.Format.SampleRate), stereo), encodeSamples16(dst)), nil
+}
+
+// convertBitDepth は16bit PCMのWAVを指定したビット深度に変換します。
+// bits は 8, 16, 24, 32 のいずれかで、float が true の場合は32bit浮動小数点 (audioFormat=3) にします
+func convertBitDepth(b []byte, bits int, float bool) ([]byte, error) {
+	if float && bits != 32 {
+		return nil, fmt.Errorf("浮動小数点は32bitのみ対応しています (指定: %dbit)", bits)
+	}
+	switch bits {
+	case 8, 16, 24, 32:
+	default:
+		return nil, fmt.Errorf("未対応のビット深度です: %d (8, 16, 24, 32 のいずれかを指定してください)", bits)
+	}
+	wav, err := parsePCM16(b)
+	if err != nil {
+		return nil, err
+	}
+	if bits == 16 {
+		return b, nil
+	}
+
+	samples := decodeSamples16(wav.Data)
+	bytesPerSample := bits / 8
+	pcm := make([]byte, len(samples)*bytesPerSample)
+	for i, s := range samples {
+		out := pcm[i*bytesPerSample:]
+		switch {
+		case float:
+			binary.LittleEndian.PutUint32(out, math.Float32bits(float32(s)/(maxSample16+1)))
+		case bits == 8:
+			// 8bit PCM は符号なしで、無音は 128 です
+			out[0] = uint8(int(s)>>8 + 128)
+		case bits == 24:
+			v := int32(s) << 8
+			out[0], out[1], out[2] = byte(v), byte(v>>8), byte(v>>16)
+		case bits == 32:
+			binary.LittleEndian.PutUint32(out, uint32(int32(s)<<16))
+		}
+	}
+
+	format := wav.Format
+	format.AudioFormat = 1
+	if float {
+		format.AudioFormat = 3
+	}
+	format.BitsPerSample = uint16(bits)
+	format.BlockAlign = format.Channels * uint16(bytesPerSample)
+	format.ByteRate = format.SampleRate * uint32(format.BlockAlign)
+	return encodeWAV(format, pcm), nil
+}
+
+// parseBitDepth は --bit-depth の指定 ("8", "16", "24", "32", 浮動小数点は "32f") を解析します
+func parseBitDepth(value string) (bits int, float bool, err error) {
+	switch value {
+	case "8", "16", "24", "32":
+		bits, _ = strconv.Atoi(value)
+		return bits, false, nil
+	case "32f", "32float":
+		return 32, true, nil
+	}
+	return 0, false, fmt.Errorf("--bit-depth には 8, 16, 24, 32, 32f のいずれかを指定してください: %s", value)
+}
+
+// splitBySilence は16bit PCMのWAVを、thresholdDB (dBFS) 未満の区間が minSilenceMs ミリ秒以上続く箇所で分割します。
+// 分割位置は無音区間の中央で、先頭と末尾の無音では分割しません
+func splitBySilence(b []byte, minSilenceMs int, thresholdDB float64) ([][]byte, error) {
+	wav, err := parsePCM16(b)
+	if err != nil {
+		return nil, err
+	}
+
+	// 10ms ごとの窓で無音かどうかを判定します
+	frameSize := int(max(wav.Format.BlockAlign, 1))
+	windowBytes := max(int(wav.Format.SampleRate)/100, 1) * frameSize
+	var silent []bool
+	for start := 0; start < len(wav.Data); start += windowBytes {
+		_, rms := peakAndRMS(decodeSamples16(wav.Data[start:min(start+windowBytes, len(wav.Data))]))
+		silent = append(silent, toDBFS(rms) < thresholdDB)
+	}
+
+	minWindows := max(minSilenceMs/10, 1)
+	var cuts []int
+	seenSound := false
+	for i := 0; i < len(silent); {
+		if !silent[i] {
+			seenSound = true
+			i++
+			continue
+		}
+		j := i
+		for j < len(silent) && silent[j] {
+			j++
+		}
+		if seenSound && j < len(silent) && j-i >= minWindows {
+			cuts = append(cuts, (i+j)/2*windowBytes)
+		}
+		i = j
+	}
+
+	parts := make([][]byte, 0, len(cuts)+1)
+	start := 0
+	for _, cut := range append(cuts, len(wav.Data)) {
+		parts = append(parts, encodeWAV(wav.Format, wav.Data[start:cut]))
+		start = cut
+	}
+	return parts, nil
+}
+
+// mergeShortChunks は再生時間が minChunkMs ミリ秒に満たない分割結果を次の分割結果と結合します。
+// 最後の分割結果が短い場合は、1つ前と結合します
+func mergeShortChunks(parts [][]byte, minChunkMs int) ([][]byte, error) {
+	minDuration := time.Duration(minChunkMs) * time.Millisecond
+	var merged [][]byte
+	var pending [][]byte
+	for _, part := range parts {
+		pending = append(pending, part)
+		joined, err := concatWAV(pending)
+		if err != nil {
+			return nil, err
+		}
+		d, err := wavDuration(joined)
+		if err != nil {
+			return nil, err
+		}
+		if d >= minDuration {
+			merged = append(merged, joined)
+			pending = nil
+		}
+	}
+	if len(pending) > 0 {
+		if len(merged) > 0 {
+			pending = append([][]byte{merged[len(merged)-1]}, pending...)
+			merged = merged[:len(merged)-1]
+		}
+		joined, err := concatWAV(pending)
+		if err != nil {
+			return nil, err
+		}
+		merged = append(merged, joined)
+	}
+	return merged, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import "fmt"
+
+// BatchResult は複数の出力をまとめて処理したときの、1件分の結果です
+type BatchResult struct {
+	Label   string // 結果の表示に使う名前 (マニフェストの行番号や話者名)
+	Output  string // 保存したファイルのパス
+	Skipped bool   // 合成せずにスキップした場合は true
+	Reason  string // スキップした理由
+	Err     error
+}
+
+// printBatchReport は処理結果を一覧で表示し、失敗したものがあれば最初のエラーを含むエラーを返します
+func printBatchReport(results []BatchResult) error {
+	var firstErr error
+	succeeded, skipped := 0, 0
+	fmt.Println("--- バッチ処理の結果 ---")
+	for _, r := range results {
+		if r.Skipped {
+			skipped++
+			fmt.Printf("[スキップ] %s: %s (%s)\n", r.Label, r.Output, r.Reason)
+			continue
+		}
+		if r.Err != nil {
+			fmt.Printf("[失敗] %s: %v\n", r.Label, r.Err)
+			if firstErr == nil {
+				firstErr = r.Err
+			}
+			continue
+		}
+		succeeded++
+		fmt.Printf("[成功] %s: %s\n", r.Label, r.Output)
+	}
+	fmt.Println("------------------------")
+	failed := len(results) - succeeded - skipped
+	fmt.Printf("成功: %d 件 / スキップ: %d 件 / 失敗: %d 件\n", succeeded, skipped, failed)
+	if firstErr != nil {
+		return fmt.Errorf("%d 件の処理に失敗しました (最初のエラー: %w)", failed, firstErr)
+	}
+	return nil
+}
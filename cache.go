@@ -0,0 +1,304 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// engineKeyTTL は engineKey で取得したエンジンのバージョンと辞書のハッシュを使い回す時間です。
+// --serve で常駐している間に辞書やエンジンが変わっても、この時間が過ぎれば新しいキーで合成します
+const engineKeyTTL = 5 * time.Second
+
+// キャッシュが際限なく大きくならないよう、合成結果を保存するときに cachePruneInterval に一度、
+// cacheMaxAge より長く使われていないものと、合計が cacheMaxSize を超えた分の古いものを削除します
+const (
+	cacheMaxAge        = 30 * 24 * time.Hour
+	cacheMaxSize       = 1 << 30
+	cachePruneInterval = time.Hour
+)
+
+// synthCache は合成結果を、テキスト・話者・パラメータ・エンジンのバージョンから求めたキーで保存するディスク上のキャッシュです。
+// 台本の一部だけを直して再実行したときに、変わっていないチャンクや行を合成し直さずに済ませます
+type synthCache struct {
+	dir    string
+	client *Client
+
+	engineMu  sync.Mutex
+	engine    string    // エンジンのバージョンとユーザー辞書のハッシュ。取得できない場合は空で、キャッシュを使いません
+	engineAt  time.Time // engine を取得した時刻
+	engineTTL time.Duration
+
+	mu       sync.Mutex // --jobs や --workers で並行して合成した結果を数えるため
+	hits     int        // キャッシュの合成結果を使ったチャンクと行の数
+	prunedAt time.Time  // 最後に古い合成結果を削除した時刻
+}
+
+// resultCache は合成結果のキャッシュです。nil の場合 (--no-cache) は使いません
+var resultCache *synthCache
+
+// cacheDir はキャッシュの保存先 (Linux では ~/.cache/text2voicevox) を返します
+func cacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", &FileError{Msg: "キャッシュの保存先を決められませんでした", Err: err}
+	}
+	return filepath.Join(dir, "text2voicevox"), nil
+}
+
+// newSynthCache はキャッシュを用意します。保存先を決められない場合は nil を返し、キャッシュを使わずに合成します
+func newSynthCache(client *Client) *synthCache {
+	dir, err := cacheDir()
+	if err != nil {
+		logDebug("キャッシュを使いません: %v", err)
+		return nil
+	}
+	return &synthCache{dir: filepath.Join(dir, "synthesis"), client: client, engineTTL: engineKeyTTL}
+}
+
+// engineKey はエンジンのバージョンとユーザー辞書の内容をキーの一部として返します。
+// 辞書の単語で読みが変わるため、辞書を変更した後は別の結果として扱います。
+// 辞書を取得できない場合は、変更を見落とさないようキャッシュを使いません。
+// チャンクごとに問い合わせないよう、取得した値は engineTTL の間だけ使い回します
+func (c *synthCache) engineKey() string {
+	c.engineMu.Lock()
+	defer c.engineMu.Unlock()
+	if !c.engineAt.IsZero() && time.Since(c.engineAt) < c.engineTTL {
+		return c.engine
+	}
+	c.engine, c.engineAt = "", time.Now()
+	version, err := c.client.Version()
+	if err != nil {
+		logDebug("エンジンのバージョンを取得できないため、キャッシュを使いません: %v", err)
+		return ""
+	}
+	words, err := c.client.UserDict()
+	if err != nil {
+		logDebug("ユーザー辞書を取得できないため、キャッシュを使いません: %v", err)
+		return ""
+	}
+	c.engine = version + "/" + userDictHash(words)
+	return c.engine
+}
+
+// userDictHash はユーザー辞書の単語の内容 (表記・発音・アクセント型・品詞・優先度) のハッシュを返します。
+// 単語の UUID は登録し直すたび (--dict など) に変わるため使わず、同じ内容の辞書からは同じ値になるよう並べ替えてから求めます
+func userDictHash(words map[string]UserDictWord) string {
+	lines := make([]string, 0, len(words))
+	for _, w := range words {
+		lines = append(lines, fmt.Sprintf("%q %q %d %q %d", w.Surface, w.Pronunciation, w.AccentType, w.WordType(), w.Priority))
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// key はチャンクのキャッシュのキーを返します。エンジンの情報が取得できない場合は空文字列です
+func (c *synthCache) key(seg Segment, speakerID int, kanaMode bool, params SynthesisParams) string {
+	engine := c.engineKey()
+	if engine == "" {
+		return ""
+	}
+	return chunkKey(seg, speakerID, kanaMode, params, c.client.CoreVersion, engine)
+}
+
+// path はキーに対応する音声ファイルのパスを返します。1つのディレクトリにファイルが集まりすぎないよう、キーの先頭2文字で分けます
+func (c *synthCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".wav")
+}
+
+// load はキーの合成結果がキャッシュにあれば、その音声とクエリを返します。壊れたファイルはキャッシュに無いものとして扱います
+func (c *synthCache) load(key string) ([]byte, *AudioQuery, bool) {
+	if key == "" {
+		return nil, nil, false
+	}
+	path := c.path(key)
+	wav, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, false
+	}
+	if _, err := parseWAV(wav); err != nil {
+		return nil, nil, false
+	}
+	data, err := os.ReadFile(path[:len(path)-len(".wav")] + ".json")
+	if err != nil {
+		return nil, nil, false
+	}
+	var query *AudioQuery
+	if err := json.Unmarshal(data, &query); err != nil {
+		return nil, nil, false
+	}
+	// 削除するときに使われていない順に選べるよう、音声ファイルの更新時刻を使った時刻にします
+	now := time.Now()
+	os.Chtimes(path, now, now)
+
+	c.mu.Lock()
+	c.hits++
+	c.mu.Unlock()
+	return wav, query, true
+}
+
+// save は合成結果とクエリをキャッシュに保存します。中断しても壊れたファイルが残らないよう、一時ファイルに書いてから名前を変えます
+func (c *synthCache) save(key string, wav []byte, query *AudioQuery) error {
+	if key == "" {
+		return nil
+	}
+	data, err := json.Marshal(query)
+	if err != nil {
+		return fmt.Errorf("クエリのJSON変換に失敗しました: %v", err)
+	}
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return &FileError{Msg: fmt.Sprintf("キャッシュの保存先 '%s' を作成できませんでした", filepath.Dir(path)), Err: err}
+	}
+	if err := writeFileAtomic(path[:len(path)-len(".wav")]+".json", data); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, wav); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	prune := time.Since(c.prunedAt) >= cachePruneInterval
+	if prune {
+		c.prunedAt = time.Now()
+	}
+	c.mu.Unlock()
+	if prune {
+		if removed := pruneCache(c.dir, time.Now(), cacheMaxAge, cacheMaxSize); removed > 0 {
+			logDebug("キャッシュから古い合成結果を %d 個削除しました。", removed)
+		}
+	}
+	return nil
+}
+
+// pruneCache は dir の合成結果のうち、maxAge より長く使われていないものを削除し、残りの合計が maxSize を超える場合は
+// 使われていない順に削除します。使われた時刻は音声ファイルの更新時刻 (load で更新します) です。削除した合成結果の数を返します
+func pruneCache(dir string, now time.Time, maxAge time.Duration, maxSize int64) int {
+	type entry struct {
+		base string // 拡張子を除いたパス
+		used time.Time
+		size int64
+	}
+	entries := map[string]*entry{}
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".tmp-") {
+			// 中断して残った一時ファイルは、ほかのプロセスが書き込み中でない程度に古ければ削除します
+			if now.Sub(info.ModTime()) > cachePruneInterval {
+				os.Remove(path)
+			}
+			return nil
+		}
+		ext := filepath.Ext(path)
+		if ext != ".wav" && ext != ".json" {
+			return nil
+		}
+		base := strings.TrimSuffix(path, ext)
+		e := entries[base]
+		if e == nil {
+			e = &entry{base: base}
+			entries[base] = e
+		}
+		e.size += info.Size()
+		// 音声ファイルの無い合成結果 (保存の途中のもの) は、クエリのファイルの更新時刻を使います
+		if ext == ".wav" || e.used.IsZero() {
+			e.used = info.ModTime()
+		}
+		return nil
+	})
+
+	sorted := make([]*entry, 0, len(entries))
+	var total int64
+	for _, e := range entries {
+		sorted = append(sorted, e)
+		total += e.size
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].used.Before(sorted[j].used) })
+	removed := 0
+	for _, e := range sorted {
+		if now.Sub(e.used) <= maxAge && total <= maxSize {
+			break
+		}
+		os.Remove(e.base + ".wav")
+		os.Remove(e.base + ".json")
+		total -= e.size
+		removed++
+	}
+	return removed
+}
+
+// writeFileAtomic は path と同じディレクトリの一時ファイルに data を書き、path に名前を変えます
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return &FileError{Msg: fmt.Sprintf("ファイル '%s' の保存に失敗しました", path), Err: err}
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return &FileError{Msg: fmt.Sprintf("ファイル '%s' の保存に失敗しました", path), Err: err}
+	}
+	return nil
+}
+
+// reportCacheHits はキャッシュの合成結果を使った数を表示します
+func reportCacheHits() {
+	if resultCache == nil || resultCache.hits == 0 {
+		return
+	}
+	logInfo("%d 個の合成結果はキャッシュを使いました (--no-cache で合成し直せます)。", resultCache.hits)
+}
+
+// runCacheCommand は cache サブコマンドを実行します。
+// path はキャッシュの保存先を表示し、clear は保存した合成結果をすべて削除します
+func runCacheCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("cache の後に clear か path を指定してください")
+	}
+	dir, err := cacheDir()
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "clear":
+		var files int
+		var size int64
+		filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				files++
+				size += info.Size()
+			}
+			return nil
+		})
+		if err := os.RemoveAll(dir); err != nil {
+			return &FileError{Msg: fmt.Sprintf("キャッシュ '%s' を削除できませんでした", dir), Err: err}
+		}
+		logInfo("キャッシュ '%s' を削除しました (%d ファイル, %.1f MB)。", dir, files, float64(size)/(1<<20))
+	case "path":
+		fmt.Println(dir)
+	default:
+		return fmt.Errorf("不明な cache のコマンドです: '%s' (clear か path を指定してください)", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Pikka2048/text2voicevox/voicevox"
+)
+
+func TestUserDictHash(t *testing.T) {
+	word := func(surface, pronunciation string, accent int) UserDictWord {
+		return UserDictWord{Surface: surface, Pronunciation: pronunciation, AccentType: accent,
+			PartOfSpeech: "名詞", PartOfSpeechDetail1: "固有名詞", Priority: 5}
+	}
+	base := map[string]UserDictWord{
+		"uuid-1": word("ずんだ", "ズンダ", 1),
+		"uuid-2": word("餅", "モチ", 0),
+	}
+	hash := userDictHash(base)
+
+	// 登録し直して UUID が変わっても、内容が同じなら同じハッシュです
+	reregistered := map[string]UserDictWord{
+		"uuid-3": word("餅", "モチ", 0),
+		"uuid-4": word("ずんだ", "ズンダ", 1),
+	}
+	if got := userDictHash(reregistered); got != hash {
+		t.Errorf("hash changed after re-registering the same words: %s, want %s", got, hash)
+	}
+
+	changed := map[string]func(w *UserDictWord){
+		"pronunciation": func(w *UserDictWord) { w.Pronunciation = "ズンダー" },
+		"accent":        func(w *UserDictWord) { w.AccentType = 2 },
+		"priority":      func(w *UserDictWord) { w.Priority = 9 },
+		"word type":     func(w *UserDictWord) { w.PartOfSpeechDetail1 = "一般" },
+		"surface":       func(w *UserDictWord) { w.Surface = "ずんだ餅" },
+	}
+	for name, change := range changed {
+		words := map[string]UserDictWord{"uuid-2": base["uuid-2"]}
+		w := base["uuid-1"]
+		change(&w)
+		words["uuid-1"] = w
+		if userDictHash(words) == hash {
+			t.Errorf("%s: hash did not change", name)
+		}
+	}
+
+	if userDictHash(nil) == hash {
+		t.Error("empty dictionary has the same hash")
+	}
+	// 区切りの文字を含む表記で、別の単語の組と同じ値にならないことを確かめます
+	split := map[string]UserDictWord{"a": word(`x" "y`, "ア", 0)}
+	joined := map[string]UserDictWord{"a": word("x", "ア", 0), "b": word("y", "ア", 0)}
+	if userDictHash(split) == userDictHash(joined) {
+		t.Error("different dictionaries have the same hash")
+	}
+}
+
+func TestSynthCacheEngineKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		dictCode int
+		wantKey  bool
+	}{
+		{"dictionary available", http.StatusOK, true},
+		{"dictionary unavailable", http.StatusInternalServerError, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/version":
+					io.WriteString(w, `"0.14.0"`)
+				case "/user_dict":
+					w.WriteHeader(tt.dictCode)
+					io.WriteString(w, `{}`)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer srv.Close()
+			c := &synthCache{dir: t.TempDir(), client: &Client{Client: voicevox.NewClientWithDoer(srv.URL, srv.Client())}}
+
+			key := c.key(Segment{Text: "こんにちは"}, 3, false, SynthesisParams{})
+			if (key != "") != tt.wantKey {
+				t.Fatalf("key = %q, want a key: %v", key, tt.wantKey)
+			}
+			if !tt.wantKey {
+				// キーが無い場合は保存も読み込みもしません
+				if err := c.save(key, []byte("RIFF"), &AudioQuery{}); err != nil {
+					t.Fatal(err)
+				}
+				if _, _, ok := c.load(key); ok {
+					t.Error("load succeeded without a key")
+				}
+			}
+		})
+	}
+}
+
+// TestSynthCacheEngineKeyRefresh は、常駐中に辞書を変更した場合に engineTTL が過ぎるとキーが変わることを確かめます
+func TestSynthCacheEngineKeyRefresh(t *testing.T) {
+	var dict atomic.Value
+	dict.Store(`{}`)
+	var dictRequests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/version":
+			io.WriteString(w, `"0.14.0"`)
+		case "/user_dict":
+			dictRequests.Add(1)
+			io.WriteString(w, dict.Load().(string))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	c := &synthCache{dir: t.TempDir(), client: &Client{Client: voicevox.NewClientWithDoer(srv.URL, srv.Client())}, engineTTL: time.Hour}
+	seg := Segment{Text: "ずんだ"}
+
+	before := c.key(seg, 3, false, SynthesisParams{})
+	if before == "" {
+		t.Fatal("no key")
+	}
+	dict.Store(`{"uuid-1": {"surface": "ずんだ", "pronunciation": "ズンダー", "accent_type": 1, "priority": 5}}`)
+
+	// TTL の間は問い合わせずに同じキーを使います
+	if got := c.key(seg, 3, false, SynthesisParams{}); got != before {
+		t.Errorf("key changed within the TTL: %s, want %s", got, before)
+	}
+	if n := dictRequests.Load(); n != 1 {
+		t.Errorf("user_dict requested %d times within the TTL, want 1", n)
+	}
+
+	c.engineMu.Lock()
+	c.engineAt = time.Now().Add(-2 * time.Hour)
+	c.engineMu.Unlock()
+	after := c.key(seg, 3, false, SynthesisParams{})
+	if after == "" || after == before {
+		t.Errorf("key after the dictionary change = %q, want a new key (before %q)", after, before)
+	}
+}
+
+func TestPruneCache(t *testing.T) {
+	now := time.Now()
+	dir := t.TempDir()
+	// write は used の時刻に使った、size バイトの音声とクエリの合成結果を保存します
+	write := func(key string, used time.Time, size int) {
+		t.Helper()
+		base := filepath.Join(dir, key[:2], key)
+		if err := os.MkdirAll(filepath.Dir(base), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for _, ext := range []string{".json", ".wav"} {
+			if err := os.WriteFile(base+ext, make([]byte, size/2), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(base+ext, used, used); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	exists := func(key string) bool {
+		_, err := os.Stat(filepath.Join(dir, key[:2], key+".wav"))
+		return err == nil
+	}
+
+	write("aa-expired", now.Add(-48*time.Hour), 100)
+	write("bb-oldest", now.Add(-3*time.Hour), 100)
+	write("cc-older", now.Add(-2*time.Hour), 100)
+	write("dd-newest", now.Add(-time.Hour), 100)
+	// 書き込み中に中断した一時ファイル
+	tmp := filepath.Join(dir, "aa", ".tmp-123")
+	if err := os.WriteFile(tmp, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(tmp, now.Add(-2*time.Hour), now.Add(-2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if removed := pruneCache(dir, now, 24*time.Hour, 250); removed != 2 {
+		t.Errorf("removed %d entries, want 2", removed)
+	}
+	for key, want := range map[string]bool{"aa-expired": false, "bb-oldest": false, "cc-older": true, "dd-newest": true} {
+		if exists(key) != want {
+			t.Errorf("%s exists: %v, want %v", key, !want, want)
+		}
+	}
+	if _, err := os.Stat(tmp); err == nil {
+		t.Error("stale temporary file was not removed")
+	}
+
+	if removed := pruneCache(dir, now, 24*time.Hour, 250); removed != 0 {
+		t.Errorf("second prune removed %d entries, want 0", removed)
+	}
+}
+
+// TestSynthCacheLoadMarksUsed は、キャッシュを使った合成結果が削除の対象になりにくいよう、使った時刻を更新することを確かめます
+func TestSynthCacheLoadMarksUsed(t *testing.T) {
+	c := &synthCache{dir: t.TempDir()}
+	key := "0123456789abcdef"
+	wav := encodeWAV(pcm16Format(24000, false), make([]byte, 4))
+	if err := c.save(key, wav, &AudioQuery{}); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(c.path(key), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := c.load(key); !ok {
+		t.Fatal("load failed")
+	}
+	if removed := pruneCache(c.dir, time.Now(), 24*time.Hour, 1<<30); removed != 0 {
+		t.Errorf("pruned %d entries right after use, want 0", removed)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// checkpointRecord はチェックポイントファイルの1行 (完了した1件) を表します
+type checkpointRecord struct {
+	Key         string    `json:"key"`
+	Index       int       `json:"index"`
+	Output      string    `json:"output"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+// checkpoint はバッチ処理で完了したエントリを記録し、再実行時に完了済みのエントリを判定します。
+// ファイルは1行1件のJSON (JSON Lines) で、1件完了するごとに追記するため、途中で中断しても記録済みの行は失われません
+type checkpoint struct {
+	path string
+	done map[string]string // キーから保存したファイルのパスへの対応
+}
+
+// openCheckpoint はチェックポイントファイルを読み込みます。ファイルが無ければ空の状態から始めます。
+// restart が true の場合は既存の記録を消して最初からやり直します
+func openCheckpoint(path string, restart bool) (*checkpoint, error) {
+	cp := &checkpoint{path: path, done: map[string]string{}}
+	if restart {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, &FileError{Msg: "チェックポイントの削除に失敗しました", Err: err}
+		}
+		return cp, nil
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, &FileError{Msg: "チェックポイントの読み込みに失敗しました", Err: err}
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec checkpointRecord
+		// 書き込み中に中断された行は壊れていることがあるため、読めない行は未完了として扱います
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err == nil && rec.Key != "" {
+			cp.done[rec.Key] = rec.Output
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, &FileError{Msg: "チェックポイントの読み込みに失敗しました", Err: err}
+	}
+	return cp, nil
+}
+
+// completed は key のエントリが完了済みかどうかと、完了時に保存したファイルのパスを返します
+func (c *checkpoint) completed(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	output, ok := c.done[key]
+	return output, ok
+}
+
+// count は完了済みのエントリ数を返します
+func (c *checkpoint) count() int {
+	if c == nil {
+		return 0
+	}
+	return len(c.done)
+}
+
+// record は完了したエントリをチェックポイントファイルに追記します
+func (c *checkpoint) record(rec checkpointRecord) error {
+	if c == nil {
+		return nil
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("チェックポイントのJSON変換に失敗しました: %v", err)
+	}
+	f, err := os.OpenFile(c.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return &FileError{Msg: "チェックポイントへの書き込みに失敗しました", Err: err}
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return &FileError{Msg: "チェックポイントへの書き込みに失敗しました", Err: err}
+	}
+	if err := f.Sync(); err != nil {
+		return &FileError{Msg: "チェックポイントへの書き込みに失敗しました", Err: err}
+	}
+	c.done[rec.Key] = rec.Output
+	return nil
+}
+
+// manifestEntryKey はマニフェストのエントリを識別するキーを返します。
+// 内容 (テキスト・話者・speed・出力名) が変わったエントリは別のものとして扱い、再び合成します
+func manifestEntryKey(e ManifestEntry) string {
+	speed := ""
+	if e.Speed != nil {
+		speed = strconv.FormatFloat(*e.Speed, 'g', -1, 64)
+	}
+	fields := []string{strconv.Itoa(e.Index), e.Text, e.Actor, speed, e.Output}
+	// 変数の無いエントリは、変数に対応する前のチェックポイントと同じキーになるようにします
+	vars := make([]string, 0, len(e.Vars))
+	for name, value := range e.Vars {
+		vars = append(vars, name+"="+value)
+	}
+	sort.Strings(vars)
+	fields = append(fields, vars...)
+	h := sha256.New()
+	for _, field := range fields {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
@@ -0,0 +1,88 @@
+package main
+
+import "context"
+
+// requestContext は API のリクエストに使う context です。Ctrl+C で中断できるよう、run でシグナルを受け取る context を設定します
+func (c *Client) requestContext() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// withContext は ctx でリクエストを送るクライアントのコピーを返します。サーバーでリクエストごとの context を使う場合に使います
+func (c *Client) withContext(ctx context.Context) *Client {
+	copied := *c
+	copied.ctx = ctx
+	return &copied
+}
+
+// 以下は voicevox.Client のメソッドに、クライアントの context を渡して呼び出します
+
+func (c *Client) Speakers() ([]Speaker, error) {
+	return c.Client.Speakers(c.requestContext())
+}
+
+func (c *Client) SpeakerInfo(uuid string) (*SpeakerInfo, error) {
+	return c.Client.SpeakerInfo(c.requestContext(), uuid)
+}
+
+func (c *Client) SupportedDevices() (*SupportedDevices, error) {
+	return c.Client.SupportedDevices(c.requestContext())
+}
+
+func (c *Client) EngineManifest() (*EngineManifest, error) {
+	return c.Client.EngineManifest(c.requestContext())
+}
+
+func (c *Client) CoreVersions() ([]string, error) {
+	return c.Client.CoreVersions(c.requestContext())
+}
+
+func (c *Client) Presets() ([]Preset, error) {
+	return c.Client.Presets(c.requestContext())
+}
+
+func (c *Client) Version() (string, error) {
+	return c.Client.Version(c.requestContext())
+}
+
+func (c *Client) InitializeSpeaker(speakerID int) error {
+	return c.Client.InitializeSpeaker(c.requestContext(), speakerID)
+}
+
+func (c *Client) AudioQuery(text string, speakerID int) (*AudioQuery, error) {
+	return c.Client.AudioQuery(c.requestContext(), text, speakerID)
+}
+
+func (c *Client) AudioQueryFromPreset(text string, speakerID int, preset *Preset) (*AudioQuery, error) {
+	return c.Client.AudioQueryFromPreset(c.requestContext(), text, speakerID, preset)
+}
+
+func (c *Client) KanaAudioQuery(kana string, speakerID int) (*AudioQuery, error) {
+	return c.Client.KanaAudioQuery(c.requestContext(), kana, speakerID)
+}
+
+func (c *Client) Synthesis(query *AudioQuery, speakerID int) ([]byte, error) {
+	return c.Client.Synthesis(c.requestContext(), query, speakerID)
+}
+
+func (c *Client) UserDict() (map[string]UserDictWord, error) {
+	return c.Client.UserDict(c.requestContext())
+}
+
+func (c *Client) AddUserDictWord(word WordParams) (string, error) {
+	return c.Client.AddUserDictWord(c.requestContext(), word)
+}
+
+func (c *Client) UpdateUserDictWord(uuid string, word WordParams) error {
+	return c.Client.UpdateUserDictWord(c.requestContext(), uuid, word)
+}
+
+func (c *Client) DeleteUserDictWord(uuid string) error {
+	return c.Client.DeleteUserDictWord(c.requestContext(), uuid)
+}
+
+func (c *Client) ImportUserDict(words map[string]UserDictWord, override bool) error {
+	return c.Client.ImportUserDict(c.requestContext(), words, override)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"time"
+)
+
+// defaultCompareThresholdDB は --compare で一致とみなす差分のRMSレベル (dBFS) の既定値です
+const defaultCompareThresholdDB = -60.0
+
+// WAVDiff は2つのWAVの比較結果を表します
+type WAVDiff struct {
+	HashA, HashB  string        // 音声データ (dataチャンク) の SHA-256
+	Identical     bool          // サンプルがビット単位で完全に一致するか
+	LengthDiff    time.Duration // 長さの差 (b - a)
+	MaxSampleDiff int           // 重なる区間でのサンプル値の差の最大値
+	RMSDiffDB     float64       // 重なる区間での差分信号のRMSレベル (dBFS)。完全に一致する場合は -Inf です
+}
+
+// within は差分が許容範囲内か (長さが同じで、差分のRMSが thresholdDB 以下か) を返します
+func (d WAVDiff) within(thresholdDB float64) bool {
+	return d.Identical || (d.LengthDiff == 0 && d.RMSDiffDB <= thresholdDB)
+}
+
+// compareWAV は2つの16bit PCMのWAVを比較します。サンプリングレートかチャンネル数が異なる場合はエラーを返します
+func compareWAV(a, b []byte) (WAVDiff, error) {
+	wa, err := parsePCM16(a)
+	if err != nil {
+		return WAVDiff{}, err
+	}
+	wb, err := parsePCM16(b)
+	if err != nil {
+		return WAVDiff{}, err
+	}
+	if wa.Format.SampleRate != wb.Format.SampleRate || wa.Format.Channels != wb.Format.Channels {
+		return WAVDiff{}, fmt.Errorf("音声の形式が異なるため比較できません (%dHz/%dch と %dHz/%dch)",
+			wa.Format.SampleRate, wa.Format.Channels, wb.Format.SampleRate, wb.Format.Channels)
+	}
+
+	hashA, hashB := sha256.Sum256(wa.Data), sha256.Sum256(wb.Data)
+	diff := WAVDiff{
+		HashA:      hex.EncodeToString(hashA[:]),
+		HashB:      hex.EncodeToString(hashB[:]),
+		Identical:  hashA == hashB,
+		LengthDiff: pcmDuration(wb.Format, len(wb.Data)) - pcmDuration(wa.Format, len(wa.Data)),
+		RMSDiffDB:  math.Inf(-1),
+	}
+	if diff.Identical {
+		return diff, nil
+	}
+
+	sa, sb := decodeSamples16(wa.Data), decodeSamples16(wb.Data)
+	n := min(len(sa), len(sb))
+	var sum float64
+	for i := 0; i < n; i++ {
+		d := int(sb[i]) - int(sa[i])
+		if d < 0 {
+			d = -d
+		}
+		diff.MaxSampleDiff = max(diff.MaxSampleDiff, d)
+		v := float64(d) / maxSample16
+		sum += v * v
+	}
+	if n > 0 {
+		diff.RMSDiffDB = toDBFS(math.Sqrt(sum / float64(n)))
+	}
+	return diff, nil
+}
+
+// printWAVDiff は比較結果を表示します
+func printWAVDiff(baseline, target string, diff WAVDiff) {
+	fmt.Printf("--- 比較結果: %s と %s ---\n", baseline, target)
+	fmt.Printf("SHA-256 (基準) : %s\n", diff.HashA)
+	fmt.Printf("SHA-256 (対象) : %s\n", diff.HashB)
+	if diff.Identical {
+		fmt.Println("判定           : 完全に一致")
+		return
+	}
+	fmt.Printf("長さの差       : %+.3f 秒\n", diff.LengthDiff.Seconds())
+	fmt.Printf("最大サンプル差 : %d\n", diff.MaxSampleDiff)
+	fmt.Printf("差分のRMS      : %.1f dBFS\n", diff.RMSDiffDB)
+}
+
+// checkWAVDiff は差分がしきい値を超えていればエラーを返します
+func checkWAVDiff(diff WAVDiff, thresholdDB float64) error {
+	if diff.within(thresholdDB) {
+		if !diff.Identical {
+			fmt.Printf("判定           : 許容範囲内 (しきい値 %.1f dBFS)\n", thresholdDB)
+		}
+		return nil
+	}
+	if diff.LengthDiff != 0 {
+		return fmt.Errorf("音声が基準と異なります: 長さが %+.3f 秒異なります", diff.LengthDiff.Seconds())
+	}
+	return fmt.Errorf("音声が基準と異なります: 差分のRMS %.1f dBFS がしきい値 %.1f dBFS を超えています", diff.RMSDiffDB, thresholdDB)
+}
+
+// compareWithBaseline は合成結果を基準のWAVファイルと比較します。
+// 基準のファイルが無い場合は、合成結果を基準として保存します
+func compareWithBaseline(path string, wav []byte, thresholdDB float64, mkdir bool) error {
+	baseline, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if err := writeOutputFile(path, wav, mkdir); err != nil {
+			return err
+		}
+		logInfo("基準の音声 '%s' が無いため、合成結果を基準として保存しました。", path)
+		return nil
+	}
+	if err != nil {
+		return &FileError{Msg: "基準のWAVファイルの読み込みに失敗しました", Err: err}
+	}
+
+	diff, err := compareWAV(baseline, wav)
+	if err != nil {
+		return fmt.Errorf("'%s' と比較できませんでした: %v", path, err)
+	}
+	printWAVDiff(path, "合成結果", diff)
+	return checkWAVDiff(diff, thresholdDB)
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// completionShells は completion サブコマンドで補完スクリプトを生成できるシェルです
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// actorCompletionFlags は値として話者名を補完するフラグです
+var actorCompletionFlags = []string{"actor", "actors", "actor-info"}
+
+// completionConnFlags は補完時に話者名を取得する際に引き継ぐ、接続先のフラグです。
+// 認証ヘッダー (--header) はスクリプトに残らないよう引き継ぎません
+var completionConnFlags = []string{"host", "port", "base-url", "insecure"}
+
+// flagValueCompletions はフラグの値の固定の補完候補です
+var flagValueCompletions = map[string][]string{
+	"style-type":  styleTypes,
+	"number-mode": numberModes,
+	"encoding":    {"auto", "utf-8", "shift_jis", "euc-jp"},
+	"bit-depth":   {"8", "16", "24", "32", "32f"},
+	"format":      supportedFormats,
+	"log-format":  logFormats,
+}
+
+// completionSpec は補完スクリプトの生成に使う情報です
+type completionSpec struct {
+	Program    string   // 補完を登録するコマンド名
+	Flags      []string // すべてのフラグ名 ("-" を除いたもの)
+	ValueFlags []string // 値を取るフラグ名
+	Usage      map[string]string
+	// ActorsCommand は話者名の候補を動的に取得するコマンドです。生成時の --port / --base-url を引き継ぎます
+	ActorsCommand []string
+	// Actors は生成時にエンジンから取得した話者名です。補完時にエンジンに接続できない場合の候補に使います
+	Actors []string
+}
+
+// newCompletionSpec はコマンドラインのフラグ定義から補完スクリプトの情報を作成します
+func newCompletionSpec(fs *flag.FlagSet, actors []string) completionSpec {
+	spec := completionSpec{
+		Program: filepath.Base(os.Args[0]),
+		Usage:   map[string]string{},
+		Actors:  actors,
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		spec.Flags = append(spec.Flags, f.Name)
+		spec.Usage[f.Name] = f.Usage
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+			spec.ValueFlags = append(spec.ValueFlags, f.Name)
+		}
+	})
+	spec.ActorsCommand = []string{spec.Program}
+	fs.Visit(func(f *flag.Flag) {
+		for _, name := range completionConnFlags {
+			if f.Name != name {
+				continue
+			}
+			spec.ActorsCommand = append(spec.ActorsCommand, flagArg(f.Name))
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+				spec.ActorsCommand = append(spec.ActorsCommand, f.Value.String())
+			}
+		}
+	})
+	spec.ActorsCommand = append(spec.ActorsCommand, "completion", "actors")
+	return spec
+}
+
+// completionActors はエンジンの話者名と定義済みのエイリアスを、補完の候補として名前順に返します
+func (c *Client) completionActors() ([]string, error) {
+	speakers, err := c.Speakers()
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var names []string
+	for _, s := range speakers {
+		if !seen[s.Name] {
+			seen[s.Name] = true
+			names = append(names, s.Name)
+		}
+	}
+	for alias := range c.Aliases {
+		if !seen[alias] {
+			seen[alias] = true
+			names = append(names, alias)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// runCompletion は completion サブコマンドを処理します。
+// "bash" "zsh" "fish" なら補完スクリプトを、"actors" なら補完スクリプトから呼び出される話者名の候補を標準出力に出力します
+func runCompletion(client *Client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("completion には %s のいずれかを指定してください (例: completion bash)", strings.Join(completionShells, ", "))
+	}
+	if args[0] == "actors" {
+		names, err := client.completionActors()
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return nil
+	}
+
+	var write func(io.Writer, completionSpec)
+	switch args[0] {
+	case "bash":
+		write = writeBashCompletion
+	case "zsh":
+		write = writeZshCompletion
+	case "fish":
+		write = writeFishCompletion
+	default:
+		return fmt.Errorf("completion に未対応のシェルです: %s (%s のいずれかを指定してください)", args[0], strings.Join(completionShells, ", "))
+	}
+	// エンジンに接続できない場合でも、話者名以外の補完は使えるよう生成は続けます
+	actors, err := client.completionActors()
+	if err != nil {
+		logWarn("話者名の候補を取得できなかったため、補完時にエンジンから取得できた場合だけ話者名を補完します: %v", err)
+	}
+	write(os.Stdout, newCompletionSpec(flag.CommandLine, actors))
+	return nil
+}
+
+// flagArg はフラグ名をコマンドラインでの表記 (1文字なら -i、それ以外は --actor) にします
+func flagArg(name string) string {
+	if len(name) == 1 {
+		return "-" + name
+	}
+	return "--" + name
+}
+
+// posixQuote は文字列をPOSIXシェルのシングルクォートで囲みます
+func posixQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// posixCommand はコマンドと引数をPOSIXシェルのコマンドラインにします
+func posixCommand(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = posixQuote(a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// writeBashCompletion はbash向けの補完スクリプトを書き出します
+func writeBashCompletion(w io.Writer, spec completionSpec) {
+	fmt.Fprintf(w, "# %s の bash 補完です。eval \"$(%s completion bash)\" で有効になります\n", spec.Program, spec.Program)
+	fmt.Fprintln(w, "_text2voicevox_actors() {")
+	fmt.Fprintln(w, "\tlocal names")
+	fmt.Fprintf(w, "\tnames=$(%s 2>/dev/null)\n", posixCommand(spec.ActorsCommand))
+	if len(spec.Actors) > 0 {
+		fmt.Fprintln(w, "\t# エンジンに接続できない場合は、生成時に取得した話者名を使います")
+		fmt.Fprintf(w, "\t[ -n \"$names\" ] || names=%s\n", posixQuote(strings.Join(spec.Actors, "\n")))
+	}
+	io.WriteString(w, "\tprintf '%s\\n' \"$names\"\n")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "_text2voicevox() {")
+	fmt.Fprintln(w, "\tlocal cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"")
+	fmt.Fprintln(w, "\tlocal IFS=$'\\n'")
+	fmt.Fprintln(w, "\tcase \"$prev\" in")
+	fmt.Fprintf(w, "\t%s)\n", bashPatterns(actorCompletionFlags))
+	fmt.Fprintln(w, "\t\tCOMPREPLY=($(compgen -W \"$(_text2voicevox_actors)\" -- \"$cur\"))")
+	fmt.Fprintln(w, "\t\treturn ;;")
+	for _, name := range sortedKeys(flagValueCompletions) {
+		fmt.Fprintf(w, "\t%s)\n", bashPatterns([]string{name}))
+		fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %s -- \"$cur\"))\n", posixQuote(strings.Join(flagValueCompletions[name], "\n")))
+		fmt.Fprintln(w, "\t\treturn ;;")
+	}
+	fmt.Fprintf(w, "\t%s)\n", bashPatterns(spec.ValueFlags))
+	fmt.Fprintln(w, "\t\tCOMPREPLY=($(compgen -f -- \"$cur\"))")
+	fmt.Fprintln(w, "\t\treturn ;;")
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, "\tif [[ \"$cur\" == -* ]]; then")
+	args := make([]string, len(spec.Flags))
+	for i, name := range spec.Flags {
+		args[i] = flagArg(name)
+	}
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %s -- \"$cur\"))\n", posixQuote(strings.Join(args, "\n")))
+	fmt.Fprintln(w, "\telif [ \"$COMP_CWORD\" -eq 1 ]; then")
+	fmt.Fprintln(w, "\t\tCOMPREPLY=($(compgen -W completion -- \"$cur\") $(compgen -f -- \"$cur\"))")
+	fmt.Fprintln(w, "\telif [ \"$prev\" = completion ]; then")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %s -- \"$cur\"))\n", posixQuote(strings.Join(completionShells, "\n")))
+	fmt.Fprintln(w, "\telse")
+	fmt.Fprintln(w, "\t\tCOMPREPLY=($(compgen -f -- \"$cur\"))")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintf(w, "complete -o filenames -F _text2voicevox %s\n", posixQuote(spec.Program))
+}
+
+// bashPatterns はフラグ名を、case 文で -name と --name の両方に一致するパターンにします
+func bashPatterns(names []string) string {
+	patterns := make([]string, 0, len(names)*2)
+	for _, name := range names {
+		patterns = append(patterns, "-"+name, "--"+name)
+	}
+	return strings.Join(patterns, "|")
+}
+
+// writeZshCompletion はzsh向けの補完スクリプトを書き出します。zsh の bashcompinit でbash向けの補完を使います
+func writeZshCompletion(w io.Writer, spec completionSpec) {
+	fmt.Fprintf(w, "# %s の zsh 補完です。eval \"$(%s completion zsh)\" で有効になります\n", spec.Program, spec.Program)
+	fmt.Fprintln(w, "autoload -U +X compinit && compinit")
+	fmt.Fprintln(w, "autoload -U +X bashcompinit && bashcompinit")
+	writeBashCompletion(w, spec)
+}
+
+// fishQuote は文字列をfishのシングルクォートで囲みます
+func fishQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+	return "'" + s + "'"
+}
+
+// writeFishCompletion はfish向けの補完スクリプトを書き出します
+func writeFishCompletion(w io.Writer, spec completionSpec) {
+	prog := fishQuote(spec.Program)
+	quoted := make([]string, len(spec.ActorsCommand))
+	for i, a := range spec.ActorsCommand {
+		quoted[i] = fishQuote(a)
+	}
+
+	fmt.Fprintf(w, "# %s の fish 補完です。%s completion fish | source で有効になります\n", spec.Program, spec.Program)
+	fmt.Fprintln(w, "function __text2voicevox_actors")
+	fmt.Fprintf(w, "    set -l names (%s 2>/dev/null)\n", strings.Join(quoted, " "))
+	if len(spec.Actors) > 0 {
+		actors := make([]string, len(spec.Actors))
+		for i, name := range spec.Actors {
+			actors[i] = fishQuote(name)
+		}
+		fmt.Fprintln(w, "    # エンジンに接続できない場合は、生成時に取得した話者名を使います")
+		fmt.Fprintf(w, "    test (count $names) -gt 0; or set names %s\n", strings.Join(actors, " "))
+	}
+	io.WriteString(w, "    printf '%s\\n' $names\n")
+	fmt.Fprintln(w, "end")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "complete -c %s -n __fish_use_subcommand -a completion -d %s\n", prog, fishQuote("補完スクリプトを出力"))
+	fmt.Fprintf(w, "complete -c %s -n '__fish_seen_subcommand_from completion' -x -a %s\n", prog, fishQuote(strings.Join(completionShells, " ")))
+
+	values := map[string]bool{}
+	for _, name := range spec.ValueFlags {
+		values[name] = true
+	}
+	actorFlags := map[string]bool{}
+	for _, name := range actorCompletionFlags {
+		actorFlags[name] = true
+	}
+	for _, name := range spec.Flags {
+		opt := "-l " + name
+		if len(name) == 1 {
+			// 1文字のフラグは Go の flag パッケージに合わせて -i の形で補完します
+			opt = "-o " + name
+		}
+		line := fmt.Sprintf("complete -c %s %s", prog, opt)
+		switch {
+		case actorFlags[name]:
+			line += " -x -a '(__text2voicevox_actors)'"
+		case flagValueCompletions[name] != nil:
+			line += " -x -a " + fishQuote(strings.Join(flagValueCompletions[name], " "))
+		case values[name]:
+			line += " -r -F"
+		}
+		fmt.Fprintf(w, "%s -d %s\n", line, fishQuote(firstLine(spec.Usage[name])))
+	}
+}
+
+// firstLine は文字列の最初の行を返します
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// sortedKeys は map のキーを名前順に返します
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
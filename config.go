@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultConfigName は設定ディレクトリに置く既定の設定ファイルの名前です
+const defaultConfigName = "config.yaml"
+
+// ConfigEntry は設定ファイルの1つの値です。リストで指定したオプションは複数の Values を持ちます
+type ConfigEntry struct {
+	Key    string
+	Values []string
+	Line   int
+}
+
+// configConflicts は、コマンドラインで指定されていれば設定ファイルの値を使わないオプションです。
+// 同時に指定できないオプションの組で、コマンドラインの指定を優先するために使います
+var configConflicts = map[string][]string{
+	"actor":             {"actors", "speaker-id"},
+	"actors":            {"actor", "speaker-id"},
+	"style":             {"speaker-id", "actor", "actors"},
+	"style-type":        {"speaker-id"},
+	"speaker-id":        {"actor", "actors", "style", "style-type"},
+	"host":              {"base-url", "auto-port"},
+	"port":              {"base-url", "auto-port"},
+	"base-url":          {"host", "port", "auto-port"},
+	"connect-timeout":   {"timeout"},
+	"synthesis-timeout": {"timeout"},
+	"speed":             {"speed-rel"},
+	"speed-rel":         {"speed"},
+	"pitch":             {"pitch-rel"},
+	"pitch-rel":         {"pitch"},
+	"intonation":        {"intonation-rel"},
+	"intonation-rel":    {"intonation"},
+	"volume":            {"volume-rel"},
+	"volume-rel":        {"volume"},
+	"max-chunk-chars":   {"max-chars"},
+	"max-chars":         {"max-chunk-chars"},
+	"no-clobber":        {"force-overwrite"},
+	"force-overwrite":   {"no-clobber"},
+}
+
+// configNotAllowed は設定ファイルに書けないオプションです。実行ごとに指定するものと、設定ファイル自体の指定です
+var configNotAllowed = map[string]bool{
+	"config": true,
+	"i":      true,
+	"o":      true,
+	"text":   true,
+	"watch":  true,
+}
+
+// resolveConfigPath は読み込む設定ファイルのパスを返します。--config を省略した場合は設定ディレクトリの config.yaml です
+func resolveConfigPath(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	return configFilePath(defaultConfigName)
+}
+
+// loadDefaults は、コマンドラインで指定しなかったオプションの既定値を読み込みます。
+// 優先順位はコマンドライン > --preset のプリセット > 環境変数 > 設定ファイルです。
+// 設定ファイルの preset で指定したプリセットは、環境変数より弱く、設定ファイルのほかの値より強くなります。
+// path (--config) を省略した場合、既定の設定ファイルが無ければ読み込みません
+func loadDefaults(fset *flag.FlagSet, path, preset string, getenv func(string) string) error {
+	if preset != "" {
+		if err := applyPreset(fset, preset); err != nil {
+			return err
+		}
+	}
+	if err := applyEnv(fset, getenv); err != nil {
+		return err
+	}
+	entries, path, err := readConfig(path)
+	if err != nil {
+		return err
+	}
+	if preset == "" {
+		for _, e := range entries {
+			if e.Key == "preset" {
+				preset = e.Values[len(e.Values)-1]
+			}
+		}
+		if preset != "" {
+			if err := applyPreset(fset, preset); err != nil {
+				return err
+			}
+		}
+	}
+	return applyConfig(fset, entries, path)
+}
+
+// readConfig は設定ファイルを読み込んで解析します。path を省略して既定の設定ファイルが無い場合は、空の設定を返します
+func readConfig(path string) ([]ConfigEntry, string, error) {
+	explicitPath := path != ""
+	path, err := resolveConfigPath(path)
+	if err != nil {
+		if explicitPath {
+			return nil, "", err
+		}
+		return nil, "", nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicitPath {
+		return nil, path, nil
+	}
+	if err != nil {
+		return nil, "", &FileError{Msg: fmt.Sprintf("設定ファイル '%s' の読み込みに失敗しました", path), Err: err}
+	}
+	entries, err := parseConfig(data, strings.EqualFold(filepath.Ext(path), ".toml"))
+	if err != nil {
+		return nil, "", fmt.Errorf("設定ファイル '%s' の解析に失敗しました: %v", path, err)
+	}
+	return entries, path, nil
+}
+
+// applyConfig は設定ファイルの値をフラグに設定します。コマンドラインで指定したオプションと、
+// それと同時に指定できないオプションは設定しません
+func applyConfig(fset *flag.FlagSet, entries []ConfigEntry, path string) error {
+	explicit := map[string]bool{}
+	fset.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	for _, e := range entries {
+		if configNotAllowed[e.Key] {
+			return fmt.Errorf("設定ファイル '%s' の %d 行目: --%s は設定ファイルでは指定できません", path, e.Line, e.Key)
+		}
+		if fset.Lookup(e.Key) == nil {
+			return fmt.Errorf("設定ファイル '%s' の %d 行目: 不明なオプション '%s' です", path, e.Line, e.Key)
+		}
+		if explicit[e.Key] || configOverridden(e.Key, explicit) {
+			continue
+		}
+		for _, v := range e.Values {
+			if err := fset.Set(e.Key, v); err != nil {
+				return fmt.Errorf("設定ファイル '%s' の %d 行目: %s の値が不正です: %v", path, e.Line, e.Key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configOverridden は key と同時に指定できないオプションがコマンドラインで指定されているかを返します
+func configOverridden(key string, explicit map[string]bool) bool {
+	for _, other := range configConflicts[key] {
+		if explicit[other] {
+			return true
+		}
+	}
+	return false
+}
+
+// parseConfig は設定ファイルを解析します。YAML は「キー: 値」の行と、値を「- 値」の行で並べるリストだけに、
+// TOML (toml が true) は「キー = 値」の行と ["値", ...] の配列だけに対応します。キーはオプション名 (先頭の - を除いたもの) です
+func parseConfig(data []byte, toml bool) ([]ConfigEntry, error) {
+	var entries []ConfigEntry
+	seen := map[string]int{}
+	var list *ConfigEntry // 値を省略したキー。続く「- 値」の行をリストとして読み込みます
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	for n := 1; scanner.Scan(); n++ {
+		raw := scanner.Text()
+		line := strings.TrimSpace(stripConfigComment(raw))
+		if line == "" || (!toml && line == "---") {
+			continue
+		}
+		if toml && strings.HasPrefix(line, "[") {
+			return nil, fmt.Errorf("%d 行目: テーブル (%s) には対応していません", n, line)
+		}
+		if !toml && (strings.HasPrefix(line, "- ") || line == "-") {
+			if list == nil {
+				return nil, fmt.Errorf("%d 行目: リストの前にキーがありません", n)
+			}
+			value, err := unquoteConfigValue(strings.TrimSpace(strings.TrimPrefix(line, "-")))
+			if err != nil {
+				return nil, fmt.Errorf("%d 行目: %v", n, err)
+			}
+			list.Values = append(list.Values, value)
+			continue
+		}
+		if !toml && raw != strings.TrimLeft(raw, " \t") {
+			return nil, fmt.Errorf("%d 行目: 入れ子の設定には対応していません", n)
+		}
+
+		sep, form := ":", "キー: 値"
+		if toml {
+			sep, form = "=", "キー = 値"
+		}
+		key, value, ok := strings.Cut(line, sep)
+		if !ok {
+			return nil, fmt.Errorf("%d 行目: 「%s」の形式ではありません", n, form)
+		}
+		key = strings.TrimPrefix(strings.TrimSpace(key), "--")
+		key = strings.TrimPrefix(key, "-")
+		if key == "" {
+			return nil, fmt.Errorf("%d 行目: キーがありません", n)
+		}
+		if prev, ok := seen[key]; ok {
+			return nil, fmt.Errorf("%d 行目: '%s' は %d 行目でも指定されています", n, key, prev)
+		}
+		seen[key] = n
+
+		entry := ConfigEntry{Key: key, Line: n}
+		value = strings.TrimSpace(value)
+		switch {
+		case value == "":
+			if toml {
+				return nil, fmt.Errorf("%d 行目: '%s' の値がありません", n, key)
+			}
+		case strings.HasPrefix(value, "{"):
+			return nil, fmt.Errorf("%d 行目: 入れ子の設定には対応していません", n)
+		case strings.HasPrefix(value, "["):
+			values, err := parseConfigArray(value)
+			if err != nil {
+				return nil, fmt.Errorf("%d 行目: %v", n, err)
+			}
+			entry.Values = values
+		default:
+			v, err := unquoteConfigValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("%d 行目: %v", n, err)
+			}
+			entry.Values = []string{v}
+		}
+		entries = append(entries, entry)
+		list = nil
+		if value == "" {
+			list = &entries[len(entries)-1]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if len(e.Values) == 0 {
+			return nil, fmt.Errorf("%d 行目: '%s' の値がありません", e.Line, e.Key)
+		}
+	}
+	return entries, nil
+}
+
+// stripConfigComment は行の # 以降のコメントを取り除きます。引用符の中の # はそのまま残します
+func stripConfigComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++ // エスケープされた文字を飛ばします
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// unquoteConfigValue は引用符で囲まれた値の引用符を外します。"…" はエスケープを解釈し、'…' はそのまま使います
+func unquoteConfigValue(value string) (string, error) {
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	}
+	if strings.HasPrefix(value, `"`) {
+		v, err := strconv.Unquote(value)
+		if err != nil {
+			return "", fmt.Errorf("引用符で囲んだ値 %s を解釈できません", value)
+		}
+		return v, nil
+	}
+	return value, nil
+}
+
+// parseConfigArray は [a, "b", 'c'] の形式の配列を解析します
+func parseConfigArray(value string) ([]string, error) {
+	if !strings.HasSuffix(value, "]") {
+		return nil, fmt.Errorf("配列 %s が ] で閉じられていません", value)
+	}
+	inner := value[1 : len(value)-1]
+	var values []string
+	var quote byte
+	start := 0
+	for i := 0; i <= len(inner); i++ {
+		if i < len(inner) {
+			c := inner[i]
+			switch {
+			case quote == '"' && c == '\\':
+				i++
+				continue
+			case quote != 0:
+				if c == quote {
+					quote = 0
+				}
+				continue
+			case c == '"' || c == '\'':
+				quote = c
+				continue
+			case strings.IndexByte("[]{}", c) >= 0:
+				return nil, fmt.Errorf("配列 %s の入れ子には対応していません", value)
+			case c != ',':
+				continue
+			}
+		} else if quote != 0 {
+			return nil, fmt.Errorf("配列 %s の引用符が閉じられていません", value)
+		}
+		item := strings.TrimSpace(inner[start:min(i, len(inner))])
+		start = i + 1
+		if item == "" {
+			if i >= len(inner) {
+				break
+			}
+			return nil, fmt.Errorf("配列 %s に空の要素があります", value)
+		}
+		v, err := unquoteConfigValue(item)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// configTemplate は config init で書き出す設定ファイルのひな形です
+const configTemplate = `# text2voicevox の設定ファイル
+# キーはコマンドラインのオプション名 (先頭の -- を除いたもの) で、値はコマンドラインの指定が優先します。
+# 使う行の先頭の # を外してください。
+
+# 既定で使うプリセット (presets ディレクトリの <名前>.yaml)
+# preset: narration
+
+# 話者とスタイル
+# actor: ずんだもん
+# style: ノーマル
+
+# 接続先のエンジン
+# port: 50021
+# base-url: http://localhost:50021
+
+# 音声パラメータ
+# speed: 1.0
+# pitch: 0.0
+# intonation: 1.0
+# volume: 1.0
+
+# 出力
+# format: wav
+# force-overwrite: true
+
+# 複数指定できるオプションはリストで指定します
+# replace:
+#   - "(株)=>かぶしきがいしゃ"
+`
+
+// initConfig は設定ファイルのひな形を path に書き出します。path が空の場合は既定の設定ファイルです。
+// force が false の場合、既にあるファイルは上書きしません
+func initConfig(path string, force bool) (string, error) {
+	path, err := resolveConfigPath(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err == nil && !force {
+		return "", &FileError{Msg: fmt.Sprintf("設定ファイル '%s' は既に存在します (上書きするには --force-overwrite を指定してください)", path), Err: fs.ErrExist}
+	}
+	if err := writeOutputFile(path, []byte(configTemplate), true); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// runConfigCommand は config サブコマンドを実行します。
+// config init で設定ファイルのひな形を書き出し、config path で読み込む設定ファイルのパスを表示します
+func runConfigCommand(args []string, path string, force bool) error {
+	if len(args) != 1 {
+		return fmt.Errorf("config の後に init か path を指定してください")
+	}
+	switch args[0] {
+	case "init":
+		written, err := initConfig(path, force)
+		if err != nil {
+			return err
+		}
+		logInfo("設定ファイルのひな形を '%s' に保存しました。", written)
+	case "path":
+		resolved, err := resolveConfigPath(path)
+		if err != nil {
+			return err
+		}
+		fmt.Println(resolved)
+	default:
+		return fmt.Errorf("不明な config のコマンドです: '%s' (init か path を指定してください)", args[0])
+	}
+	return nil
+}
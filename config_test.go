@@ -0,0 +1,316 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		toml bool
+		data string
+		want []ConfigEntry
+	}{
+		{
+			name: "yaml values",
+			data: "actor: ずんだもん\nspeed: 1.2\n--port: 50021\n",
+			want: []ConfigEntry{
+				{Key: "actor", Values: []string{"ずんだもん"}, Line: 1},
+				{Key: "speed", Values: []string{"1.2"}, Line: 2},
+				{Key: "port", Values: []string{"50021"}, Line: 3},
+			},
+		},
+		{
+			name: "yaml quoting",
+			data: "a: \"x: y\"\nb: 'it''s'\nc: \"tab\\there\"\nd: ''\n",
+			want: []ConfigEntry{
+				{Key: "a", Values: []string{"x: y"}, Line: 1},
+				{Key: "b", Values: []string{"it's"}, Line: 2},
+				{Key: "c", Values: []string{"tab\there"}, Line: 3},
+				{Key: "d", Values: []string{""}, Line: 4},
+			},
+		},
+		{
+			name: "yaml comments",
+			data: "---\n# comment\na: \"#1\" # trailing\nb: x#y\nc: 'q # r'\n",
+			want: []ConfigEntry{
+				{Key: "a", Values: []string{"#1"}, Line: 3},
+				{Key: "b", Values: []string{"x#y"}, Line: 4},
+				{Key: "c", Values: []string{"q # r"}, Line: 5},
+			},
+		},
+		{
+			name: "yaml list",
+			data: "replace:\n  - \"(株)=>かぶしきがいしゃ\"\n  - 'a, b=>c'\nactor: x\n",
+			want: []ConfigEntry{
+				{Key: "replace", Values: []string{"(株)=>かぶしきがいしゃ", "a, b=>c"}, Line: 1},
+				{Key: "actor", Values: []string{"x"}, Line: 4},
+			},
+		},
+		{
+			name: "yaml flow array",
+			data: "replace: [a=>b, \"c, d=>e\", 'f]=>g']\n",
+			want: []ConfigEntry{
+				{Key: "replace", Values: []string{"a=>b", "c, d=>e", "f]=>g"}, Line: 1},
+			},
+		},
+		{
+			name: "toml",
+			toml: true,
+			data: "actor = \"ずんだもん\" # comment\nspeed = 1.2\nreplace = [\"a, b=>c\", 'd # e=>f',]\n",
+			want: []ConfigEntry{
+				{Key: "actor", Values: []string{"ずんだもん"}, Line: 1},
+				{Key: "speed", Values: []string{"1.2"}, Line: 2},
+				{Key: "replace", Values: []string{"a, b=>c", "d # e=>f"}, Line: 3},
+			},
+		},
+		{
+			name: "bom",
+			data: "\ufeffactor: x\n",
+			want: []ConfigEntry{{Key: "actor", Values: []string{"x"}, Line: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseConfig([]byte(tt.data), tt.toml)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseConfig =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		toml bool
+		data string
+		want string // エラーメッセージに含まれる文字列
+	}{
+		{"yaml nested map", false, "engine:\n  host: x\n", "2 行目: 入れ子の設定"},
+		{"yaml inline map", false, "engine: {host: x}\n", "1 行目: 入れ子の設定"},
+		{"yaml list without key", false, "- a\n", "リストの前にキーがありません"},
+		{"yaml missing value", false, "actor:\n", "'actor' の値がありません"},
+		{"yaml missing separator", false, "actor\n", "「キー: 値」の形式ではありません"},
+		{"duplicate key", false, "a: 1\nb: 2\na: 3\n", "3 行目: 'a' は 1 行目でも指定されています"},
+		{"bad escape", false, "a: \"\\q\"\n", "引用符で囲んだ値"},
+		{"toml table", true, "[engine]\nhost = \"x\"\n", "1 行目: テーブル ([engine])"},
+		{"toml array of tables", true, "[[engine]]\n", "テーブル"},
+		{"toml inline table", true, "engine = {host = \"x\"}\n", "入れ子の設定"},
+		{"toml nested array", true, "replace = [\"a\", [\"b\"]]\n", "入れ子には対応していません"},
+		{"toml missing separator", true, "actor: x\n", "「キー = 値」の形式ではありません"},
+		{"toml missing value", true, "actor =\n", "'actor' の値がありません"},
+		{"unclosed array", true, "replace = [\"a\", \"b\"\n", "] で閉じられていません"},
+		{"unclosed quote in array", true, "replace = [\"a, b]\n", "引用符が閉じられていません"},
+		{"empty array element", true, "replace = [a, , b]\n", "空の要素"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfig([]byte(tt.data), tt.toml)
+			if err == nil {
+				t.Fatalf("parseConfig succeeded, want an error containing %q", tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %q, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripConfigComment(t *testing.T) {
+	tests := []struct {
+		line, want string
+	}{
+		{"a: b", "a: b"},
+		{"# comment", ""},
+		{"a: b # comment", "a: b "},
+		{"a: b\t# comment", "a: b\t"},
+		{"a: b#c", "a: b#c"},
+		{`a: "b # c" # d`, `a: "b # c" `},
+		{`a: 'b # c' # d`, `a: 'b # c' `},
+		{`a: "b \" # c" # d`, `a: "b \" # c" `},
+		{`a: 'b \' # c`, `a: 'b \' `},
+		{`a: "unterminated # c`, `a: "unterminated # c`},
+	}
+	for _, tt := range tests {
+		if got := stripConfigComment(tt.line); got != tt.want {
+			t.Errorf("stripConfigComment(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseConfigArray(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"[]", nil},
+		{"[a]", []string{"a"}},
+		{"[ a , b ]", []string{"a", "b"}},
+		{"[a, b,]", []string{"a", "b"}},
+		{`["a, b", 'c, d']`, []string{"a, b", "c, d"}},
+		{`["a\"b", 'it''s']`, []string{`a"b`, "it's"}},
+		{`["[x]", '{y}']`, []string{"[x]", "{y}"}},
+	}
+	for _, tt := range tests {
+		got, err := parseConfigArray(tt.value)
+		if err != nil {
+			t.Errorf("parseConfigArray(%q): %v", tt.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseConfigArray(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+
+	for _, value := range []string{"[a", "[a, [b]]", "[a], b]", "[{a = 1}]", `["a]`, "[a,,b]"} {
+		if got, err := parseConfigArray(value); err == nil {
+			t.Errorf("parseConfigArray(%q) = %q, want an error", value, got)
+		}
+	}
+}
+
+func TestLoadDefaultsPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	presets := filepath.Join(dir, "text2voicevox", "presets")
+	if err := os.MkdirAll(presets, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(presets, "cli.yaml"):    "actor: プリセット\nspeed: 1.1\npitch: 0.01\n",
+		filepath.Join(presets, "config.yaml"): "actor: 設定のプリセット\nspeed: 1.2\npitch: 0.02\nintonation: 1.3\n",
+		filepath.Join(dir, "config.yaml"):     "preset: config\nactor: 設定ファイル\nspeed: 1.4\nintonation: 1.5\nvolume: 1.6\n",
+	}
+	for path, data := range files {
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := filepath.Join(dir, "config.yaml")
+
+	tests := []struct {
+		name   string
+		args   []string
+		preset string
+		env    map[string]string
+		want   map[string]string
+	}{
+		{
+			name: "config file only",
+			want: map[string]string{"actor": "設定のプリセット", "speed": "1.2", "pitch": "0.02", "intonation": "1.3", "volume": "1.6"},
+		},
+		{
+			name: "env over config preset",
+			env:  map[string]string{envActor: "環境変数"},
+			want: map[string]string{"actor": "環境変数", "speed": "1.2", "intonation": "1.3", "volume": "1.6"},
+		},
+		{
+			name:   "explicit preset over env",
+			preset: "cli",
+			env:    map[string]string{envActor: "環境変数"},
+			want:   map[string]string{"actor": "プリセット", "speed": "1.1", "pitch": "0.01", "intonation": "1.5", "volume": "1.6"},
+		},
+		{
+			name:   "command line over everything",
+			args:   []string{"-actor", "コマンドライン", "-speed", "2"},
+			preset: "cli",
+			env:    map[string]string{envActor: "環境変数"},
+			want:   map[string]string{"actor": "コマンドライン", "speed": "2", "pitch": "0.01", "intonation": "1.5"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fset := flag.NewFlagSet("test", flag.ContinueOnError)
+			for _, name := range []string{"actor", "speed", "pitch", "intonation", "volume", "preset", "port", "host", "speaker-id", "speed-rel", "pitch-rel", "intonation-rel", "volume-rel"} {
+				fset.String(name, "", "")
+			}
+			if err := fset.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			getenv := func(key string) string { return tt.env[key] }
+			if err := loadDefaults(fset, config, tt.preset, getenv); err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range tt.want {
+				if got := fset.Lookup(name).Value.String(); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyConfigConflicts(t *testing.T) {
+	entries := func(keys ...string) []ConfigEntry {
+		values := map[string]string{"actor": "設定の話者", "style": "あまあま", "speaker-id": "3", "max-chars": "40"}
+		var e []ConfigEntry
+		for i, key := range keys {
+			e = append(e, ConfigEntry{Key: key, Values: []string{values[key]}, Line: i + 1})
+		}
+		return e
+	}
+	tests := []struct {
+		name    string
+		args    []string
+		entries []ConfigEntry
+		want    map[string]string
+	}{
+		{
+			name:    "config speaker-id",
+			entries: entries("speaker-id"),
+			want:    map[string]string{"speaker-id": "3", "actor": ""},
+		},
+		{
+			name:    "command line actor over config speaker-id",
+			args:    []string{"-actor", "コマンドライン"},
+			entries: entries("speaker-id"),
+			want:    map[string]string{"speaker-id": "", "actor": "コマンドライン"},
+		},
+		{
+			name:    "command line style over config speaker-id",
+			args:    []string{"-style", "ノーマル"},
+			entries: entries("speaker-id"),
+			want:    map[string]string{"speaker-id": "", "style": "ノーマル"},
+		},
+		{
+			name:    "command line speaker-id over config actor and style",
+			args:    []string{"-speaker-id", "8"},
+			entries: entries("actor", "style"),
+			want:    map[string]string{"speaker-id": "8", "actor": "", "style": ""},
+		},
+		{
+			name:    "command line max-chunk-chars over config max-chars",
+			args:    []string{"-max-chunk-chars", "30"},
+			entries: entries("max-chars"),
+			want:    map[string]string{"max-chunk-chars": "30", "max-chars": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fset := flag.NewFlagSet("test", flag.ContinueOnError)
+			for _, name := range []string{"actor", "actors", "style", "style-type", "speaker-id", "max-chunk-chars", "max-chars"} {
+				fset.String(name, "", "")
+			}
+			if err := fset.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyConfig(fset, tt.entries, "config.yaml"); err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range tt.want {
+				if got := fset.Lookup(name).Value.String(); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
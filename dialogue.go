@@ -0,0 +1,104 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// DialogueLine は --dialogue の台本の1行 (話者名とセリフ) です
+type DialogueLine struct {
+	Actor string // 話者名。空の場合はコマンドラインで指定した話者です
+	Style string // スタイル名。空の場合は --style (未指定なら話者の既定のスタイル) です
+	Text  string
+}
+
+// dialoguePattern は台本の「話者名: セリフ」の行に一致します。区切りには全角のコロンも使えます
+var dialoguePattern = regexp.MustCompile(`^([^:：。、]{1,20}?)\s*[:：]\s*(.*)$`)
+
+// voiceTagPattern は以降の話者を切り替えるタグ ([voice:四国めたん/あまあま]、スタイルは省略可) と、
+// コマンドラインの話者に戻すタグ ([/voice]) に一致します
+var voiceTagPattern = regexp.MustCompile(`(?i)\[(?:voice:\s*([^\]/]+?)\s*(?:/\s*([^\]]+?)\s*)?|/voice)\]`)
+
+// hasVoiceTags はテキストに話者を切り替えるタグが含まれるかを返します
+func hasVoiceTags(text string) bool {
+	return voiceTagPattern.MatchString(text)
+}
+
+// parseVoiceTags はテキストを [voice:話者名/スタイル名] のタグで区切り、話者を持つ行の並びにします。
+// タグより後のテキストはその話者で、[/voice] より後と最初のタグまでのテキストはコマンドラインの話者で合成します
+func parseVoiceTags(text string) []DialogueLine {
+	var lines []DialogueLine
+	var actor, style string
+	add := func(s string) {
+		if s = strings.TrimSpace(s); s != "" {
+			lines = append(lines, DialogueLine{Actor: actor, Style: style, Text: s})
+		}
+	}
+	pos := 0
+	for _, m := range voiceTagPattern.FindAllStringSubmatchIndex(text, -1) {
+		add(text[pos:m[0]])
+		pos = m[1]
+		actor, style = "", ""
+		if m[2] >= 0 {
+			actor = text[m[2]:m[3]]
+		}
+		if m[4] >= 0 {
+			style = text[m[4]:m[5]]
+		}
+	}
+	add(text[pos:])
+	return lines
+}
+
+// parseDialogue は「話者名: セリフ」を1行ずつ並べた台本を読み込みます。
+// 話者名の無い行は直前の話者のセリフとして扱い、「話者名:」だけの行は以降の行の話者を切り替えます。
+// 最初に話者名が現れるまでの行は、コマンドラインで指定した話者で合成します
+func parseDialogue(text string) []DialogueLine {
+	var lines []DialogueLine
+	actor := ""
+	for _, line := range splitLines(text) {
+		if m := dialoguePattern.FindStringSubmatch(line); m != nil {
+			actor = strings.TrimSpace(m[1])
+			line = m[2]
+		}
+		if line != "" {
+			lines = append(lines, DialogueLine{Actor: actor, Text: line})
+		}
+	}
+	return lines
+}
+
+// dialogueSegments は台本の行を、話者名を持つ区間にします。markup が true の場合は行ごとにタグを解釈します
+func dialogueSegments(lines []DialogueLine, markup, strict bool) ([]Segment, error) {
+	var segments []Segment
+	for _, line := range lines {
+		segs := []Segment{{Text: line.Text}}
+		if markup {
+			var err error
+			if segs, err = parseMarkup(line.Text, strict); err != nil {
+				return nil, err
+			}
+		}
+		for _, seg := range segs {
+			seg.Actor = line.Actor
+			seg.Style = line.Style
+			segments = append(segments, seg)
+		}
+	}
+	return segments, nil
+}
+
+// resolveSegmentSpeakers は台本やタグで指定された区間の話者を解決します。同じ話者とスタイルは一度だけ問い合わせます
+func resolveSegmentSpeakers(speakers *speakerCache, segments []Segment) error {
+	for i, seg := range segments {
+		if seg.Actor == "" || seg.Break > 0 {
+			continue
+		}
+		sel, err := speakers.findStyle(seg.Actor, seg.Style)
+		if err != nil {
+			return err
+		}
+		segments[i].Speaker = sel
+	}
+	return nil
+}
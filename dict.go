@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Pikka2048/text2voicevox/voicevox"
+)
+
+// dictCommands は dict サブコマンドで指定できる操作です
+var dictCommands = []string{"list", "add", "update", "delete", "import", "export"}
+
+// dictCSVColumns はユーザー辞書をCSVでインポート・エクスポートするときの列です
+var dictCSVColumns = []string{"surface", "pronunciation", "accent_type", "word_type", "priority"}
+
+// dictCommand は dict サブコマンドの操作と、その引数・オプションです
+type dictCommand struct {
+	name          string
+	args          []string
+	surface       string
+	pronunciation string
+	accent        int
+	wordType      string
+	priority      int
+	override      bool
+	explicit      map[string]bool // update で変更する項目
+}
+
+// parseDictCommand は dict の後の引数を解析します。
+// 接続先などのオプションを dict の後にも書けるよう、コマンドラインのフラグも受け付けてそのまま反映します
+func parseDictCommand(args []string) (*dictCommand, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("dict の後に %s のいずれかを指定してください", strings.Join(dictCommands, ", "))
+	}
+	d := &dictCommand{name: args[0], explicit: map[string]bool{}}
+	if !slices.Contains(dictCommands, d.name) {
+		return nil, fmt.Errorf("不明な dict のコマンドです: '%s' (%s のいずれかを指定してください)", d.name, strings.Join(dictCommands, ", "))
+	}
+
+	fs := flag.NewFlagSet("dict "+d.name, flag.ExitOnError)
+	fs.StringVar(&d.surface, "surface", "", "単語の表記 (例: 常用漢字)")
+	fs.StringVar(&d.pronunciation, "pronunciation", "", "単語の読み (カタカナ。例: ジョウヨウカンジ)")
+	fs.IntVar(&d.accent, "accent", -1, "アクセント核の位置 (1始まりのモーラ番号。0 は平板型)")
+	fs.StringVar(&d.wordType, "word-type", "", "品詞 ("+strings.Join(voicevox.WordTypes, ", ")+")。省略すると固有名詞")
+	fs.IntVar(&d.priority, "priority", 5, "優先度 (0〜10)。大きいほど優先される")
+	fs.BoolVar(&d.override, "override", false, "import で、既に登録されている単語を上書きする")
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		if fs.Lookup(f.Name) == nil {
+			fs.Var(globalFlag{name: f.Name, Value: f.Value}, f.Name, f.Usage)
+		}
+	})
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "使用法: %s dict list [--json]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "        %s dict add --surface <表記> --pronunciation <読み> --accent <位置> [--word-type <品詞>] [--priority <優先度>]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "        %s dict update <UUIDか表記> [--surface ...] [--pronunciation ...] [--accent ...] [--word-type ...] [--priority ...]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "        %s dict delete <UUIDか表記>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "        %s dict import <ファイル (.csv / .json)> [--override]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "        %s dict export <ファイル (.csv / .json) か ->\n\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "dict のオプション (接続先などそのほかのオプションも指定できます):")
+		for _, name := range []string{"surface", "pronunciation", "accent", "word-type", "priority", "override"} {
+			f := fs.Lookup(name)
+			fmt.Fprintf(os.Stderr, "  --%s\n    \t%s\n", f.Name, f.Usage)
+		}
+	}
+	fs.Parse(args[1:])
+	d.args = parseInterspersed(fs)
+	fs.Visit(func(f *flag.Flag) { d.explicit[f.Name] = true })
+
+	switch {
+	case d.wordType != "" && !slices.Contains(voicevox.WordTypes, d.wordType):
+		return nil, fmt.Errorf("--word-type は %s のいずれかを指定してください", strings.Join(voicevox.WordTypes, ", "))
+	case d.priority < 0 || d.priority > 10:
+		return nil, fmt.Errorf("--priority は0〜10で指定してください")
+	case d.explicit["accent"] && d.accent < 0:
+		return nil, fmt.Errorf("--accent は0以上のモーラ番号で指定してください")
+	}
+	return d, nil
+}
+
+// globalFlag は dict の後に書いたコマンドラインのフラグを、元のフラグに反映します。
+// flag.CommandLine.Set を使うため、元のフラグも明示的に指定したものとして扱われます
+type globalFlag struct {
+	name string
+	flag.Value
+}
+
+func (g globalFlag) Set(s string) error {
+	return flag.CommandLine.Set(g.name, s)
+}
+
+func (g globalFlag) IsBoolFlag() bool {
+	b, ok := g.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// run は dict サブコマンドの操作を実行します。jsonOutput は --json、force は --force-overwrite の指定です
+func (d *dictCommand) run(client *Client, jsonOutput, force bool) error {
+	switch d.name {
+	case "list":
+		return d.list(client, jsonOutput)
+	case "add":
+		return d.add(client)
+	case "update":
+		return d.update(client)
+	case "delete":
+		return d.delete(client)
+	case "import":
+		return d.importFile(client)
+	default:
+		return d.export(client, force)
+	}
+}
+
+// expectArgs は操作に指定した位置引数の数を確認します
+func (d *dictCommand) expectArgs(n int, usage string) error {
+	if len(d.args) != n {
+		return fmt.Errorf("dict %s には %s を指定してください", d.name, usage)
+	}
+	return nil
+}
+
+// list はユーザー辞書の単語を表記の順に表示します。jsonOutput の場合はエンジンの形式のJSONで出力します
+func (d *dictCommand) list(client *Client, jsonOutput bool) error {
+	if err := d.expectArgs(0, "引数なし"); err != nil {
+		return err
+	}
+	words, err := client.UserDict()
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		out, err := json.MarshalIndent(words, "", "  ")
+		if err != nil {
+			return fmt.Errorf("ユーザー辞書のJSON変換に失敗しました: %v", err)
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	fmt.Printf("--- ユーザー辞書 (%d 語) ---\n", len(words))
+	if len(words) == 0 {
+		fmt.Println("(登録されている単語はありません)")
+	}
+	for _, uuid := range sortedDictUUIDs(words) {
+		w := words[uuid]
+		wordType := w.WordType()
+		if wordType == "" {
+			wordType = "不明"
+		}
+		fmt.Printf("%s (読み: %s, アクセント: %d, 品詞: %s, 優先度: %d)\n", w.Surface, w.Pronunciation, w.AccentType, wordType, w.Priority)
+		fmt.Printf("  - UUID: %s\n", uuid)
+	}
+	fmt.Println("--------------------------")
+	return nil
+}
+
+// sortedDictUUIDs は単語のUUIDを、表記の順 (同じ表記ならUUIDの順) に並べて返します
+func sortedDictUUIDs(words map[string]UserDictWord) []string {
+	uuids := make([]string, 0, len(words))
+	for uuid := range words {
+		uuids = append(uuids, uuid)
+	}
+	sort.Slice(uuids, func(i, j int) bool {
+		a, b := words[uuids[i]], words[uuids[j]]
+		if a.Surface != b.Surface {
+			return a.Surface < b.Surface
+		}
+		return uuids[i] < uuids[j]
+	})
+	return uuids
+}
+
+// add は --surface などで指定した単語を登録します
+func (d *dictCommand) add(client *Client) error {
+	if err := d.expectArgs(0, "引数なし (単語は --surface などで指定します)"); err != nil {
+		return err
+	}
+	if d.surface == "" || d.pronunciation == "" || !d.explicit["accent"] {
+		return fmt.Errorf("dict add には --surface / --pronunciation / --accent を指定してください")
+	}
+	word := WordParams{Surface: d.surface, Pronunciation: d.pronunciation, AccentType: d.accent, WordType: d.wordType, Priority: d.priority}
+	uuid, err := client.AddUserDictWord(word)
+	if err != nil {
+		return err
+	}
+	logInfo("単語 '%s' を登録しました。(UUID: %s)", word.Surface, uuid)
+	return nil
+}
+
+// update はUUIDか表記で指定した単語の、オプションで指定した項目だけを変更します
+func (d *dictCommand) update(client *Client) error {
+	if err := d.expectArgs(1, "変更する単語のUUIDか表記"); err != nil {
+		return err
+	}
+	words, err := client.UserDict()
+	if err != nil {
+		return err
+	}
+	uuid, current, err := findDictWord(words, d.args[0])
+	if err != nil {
+		return err
+	}
+	word := WordParams{
+		Surface:       current.Surface,
+		Pronunciation: current.Pronunciation,
+		AccentType:    current.AccentType,
+		WordType:      current.WordType(),
+		Priority:      current.Priority,
+	}
+	if d.explicit["surface"] {
+		word.Surface = d.surface
+	}
+	if d.explicit["pronunciation"] {
+		word.Pronunciation = d.pronunciation
+	}
+	if d.explicit["accent"] {
+		word.AccentType = d.accent
+	}
+	if d.explicit["word-type"] {
+		word.WordType = d.wordType
+	}
+	if d.explicit["priority"] {
+		word.Priority = d.priority
+	}
+	if err := client.UpdateUserDictWord(uuid, word); err != nil {
+		return err
+	}
+	logInfo("単語 '%s' を更新しました。(UUID: %s)", word.Surface, uuid)
+	return nil
+}
+
+// delete はUUIDか表記で指定した単語を削除します
+func (d *dictCommand) delete(client *Client) error {
+	if len(d.args) == 0 {
+		return fmt.Errorf("dict delete には削除する単語のUUIDか表記を指定してください")
+	}
+	words, err := client.UserDict()
+	if err != nil {
+		return err
+	}
+	// 途中で見つからない単語があった場合に一部だけ削除しないよう、先にすべて探します
+	uuids := make([]string, len(d.args))
+	for i, key := range d.args {
+		if uuids[i], _, err = findDictWord(words, key); err != nil {
+			return err
+		}
+	}
+	for _, uuid := range uuids {
+		if err := client.DeleteUserDictWord(uuid); err != nil {
+			return err
+		}
+		logInfo("単語 '%s' を削除しました。(UUID: %s)", words[uuid].Surface, uuid)
+	}
+	return nil
+}
+
+// findDictWord はUUIDか表記で単語を探します。同じ表記の単語が複数ある場合はUUIDでの指定を求めます
+func findDictWord(words map[string]UserDictWord, key string) (string, UserDictWord, error) {
+	if w, ok := words[key]; ok {
+		return key, w, nil
+	}
+	var found []string
+	for _, uuid := range sortedDictUUIDs(words) {
+		if words[uuid].Surface == key {
+			found = append(found, uuid)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", UserDictWord{}, fmt.Errorf("ユーザー辞書に '%s' は登録されていません (dict list で確認できます)", key)
+	case 1:
+		return found[0], words[found[0]], nil
+	}
+	return "", UserDictWord{}, fmt.Errorf("'%s' は %d 件登録されています。UUIDで指定してください: %s", key, len(found), strings.Join(found, ", "))
+}
+
+// isDictCSV はファイル名の拡張子からCSVとして扱うかどうかを返します
+func isDictCSV(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".csv")
+}
+
+// importFile はCSVかJSONのファイルから単語をまとめて登録します。
+// JSONはエンジン (dict export / GUI) の形式で、同じUUIDの単語は --override の場合だけ上書きします。
+// CSVは行ごとに登録し、同じ表記の単語が既にある場合は --override なら更新、そうでなければ飛ばします
+func (d *dictCommand) importFile(client *Client) error {
+	if err := d.expectArgs(1, "読み込むファイル (.csv / .json)"); err != nil {
+		return err
+	}
+	path := d.args[0]
+	data, err := readInputFile(path)
+	if err != nil {
+		return err
+	}
+
+	if !isDictCSV(path) {
+		var words map[string]UserDictWord
+		if err := json.Unmarshal(data, &words); err != nil {
+			return &FileError{Msg: fmt.Sprintf("'%s' をユーザー辞書のJSONとして読み込めませんでした", path), Err: err}
+		}
+		if err := client.ImportUserDict(words, d.override); err != nil {
+			return err
+		}
+		logInfo("'%s' から %d 語をインポートしました。", path, len(words))
+		return nil
+	}
+
+	rows, err := parseDictCSV(data)
+	if err != nil {
+		return &FileError{Msg: fmt.Sprintf("'%s' をユーザー辞書のCSVとして読み込めませんでした", path), Err: err}
+	}
+	words, err := client.UserDict()
+	if err != nil {
+		return err
+	}
+	added, updated, skipped := 0, 0, 0
+	for _, word := range rows {
+		uuid, _, err := findDictWord(words, word.Surface)
+		switch {
+		case err != nil:
+			if _, err := client.AddUserDictWord(word); err != nil {
+				return err
+			}
+			added++
+		case d.override:
+			if err := client.UpdateUserDictWord(uuid, word); err != nil {
+				return err
+			}
+			updated++
+		default:
+			logWarn("'%s' は既に登録されているため飛ばしました (上書きする場合は --override を指定してください)", word.Surface)
+			skipped++
+		}
+	}
+	logInfo("'%s' から %d 語を登録、%d 語を更新しました。(飛ばした単語: %d 語)", path, added, updated, skipped)
+	return nil
+}
+
+// parseDictCSV はユーザー辞書のCSVを読み込みます。1行目は dictCSVColumns の列名で、
+// surface / pronunciation / accent_type は必須、word_type と priority は省略できます
+func parseDictCSV(data []byte) ([]WordParams, error) {
+	records, err := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("CSVが空です")
+	}
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range dictCSVColumns[:3] {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("1行目に %s の列がありません (列: %s)", name, strings.Join(dictCSVColumns, ","))
+		}
+	}
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var words []WordParams
+	for n, record := range records[1:] {
+		line := n + 2
+		word := WordParams{Surface: field(record, "surface"), Pronunciation: field(record, "pronunciation"), WordType: field(record, "word_type"), Priority: 5}
+		if word.Surface == "" || word.Pronunciation == "" {
+			return nil, fmt.Errorf("%d行目: surface と pronunciation が必要です", line)
+		}
+		if word.AccentType, err = strconv.Atoi(field(record, "accent_type")); err != nil || word.AccentType < 0 {
+			return nil, fmt.Errorf("%d行目: accent_type は0以上の整数で指定してください", line)
+		}
+		if word.WordType != "" && !slices.Contains(voicevox.WordTypes, word.WordType) {
+			return nil, fmt.Errorf("%d行目: word_type は %s のいずれかを指定してください", line, strings.Join(voicevox.WordTypes, ", "))
+		}
+		if p := field(record, "priority"); p != "" {
+			if word.Priority, err = strconv.Atoi(p); err != nil || word.Priority < 0 || word.Priority > 10 {
+				return nil, fmt.Errorf("%d行目: priority は0〜10の整数で指定してください", line)
+			}
+		}
+		words = append(words, word)
+	}
+	return words, nil
+}
+
+// registerTempDict は --dict のCSVの単語をユーザー辞書に一時的に登録し、登録した単語を削除する関数を返します。
+// Ctrl+C で中断した後にも削除できるよう、削除は合成とは別の context で行います
+func registerTempDict(client *Client, path string) (func(), error) {
+	data, err := readInputFile(path)
+	if err != nil {
+		return nil, err
+	}
+	words, err := parseDictCSV(data)
+	if err != nil {
+		return nil, &FileError{Msg: fmt.Sprintf("'%s' をユーザー辞書のCSVとして読み込めませんでした", path), Err: err}
+	}
+
+	var uuids []string
+	remove := func() {
+		c := client.withContext(context.Background())
+		for _, uuid := range uuids {
+			if err := c.DeleteUserDictWord(uuid); err != nil {
+				logWarn("--dict で一時的に登録した単語を削除できませんでした (UUID: %s。dict delete で削除できます): %v", uuid, err)
+			}
+		}
+		logDebug("--dict で登録した %d 語をユーザー辞書から削除しました", len(uuids))
+	}
+	for _, word := range words {
+		uuid, err := client.AddUserDictWord(word)
+		if err != nil {
+			remove()
+			return nil, err
+		}
+		uuids = append(uuids, uuid)
+	}
+	logInfo("'%s' の %d 語をユーザー辞書に一時的に登録しました。", path, len(uuids))
+	return remove, nil
+}
+
+// export はユーザー辞書をCSVかJSONのファイルに書き出します。- の場合はJSONで標準出力に書き出します
+func (d *dictCommand) export(client *Client, force bool) error {
+	if err := d.expectArgs(1, "書き出すファイル (.csv / .json) か -"); err != nil {
+		return err
+	}
+	path := d.args[0]
+	if path != stdioPath && !force {
+		if _, err := os.Stat(path); err == nil {
+			return &FileError{Msg: fmt.Sprintf("'%s' は既に存在します", path), Err: fmt.Errorf("上書きする場合は --force-overwrite を指定してください")}
+		}
+	}
+	words, err := client.UserDict()
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if isDictCSV(path) {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write(dictCSVColumns)
+		for _, uuid := range sortedDictUUIDs(words) {
+			word := words[uuid]
+			w.Write([]string{word.Surface, word.Pronunciation, strconv.Itoa(word.AccentType), word.WordType(), strconv.Itoa(word.Priority)})
+		}
+		w.Flush()
+		data = buf.Bytes()
+	} else {
+		if data, err = json.MarshalIndent(words, "", "  "); err != nil {
+			return fmt.Errorf("ユーザー辞書のJSON変換に失敗しました: %v", err)
+		}
+		data = append(data, '\n')
+	}
+
+	if path == stdioPath {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := writeOutputFile(path, data, true); err != nil {
+		return err
+	}
+	logInfo("%d 語を '%s' に書き出しました。", len(words), path)
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultPortCandidates は --auto-port で探索するポートの既定値です
+// (VOICEVOX, VOICEVOX Nemo, SHAREVOX, AivisSpeech)
+var defaultPortCandidates = []int{50021, 50121, 50025, 10101}
+
+// portProbeTimeout は --auto-port で1つのポートの応答を待つ時間です
+const portProbeTimeout = 500 * time.Millisecond
+
+// parsePortCandidates は --port-range の指定を解析します。
+// "50021,50121" のようなカンマ区切りと "50021-50030" のような範囲を組み合わせて指定できます
+func parsePortCandidates(spec string) ([]int, error) {
+	var ports []int
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		start, err := parsePort(from)
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if isRange {
+			if end, err = parsePort(to); err != nil {
+				return nil, err
+			}
+			if end < start {
+				return nil, fmt.Errorf("--port-range の範囲 '%s' が逆順です", part)
+			}
+		}
+		for p := start; p <= end; p++ {
+			ports = append(ports, p)
+		}
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("--port-range にポート番号を指定してください")
+	}
+	return ports, nil
+}
+
+// parsePort はポート番号を解析します
+func parsePort(s string) (int, error) {
+	p, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || p < 1 || p > 65535 {
+		return 0, fmt.Errorf("--port-range のポート番号 '%s' が不正です (1〜65535)", s)
+	}
+	return p, nil
+}
+
+// discoverPort は候補のポートを順に /version で確認し、最初に応答したエンジンのポートとバージョンを返します。
+// どのポートも応答しない場合は、試したポートの一覧を含む ConnectionError を返します
+func (c *Client) discoverPort(candidates []int, insecure bool) (int, string, error) {
+	for _, port := range candidates {
+		probe := *c.Client
+		probe.BaseURL = fmt.Sprintf("http://localhost:%d", port)
+		probe.Doer = newHTTPClient(portProbeTimeout, insecure)
+		probe.Retries = 0 // 応答しないポートは再試行せず、次の候補を確認します
+		if version, err := probe.Version(c.requestContext()); err == nil {
+			return port, version, nil
+		}
+	}
+
+	tried := make([]string, len(candidates))
+	for i, port := range candidates {
+		tried[i] = strconv.Itoa(port)
+	}
+	return 0, "", &ConnectionError{Err: fmt.Errorf("応答するエンジンが見つかりませんでした (試したポート: %s)", strings.Join(tried, ", "))}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// printDryRun は音声合成を行わずに、使用する話者・パラメータ・分割結果を表示します。
+// withQuery が true の場合は各チャンクの audio_query を作成し、エンジンが解釈した読みも表示します
+func printDryRun(client *Client, selection *SpeakerSelection, segments []Segment, params SynthesisParams, kanaMode, withQuery bool) error {
+	overridden := map[string]bool{}
+	for _, name := range params.overrides() {
+		overridden[name] = true
+	}
+	show := func(name, unit string) string {
+		base := fmt.Sprintf("%g%s", params.value(name), unit)
+		if !overridden[name] {
+			base = "APIのデフォルト値"
+			if params.Preset != nil {
+				base = fmt.Sprintf("プリセット '%s' の値", params.Preset.Name)
+			}
+		}
+		if rel, ok := params.Relative[name]; ok {
+			return fmt.Sprintf("%s %s", base, rel)
+		}
+		return base
+	}
+
+	fmt.Println("--- ドライラン (音声合成は実行しません) ---")
+	if selection.Speaker.Name == "" {
+		fmt.Printf("話者      : スタイルID %d (--speaker-id)\n", selection.Style.ID)
+	} else {
+		fmt.Printf("話者      : %s (スタイル: %s, ID: %d)\n", selection.Speaker.Name, selection.Style.Name, selection.Style.ID)
+	}
+	fmt.Printf("話速      : %s\n", show("speed", ""))
+	fmt.Printf("音高      : %s\n", show("pitch", ""))
+	fmt.Printf("抑揚      : %s\n", show("intonation", ""))
+	fmt.Printf("音量      : %s\n", show("volume", ""))
+	fmt.Printf("前の無音  : %s\n", show("pre-phoneme", " 秒"))
+	fmt.Printf("後の無音  : %s\n", show("post-phoneme", " 秒"))
+
+	total, requests := 0, 0
+	for _, seg := range segments {
+		if seg.Break == 0 {
+			total += utf8.RuneCountInString(seg.Text)
+			requests++
+		}
+	}
+	fmt.Printf("チャンク数: %d (合計 %d 文字)\n", len(segments), total)
+
+	for i, seg := range segments {
+		if seg.Break > 0 {
+			fmt.Printf("[%d] (無音 %s)\n", i+1, seg.Break)
+			continue
+		}
+		fmt.Printf("[%d] (%d文字) %s\n", i+1, utf8.RuneCountInString(seg.Text), preview(seg.Text, 40))
+		if seg.Speaker != nil {
+			fmt.Printf("    話者: %s (スタイル: %s, ID: %d)\n", seg.Speaker.Speaker.Name, seg.Speaker.Style.Name, seg.Speaker.Style.ID)
+		}
+		if len(seg.Overrides) > 0 || len(seg.Relative) > 0 {
+			fmt.Printf("    パラメータ: %s\n", formatOverrides(seg.Overrides, seg.Relative))
+		}
+		if !withQuery {
+			continue
+		}
+		query, err := buildSegmentQuery(client, seg, selection.Style.ID, kanaMode, params)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("    読み: %s\n", query.Kana)
+	}
+	fmt.Println("------------------------------------------")
+	queryPath := "/audio_query"
+	if kanaMode {
+		queryPath = "/accent_phrases"
+	}
+	fmt.Printf("合成を実行すると %s と /synthesis が %d 回ずつ呼び出されます。\n", queryPath, requests)
+
+	return nil
+}
+
+// formatOverrides は区間ごとのパラメータ指定と相対値を名前順に整形します
+func formatOverrides(overrides map[string]float64, relative map[string]RelativeValue) string {
+	var parts []string
+	for name, v := range overrides {
+		parts = append(parts, fmt.Sprintf("%s=%g", name, v))
+	}
+	for name, rel := range relative {
+		parts = append(parts, fmt.Sprintf("%s=%s", name, rel))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, " ")
+}
+
+// QueryChunk は --dry-run-json で複数のチャンクを書き出す場合の1チャンク分です。
+// 無音区間は Break（秒）だけを持ちます
+type QueryChunk struct {
+	Index     int         `json:"index"`
+	Text      string      `json:"text,omitempty"`
+	SpeakerID *int        `json:"speaker_id,omitempty"`
+	Break     float64     `json:"break,omitempty"`
+	Query     *AudioQuery `json:"query,omitempty"`
+}
+
+// printDryRunJSON は音声合成を行わずに、パラメータを適用した audio_query をJSONで out に書き出します。
+// チャンクが1つだけの場合は audio_query をそのまま、複数の場合は QueryChunk の配列を書き出します
+func printDryRunJSON(out io.Writer, client *Client, selection *SpeakerSelection, segments []Segment, params SynthesisParams, kanaMode bool) error {
+	chunks := make([]QueryChunk, len(segments))
+	for i, seg := range segments {
+		chunks[i].Index = i + 1
+		if seg.Break > 0 {
+			chunks[i].Break = seg.Break.Seconds()
+			continue
+		}
+		speakerID := seg.styleID(selection.Style.ID)
+		query, err := buildSegmentQuery(client, seg, selection.Style.ID, kanaMode, params)
+		if err != nil {
+			return err
+		}
+		chunks[i].Text = seg.Text
+		chunks[i].SpeakerID = &speakerID
+		chunks[i].Query = query
+	}
+
+	var v interface{} = chunks
+	if len(chunks) == 1 && chunks[0].Query != nil {
+		v = chunks[0].Query
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%s\n", data)
+	return err
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// supportedFormats は出力できる音声フォーマットの一覧です
+var supportedFormats = []string{"wav", "mp3", "ogg", "flac"}
+
+// formatExtensions は出力ファイルの拡張子と出力フォーマットの対応です
+var formatExtensions = map[string]string{
+	".wav":  "wav",
+	".mp3":  "mp3",
+	".ogg":  "ogg",
+	".oga":  "ogg",
+	".flac": "flac",
+}
+
+// ffmpegCodecArgs はフォーマットごとの ffmpeg のエンコード引数です
+var ffmpegCodecArgs = map[string][]string{
+	"mp3":  {"-f", "mp3", "-codec:a", "libmp3lame", "-q:a", "2"},
+	"ogg":  {"-f", "ogg", "-codec:a", "libvorbis", "-q:a", "5"},
+	"flac": {"-f", "flac", "-codec:a", "flac"},
+}
+
+// formatFromPath は出力パスの拡張子から出力フォーマットを判定します。拡張子が無い場合は wav とみなします
+func formatFromPath(path string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == "" {
+		return "wav", nil
+	}
+	format, ok := formatExtensions[ext]
+	if !ok {
+		return "", fmt.Errorf("対応していない出力フォーマットです: '%s' (対応フォーマット: %s)", ext, strings.Join(supportedFormats, ", "))
+	}
+	return format, nil
+}
+
+// resolveFormat は出力フォーマットを決めます。format (--format) を指定した場合は拡張子より優先し、
+// 省略した場合は path の拡張子から判定します
+func resolveFormat(path, format string) (string, error) {
+	if format == "" {
+		return formatFromPath(path)
+	}
+	format = strings.ToLower(format)
+	if !slices.Contains(supportedFormats, format) {
+		return "", fmt.Errorf("対応していない出力フォーマットです: '%s' (対応フォーマット: %s)", format, strings.Join(supportedFormats, ", "))
+	}
+	if ext := filepath.Ext(path); ext != "" && path != stdioPath {
+		if extFormat, err := formatFromPath(path); err != nil || extFormat != format {
+			logWarn("'%s' の拡張子と --format %s が一致しません。%s で保存します", path, format, format)
+		}
+	}
+	return format, nil
+}
+
+// pathWithFormat は拡張子の無い出力パスに、format の拡張子を付けます。標準出力 ("-") はそのまま返します
+func pathWithFormat(path, format string) string {
+	if format == "" || path == "" || path == stdioPath || filepath.Ext(path) != "" {
+		return path
+	}
+	return path + "." + strings.ToLower(format)
+}
+
+// checkEncoder は format で保存できるかを、合成の前に確認します。bitDepth は --bit-depth のビット数 (0 は変換しない) です。
+// ogg は ffmpeg が無くても組み込みのエンコーダで保存できますが、組み込みのエンコーダは16bit PCMだけに対応します
+func checkEncoder(format string, bitDepth int) error {
+	if format == "wav" {
+		return nil
+	}
+	_, err := lookupFFmpeg()
+	if err != nil && format == "ogg" {
+		if bitDepth == 0 || bitDepth == 16 {
+			return nil
+		}
+		return fmt.Errorf("ffmpeg が無い場合の ogg は16bitの音声だけを保存できます。--bit-depth で16bit以外に変換するには ffmpeg をインストールしてください")
+	}
+	return err
+}
+
+var (
+	ffmpegOnce sync.Once
+	ffmpegPath string
+	ffmpegErr  error
+)
+
+// lookupFFmpeg は ffmpeg の実行ファイルを探します。探索はプロセス中で一度だけ行います
+func lookupFFmpeg() (string, error) {
+	ffmpegOnce.Do(func() {
+		ffmpegPath, ffmpegErr = exec.LookPath("ffmpeg")
+		if ffmpegErr != nil {
+			ffmpegErr = fmt.Errorf("mp3 と flac で保存するには ffmpeg が必要です。ffmpeg をインストールし、PATH を通すか、--format ogg を指定してください")
+		}
+	})
+	return ffmpegPath, ffmpegErr
+}
+
+// encodeOutput はWAVデータを指定したフォーマットに変換します。wav 以外は ffmpeg を使ってエンコードし、
+// ffmpeg が無い場合の ogg は組み込みのエンコーダ (encodeVorbis) を使います
+func encodeOutput(wav []byte, format string) ([]byte, error) {
+	if format == "wav" {
+		return wav, nil
+	}
+
+	codecArgs, ok := ffmpegCodecArgs[format]
+	if !ok {
+		return nil, fmt.Errorf("対応していない出力フォーマットです: '%s' (対応フォーマット: %s)", format, strings.Join(supportedFormats, ", "))
+	}
+	ffmpeg, err := lookupFFmpeg()
+	if err != nil {
+		if format == "ogg" {
+			return encodeVorbis(wav)
+		}
+		return nil, err
+	}
+
+	args := []string{"-hide_banner", "-loglevel", "error", "-i", "pipe:0"}
+	args = append(args, codecArgs...)
+	args = append(args, "pipe:1")
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(ffmpeg, args...)
+	cmd.Stdin = bytes.NewReader(wav)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s へのエンコードに失敗しました: %v\n%s", format, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
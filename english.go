@@ -0,0 +1,83 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// englishWordPattern はテキスト中のラテン文字の連続 (英単語) に一致します。"don't" のようなアポストロフィも含めます
+var englishWordPattern = regexp.MustCompile(`[A-Za-z]+(?:'[A-Za-z]+)*`)
+
+// englishReadings は --romaji-to-kana で変換する英単語の読みです (キーは小文字)。
+// 最小限の辞書のため、ここに無い単語は大文字の略語を除いてそのまま残します
+var englishReadings = map[string]string{
+	"the": "ザ", "and": "アンド", "or": "オア", "of": "オブ", "to": "トゥー",
+	"in": "イン", "on": "オン", "for": "フォー", "with": "ウィズ", "is": "イズ", "it": "イット",
+	"hello": "ハロー", "world": "ワールド", "yes": "イエス", "no": "ノー", "ok": "オーケー", "okay": "オーケー",
+	"thank": "サンク", "thanks": "サンクス", "you": "ユー", "please": "プリーズ", "sorry": "ソーリー",
+	"good": "グッド", "morning": "モーニング", "night": "ナイト", "happy": "ハッピー", "new": "ニュー",
+	"go": "ゴー", "golang": "ゴーラング", "python": "パイソン", "java": "ジャバ", "linux": "リナックス",
+	"windows": "ウィンドウズ", "mac": "マック", "google": "グーグル", "github": "ギットハブ", "git": "ギット",
+	"voicevox": "ボイスボックス", "web": "ウェブ", "server": "サーバー", "file": "ファイル", "data": "データ",
+	"error": "エラー", "test": "テスト", "tool": "ツール", "app": "アプリ", "update": "アップデート",
+	"download": "ダウンロード", "online": "オンライン", "email": "イーメール", "youtube": "ユーチューブ",
+	"twitter": "ツイッター", "iphone": "アイフォーン", "android": "アンドロイド", "wifi": "ワイファイ",
+}
+
+// letterReadings はアルファベット1文字の読みです。辞書に無い大文字の略語 (API など) を1文字ずつ読むのに使います
+var letterReadings = map[rune]string{
+	'A': "エー", 'B': "ビー", 'C': "シー", 'D': "ディー", 'E': "イー", 'F': "エフ", 'G': "ジー",
+	'H': "エイチ", 'I': "アイ", 'J': "ジェー", 'K': "ケー", 'L': "エル", 'M': "エム", 'N': "エヌ",
+	'O': "オー", 'P': "ピー", 'Q': "キュー", 'R': "アール", 'S': "エス", 'T': "ティー", 'U': "ユー",
+	'V': "ブイ", 'W': "ダブリュー", 'X': "エックス", 'Y': "ワイ", 'Z': "ゼット",
+}
+
+// maxAcronymLength は1文字ずつ読む大文字の略語の最大の長さです
+const maxAcronymLength = 5
+
+// romajiToKana はテキスト中の英単語を、辞書にあればカタカナ読みに、辞書に無い大文字の略語なら1文字ずつの読みに変換します。
+// それ以外の未知語はそのまま残し、読みはエンジンに任せます
+func romajiToKana(text string) string {
+	return englishWordPattern.ReplaceAllStringFunc(text, func(word string) string {
+		if reading, ok := englishReadings[strings.ToLower(word)]; ok {
+			return reading
+		}
+		if len(word) <= maxAcronymLength && strings.ToUpper(word) == word && !strings.Contains(word, "'") {
+			var b strings.Builder
+			for _, r := range word {
+				b.WriteString(letterReadings[r])
+			}
+			return b.String()
+		}
+		return word
+	})
+}
+
+// latinWarnRatio は英字の割合がこれを超えると警告する値です
+const latinWarnRatio = 0.5
+
+// latinRatio はテキスト中の文字 (数字・記号・空白を除く) のうち、ラテン文字の割合を返します
+func latinRatio(text string) float64 {
+	letters, latin := 0, 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+		}
+	}
+	if letters == 0 {
+		return 0
+	}
+	return float64(latin) / float64(letters)
+}
+
+// warnLatinText は英字の割合が latinWarnRatio を超える場合に、日本語向けのツールである旨を標準エラー出力に警告します
+func warnLatinText(text string) {
+	if ratio := latinRatio(text); ratio > latinWarnRatio {
+		logWarn("テキストの %.0f%% が英字です。このツールは日本語向けのため、英語の文章は正しく読み上げられない場合があります", ratio*100)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// 環境変数の名前です。コンテナなどフラグを渡しにくい環境で、接続先と話者の既定値を指定します
+const (
+	envHost  = "VOICEVOX_HOST"  // エンジンのホスト名 (engine や engine:50021)、または URL (--host)
+	envPort  = "VOICEVOX_PORT"  // エンジンのポート番号 (--port)
+	envActor = "VOICEVOX_ACTOR" // 話者の名前 (--actor)
+	// envPassword は --user でパスワードを省略したときに使う、Basic認証のパスワードです
+	envPassword = "VOICEVOX_PASSWORD"
+)
+
+// applyEnv は環境変数の値を、コマンドラインと --preset で指定されていないオプションに設定します。
+// 呼び出す順序による優先順位は loadDefaults を参照してください
+func applyEnv(fset *flag.FlagSet, getenv func(string) string) error {
+	explicit := map[string]bool{}
+	fset.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	if v := strings.TrimSpace(getenv(envPort)); v != "" && !explicit["port"] && !configOverridden("port", explicit) {
+		if err := fset.Set("port", v); err != nil {
+			return fmt.Errorf("環境変数 %s の値 '%s' が不正です: %v", envPort, v, err)
+		}
+	}
+	if v := strings.TrimSpace(getenv(envHost)); v != "" && !explicit["host"] && !configOverridden("host", explicit) {
+		// --port を指定した場合は、ホスト名に含まれるポートより --port を優先します
+		if u, err := url.Parse("http://" + v); explicit["port"] && !strings.Contains(v, "://") && err == nil && u.Port() != "" {
+			v = strings.TrimSuffix(u.Host, ":"+u.Port())
+		}
+		fset.Set("host", v)
+	}
+	if v := strings.TrimSpace(getenv(envActor)); v != "" && !explicit["actor"] && !configOverridden("actor", explicit) {
+		fset.Set("actor", v)
+	}
+	return nil
+}
+
+// hostURL は --host の値をエンジンのURLにします。URL の場合はそのまま使い、
+// ホスト名だけの場合は http:// を補います。ホスト名にポートが無い場合は port を使います
+func hostURL(host string, port int) (string, error) {
+	invalid := fmt.Errorf("--host '%s' が不正です (ホスト名か、http:// または https:// で始まるURLを指定してください)", host)
+	if strings.Contains(host, "://") {
+		if u, err := url.Parse(host); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "", invalid
+		}
+		return host, nil
+	}
+	u, err := url.Parse("http://" + host)
+	if err != nil || u.Hostname() == "" || (u.Path != "" && u.Path != "/") {
+		return "", invalid
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), strconv.Itoa(port))
+	}
+	return "http://" + u.Host, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Pikka2048/text2voicevox/voicevox"
+)
+
+// 終了コードの一覧です。スクリプトからエラーの原因を判別できるように使い分けます
+const (
+	exitOK              = 0   // 正常終了
+	exitFailure         = 1   // その他のエラー（引数の誤りなど）
+	exitConnection      = 2   // VOICEVOXエンジンへの接続失敗
+	exitSpeakerNotFound = 3   // 指定された話者が見つからない
+	exitFileIO          = 4   // 入出力ファイルのエラー
+	exitSynthesis       = 5   // APIがエラーを返した（音声合成の失敗など、4xx/5xx）
+	exitInterrupted     = 130 // Ctrl+C (SIGINT) や SIGTERM で中断した (シェルの慣例に合わせて 128 + 2)
+)
+
+// errInterrupted は Ctrl+C (SIGINT) や SIGTERM で処理を中断したことを表します
+var errInterrupted = errors.New("処理を中断しました")
+
+// VOICEVOX APIのエラーは voicevox パッケージで定義しています
+type (
+	ConnectionError   = voicevox.ConnectionError
+	PartialAudioError = voicevox.PartialAudioError
+	APIError          = voicevox.APIError
+)
+
+// isNotFound はエラーがAPIの 404 Not Found によるものかどうかを返します
+func isNotFound(err error) bool {
+	return voicevox.IsNotFound(err)
+}
+
+// SpeakerNotFoundError は指定された話者が見つからなかった（または一意に決まらなかった）ことを表します
+type SpeakerNotFoundError struct {
+	Name        string
+	Candidates  []string // 部分一致した話者が複数ある場合の候補
+	Suggestions []string // 一致する話者が無い場合の、名前が似ている話者
+	StyleType   string   // 空でない場合、話者は見つかったがこのタイプのスタイルが無いことを表します
+	Style       string   // 空でない場合、話者は見つかったがこの名前のスタイルが無い (または一意に決まらない) ことを表します
+	Styles      []string // Style が見つからない場合の、話者の利用できるスタイル
+}
+
+func (e *SpeakerNotFoundError) Error() string {
+	if e.Style != "" {
+		if len(e.Candidates) > 0 {
+			return fmt.Sprintf("話者 '%s' に '%s' に該当するスタイルが複数あります: %s\n--style でスタイル名を正確に指定してください", e.Name, e.Style, strings.Join(e.Candidates, ", "))
+		}
+		return fmt.Sprintf("話者 '%s' にスタイル '%s' が見つかりませんでした\n利用できるスタイル: %s", e.Name, e.Style, strings.Join(e.Styles, ", "))
+	}
+	if e.StyleType != "" {
+		return fmt.Sprintf("話者 '%s' には '%s' タイプのスタイルがありません\n--list-actors --style-type %s で利用できる話者を確認してください", e.Name, e.StyleType, e.StyleType)
+	}
+	if len(e.Candidates) > 0 {
+		return fmt.Sprintf("'%s' に該当する話者が複数あります: %s\n--actor で話者名を正確に指定してください", e.Name, strings.Join(e.Candidates, ", "))
+	}
+	msg := fmt.Sprintf("指定された話者 '%s' が見つかりませんでした", e.Name)
+	if len(e.Suggestions) > 0 {
+		msg += "\nもしかして: " + strings.Join(e.Suggestions, ", ")
+	}
+	return msg
+}
+
+// FileError は入出力ファイルの読み書きや解析に失敗したことを表します
+type FileError struct {
+	Msg string
+	Err error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Msg, e.Err)
+}
+
+func (e *FileError) Unwrap() error { return e.Err }
+
+// errorMessage はCLIで表示するエラーメッセージを返します。voicevox パッケージのエラーはオプションを知らないため、
+// 対処に使うオプションをここで書き添えます
+func errorMessage(err error) string {
+	msg := err.Error()
+	var connErr *ConnectionError
+	if errors.As(err, &connErr) && connErr.Timeout() {
+		msg += "\n時間の掛かる処理の場合は --timeout (または --connect-timeout / --synthesis-timeout) で延長してください"
+	}
+	return msg
+}
+
+// exitCode はエラーの種類に応じた終了コードを返します
+func exitCode(err error) int {
+	var connErr *ConnectionError
+	var apiErr *APIError
+	var speakerErr *SpeakerNotFoundError
+	var fileErr *FileError
+
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errInterrupted), errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.As(err, &connErr):
+		return exitConnection
+	case errors.As(err, &speakerErr):
+		return exitSpeakerNotFound
+	case errors.As(err, &fileErr):
+		return exitFileIO
+	case errors.As(err, &apiErr):
+		return exitSynthesis
+	}
+	return exitFailure
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+)
+
+// timeoutError は net.Error のタイムアウトです
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, exitOK},
+		{"other", errors.New("x"), exitFailure},
+		{"interrupted", errInterrupted, exitInterrupted},
+		{"canceled", fmt.Errorf("合成: %w", context.Canceled), exitInterrupted},
+		{"connection", &ConnectionError{Err: errors.New("refused")}, exitConnection},
+		{"partial audio", &PartialAudioError{Err: &ConnectionError{Err: timeoutError{}}}, exitConnection},
+		{"speaker", fmt.Errorf("wrapped: %w", &SpeakerNotFoundError{Name: "x"}), exitSpeakerNotFound},
+		{"file", &FileError{Msg: "x", Err: os.ErrNotExist}, exitFileIO},
+		{"api", fmt.Errorf("wrapped: %w", &APIError{Op: "x", StatusCode: 500}), exitSynthesis},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("%s: exitCode = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	const hint = "--timeout (または --connect-timeout / --synthesis-timeout)"
+	tests := []struct {
+		name     string
+		err      error
+		wantHint bool
+	}{
+		{"timeout", &ConnectionError{Err: timeoutError{}}, true},
+		{"wrapped timeout", fmt.Errorf("チャンク 1: %w", &ConnectionError{Err: timeoutError{}}), true},
+		{"refused", &ConnectionError{Err: errors.New("connection refused")}, false},
+		{"other", errors.New("x"), false},
+	}
+	for _, tt := range tests {
+		msg := errorMessage(tt.err)
+		if !strings.HasPrefix(msg, tt.err.Error()) {
+			t.Errorf("%s: errorMessage = %q, want it to start with %q", tt.name, msg, tt.err.Error())
+		}
+		if got := strings.Contains(msg, hint); got != tt.wantHint {
+			t.Errorf("%s: errorMessage = %q, want hint: %v", tt.name, msg, tt.wantHint)
+		}
+	}
+}
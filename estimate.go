@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// secondsPerChar は話速 1.0 のときの1文字あたりの平均的な読み上げ秒数です（文字数からの推定に使います）
+const secondsPerChar = 0.15
+
+// estimateFromText は文字数から、おおよその再生時間を推定します
+func estimateFromText(text string, speed float64) time.Duration {
+	if speed <= 0 {
+		speed = 1.0
+	}
+	seconds := float64(utf8.RuneCountInString(text)) * secondsPerChar / speed
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// estimateFromQuery は audio_query のモーラ長と前後の無音から再生時間を推定します。モーラ数も返します
+func estimateFromQuery(query *AudioQuery) (time.Duration, int) {
+	seconds, moras := 0.0, 0
+	for _, phrase := range query.AccentPhrases {
+		for _, mora := range phrase.Moras {
+			seconds += mora.Length()
+			moras++
+		}
+		if phrase.PauseMora != nil {
+			seconds += phrase.PauseMora.VowelLength
+		}
+	}
+	seconds += query.PrePhonemeLength + query.PostPhonemeLength
+
+	speed := query.SpeedScale
+	if speed <= 0 {
+		speed = 1.0
+	}
+	return time.Duration(seconds / speed * float64(time.Second)), moras
+}
+
+// printEstimate は区間ごとの文字数から推定した再生時間を表示します。
+// withQuery が true の場合は audio_query を作成し、モーラ長に基づいたより正確な推定も表示します
+func printEstimate(client *Client, speakerID int, segments []Segment, params SynthesisParams, kanaMode, withQuery bool) error {
+	chars := 0
+	var byText, byQuery, breaks time.Duration
+	moras := 0
+	for _, seg := range segments {
+		if seg.Break > 0 {
+			breaks += seg.Break
+			continue
+		}
+		p := seg.params(params)
+		chars += utf8.RuneCountInString(seg.Text)
+		byText += estimateFromText(seg.Text, p.Speed)
+
+		if !withQuery {
+			continue
+		}
+		query, err := buildSegmentQuery(client, seg, speakerID, kanaMode, params)
+		if err != nil {
+			return err
+		}
+		d, n := estimateFromQuery(query)
+		byQuery += d
+		moras += n
+	}
+
+	fmt.Println("--- 推定再生時間 (目安) ---")
+	fmt.Printf("文字数      : %d 文字\n", chars)
+	fmt.Printf("文字数から  : 約 %.1f 秒 (1文字あたり %g 秒として計算)\n", (byText + breaks).Seconds(), secondsPerChar)
+	if withQuery {
+		fmt.Printf("モーラ数    : %d\n", moras)
+		fmt.Printf("audio_query : 約 %.1f 秒 (前後の無音を含む)\n", (byQuery + breaks).Seconds())
+	}
+	fmt.Println("--------------------------")
+	fmt.Println("※ 推定値はあくまで目安です。実際に合成した音声の長さとは誤差があります。")
+	return nil
+}
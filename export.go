@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+// exportFormats は --export で指定できる、動画編集ソフト向けのファイル一式の形式です
+var exportFormats = []string{"psdtoolkit", "ymm4"}
+
+// timelineName は --export で行の並びと開始時刻を保存するファイルの名前です
+const timelineName = "timeline.csv"
+
+// checkExportFormat は --export に指定された形式が対応しているかを確認します
+func checkExportFormat(name string) error {
+	for _, f := range exportFormats {
+		if name == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("--export には %s のいずれかを指定してください: %s", strings.Join(exportFormats, ", "), name)
+}
+
+// writeLineCompanions は --export の形式に合わせて、行の音声 (path) と同じ名前でセリフの .txt を保存します。
+// psdtoolkit では PSDToolKit の既定に合わせて .txt を Shift_JIS にし、口パク用の .lab も保存します
+func writeLineCompanions(path, text string, wav []byte, query *AudioQuery, format string) error {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	data := []byte(text)
+	if format == "psdtoolkit" {
+		encoded, err := japanese.ShiftJIS.NewEncoder().Bytes(data)
+		if err != nil {
+			// Shift_JIS に無い文字は、PSDToolKit の設定で読み込めるよう UTF-8 のままにします
+			logWarn("'%s' は Shift_JIS に無い文字を含むため、UTF-8 で保存します", base+".txt")
+		} else {
+			data = encoded
+		}
+
+		d, err := wavDuration(wav)
+		if err != nil {
+			return fmt.Errorf("合成結果の解析に失敗しました: %v", err)
+		}
+		lab := formatLab(chunkPhonemes([]ChunkTiming{{Duration: d, Query: query}}))
+		if err := writeOutputFile(base+".lab", lab, false); err != nil {
+			return err
+		}
+	}
+	return writeOutputFile(base+".txt", data, false)
+}
+
+// writeTimeline は保存した行の音声を順に並べたときの開始時刻と長さ (秒) を、最初の音声と同じディレクトリの timeline.csv に保存します。
+// 失敗した行は含めません
+func writeTimeline(entries []ManifestEntry, results []BatchResult, defaultActor string) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"index", "file", "actor", "text", "start", "duration"})
+	dir := ""
+	var start time.Duration
+	for i, res := range results {
+		if res.Err != nil || res.Output == "" {
+			continue
+		}
+		data, err := os.ReadFile(res.Output)
+		if err != nil {
+			return &FileError{Msg: fmt.Sprintf("'%s' の読み込みに失敗しました", res.Output), Err: err}
+		}
+		d, err := wavDuration(data)
+		if err != nil {
+			return fmt.Errorf("'%s' の解析に失敗しました: %v", res.Output, err)
+		}
+		if dir == "" {
+			dir = filepath.Dir(res.Output)
+		}
+		actor := entries[i].Actor
+		if actor == "" {
+			actor = defaultActor
+		}
+		w.Write([]string{
+			strconv.Itoa(entries[i].Index),
+			filepath.Base(res.Output),
+			actor,
+			entries[i].Text,
+			strconv.FormatFloat(start.Seconds(), 'f', 3, 64),
+			strconv.FormatFloat(d.Seconds(), 'f', 3, 64),
+		})
+		start += d
+	}
+	if dir == "" {
+		return nil
+	}
+	w.Flush()
+
+	path := filepath.Join(dir, timelineName)
+	if err := writeOutputFile(path, buf.Bytes(), false); err != nil {
+		return err
+	}
+	logInfo("行の並びと開始時刻を '%s' に保存しました。", path)
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// minFitSpeed と maxFitSpeed は --target-duration で話速を調整する範囲です。これを超える場合は調整を打ち切ります
+const (
+	minFitSpeed = 0.5
+	maxFitSpeed = 2.0
+)
+
+// fitTolerance は --target-duration で目標時間に収まったとみなす誤差の割合です
+const fitTolerance = 0.02
+
+// maxFitPasses は --target-duration で合成を繰り返す最大の回数です
+const maxFitPasses = 4
+
+// fitDuration は合成結果の長さが target に近づくよう、話速を調整しながら synth で合成を繰り返します。
+// 1回目は params の話速で合成し、実測した長さと目標の比から話速を計算し直して再合成します。
+// 無音区間や前後の無音は話速で変わらないため、誤差が fitTolerance 以内になるまで最大 maxFitPasses 回繰り返します。
+// 必要な話速が minFitSpeed〜maxFitSpeed を超える場合は、範囲の端の話速で合成して警告します。
+// 合成結果と、最後に使ったパラメータを返します
+func fitDuration(target time.Duration, params SynthesisParams, quiet bool, synth func(SynthesisParams) ([]byte, error)) ([]byte, SynthesisParams, error) {
+	speed := params.Speed
+	var wav []byte
+	for pass := 1; pass <= maxFitPasses; pass++ {
+		params.set("speed", speed)
+		var err error
+		if wav, err = synth(params); err != nil {
+			return nil, params, err
+		}
+		actual, err := wavDuration(wav)
+		if err != nil {
+			return nil, params, fmt.Errorf("合成結果の長さを取得できませんでした: %v", err)
+		}
+		if !quiet {
+			logInfo("  [%d回目] 話速 %.3f → %.2f 秒 (目標 %.2f 秒)", pass, speed, actual.Seconds(), target.Seconds())
+		}
+
+		ratio := actual.Seconds() / target.Seconds()
+		if math.Abs(ratio-1) <= fitTolerance {
+			return wav, params, nil
+		}
+		next := speed * ratio
+		if next < minFitSpeed || next > maxFitSpeed {
+			limit := math.Max(minFitSpeed, math.Min(maxFitSpeed, next))
+			if speed != limit {
+				params.set("speed", limit)
+				if wav, err = synth(params); err != nil {
+					return nil, params, err
+				}
+			}
+			logWarn("目標時間に合わせるには話速 %.2f が必要ですが、推奨範囲 (%g〜%g) を超えるため話速 %g で打ち切りました",
+				next, minFitSpeed, maxFitSpeed, limit)
+			return wav, params, nil
+		}
+		speed = next
+	}
+	logWarn("%d 回の調整で目標時間との誤差が %.0f%% 以内に収まりませんでした", maxFitPasses, fitTolerance*100)
+	return wav, params, nil
+}
+
+// wavDuration はWAVデータの再生時間を返します
+func wavDuration(b []byte) (time.Duration, error) {
+	wav, err := parseWAV(b)
+	if err != nil {
+		return 0, err
+	}
+	return pcmDuration(wav.Format, len(wav.Data)), nil
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Pikka2048/text2voicevox/voicevox"
+)
+
+// cliOptions はコマンドライン引数の値です。defineFlags でフラグとして定義し、flag.Parse の後に run で使います
+type cliOptions struct {
+	// 基本設定
+	inputFile        *string
+	directText       *string
+	outputFile       *string
+	configPath       *string
+	outputFormat     *string
+	actors           actorsFlag
+	actorList        *string
+	exactActor       *bool
+	port             *int
+	autoPort         *bool
+	portRange        *string
+	host             *string
+	basicAuth        *string
+	baseURL          *string
+	headers          headerFlag
+	insecure         *bool
+	connectTimeout   *time.Duration
+	synthesisTimeout *time.Duration
+	timeout          *time.Duration
+	retries          *int
+	savePartial      *bool
+	keepPartial      *bool
+	showActors       *bool
+	actorFilter      *string
+	styleFilter      *string
+	styleID          *int
+	styleName        *string
+	styleType        *string
+	actorSort        *string
+	jsonOutput       *bool
+	noClobber        *bool
+	forceOverwrite   *bool
+	noMkdir          *bool
+	strictOutputName *bool
+	split            *bool
+	dialogueMode     *bool
+	splitLinesMode   *bool
+	export           *string
+	filenameTemplate *string
+	targetDuration   *float64
+	stream           *bool
+	tolerateFailures *bool
+	gap              *float64
+	jobs             *int
+	maxChunkChars    *int
+	splitOn          *string
+	dryRun           *bool
+	dryRunQuery      *bool
+	dryRunJSON       *bool
+	markup           *bool
+	ssmlMode         *bool
+	markupStrict     *bool
+	verbose          *bool
+	progressJSON     *bool
+	quiet            *bool
+	logFormat        *string
+	estimate         *bool
+	estimateQuery    *bool
+	play             *bool
+	player           *string
+	tempDict         *string
+	kanaMode         *bool
+	actorInfo        *string
+	savePortrait     *string
+	coreVersion      *string
+	showCoreVersions *bool
+	silence          *float64
+	silenceRate      *int
+	silenceStereo    *bool
+	showPresets      *bool
+	presetName       *string
+	presetID         *int
+	showEngineInfo   *bool
+	showDevices      *bool
+	subtitles        *string
+	phonemes         *string
+	resume           *bool
+	noCache          *bool
+	sidecar          *bool
+	queryFile        *string
+	loadQuery        *string
+	splitSilence     *bool
+	minSilenceMs     *int
+	silenceThreshold *float64
+	minChunkMs       *int
+	compare          *string
+	compareThreshold *float64
+	analyze          *bool
+	checkpointFile   *string
+	restart          *bool
+	serveMode        *bool
+	preHook          *string
+	postHook         *string
+	hookShell        *bool
+	failOnHookError  *bool
+	interactiveMode  *bool
+	watchMode        *bool
+	metricsListen    *string
+	workers          *int
+	listen           *string
+	manifest         *string
+	concat           *bool
+
+	// テキストの前処理
+	textEncoding  *string
+	replaceRules  replaceRulesFlag
+	numberMode    *string
+	romajiKana    *bool
+	ruby          *bool
+	expandSymbols *bool
+	textVars      textVarsFlag
+	undefinedVar  *string
+
+	// 合成後の処理
+	normalize  *bool
+	targetDB   *float64
+	targetLUFS *float64
+	truePeak   *float64
+	resample   *int
+	toStereo   *bool
+	toMono     *bool
+	bitDepth   *string
+	fadeIn     *int
+	fadeOut    *int
+	echo       *bool
+	echoDelay  *int
+	echoDecay  *float64
+
+	// 音声パラメータ設定
+	profileName     *string
+	saveProfileName *string
+	showAliases     *bool
+	showProfiles    *bool
+	speed           *float64
+	pitch           *float64
+	intonation      *float64
+	volume          *float64
+	prePhoneme      *float64
+	postPhoneme     *float64
+	relativeFlags   map[string]*string
+}
+
+// defineFlags はコマンドライン引数を flag.CommandLine に定義し、値を受け取る cliOptions を返します
+func defineFlags() *cliOptions {
+	o := &cliOptions{}
+
+	// 基本設定
+	o.inputFile = flag.String("i", "", "入力テキストファイルのパス (必須)。- で標準入力から読み込む")
+	o.directText = flag.String("text", "", "ファイルの代わりに、合成するテキストを直接指定する (-i とは同時に指定できない)")
+	o.outputFile = flag.String("o", "", "出力WAVファイルのパス (必須)。{input} {actor} {style} {id} {date} {time} を置換します。- で標準出力に書き出す")
+	o.configPath = flag.String("config", "", "設定ファイルのパス。省略すると ~/.config/text2voicevox/config.yaml があれば読み込む (.toml はTOMLとして読み込む)")
+	o.outputFormat = flag.String("format", "", "出力フォーマット (wav, mp3, ogg, flac)。省略すると -o の拡張子から判定する")
+	o.actors = actorsFlag{names: []string{defaultActor}}
+	flag.Var(&o.actors, "actor", "話者の名前 (複数回指定すると話者ごとに合成)")
+	o.actorList = flag.String("actors", "", "カンマ区切りで複数の話者を指定し、話者ごとに合成する (例: \"ずんだもん,四国めたん\")")
+	o.exactActor = flag.Bool("exact", false, "話者名を完全一致のみで検索する (部分一致で話者を選ばない)")
+	o.port = flag.Int("port", 50021, "VOICEVOXエンジンのポート番号")
+	o.autoPort = flag.Bool("auto-port", false, "候補のポートを順に確認し、最初に応答したエンジンに接続する (候補は --port-range で変更)")
+	o.portRange = flag.String("port-range", "", "--auto-port で探索するポート (例: 50021,50121 や 50021-50030)。未指定時は 50021,50121,50025,10101")
+	o.host = flag.String("host", "", "VOICEVOXエンジンのホスト名 (例: 192.168.1.10, voicevox:50021)。ポートを省略すると --port を使う")
+	o.basicAuth = flag.String("user", "", "エンジンのBasic認証のユーザー名とパスワード \"user:password\" (パスワードを省略すると環境変数 VOICEVOX_PASSWORD を使う)")
+	o.baseURL = flag.String("base-url", "", "VOICEVOXエンジンのURL (例: https://voicevox.example.com)。指定時は --port より優先")
+	flag.Var(&o.headers, "header", "すべてのリクエストに付与するHTTPヘッダー \"Key: Value\" (複数指定可)")
+	o.insecure = flag.Bool("insecure", false, "TLS証明書の検証を省略する (自己署名証明書向け)")
+	o.connectTimeout = flag.Duration("connect-timeout", voicevox.DefaultConnectTimeout, "話者の取得など短いリクエストのタイムアウト (例: 5s)。0で無制限")
+	o.synthesisTimeout = flag.Duration("synthesis-timeout", voicevox.DefaultSynthesisTimeout, "音声合成リクエストのタイムアウト (例: 10m)。0で無制限")
+	o.timeout = flag.Duration("timeout", 0, "すべてのリクエストのタイムアウト (例: 30s)。--connect-timeout / --synthesis-timeout を指定した場合はそちらを優先")
+	o.retries = flag.Int("retries", 0, "接続エラー・タイムアウトと5xxのエラーを再試行する回数。再試行のたびに待ち時間を倍にする")
+	o.savePartial = flag.Bool("save-partial", false, "音声合成の受信がタイムアウトなどで中断された場合、受信済みの不完全な音声を <出力名>.partial.wav に保存する")
+	o.keepPartial = flag.Bool("keep-partial", false, "Ctrl+C で中断した場合、それまでに合成した音声を <出力名>.partial.wav に保存する (既定では作成途中のファイルを削除する)")
+	o.showActors = flag.Bool("list-actors", false, "利用可能な話者の一覧を表示")
+	o.actorFilter = flag.String("filter", "", "--list-actors で話者名の部分一致で絞り込む")
+	o.styleFilter = flag.String("filter-style", "", "--list-actors でスタイル名の部分一致で絞り込む")
+	o.styleID = flag.Int("speaker-id", -1, "話者の一覧を問い合わせず、このスタイルIDで合成する (--actor / --style の代わり)")
+	o.styleName = flag.String("style", "", "使用するスタイル名 (例: あまあま)。前方一致・部分一致でも選び、未指定時は --style-type に従う")
+	o.styleType = flag.String("style-type", "", "使用・一覧するスタイルのタイプ (talk, singing_teacher, frame_decode, sing)。未指定時は talk を優先する")
+	o.actorSort = flag.String("sort", "", "--list-actors の並べ替え (name: 話者名順, id: スタイルID順)")
+	o.jsonOutput = flag.Bool("json", false, "--list-actors の結果をJSONで出力する")
+	o.noClobber = flag.Bool("no-clobber", false, "出力ファイルが既に存在する場合は上書きせずにスキップする")
+	o.forceOverwrite = flag.Bool("force-overwrite", false, "出力ファイルが既に存在しても確認せずに上書きする")
+	o.noMkdir = flag.Bool("no-mkdir", false, "出力先のディレクトリが存在しない場合に自動で作成しない")
+	o.strictOutputName = flag.Bool("strict-output-name", false, "-o に未知のプレースホルダがある場合にエラーにする")
+	o.split = flag.Bool("split", false, "テキストを文単位（--kana 指定時は行単位）に分割して合成し、1つのWAVに結合する")
+	o.dialogueMode = flag.Bool("dialogue", false, "入力を「話者名: セリフ」の台本として読み込み、行ごとに指定した話者で合成する")
+	o.splitLinesMode = flag.Bool("split-lines", false, "入力の空でない行ごとに合成し、out_0001.wav のように連番の別ファイルに保存する")
+	o.export = flag.String("export", "", "--split-lines で、動画編集ソフト向けに行ごとのセリフの .txt と timeline.csv も保存する (psdtoolkit, ymm4)")
+	o.filenameTemplate = flag.String("filename-template", "", "--split-lines で保存するファイル名。{index} (4桁の連番) {text} (行の先頭) と -o と同じプレースホルダを置換する")
+	o.targetDuration = flag.Float64("target-duration", 0, "合成結果がこの秒数に近づくよう、話速を自動で調整して合成し直す")
+	o.stream = flag.Bool("stream", false, "--split の各チャンクを合成でき次第、出力に追記していく (-o - で標準出力に書き出す。--play でチャンクごとに再生する)")
+	o.tolerateFailures = flag.Bool("tolerate-failures", false, "合成に失敗したチャンクを再試行し、それでも失敗した区間は無音で埋めて残りを出力する")
+	o.gap = flag.Float64("gap", 0, "分割して合成した区間の間 (--concat ではファイルの間) に挟む無音の秒数")
+	o.jobs = flag.Int("jobs", 1, "--split のチャンクを同時に合成する数。結果は元の順番で結合する")
+	o.maxChunkChars = flag.Int("max-chunk-chars", 0, fmt.Sprintf("--split 時、この文字数を超える文を読点や助詞の位置でさらに分割する (%d以上、0で無効)", minMaxChunkChars))
+	flag.IntVar(o.maxChunkChars, "max-chars", 0, "--max-chunk-chars の別名")
+	o.splitOn = flag.String("split-on", "", "--split で文を区切る種類をカンマ区切りで指定する (period, exclamation, ellipsis, comma, newline)。未指定時は period,exclamation,newline")
+	o.dryRun = flag.Bool("dry-run", false, "音声合成を行わず、使用する話者・パラメータ・分割結果を表示する")
+	o.dryRunQuery = flag.Bool("dry-run-query", false, "--dry-run に加えて audio_query を作成し、エンジンが解釈した読みを表示する")
+	o.dryRunJSON = flag.Bool("dry-run-json", false, "音声合成を行わず、パラメータを適用した audio_query のJSONを標準出力に書き出す")
+	o.markup = flag.Bool("markup", false, "テキスト中の <speed=1.5>…</speed> や <break time=\"500ms\"/> などのタグで部分的にパラメータを変える")
+	o.ssmlMode = flag.Bool("ssml", false, "入力をSSML (<break> <prosody> <p> <s> <voice> <sub>) として読み込む")
+	o.markupStrict = flag.Bool("markup-strict", false, "--markup で未対応のタグをエラーにする (指定しない場合は無視する)")
+	o.verbose = flag.Bool("verbose", false, "詳細なログ (上書きしたパラメータや話者のバージョンなど) を表示する")
+	o.progressJSON = flag.Bool("progress-json", false, "進捗とイベントをJSON行 (NDJSON) で標準エラー出力に出力し、人間向けの表示を抑制する")
+	o.quiet = flag.Bool("quiet", false, "進捗（プログレスバーなど）と、エラー以外のメッセージを表示しない")
+	o.logFormat = flag.String("log-format", "text", "メッセージの形式 (text, json)。json は1行1つのJSONで標準エラー出力に書き出す")
+	o.estimate = flag.Bool("estimate", false, "音声合成を行わず、文字数から推定した再生時間を表示する")
+	o.estimateQuery = flag.Bool("estimate-query", false, "audio_query のモーラ長から、より正確な推定再生時間を表示する")
+	o.play = flag.Bool("play", false, "合成した音声をOS標準のプレイヤーで再生する (-o を省略するとファイルは保存しない)")
+	o.player = flag.String("player", "", "--play と対話モードで使う再生コマンド (例: \"mpv --no-video\")。WAVファイルのパスを最後の引数に付けて実行する")
+	o.tempDict = flag.String("dict", "", "合成の間だけユーザー辞書に登録する単語のCSV (dict import と同じ形式)。終了時に削除する")
+	o.kanaMode = flag.Bool("kana", false, "入力をAquesTalk風記法のkana（例: コンニチワ'）として扱う")
+	o.actorInfo = flag.String("actor-info", "", "指定した話者の利用規約を表示")
+	o.savePortrait = flag.String("save-portrait", "", "--actor-info の話者の立ち絵画像 (PNG) を保存するパス")
+	o.coreVersion = flag.String("core-version", "", "合成に使うエンジンのコアバージョン")
+	o.showCoreVersions = flag.Bool("list-core-versions", false, "エンジンに搭載されているコアバージョンの一覧を表示")
+	o.silence = flag.Float64("silence", 0, "指定した秒数の無音WAVを生成して -o に保存")
+	o.silenceRate = flag.Int("silence-rate", 24000, "--silence で生成する無音のサンプリングレート (Hz)")
+	o.silenceStereo = flag.Bool("silence-stereo", false, "--silence で生成する無音をステレオにする")
+	o.showPresets = flag.Bool("list-presets", false, "名前付きのプリセットと、エンジンに登録済みのプリセットの一覧を表示")
+	o.presetName = flag.String("preset", "", "presets ディレクトリ (~/.config/text2voicevox/presets) の <名前>.yaml に書いた話者・スタイル・パラメータを使う (コマンドラインで指定したオプションが優先。環境変数と設定ファイルより優先)")
+	o.presetID = flag.Int("preset-id", -1, "合成に使うエンジンのプリセットID (明示的に指定したパラメータはプリセットより優先)")
+	o.showEngineInfo = flag.Bool("engine-info", false, "エンジンの名前・バージョン・対応機能を表示")
+	o.showDevices = flag.Bool("devices", false, "エンジンのGPU/CPUデバイス対応状況を表示")
+	o.subtitles = flag.String("subtitles", "", "合成した音声に合わせた字幕を保存するパス (.srt か .vtt)。文ごとの表示時間はチャンクの音声の長さから求める")
+	o.phonemes = flag.String("phonemes", "", "合成した音声の音素のタイミングをリップシンク用に保存するパス (.lab はHTK形式のラベル、.json)")
+	o.resume = flag.Bool("resume", false, "合成できたチャンクを <出力名>.chunks に保存し、中断した後の再実行では同じ内容のチャンクを合成し直さずに使う")
+	o.noCache = flag.Bool("no-cache", false, "合成結果のキャッシュ (~/.cache/text2voicevox) を使わずにすべて合成し直す。キャッシュへの保存もしない")
+	o.sidecar = flag.Bool("sidecar", false, "合成に使った情報 (テキスト・話者・パラメータ・エンジンのバージョンなど) を出力ファイルの隣に .json で保存する")
+	o.queryFile = flag.String("query-file", "", "--dry-run-json などで保存した audio_query のJSONを /audio_query を使わずにそのまま合成する (-i の代わり)")
+	o.loadQuery = flag.String("load-query", "", "--sidecar で保存したJSONを読み込み、同じテキスト・話者・パラメータで再合成する (-i の代わり)")
+	o.splitSilence = flag.Bool("split-by-silence", false, "合成結果を無音区間で分割し、out_001.wav のように連番で保存する")
+	o.minSilenceMs = flag.Int("min-silence-ms", 500, "--split-by-silence で分割する無音の最小の長さ (ミリ秒)")
+	o.silenceThreshold = flag.Float64("silence-threshold", silenceThresholdDB, "--split-by-silence で無音とみなすレベル (dBFS)")
+	o.minChunkMs = flag.Int("min-chunk-ms", 1000, "--split-by-silence で分割後の1ファイルの最小の長さ (ミリ秒)。短いものは次と結合する")
+	o.compare = flag.String("compare", "", "合成結果 (位置引数があればそのWAVファイル) を基準のWAVと比較し、差分がしきい値を超えたら失敗する。基準が無ければ合成結果を保存する")
+	o.compareThreshold = flag.Float64("compare-threshold", defaultCompareThresholdDB, "--compare で一致とみなす差分のRMSレベル (dBFS)")
+	o.analyze = flag.Bool("analyze", false, "WAVのピーク・RMS・クリッピング・無音の割合を表示する (位置引数のWAVファイル、無ければ合成結果が対象)")
+	o.checkpointFile = flag.String("checkpoint", "", "--manifest の完了したエントリを記録するファイル。再実行時は完了済みのエントリを飛ばす")
+	o.restart = flag.Bool("restart", false, "--checkpoint の記録を消して最初からやり直す")
+	o.serveMode = flag.Bool("serve", false, "常駐してHTTPで合成リクエスト (POST /synthesize, POST /tts) を受け付けるサーバーモードで起動する (serve サブコマンドと同じ)")
+	o.preHook = flag.String("pre-hook", "", "合成の前に実行するコマンド ({input} {output} は入力・出力のパスに置換)")
+	o.postHook = flag.String("post-hook", "", "合成した音声を保存した後に実行するコマンド ({input} {output} は入力・出力のパスに置換)")
+	o.hookShell = flag.Bool("hook-shell", false, "フックをシェル経由 (sh -c / cmd /C) で実行する (既定は空白で区切って直接実行)")
+	o.failOnHookError = flag.Bool("fail-on-hook-error", false, "フックが失敗した場合に全体を失敗扱いにする (既定は警告のみ)")
+	o.interactiveMode = flag.Bool("interactive", false, "標準入力から1行ずつ読み込み、合成して再生する対話モードで起動する (:help でコマンド一覧)")
+	o.watchMode = flag.Bool("watch", false, "入力ファイル (-i) の更新時刻とサイズを0.5秒ごとに確認し、保存されるたびに出力を上書きして合成し直す (--play と組み合わせると毎回再生する)。Ctrl+C で終了")
+	o.metricsListen = flag.String("metrics-listen", "", "--serve で GET /metrics (Prometheus形式) を公開するアドレス (例: :9100)")
+	o.workers = flag.Int("workers", 1, "--serve で同時に合成するジョブの数。待機中のジョブはリクエストの priority が大きい順に処理する")
+	o.listen = flag.String("listen", "127.0.0.1:8080", "--serve で待ち受けるアドレス (例: :8080 で全てのインターフェース)")
+	o.manifest = flag.String("manifest", "", "「テキスト, 話者, speed, 出力名」を並べたCSV/JSONを読み込み、エントリごとに合成して保存する")
+	o.concat = flag.Bool("concat", false, "位置引数で指定した複数のWAVファイルを結合して -o に保存")
+
+	// テキストの前処理
+	o.textEncoding = flag.String("encoding", "auto", "入力ファイルの文字コード (auto, utf-8, shift_jis, euc-jp)。auto はBOMとUTF-8の妥当性から判定")
+	o.numberMode = flag.String("number-mode", "", "数字の読み方 (digit: 1桁ずつ読む, kanji: 漢数字として読む)。省略時はエンジンに任せる")
+	o.romajiKana = flag.Bool("romaji-to-kana", false, "英単語を簡易的な辞書でカタカナ読みに変換し、辞書に無い大文字の略語は1文字ずつ読む (未知語はそのまま)")
+	o.ruby = flag.Bool("ruby", false, "テキスト中の |漢字《かんじ》 や 漢字{かんじ} のルビを、その箇所の読みとして使う")
+	o.expandSymbols = flag.Bool("expand-symbols", false, "% ℃ 〜 などの記号を読みの語 (パーセント、度、から など) に展開する")
+	flag.Var(&o.replaceRules, "replace", "読み上げ前に適用する正規表現の置換ルール \"pattern=>replacement\" (複数指定可、指定順に適用)")
+	o.textVars = textVarsFlag{}
+	flag.Var(o.textVars, "var", "テキスト中の {{名前}} / {{var:名前}} を置き換える変数 \"名前=値\" (複数指定可。組み込みの date, time, weekday より優先)")
+	o.undefinedVar = flag.String("undefined-var", "error", "定義されていない変数の扱い (error: エラーにする, empty: 空文字に置き換える)")
+
+	// 合成後の処理
+	o.normalize = flag.Bool("normalize", false, "合成後にRMS基準で音量を正規化する (ピークが0dBFSを超えない範囲に収める)")
+	o.targetDB = flag.Float64("target-db", -20.0, "--normalize の目標RMSレベル (dBFS)")
+	o.targetLUFS = flag.Float64("target-lufs", 0, "合成後に統合ラウドネス (ITU-R BS.1770) がこの値 (LUFS) になるよう音量を揃える (例: -14, -16, -23)")
+	o.truePeak = flag.Float64("true-peak", -1.0, "--target-lufs でトゥルーピークがこの値 (dBTP) を超えないようリミッタを掛ける")
+	o.resample = flag.Int("resample", 0, "合成結果を指定したサンプリングレート (Hz) に変換する (例: 44100, 48000)")
+	o.toStereo = flag.Bool("to-stereo", false, "合成結果をステレオに変換する (左右に同じ音声を複製)")
+	o.toMono = flag.Bool("to-mono", false, "合成結果をモノラルに変換する (左右の平均)")
+	o.bitDepth = flag.String("bit-depth", "", "合成結果のビット深度 (8, 16, 24, 32, 32f: 32bit浮動小数点)")
+	o.fadeIn = flag.Int("fade-in", 0, "合成結果の先頭に掛けるフェードインの長さ (ミリ秒)")
+	o.fadeOut = flag.Int("fade-out", 0, "合成結果の末尾に掛けるフェードアウトの長さ (ミリ秒)")
+	o.echo = flag.Bool("echo", false, "合成結果に、遅延と減衰を指定したエコーを掛ける")
+	o.echoDelay = flag.Int("echo-delay", 250, "--echo の遅延 (ミリ秒)")
+	o.echoDecay = flag.Float64("echo-decay", 0.4, "--echo で繰り返すごとの減衰の割合 (0より大きく1未満)")
+
+	// 音声パラメータ設定
+	o.profileName = flag.String("profile", "", "保存済みのプロファイルのパラメータを使う (明示的に指定したパラメータが優先)")
+	o.saveProfileName = flag.String("save-profile", "", "指定した音声パラメータを名前を付けてプロファイルに保存する")
+	o.showAliases = flag.Bool("list-aliases", false, "定義済みの話者のエイリアスの一覧を表示")
+	o.showProfiles = flag.Bool("list-profiles", false, "保存済みのプロファイルの一覧を表示")
+	o.speed = flag.Float64("speed", 1.0, "話速")
+	o.pitch = flag.Float64("pitch", 0.0, "音高（±0.15程度が推奨）")
+	o.intonation = flag.Float64("intonation", 1.0, "抑揚")
+	o.volume = flag.Float64("volume", 1.0, "音量")
+	o.prePhoneme = flag.Float64("pre-phoneme", -1.0, "音声の前の無音時間 (秒)。-1でAPIのデフォルト値を使用")
+	o.postPhoneme = flag.Float64("post-phoneme", -1.0, "音声の後の無音時間 (秒)。-1でAPIのデフォルト値を使用")
+	o.relativeFlags = map[string]*string{
+		"speed":      flag.String("speed-rel", "", "話速をクエリの値 (プリセットなど) からの相対値で調整 (例: +20% / -0.1)。--speed と排他"),
+		"pitch":      flag.String("pitch-rel", "", "音高をクエリの値からの相対値で調整 (例: -10% は周波数を1割下げる / +0.05)。--pitch と排他"),
+		"intonation": flag.String("intonation-rel", "", "抑揚をクエリの値からの相対値で調整 (例: +20%)。--intonation と排他"),
+		"volume":     flag.String("volume-rel", "", "音量をクエリの値からの相対値で調整 (例: -10%)。--volume と排他"),
+	}
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "使用法: %s [オプション]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "        %s --concat <WAVファイル>... -o <出力WAVファイル>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "        %s completion <bash|zsh|fish>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "        %s config <init|path>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "        %s cache <clear|path>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "        %s serve [--listen <アドレス>] (--serve と同じ)\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "        %s dict <list|add|update|delete|import|export> (詳しくは dict <コマンド> -h)\n\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "必須オプション:")
+		fmt.Fprintln(os.Stderr, "  -i string\n    \t入力テキストファイルのパス (--text でテキストを直接指定する場合は不要)")
+		fmt.Fprintln(os.Stderr, "  -o string\n    \t出力WAVファイルのパス (--play 指定時は省略可)")
+		fmt.Fprintln(os.Stderr, "\nその他のオプション:")
+		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "\n環境変数 (コマンドラインと --preset より弱く、設定ファイルより強い):")
+		fmt.Fprintln(os.Stderr, "  VOICEVOX_HOST   エンジンのホスト名 (例: engine, engine:50021) またはURL")
+		fmt.Fprintln(os.Stderr, "  VOICEVOX_PORT   エンジンのポート番号")
+		fmt.Fprintln(os.Stderr, "  VOICEVOX_ACTOR  話者の名前")
+		fmt.Fprintln(os.Stderr, "  VOICEVOX_PASSWORD  --user でパスワードを省略したときのBasic認証のパスワード")
+		fmt.Fprintln(os.Stderr, "\nオプションの優先順位:")
+		fmt.Fprintln(os.Stderr, "  コマンドライン > --preset のプリセット > 環境変数 > 設定ファイルの preset のプリセット > 設定ファイル")
+		fmt.Fprintln(os.Stderr, "\n終了コード:")
+		fmt.Fprintln(os.Stderr, "  0  正常終了")
+		fmt.Fprintln(os.Stderr, "  1  その他のエラー（引数の誤りなど）")
+		fmt.Fprintln(os.Stderr, "  2  VOICEVOXエンジンへの接続失敗")
+		fmt.Fprintln(os.Stderr, "  3  指定された話者が見つからない")
+		fmt.Fprintln(os.Stderr, "  4  入出力ファイルのエラー")
+		fmt.Fprintln(os.Stderr, "  5  APIがエラーを返した（音声合成の失敗など）")
+		fmt.Fprintln(os.Stderr, "  130  Ctrl+C や SIGTERM で中断した")
+	}
+
+	return o
+}
+
+// validate はコマンドライン引数の値の範囲と組み合わせを確認します。
+// どの処理でも使うオプションのため、サブコマンドや --serve に振り分ける前に呼びます
+func (o *cliOptions) validate(explicit map[string]bool) error {
+	if err := checkStyleType(*o.styleType); err != nil {
+		return err
+	}
+	if err := checkSpeakerSort(*o.actorSort); err != nil {
+		return err
+	}
+	if err := checkUndefinedVarMode(*o.undefinedVar); err != nil {
+		return err
+	}
+	if *o.export != "" {
+		if err := checkExportFormat(*o.export); err != nil {
+			return err
+		}
+	}
+	if *o.subtitles != "" {
+		if _, err := subtitleFormat(*o.subtitles); err != nil {
+			return err
+		}
+	}
+	if *o.phonemes != "" {
+		if _, err := phonemeFormat(*o.phonemes); err != nil {
+			return err
+		}
+	}
+	for _, name := range relativeParamNames {
+		if *o.relativeFlags[name] != "" && explicit[name] {
+			return fmt.Errorf("--%s と --%s-rel は同時に指定できません", name, name)
+		}
+	}
+	if *o.styleID >= 0 {
+		switch {
+		case explicit["actor"] || explicit["actors"] || *o.styleName != "" || *o.styleType != "":
+			return fmt.Errorf("--speaker-id は --actor / --actors / --style / --style-type と同時に指定できません")
+		case *o.serveMode || *o.interactiveMode:
+			return fmt.Errorf("--speaker-id は --serve / --interactive では使えません")
+		}
+	} else if *o.styleID != -1 {
+		return fmt.Errorf("--speaker-id は0以上のスタイルIDで指定してください")
+	}
+	if *o.targetLUFS != 0 {
+		switch {
+		case *o.normalize:
+			return fmt.Errorf("--normalize と --target-lufs は同時に指定できません")
+		case *o.targetLUFS >= 0 || *o.targetLUFS < lufsAbsoluteGate:
+			return fmt.Errorf("--target-lufs は %g より大きい負の値で指定してください (例: -14)", lufsAbsoluteGate)
+		case *o.truePeak > 0:
+			return fmt.Errorf("--true-peak は0以下の値 (dBTP) で指定してください")
+		}
+	}
+	switch {
+	case *o.noClobber && *o.forceOverwrite:
+		return fmt.Errorf("--no-clobber と --force-overwrite は同時に指定できません")
+	case *o.host != "" && (*o.baseURL != "" || *o.autoPort):
+		return fmt.Errorf("--host は --base-url / --auto-port と同時に指定できません")
+	case *o.autoPort && *o.baseURL != "":
+		return fmt.Errorf("--auto-port と --base-url は同時に指定できません")
+	case *o.portRange != "" && !*o.autoPort:
+		return fmt.Errorf("--port-range は --auto-port と一緒に指定してください")
+	case *o.timeout < 0 || *o.connectTimeout < 0 || *o.synthesisTimeout < 0:
+		return fmt.Errorf("--timeout / --connect-timeout / --synthesis-timeout は0以上で指定してください")
+	case *o.retries < 0:
+		return fmt.Errorf("--retries は0以上で指定してください")
+	case explicit["text"] && *o.inputFile != "":
+		return fmt.Errorf("-i と --text は同時に指定できません")
+	case explicit["text"] && strings.TrimSpace(*o.directText) == "":
+		return fmt.Errorf("--text に合成するテキストを指定してください")
+	case *o.loadQuery != "" && (*o.inputFile != "" || explicit["text"]):
+		return fmt.Errorf("--load-query と -i / --text は同時に指定できません")
+	case *o.fadeIn < 0 || *o.fadeOut < 0:
+		return fmt.Errorf("--fade-in / --fade-out は0以上のミリ秒で指定してください")
+	case *o.echo && (*o.echoDelay <= 0 || *o.echoDecay <= 0 || *o.echoDecay >= 1):
+		return fmt.Errorf("--echo-delay は正のミリ秒、--echo-decay は0より大きく1未満で指定してください")
+	case *o.toStereo && *o.toMono:
+		return fmt.Errorf("--to-stereo と --to-mono は同時に指定できません")
+	case *o.resample < 0:
+		return fmt.Errorf("--resample は正のサンプリングレート (Hz) で指定してください")
+	case *o.metricsListen != "" && !*o.serveMode:
+		return fmt.Errorf("--metrics-listen は --serve と一緒に指定してください")
+	case *o.workers < 1:
+		return fmt.Errorf("--workers は1以上で指定してください")
+	case *o.gap < 0:
+		return fmt.Errorf("--gap は0以上の秒数で指定してください")
+	case explicit["max-chunk-chars"] && explicit["max-chars"]:
+		return fmt.Errorf("--max-chars は --max-chunk-chars の別名です。どちらか一方を指定してください")
+	case *o.maxChunkChars < 0 || (*o.maxChunkChars > 0 && *o.maxChunkChars < minMaxChunkChars):
+		return fmt.Errorf("--max-chunk-chars は%d以上の文字数 (0で無効) で指定してください", minMaxChunkChars)
+	}
+	return nil
+}
+
+// validateSynthesis はテキストを合成する処理 (-i / --text / --load-query / --query-file) のオプションの組み合わせを確認します。
+// --load-query のサイドカーの値を反映した後に呼びます
+func (o *cliOptions) validateSynthesis(explicit map[string]bool) error {
+	if err := checkOutputTemplate(*o.outputFile, *o.strictOutputName); err != nil {
+		return err
+	}
+	if err := checkEncoding(*o.textEncoding); err != nil {
+		return err
+	}
+	if err := checkNumberMode(*o.numberMode); err != nil {
+		return err
+	}
+	switch {
+	case *o.splitSilence && *o.outputFile == "":
+		return fmt.Errorf("--split-by-silence には -o で出力ファイルを指定してください")
+	case *o.splitSilence && *o.sidecar:
+		return fmt.Errorf("--split-by-silence と --sidecar は同時に指定できません")
+	case *o.splitSilence && (*o.minSilenceMs <= 0 || *o.minChunkMs < 0):
+		return fmt.Errorf("--min-silence-ms は正の値、--min-chunk-ms は0以上で指定してください")
+	case *o.targetDuration < 0:
+		return fmt.Errorf("--target-duration は正の秒数で指定してください")
+	case *o.outputFile == stdioPath && (*o.splitSilence || *o.sidecar || *o.savePartial || *o.keepPartial):
+		return fmt.Errorf("-o - (標準出力への出力) は --split-by-silence / --sidecar / --save-partial / --keep-partial と同時に指定できません")
+	case *o.stream && !*o.split:
+		return fmt.Errorf("--stream は --split と一緒に指定してください")
+	case *o.stream && *o.outputFile == "" && !*o.play:
+		return fmt.Errorf("--stream には -o で出力ファイルを指定してください (標準出力に書き出す場合は -o -、再生だけする場合は --play)")
+	case *o.stream && (*o.analyze || *o.compare != "" || *o.targetDuration > 0 || *o.splitSilence || *o.sidecar || *o.savePartial):
+		return fmt.Errorf("--stream は --analyze / --compare / --target-duration / --split-by-silence / --sidecar / --save-partial と同時に指定できません")
+	case (*o.savePartial || *o.keepPartial) && *o.outputFile == "":
+		return fmt.Errorf("--save-partial / --keep-partial には -o で出力ファイルを指定してください")
+	case *o.stream && (*o.normalize || *o.targetLUFS != 0 || *o.fadeIn > 0 || *o.fadeOut > 0 || *o.echo):
+		return fmt.Errorf("--stream はチャンクごとに書き出すため、全体を見て処理する --normalize / --target-lufs / --fade-in / --fade-out / --echo と同時に指定できません")
+	case (*o.subtitles != "" || *o.phonemes != "") && (*o.splitLinesMode || *o.splitSilence):
+		return fmt.Errorf("--subtitles / --phonemes は1つの音声に合わせて作成するため、--split-lines / --split-by-silence と同時に指定できません")
+	case *o.resume && (*o.outputFile == "" || *o.outputFile == stdioPath):
+		return fmt.Errorf("--resume には -o で出力ファイルを指定してください")
+	case *o.resume && *o.splitLinesMode:
+		return fmt.Errorf("--split-lines は行ごとに保存するため --resume は使えません (保存済みの行は --no-clobber で飛ばせます)")
+	case *o.export != "" && !*o.splitLinesMode:
+		return fmt.Errorf("--export は --split-lines と一緒に指定してください")
+	case *o.filenameTemplate != "" && !*o.splitLinesMode:
+		return fmt.Errorf("--filename-template は --split-lines と一緒に指定してください")
+	case *o.splitLinesMode && (*o.split || *o.markup || *o.stream || *o.splitSilence || *o.sidecar || *o.savePartial || *o.play || *o.compare != "" || *o.analyze || *o.targetDuration > 0):
+		return fmt.Errorf("--split-lines は --split / --markup / --stream / --split-by-silence / --sidecar / --save-partial / --play / --compare / --analyze / --target-duration と同時に指定できません")
+	case *o.splitLinesMode && *o.outputFile == stdioPath:
+		return fmt.Errorf("--split-lines は行ごとにファイルに保存するため、-o - は使えません")
+	case *o.queryFile != "" && (*o.inputFile != "" || explicit["text"] || *o.loadQuery != ""):
+		return fmt.Errorf("--query-file は -i / --text / --load-query と同時に指定できません")
+	case *o.queryFile != "" && (*o.kanaMode || *o.markup || *o.split || *o.splitLinesMode || *o.dialogueMode || *o.sidecar):
+		return fmt.Errorf("--query-file は --kana / --markup / --split / --split-lines / --dialogue / --sidecar と同時に指定できません")
+	case *o.dialogueMode && (*o.kanaMode || *o.loadQuery != "" || *o.sidecar):
+		return fmt.Errorf("--dialogue は --kana / --load-query / --sidecar と同時に指定できません")
+	case *o.ssmlMode && (*o.markup || *o.dialogueMode || *o.kanaMode || *o.queryFile != "" || *o.loadQuery != "" || *o.sidecar):
+		return fmt.Errorf("--ssml は --markup / --dialogue / --kana / --query-file / --load-query / --sidecar と同時に指定できません")
+	case *o.maxChunkChars > 0 && !*o.split:
+		return fmt.Errorf("--max-chunk-chars は --split と一緒に指定してください")
+	case *o.splitOn != "" && !*o.split:
+		return fmt.Errorf("--split-on は --split と一緒に指定してください")
+	case *o.splitOn != "" && *o.kanaMode:
+		return fmt.Errorf("--split-on は --kana と同時に指定できません (AquesTalk記法は行単位で分割します)")
+	case *o.maxChunkChars > 0 && *o.kanaMode:
+		return fmt.Errorf("--max-chunk-chars は --kana と同時に指定できません (AquesTalk記法は行単位で分割します)")
+	case *o.gap > 0 && *o.splitLinesMode:
+		return fmt.Errorf("--split-lines は行ごとに別のファイルに保存するため、--gap は使えません")
+	case *o.jobs < 1:
+		return fmt.Errorf("--jobs は1以上の数で指定してください")
+	case *o.jobs > 1 && !*o.split && !*o.markup && !*o.ssmlMode && *o.queryFile == "":
+		return fmt.Errorf("--jobs はテキストを分割して合成する --split か --markup (または --ssml / --query-file) と一緒に指定してください")
+	}
+	return nil
+}
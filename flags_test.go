@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+// parseTestFlags は新しいフラグセットに defineFlags で定義したフラグで args を解析します
+func parseTestFlags(t *testing.T, args ...string) (*cliOptions, map[string]bool) {
+	t.Helper()
+	saved := flag.CommandLine
+	t.Cleanup(func() { flag.CommandLine = saved })
+	flag.CommandLine = flag.NewFlagSet("text2voicevox", flag.ContinueOnError)
+	o := defineFlags()
+	if err := flag.CommandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	return o, explicit
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string // 空の場合はエラーにならないこと
+	}{
+		{"defaults", nil, ""},
+		{"serve", []string{"--serve", "--max-chunk-chars", "40", "--workers", "2"}, ""},
+		{"serve negative max-chunk-chars", []string{"--serve", "--max-chunk-chars", "-5"}, "--max-chunk-chars は20以上"},
+		{"serve small max-chars", []string{"--serve", "--max-chars", "10"}, "--max-chunk-chars は20以上"},
+		{"max-chars and max-chunk-chars", []string{"--max-chars", "30", "--max-chunk-chars", "30"}, "別名"},
+		{"serve workers", []string{"--serve", "--workers", "0"}, "--workers は1以上"},
+		{"concat negative gap", []string{"--concat", "--gap", "-1", "-o", "out.wav", "a.wav", "b.wav"}, "--gap は0以上"},
+		{"serve speaker-id", []string{"--serve", "--speaker-id", "3"}, "--serve / --interactive では使えません"},
+		{"metrics without serve", []string{"--metrics-listen", ":9090"}, "--serve と一緒に"},
+		{"negative timeout", []string{"--timeout", "-1s"}, "0以上"},
+		{"relative and absolute", []string{"--speed", "1.2", "--speed-rel", "+10%"}, "--speed と --speed-rel"},
+		{"text and input", []string{"--text", "こんにちは", "-i", "in.txt"}, "-i と --text"},
+		{"target lufs", []string{"--target-lufs", "3"}, "--target-lufs は"},
+		{"stereo and mono", []string{"--to-stereo", "--to-mono"}, "同時に指定できません"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, explicit := parseTestFlags(t, tt.args...)
+			err := o.validate(explicit)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("validate(%q) = %v, want no error", tt.args, err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("validate(%q) = %v, want an error containing %q", tt.args, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSynthesis(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"split", []string{"-i", "in.txt", "-o", "out.wav", "--split", "--max-chunk-chars", "40"}, ""},
+		{"max-chunk-chars without split", []string{"-i", "in.txt", "-o", "out.wav", "--max-chunk-chars", "40"}, "--split と一緒に"},
+		{"stream without split", []string{"-i", "in.txt", "-o", "out.wav", "--stream"}, "--stream は --split と一緒に"},
+		{"stream and normalize", []string{"-i", "in.txt", "-o", "out.wav", "--split", "--stream", "--normalize"}, "--normalize"},
+		{"jobs without split", []string{"-i", "in.txt", "-o", "out.wav", "--jobs", "2"}, "--jobs は"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, explicit := parseTestFlags(t, tt.args...)
+			err := o.validateSynthesis(explicit)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("validateSynthesis(%q) = %v, want no error", tt.args, err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("validateSynthesis(%q) = %v, want an error containing %q", tt.args, err, tt.want)
+			}
+		})
+	}
+}
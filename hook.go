@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Hook は合成の前後に実行する外部コマンドです
+type Hook struct {
+	Name    string // メッセージに使う名前 ("--pre-hook" など)
+	Command string // 実行するコマンド。{output} と {input} はパスに置換します
+	Shell   bool   // true の場合はシェル経由で実行します。false の場合は空白で区切って直接実行します
+}
+
+// HookVars はフックのコマンドのプレースホルダに埋め込む値です
+type HookVars struct {
+	Input  string
+	Output string
+}
+
+// command はフックを実行するコマンドを組み立てます。
+// 直接実行する場合は引数ごとにプレースホルダを置換するため、パスに空白や記号が含まれていても1つの引数のまま渡ります。
+// シェル経由の場合は置換する値をクォートします
+func (h Hook) command(vars HookVars) (*exec.Cmd, error) {
+	if h.Shell {
+		line := expandHookVars(h.Command, vars, shellQuote)
+		if runtime.GOOS == "windows" {
+			return exec.Command("cmd", "/C", line), nil
+		}
+		return exec.Command("sh", "-c", line), nil
+	}
+
+	args, err := splitCommandLine(h.Command)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%s のコマンドが空です", h.Name)
+	}
+	for i, arg := range args {
+		args[i] = expandHookVars(arg, vars, func(s string) string { return s })
+	}
+	return exec.Command(args[0], args[1:]...), nil
+}
+
+// run はフックを実行します。コマンドが起動できないか終了コードが0以外の場合はエラーを返します
+func (h Hook) run(vars HookVars) error {
+	cmd, err := h.command(vars)
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s の実行に失敗しました: %v", h.Name, err)
+	}
+	return nil
+}
+
+// runHook はフックが指定されていれば実行します。失敗した場合は、failOnError が true ならエラーを返し、
+// そうでなければ警告を表示して続行します
+func runHook(h Hook, vars HookVars, failOnError bool) error {
+	if h.Command == "" {
+		return nil
+	}
+	err := h.run(vars)
+	if err == nil || failOnError {
+		return err
+	}
+	logWarn("%v", err)
+	return nil
+}
+
+// expandHookVars はコマンド中の {input} と {output} を、quote で変換した値に置換します
+func expandHookVars(s string, vars HookVars, quote func(string) string) string {
+	return strings.NewReplacer("{input}", quote(vars.Input), "{output}", quote(vars.Output)).Replace(s)
+}
+
+// shellQuote はシェルのコマンドラインに埋め込めるよう値をクォートします
+func shellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// splitCommandLine はコマンドを空白で引数に分割します。
+// シングルクォートまたはダブルクォートで囲んだ部分は、空白を含めて1つの引数として扱います
+func splitCommandLine(s string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("コマンドのクォートが閉じられていません: %s", s)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
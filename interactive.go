@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// InteractiveOptions は対話モードの初期設定です
+type InteractiveOptions struct {
+	Actor    string // 最初に使う話者名
+	Params   SynthesisParams
+	KanaMode bool
+	Text     TextOptions
+	Post     PostProcess
+}
+
+// interactiveHelp は対話モードで使えるコマンドの説明です
+const interactiveHelp = `入力した行を合成して再生します。空行、exit、quit で終了します。
+コマンド:
+  :actor 話者名      話者を切り替えます
+  :speed 1.2         パラメータを変更します (speed, pitch, intonation, volume, pre-phoneme, post-phoneme)
+  :params            現在の話者とパラメータを表示します
+  :replay            直前の音声をもう一度再生します
+  :help              このヘルプを表示します`
+
+// interactiveSession は対話モードの状態です。話者の検索結果はキャッシュし、切り替えた話者は初期化しておきます
+type interactiveSession struct {
+	client   *Client
+	speakers *speakerCache
+	opts     InteractiveOptions
+	speaker  *SpeakerSelection
+	params   SynthesisParams
+	last     []byte // 直前に合成した音声
+}
+
+// runInteractive は標準入力から1行ずつ読み込み、合成して再生するループを実行します
+func runInteractive(client *Client, speakers *speakerCache, opts InteractiveOptions) error {
+	if _, err := playerCommand(""); err != nil {
+		return err
+	}
+	s := &interactiveSession{client: client, speakers: speakers, opts: opts, params: opts.Params}
+	if err := s.switchActor(opts.Actor); err != nil {
+		return err
+	}
+	fmt.Println(":help でコマンドの一覧を表示します。空行か exit で終了します。")
+	return s.loop(os.Stdin)
+}
+
+// loop は入力が終わるか終了の指示があるまで、行を読んで処理します
+func (s *interactiveSession) loop(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Printf("%s> ", s.speaker.Speaker.Name)
+		if !scanner.Scan() {
+			fmt.Println()
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		switch line {
+		case "", "exit", "quit":
+			return nil
+		}
+
+		var err error
+		if strings.HasPrefix(line, ":") {
+			err = s.command(line[1:])
+		} else {
+			err = s.speak(line)
+		}
+		if err != nil {
+			// 1行の失敗でループを終えず、次の入力を受け付けます
+			logError(err)
+		}
+	}
+}
+
+// command は : で始まるコマンドを実行します
+func (s *interactiveSession) command(line string) error {
+	name, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case "help":
+		fmt.Println(interactiveHelp)
+		return nil
+	case "actor":
+		if arg == "" {
+			return fmt.Errorf(":actor の後に話者名を指定してください")
+		}
+		return s.switchActor(arg)
+	case "params":
+		fmt.Printf("話者: %s (スタイル: %s, ID: %d)\n", s.speaker.Speaker.Name, s.speaker.Style.Name, s.speaker.Style.ID)
+		fmt.Printf("上書きするパラメータ: %s\n", s.params.describe())
+		return nil
+	case "replay":
+		if s.last == nil {
+			return fmt.Errorf("まだ音声を合成していません")
+		}
+		return playWAV(s.last)
+	}
+
+	for _, param := range paramNames {
+		if name != param {
+			continue
+		}
+		v, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Errorf(":%s の値 '%s' が数値ではありません", name, arg)
+		}
+		s.params.set(name, v)
+		fmt.Printf("%s を %g に変更しました。\n", name, v)
+		return nil
+	}
+	return fmt.Errorf("未知のコマンドです: :%s (:help で一覧を表示します)", name)
+}
+
+// switchActor は話者を切り替え、エンジンに話者を初期化させます。切り替え後の話者名はプロンプトに表示します
+func (s *interactiveSession) switchActor(name string) error {
+	selection, err := s.speakers.find(name)
+	if err != nil {
+		return err
+	}
+	if err := s.client.InitializeSpeaker(selection.Style.ID); err != nil {
+		return err
+	}
+	s.speaker = selection
+	return nil
+}
+
+// speak は1行のテキストを合成して再生します
+func (s *interactiveSession) speak(line string) error {
+	text := preprocessText(line, s.opts.Text)
+	wav, err := synthesizeSegments(s.client, []Segment{{Text: text}}, s.speaker.Style.ID, s.opts.KanaMode, s.params, true)
+	if err != nil {
+		return err
+	}
+	if wav, err = s.opts.Post.apply(wav); err != nil {
+		return err
+	}
+	s.last = wav
+	return playWAV(wav)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// interruptContext は Ctrl+C (SIGINT) と SIGTERM でキャンセルされる context を返します。
+// 1回目のシグナルで送信中のリクエストを中断し、後片付けをしてから終了できるようにします。
+// 後片付けが止まった場合に備えて、2回目のシグナルでは通常どおりすぐに終了します
+func interruptContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sig:
+			signal.Stop(sig)
+			logWarn("中断しています... (もう一度 Ctrl+C を押すとすぐに終了します)")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sig)
+		cancel()
+	}
+}
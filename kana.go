@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// KanaError はAquesTalk風記法のkanaの誤りを、入力中の位置とともに表します
+type KanaError struct {
+	Line   int // 1始まりの行番号
+	Column int // 1始まりの文字位置
+	Msg    string
+}
+
+func (e *KanaError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("kanaの記法が正しくありません: %s", e.Msg)
+	}
+	return fmt.Sprintf("kanaの記法が正しくありません (%d行目 %d文字目): %s", e.Line, e.Column, e.Msg)
+}
+
+// kanaErrorMessages はエンジンが返すkanaの解析エラー名を説明文に対応付けます
+var kanaErrorMessages = map[string]string{
+	"UNKNOWN_TEXT":                  "判別できない読み仮名があります",
+	"ACCENT_TOP":                    "句頭にアクセントは置けません",
+	"ACCENT_TWICE":                  "1つのアクセント句に二つ以上のアクセントは置けません",
+	"ACCENT_NOTFOUND":               "アクセントを指定していないアクセント句があります",
+	"EMPTY_PHRASE":                  "空のアクセント句があります",
+	"INTERROGATION_MARK_NOT_AT_END": "アクセント句末以外に「？」は置けません",
+	"INFINITE_LOOP":                 "処理時に無限ループになってしまいました",
+}
+
+// isKanaRune はAquesTalk風記法で読み仮名として使える文字かどうかを返します
+func isKanaRune(r rune) bool {
+	return (r >= 'ァ' && r <= 'ヴ') || r == 'ー'
+}
+
+// prepareKana はkana入力を検証し、エンジンに渡す1行のkanaに変換します。
+// 各行はアクセント句の並びとして扱い、行の区切りは読点（ポーズ）に置き換えます
+func prepareKana(text string) (string, error) {
+	var lines []string
+	for i, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if kerr := validateKanaLine(line); kerr != nil {
+			kerr.Line = i + 1
+			return "", kerr
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return "", &KanaError{Msg: "kanaが空です"}
+	}
+	return strings.Join(lines, "、"), nil
+}
+
+// validateKanaLine は1行分のkanaをアクセント句ごとに検証します
+func validateKanaLine(line string) *KanaError {
+	phraseStart := 1 // アクセント句の先頭の文字位置
+	col := 0
+	accents, moras := 0, 0
+	interrogative := false
+
+	endPhrase := func() *KanaError {
+		switch {
+		case moras == 0:
+			return &KanaError{Column: phraseStart, Msg: kanaErrorMessages["EMPTY_PHRASE"]}
+		case accents == 0:
+			return &KanaError{Column: phraseStart, Msg: kanaErrorMessages["ACCENT_NOTFOUND"]}
+		}
+		return nil
+	}
+
+	for _, r := range line {
+		col++
+		switch {
+		case r == '/' || r == '、':
+			if err := endPhrase(); err != nil {
+				return err
+			}
+			phraseStart = col + 1
+			accents, moras = 0, 0
+			interrogative = false
+		case interrogative:
+			return &KanaError{Column: col - 1, Msg: kanaErrorMessages["INTERROGATION_MARK_NOT_AT_END"]}
+		case r == '\'':
+			if moras == 0 {
+				return &KanaError{Column: col, Msg: kanaErrorMessages["ACCENT_TOP"]}
+			}
+			accents++
+			if accents > 1 {
+				return &KanaError{Column: col, Msg: kanaErrorMessages["ACCENT_TWICE"]}
+			}
+		case r == '_':
+			// 無声化の記号。直後の読み仮名に掛かります
+		case r == '？' || r == '?':
+			interrogative = true
+		case isKanaRune(r):
+			moras++
+		default:
+			return &KanaError{Column: col, Msg: fmt.Sprintf("%s: '%c' (カタカナで記述してください)", kanaErrorMessages["UNKNOWN_TEXT"], r)}
+		}
+	}
+	return endPhrase()
+}
+
+// kanaParseErrorDetail はエンジンがkanaの解析に失敗したときのエラー詳細を表します
+type kanaParseErrorDetail struct {
+	Detail struct {
+		Text      string            `json:"text"`
+		ErrorName string            `json:"error_name"`
+		ErrorArgs map[string]string `json:"error_args"`
+	} `json:"detail"`
+}
+
+// locateKanaError はエンジンが返したkanaの解析エラーを、元の入力中の位置を含むエラーに変換します。
+// kanaの解析エラーでない場合は err をそのまま返します
+func locateKanaError(original string, err error) error {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	var resp kanaParseErrorDetail
+	if jsonErr := json.Unmarshal([]byte(apiErr.Body), &resp); jsonErr != nil || resp.Detail.ErrorName == "" {
+		return err
+	}
+
+	msg, ok := kanaErrorMessages[resp.Detail.ErrorName]
+	if !ok {
+		msg = resp.Detail.Text
+	}
+	kerr := &KanaError{Msg: msg}
+
+	// 問題のあるアクセント句が分かれば、元の入力から位置を探します
+	if phrase := resp.Detail.ErrorArgs["text"]; phrase != "" {
+		kerr.Msg += fmt.Sprintf(" ('%s')", phrase)
+		for i, line := range strings.Split(original, "\n") {
+			if idx := strings.Index(line, phrase); idx >= 0 {
+				kerr.Line = i + 1
+				kerr.Column = utf8.RuneCountInString(line[:idx]) + 1
+				break
+			}
+		}
+	}
+	return kerr
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// maxLineNameRunes は --filename-template の {text} に使う行の先頭の文字数です
+const maxLineNameRunes = 20
+
+// defaultLineTemplate は --filename-template を省略した場合のファイル名を、-o の出力名に連番を付けて作ります
+// (out.wav なら out_{index}.wav)
+func defaultLineTemplate(output string) string {
+	ext := filepath.Ext(output)
+	return strings.TrimSuffix(output, ext) + "_{index}" + ext
+}
+
+// lineOutputName は --split-lines のファイル名テンプレートの {index} (4桁の連番) と {text} (行の先頭) を置換します。
+// そのほかのプレースホルダは expandOutputName で置換します
+func lineOutputName(tmpl string, index int, text string) string {
+	return strings.NewReplacer(
+		"{index}", fmt.Sprintf("%04d", index),
+		"{text}", lineNamePart(text),
+	).Replace(tmpl)
+}
+
+// lineNamePart は行の先頭を、ファイル名に使えない文字と空白を _ に置き換えて切り出します
+func lineNamePart(text string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range text {
+		if n >= maxLineNameRunes {
+			break
+		}
+		if unicode.IsSpace(r) || unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|{}`, r) {
+			r = '_'
+		}
+		b.WriteRune(r)
+		n++
+	}
+	return b.String()
+}
+
+// lineManifestEntries は --split-lines の各行を、マニフェストのエントリとして合成できるようにします。
+// --dialogue の台本で指定された話者は、エントリの話者にします
+func lineManifestEntries(segments []Segment, tmpl string) []ManifestEntry {
+	entries := make([]ManifestEntry, len(segments))
+	for i, seg := range segments {
+		entries[i] = ManifestEntry{Text: seg.Text, Actor: seg.Actor, Output: lineOutputName(tmpl, i+1, seg.Text), Index: i + 1}
+	}
+	return entries
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+// phonemeFormat は音素のタイミングを保存するファイルの拡張子から形式 (lab, json) を判定します
+func phonemeFormat(path string) (string, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".lab", ".json":
+		return ext[1:], nil
+	}
+	return "", fmt.Errorf("--phonemes の拡張子は .lab か .json にしてください: %s", path)
+}
+
+// chunkPhonemes は区間ごとのクエリと合成した長さから、結合した音声全体での音素の時刻を返します。
+// クエリから求めた長さは合成結果とわずかにずれるため、区間ごとに合成結果の長さに合わせて伸縮します。
+// 無音区間と無音で埋めたチャンクは "pau" にし、続けて並ぶ "pau" は1つにまとめます
+func chunkPhonemes(timings []ChunkTiming) []Phoneme {
+	var phonemes []Phoneme
+	add := func(p Phoneme) {
+		if n := len(phonemes); n > 0 && p.Phoneme == "pau" && phonemes[n-1].Phoneme == "pau" {
+			phonemes[n-1].End = p.End
+			return
+		}
+		phonemes = append(phonemes, p)
+	}
+
+	pos := 0.0
+	for _, timing := range timings {
+		start, length := pos, timing.Duration.Seconds()
+		pos += length
+		var chunk []Phoneme
+		if timing.Query != nil {
+			chunk = timing.Query.Phonemes()
+		}
+		if len(chunk) == 0 || chunk[len(chunk)-1].End <= 0 {
+			add(Phoneme{Phoneme: "pau", Start: start, End: pos})
+			continue
+		}
+		scale := length / chunk[len(chunk)-1].End
+		for _, p := range chunk {
+			// 無声化した母音 (I, U など) も口の形は同じため、リップシンク向けに小文字にします
+			if len(p.Phoneme) == 1 && strings.Contains("AIUEO", p.Phoneme) {
+				p.Phoneme = strings.ToLower(p.Phoneme)
+			}
+			add(Phoneme{Phoneme: p.Phoneme, Start: start + p.Start*scale, End: start + p.End*scale})
+		}
+	}
+	return phonemes
+}
+
+// formatLab は音素の時刻を、HTK形式のラベル (1行に「開始 終了 音素」、時刻は100ナノ秒単位) にします
+func formatLab(phonemes []Phoneme) []byte {
+	var b strings.Builder
+	for _, p := range phonemes {
+		fmt.Fprintf(&b, "%d %d %s\n", int64(math.Round(p.Start*1e7)), int64(math.Round(p.End*1e7)), p.Phoneme)
+	}
+	return []byte(b.String())
+}
+
+// writePhonemes は区間ごとのクエリと長さから求めた音素の時刻を、path の拡張子の形式で保存します
+func writePhonemes(path string, timings []ChunkTiming, mkdir bool) error {
+	format, err := phonemeFormat(path)
+	if err != nil {
+		return err
+	}
+	phonemes := chunkPhonemes(timings)
+	var data []byte
+	if format == "lab" {
+		data = formatLab(phonemes)
+	} else {
+		for i := range phonemes {
+			// 秒の端数が長くならないよう、ミリ秒単位に丸めます
+			phonemes[i].Start = math.Round(phonemes[i].Start*1000) / 1000
+			phonemes[i].End = math.Round(phonemes[i].End*1000) / 1000
+		}
+		if phonemes == nil {
+			phonemes = []Phoneme{}
+		}
+		if data, err = json.MarshalIndent(phonemes, "", "  "); err != nil {
+			return fmt.Errorf("音素のタイミングのJSON変換に失敗しました: %v", err)
+		}
+		data = append(data, '\n')
+	}
+	if err := writeOutputFile(path, data, mkdir); err != nil {
+		return err
+	}
+	logInfo("音素のタイミングを '%s' に保存しました。", path)
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Pikka2048/text2voicevox/voicevox"
+)
+
+// logFormats は --log-format に指定できる形式です
+var logFormats = []string{"text", "json"}
+
+// logger は処理の状況・警告・エラーを表示するロガーです。
+// 一覧や結果の表など、コマンドの出力そのものは fmt で標準出力に書き出します
+var logger = slog.New(&consoleHandler{level: slog.LevelInfo})
+
+// setupLogger は --log-format と --quiet / --verbose からロガーを設定します。
+// quiet ならエラーだけを、verbose ならリクエストの所要時間などの詳細も表示します
+func setupLogger(format string, quiet, verbose bool) error {
+	level := slog.LevelInfo
+	switch {
+	case quiet:
+		level = slog.LevelError
+	case verbose:
+		level = slog.LevelDebug
+	}
+	switch format {
+	case "", "text":
+		logger = slog.New(&consoleHandler{level: level})
+	case "json":
+		logger = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	default:
+		return fmt.Errorf("--log-format は %s のいずれかを指定してください", strings.Join(logFormats, ", "))
+	}
+	return nil
+}
+
+// logInfo は処理の状況を表示します
+func logInfo(format string, args ...interface{}) {
+	logger.Info(fmt.Sprintf(format, args...))
+}
+
+// logDebug は --verbose の場合だけ表示する詳細な情報を表示します
+func logDebug(format string, args ...interface{}) {
+	logger.Debug(fmt.Sprintf(format, args...))
+}
+
+// logWarn は処理を続けられる問題を表示します
+func logWarn(format string, args ...interface{}) {
+	logger.Warn(fmt.Sprintf(format, args...))
+}
+
+// logError は処理を続けられないエラーを表示します
+func logError(err error) {
+	logger.Error(errorMessage(err))
+}
+
+// consoleHandler は --log-format text のハンドラーです。これまでの表示に合わせ、
+// 情報は標準出力に、警告とエラーは「警告: 」「エラー: 」を付けて標準エラー出力に書き出します。
+// 属性は「key=value」の形でメッセージの後ろに付けます
+type consoleHandler struct {
+	level slog.Level
+	attrs []slog.Attr
+}
+
+// consoleMu は並行して合成するチャンクのログが混ざらないようにします
+var consoleMu sync.Mutex
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *consoleHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	// -o - の場合に標準出力を標準エラー出力に付け替えるため、書き出す時点の os.Stdout を使います
+	var out io.Writer = os.Stdout
+	switch {
+	case r.Level >= slog.LevelError:
+		out = os.Stderr
+		b.WriteString("エラー: ")
+	case r.Level >= slog.LevelWarn:
+		out = os.Stderr
+		b.WriteString("警告: ")
+	}
+	b.WriteString(r.Message)
+	writeAttr := func(a slog.Attr) bool {
+		fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+		return true
+	}
+	for _, a := range h.attrs {
+		writeAttr(a)
+	}
+	r.Attrs(writeAttr)
+	b.WriteString("\n")
+	consoleMu.Lock()
+	defer consoleMu.Unlock()
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &consoleHandler{level: h.level, attrs: append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...)}
+}
+
+// WithGroup はグループを使わないため、同じハンドラーを返します
+func (h *consoleHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// loggingDoer は --verbose で、エンジンへのリクエストごとにステータスコードと応答までの時間を表示します
+type loggingDoer struct {
+	voicevox.Doer
+}
+
+func (d loggingDoer) Do(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := d.Doer.Do(req)
+	elapsed := time.Since(start).Milliseconds()
+	if err != nil {
+		logger.Debug("リクエストに失敗しました", "method", req.Method, "path", req.URL.Path, "elapsed_ms", elapsed, "error", err)
+		return nil, err
+	}
+	logger.Debug("エンジンの応答", "method", req.Method, "path", req.URL.Path, "status", resp.StatusCode, "elapsed_ms", elapsed)
+	return resp, nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// ITU-R BS.1770 のラウドネス測定の定数です
+const (
+	lufsBlockMs        = 400   // ゲーティングのブロック長 (ミリ秒)
+	lufsStepMs         = 100   // ブロックの間隔 (75% 重複)
+	lufsAbsoluteGate   = -70.0 // 絶対ゲート (LUFS)
+	lufsRelativeGate   = -10.0 // 相対ゲート (LU)
+	lufsOffset         = -0.691
+	truePeakOversample = 4 // トゥルーピークの推定に使うオーバーサンプリングの倍率
+	truePeakTaps       = 8 // 補間に使う前後のサンプル数
+)
+
+// limiterLookaheadMs と limiterReleaseMs はトゥルーピークのリミッタの先読みとリリースの時間 (ミリ秒) です
+const (
+	limiterLookaheadMs = 5
+	limiterReleaseMs   = 50
+)
+
+// biquad は2次のIIRフィルタです
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// kWeighting は BS.1770 のK特性フィルタ (高域のシェルビングと低域のハイパス) を sampleRate 用に設計します。
+// 係数は 48kHz の規格値と一致するよう、アナログのプロトタイプから双一次変換で求めます
+func kWeighting(sampleRate float64) []*biquad {
+	// 1段目: 頭部の影響を模した高域のシェルビングフィルタ
+	f0, gain, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / sampleRate)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := &biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	// 2段目: RLB特性のハイパスフィルタ
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / sampleRate)
+	a0 = 1 + k/q + k*k
+	highpass := &biquad{
+		b0: 1, b1: -2, b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return []*biquad{shelf, highpass}
+}
+
+// measureLUFS は16bit PCMのWAVの統合ラウドネス (integrated LUFS) を ITU-R BS.1770 に従って測定します。
+// K特性フィルタを通した 400ms のブロックごとのラウドネスを、絶対ゲート (-70 LUFS) と相対ゲート (-10 LU) で選別して平均します。
+// 無音などゲートを通るブロックが無い場合は -Inf を返します
+func measureLUFS(b []byte) (float64, error) {
+	wav, err := parsePCM16(b)
+	if err != nil {
+		return 0, err
+	}
+	channels := max(int(wav.Format.Channels), 1)
+	rate := int(wav.Format.SampleRate)
+	if rate == 0 {
+		return 0, fmt.Errorf("サンプリングレートが不正です")
+	}
+	samples := decodeSamples16(wav.Data)
+	frames := len(samples) / channels
+
+	// チャンネルごとにK特性フィルタを通した二乗値の累積和を求め、ブロックの平均二乗値を差分で計算します
+	cumulative := make([]float64, frames+1)
+	for ch := 0; ch < channels; ch++ {
+		filters := kWeighting(float64(rate))
+		var sum float64
+		for i := 0; i < frames; i++ {
+			v := float64(samples[i*channels+ch]) / (maxSample16 + 1)
+			for _, f := range filters {
+				v = f.process(v)
+			}
+			sum += v * v
+			cumulative[i+1] += sum
+		}
+	}
+
+	block := rate * lufsBlockMs / 1000
+	step := rate * lufsStepMs / 1000
+	if frames < block {
+		// ブロック長に満たない短い音声は全体を1ブロックとして測定します
+		block = frames
+	}
+	if block == 0 {
+		return math.Inf(-1), nil
+	}
+	var powers []float64
+	for start := 0; start+block <= frames; start += step {
+		power := (cumulative[start+block] - cumulative[start]) / float64(block)
+		if blockLoudness(power) > lufsAbsoluteGate {
+			powers = append(powers, power)
+		}
+	}
+	if len(powers) == 0 {
+		return math.Inf(-1), nil
+	}
+
+	gate := blockLoudness(meanOf(powers)) + lufsRelativeGate
+	var gated []float64
+	for _, p := range powers {
+		if blockLoudness(p) > gate {
+			gated = append(gated, p)
+		}
+	}
+	return blockLoudness(meanOf(gated)), nil
+}
+
+// blockLoudness はブロックの平均二乗値 (全チャンネルの和) をラウドネス (LUFS) に換算します
+func blockLoudness(power float64) float64 {
+	if power <= 0 {
+		return math.Inf(-1)
+	}
+	return lufsOffset + 10*math.Log10(power)
+}
+
+func meanOf(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// truePeakInterpolator はサンプルの間の値を窓付きsinc関数で補間する係数です。
+// [phase][tap] は phase/truePeakOversample だけ進んだ位置を、前後 truePeakTaps 個のサンプルから求める係数です
+var truePeakInterpolator = func() [][]float64 {
+	coeffs := make([][]float64, truePeakOversample)
+	for phase := range coeffs {
+		coeffs[phase] = make([]float64, 2*truePeakTaps)
+		offset := float64(phase) / truePeakOversample
+		for tap := range coeffs[phase] {
+			x := offset - float64(tap-truePeakTaps+1)
+			window := 0.5 + 0.5*math.Cos(math.Pi*x/truePeakTaps)
+			coeffs[phase][tap] = sinc(x) * window
+		}
+	}
+	return coeffs
+}()
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// framePeaks はフレームごとに、そのフレームから次のフレームまでの区間のトゥルーピーク (振幅 0〜1、全チャンネルの最大) を推定します。
+// 4倍にオーバーサンプリングした値で、サンプルの間で 0dBFS を超えるピークも検出します
+func framePeaks(samples []int16, channels int) []float64 {
+	frames := len(samples) / channels
+	peaks := make([]float64, frames)
+	for ch := 0; ch < channels; ch++ {
+		at := func(i int) float64 {
+			if i < 0 || i >= frames {
+				return 0
+			}
+			return float64(samples[i*channels+ch]) / maxSample16
+		}
+		for i := 0; i < frames; i++ {
+			peak := math.Abs(at(i))
+			for phase := 1; phase < truePeakOversample; phase++ {
+				var v float64
+				for tap, c := range truePeakInterpolator[phase] {
+					v += c * at(i+tap-truePeakTaps+1)
+				}
+				peak = max(peak, math.Abs(v))
+			}
+			peaks[i] = max(peaks[i], peak)
+		}
+	}
+	return peaks
+}
+
+// measureTruePeak は16bit PCMのWAVのトゥルーピーク (dBTP) を推定します
+func measureTruePeak(b []byte) (float64, error) {
+	wav, err := parsePCM16(b)
+	if err != nil {
+		return 0, err
+	}
+	peak := 0.0
+	for _, p := range framePeaks(decodeSamples16(wav.Data), max(int(wav.Format.Channels), 1)) {
+		peak = max(peak, p)
+	}
+	return toDBFS(peak), nil
+}
+
+// normalizeLUFS は16bit PCMのWAVの統合ラウドネスが targetLUFS になるようゲインを掛けます。
+// ゲインを掛けた結果のトゥルーピークが ceilingDB (dBTP) を超える部分は、先読み付きのリミッタで抑えます
+func normalizeLUFS(b []byte, targetLUFS, ceilingDB float64) ([]byte, error) {
+	loudness, err := measureLUFS(b)
+	if err != nil {
+		return nil, err
+	}
+	if math.IsInf(loudness, -1) {
+		// 無音はそのまま返します
+		return b, nil
+	}
+	wav, err := parsePCM16(b)
+	if err != nil {
+		return nil, err
+	}
+	channels := max(int(wav.Format.Channels), 1)
+	samples := decodeSamples16(wav.Data)
+	gain := fromDBFS(targetLUFS - loudness)
+	gains := limiterGains(framePeaks(samples, channels), gain, fromDBFS(ceilingDB), int(wav.Format.SampleRate))
+	for i, s := range samples {
+		samples[i] = clampSample16(float64(s) * gains[i/channels])
+	}
+	return encodeWAV(wav.Format, encodeSamples16(samples)), nil
+}
+
+// limiterGains はフレームごとに掛けるゲインを返します。gain を掛けたトゥルーピークが ceiling を超えるフレームでは、
+// 超えない値までゲインを下げます。急な変化でノイズが出ないよう、先読みの区間で徐々に下げ、リリースの時間で徐々に戻します
+func limiterGains(peaks []float64, gain, ceiling float64, sampleRate int) []float64 {
+	frames := len(peaks)
+	need := make([]float64, frames)
+	for i, p := range peaks {
+		need[i] = gain
+		if p*gain > ceiling {
+			need[i] = ceiling / p
+		}
+	}
+
+	// 先読みの区間の最小値を、同じ長さの移動平均で滑らかにします。
+	// 平均するどの値も、そのフレームを含む区間の最小値のため、結果は need を超えません
+	lookahead := max(sampleRate*limiterLookaheadMs/1000, 1)
+	windowMin := make([]float64, frames)
+	// 後ろから走査し、区間内で値が増加する順にフレーム番号を保持して最小値を求めます
+	var deque []int
+	for i := frames - 1; i >= 0; i-- {
+		for len(deque) > 0 && need[deque[len(deque)-1]] >= need[i] {
+			deque = deque[:len(deque)-1]
+		}
+		deque = append(deque, i)
+		if deque[0] >= i+lookahead {
+			deque = deque[1:]
+		}
+		windowMin[i] = need[deque[0]]
+	}
+	gains := make([]float64, frames)
+	var sum float64
+	release := 1 - math.Exp(-1/(float64(sampleRate)*limiterReleaseMs/1000))
+	prev := gain
+	for i := range windowMin {
+		sum += windowMin[i]
+		if i >= lookahead {
+			sum -= windowMin[i-lookahead]
+		}
+		smoothed := sum / float64(min(i+1, lookahead))
+		// ゲインを戻すときはリリースの時間で徐々に戻します
+		g := min(smoothed, prev+(gain-prev)*release)
+		gains[i] = g
+		prev = g
+	}
+	return gains
+}
@@ -1,111 +1,161 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"os"
-	"strconv"
+	"sort"
+	"strings"
 	"time"
-)
 
-// AudioQuery は /audio_query のレスポンスを表します
-type AudioQuery struct {
-	AccentPhrases      []interface{} `json:"accent_phrases"`
-	SpeedScale         float64       `json:"speedScale"`
-	PitchScale         float64       `json:"pitchScale"`
-	IntonationScale    float64       `json:"intonationScale"`
-	VolumeScale        float64       `json:"volumeScale"`
-	PrePhonemeLength   float64       `json:"prePhonemeLength"`
-	PostPhonemeLength  float64       `json:"postPhonemeLength"`
-	OutputSamplingRate int           `json:"outputSamplingRate"`
-	OutputStereo       bool          `json:"outputStereo"`
-	Kana               string        `json:"kana"`
-}
+	"github.com/Pikka2048/text2voicevox/voicevox"
+)
 
-// Speaker は /speakers のレスポンスに含まれる話者情報を表します
-type Speaker struct {
-	Name        string         `json:"name"`
-	SpeakerUUID string         `json:"speaker_uuid"`
-	Styles      []SpeakerStyle `json:"styles"`
-	Version     string         `json:"version"`
-}
+// VOICEVOX APIの型は voicevox パッケージで定義しています
+type (
+	AudioQuery       = voicevox.AudioQuery
+	Speaker          = voicevox.Speaker
+	SpeakerStyle     = voicevox.SpeakerStyle
+	SpeakerInfo      = voicevox.SpeakerInfo
+	SupportedDevices = voicevox.SupportedDevices
+	EngineManifest   = voicevox.EngineManifest
+	Preset           = voicevox.Preset
+	UserDictWord     = voicevox.UserDictWord
+	WordParams       = voicevox.WordParams
+	Phoneme          = voicevox.Phoneme
+)
 
-// SpeakerStyle は話者のスタイル（ノーマル、あまあま等）を表します
-type SpeakerStyle struct {
-	Name string `json:"name"`
-	ID   int    `json:"id"`
+// SpeakerSelection は話者名から解決した話者とスタイルを表します
+type SpeakerSelection struct {
+	Speaker Speaker
+	Style   SpeakerStyle
 }
 
 // --- VOICEVOX APIクライアント ---
 
-// Client はVOICEVOX APIとの通信を管理します
+// Client はCLIで使うAPIクライアントです。
+// APIとの通信は voicevox.Client が行い、話者名の解決に使う設定をここで持ちます
 type Client struct {
-	BaseURL string
+	*voicevox.Client
+	StyleType string            // 話者を選ぶときに使うスタイルのタイプ。空の場合は talk を優先します
+	Style     string            // 話者を選ぶときに使うスタイル名。空の場合は StyleType に従って選びます
+	Aliases   map[string]string // 話者のエイリアスから実名への対応
+	ctx       context.Context   // リクエストに使う context。nil の場合は context.Background を使います
 }
 
 // NewClient は新しいAPIクライアントを作成します
 func NewClient(port int) *Client {
-	return &Client{
-		BaseURL: fmt.Sprintf("http://localhost:%d", port),
-	}
+	return &Client{Client: voicevox.NewClient(port)}
 }
 
-// findSpeakerID は話者名から話者IDを検索します
-func (c *Client) findSpeakerID(name string) (int, error) {
-	resp, err := http.Get(c.BaseURL + "/speakers")
+// newHTTPClient はタイムアウト (0 なら無制限) を設定したHTTPクライアントを作成します
+func newHTTPClient(timeout time.Duration, insecure bool) *http.Client {
+	return voicevox.NewHTTPClient(timeout, insecure)
+}
+
+// findSpeaker は話者名から話者とスタイルを検索します。
+// exact が false の場合、完全一致する話者が無ければ前方一致・部分一致で一意に決まる話者を使います
+func (c *Client) findSpeaker(name string, exact bool) (*SpeakerSelection, error) {
+	return c.findSpeakerStyle(name, "", exact)
+}
+
+// findSpeakerStyle は findSpeaker と同じく話者を検索し、style が空でなければ --style の代わりにそのスタイルを選びます
+func (c *Client) findSpeakerStyle(name, style string, exact bool) (*SpeakerSelection, error) {
+	speakers, err := c.Speakers()
 	if err != nil {
-		return 0, fmt.Errorf("VOICEVOXエンジンに接続できませんでした: %v\nエンジンが起動しているか、ポート番号が正しいか確認してください", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("話者情報の取得に失敗しました (ステータスコード: %d)", resp.StatusCode)
+	if style == "" {
+		style = c.Style
 	}
+	return selectSpeaker(speakers, c.resolveAlias(name), exact, c.StyleType, style)
+}
 
-	var speakers []Speaker
-	if err := json.NewDecoder(resp.Body).Decode(&speakers); err != nil {
-		return 0, fmt.Errorf("話者情報のデコードに失敗しました: %v", err)
+// selectSpeaker は取得済みの話者一覧から、名前で話者とスタイルを選びます。
+// exact が false の場合、完全一致する話者が無ければ前方一致・部分一致で一意に決まる話者を選びます。
+// styleName が空でなければ、その名前のスタイルを findStyle で選びます
+func selectSpeaker(speakers []Speaker, name string, exact bool, styleType, styleName string) (*SpeakerSelection, error) {
+	var found *Speaker
+	for i, speaker := range speakers {
+		if speaker.Name == name && len(speaker.Styles) > 0 {
+			found = &speakers[i]
+			break
+		}
 	}
 
-	for _, speaker := range speakers {
-		if speaker.Name == name {
-			if len(speaker.Styles) > 0 {
-				fmt.Printf("話者 '%s' (スタイル: %s, ID: %d) を使用します。\n", speaker.Name, speaker.Styles[0].Name, speaker.Styles[0].ID)
-				return speaker.Styles[0].ID, nil
-			}
+	if found == nil && !exact {
+		matches := matchSpeakers(speakers, name)
+		if len(matches) > 1 {
+			return nil, &SpeakerNotFoundError{Name: name, Candidates: speakerNames(matches)}
+		}
+		if len(matches) == 1 && len(matches[0].Styles) > 0 {
+			found = &matches[0]
+			logInfo("'%s' に部分一致した話者 '%s' を使用します。", name, found.Name)
 		}
 	}
 
-	return 0, fmt.Errorf("指定された話者 '%s' が見つかりませんでした", name)
-}
+	if found == nil {
+		return nil, &SpeakerNotFoundError{Name: name, Suggestions: suggestSpeakers(speakers, name, 3)}
+	}
 
-// listSpeakers は利用可能な話者の一覧を表示します
-func (c *Client) listSpeakers() error {
-	resp, err := http.Get(c.BaseURL + "/speakers")
-	if err != nil {
-		return fmt.Errorf("VOICEVOXエンジンに接続できませんでした: %v", err)
+	var style SpeakerStyle
+	if styleName != "" {
+		var err error
+		if style, err = findStyle(*found, styleName, styleType); err != nil {
+			return nil, err
+		}
+	} else {
+		var ok bool
+		if style, ok = selectStyle(found.Styles, styleType); !ok {
+			return nil, &SpeakerNotFoundError{Name: found.Name, StyleType: styleType}
+		}
 	}
-	defer resp.Body.Close()
+	logInfo("話者 '%s' (スタイル: %s, ID: %d) を使用します。", found.Name, style.Name, style.ID)
+	return &SpeakerSelection{Speaker: *found, Style: style}, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("話者情報の取得に失敗しました (ステータスコード: %d)", resp.StatusCode)
+// listSpeakers は利用可能な話者の一覧を、指定に従って絞り込み・並べ替えて表示します
+func (c *Client) listSpeakers(opts SpeakerListOptions) error {
+	speakers, err := c.Speakers()
+	if err != nil {
+		return err
 	}
+	speakers = filterSpeakers(speakers, opts)
 
-	var speakers []Speaker
-	if err := json.NewDecoder(resp.Body).Decode(&speakers); err != nil {
-		return fmt.Errorf("話者情報のデコードに失敗しました: %v", err)
+	if opts.JSON {
+		if speakers == nil {
+			speakers = []Speaker{}
+		}
+		out, err := json.MarshalIndent(speakers, "", "  ")
+		if err != nil {
+			return fmt.Errorf("話者一覧のJSON変換に失敗しました: %v", err)
+		}
+		fmt.Println(string(out))
+		return nil
 	}
 
 	fmt.Println("--- 利用可能な話者一覧 ---")
+	if len(speakers) == 0 {
+		fmt.Println("(条件に一致する話者はいません)")
+	}
 	for _, speaker := range speakers {
-		fmt.Printf("話者名: %s\n", speaker.Name)
+		if speaker.Version != "" {
+			fmt.Printf("話者名: %s (バージョン: %s)\n", speaker.Name, speaker.Version)
+		} else {
+			fmt.Printf("話者名: %s\n", speaker.Name)
+		}
 		for _, style := range speaker.Styles {
-			fmt.Printf("  - スタイル: %s (ID: %d)\n", style.Name, style.ID)
+			if style.Type != "" {
+				fmt.Printf("  - スタイル: %s (ID: %d, タイプ: %s)\n", style.Name, style.ID, style.Type)
+			} else {
+				fmt.Printf("  - スタイル: %s (ID: %d)\n", style.Name, style.ID)
+			}
 		}
 	}
 	fmt.Println("--------------------------")
@@ -114,167 +164,1402 @@ func (c *Client) listSpeakers() error {
 	return nil
 }
 
-// createAudioQuery はテキストから音声合成クエリを生成します
-func (c *Client) createAudioQuery(text string, speakerID int) (*AudioQuery, error) {
-	endpoint := c.BaseURL + "/audio_query"
-	params := url.Values{}
-	params.Add("text", text)
-	params.Add("speaker", strconv.Itoa(speakerID))
+// showSpeakerInfo は話者名からUUIDを解決し、利用規約を表示します。取得した詳細情報も返します
+func (c *Client) showSpeakerInfo(name string) (*SpeakerInfo, error) {
+	speakers, err := c.Speakers()
+	if err != nil {
+		return nil, err
+	}
+
+	var uuid string
+	for _, speaker := range speakers {
+		if speaker.Name == name {
+			uuid = speaker.SpeakerUUID
+			break
+		}
+	}
+	if uuid == "" {
+		return nil, &SpeakerNotFoundError{Name: name}
+	}
+
+	info, err := c.SpeakerInfo(uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("--- %s の利用規約 ---\n", name)
+	fmt.Println(strings.TrimSpace(info.Policy))
+	fmt.Println("--------------------------")
+	return info, nil
+}
 
-	req, err := http.NewRequest("POST", endpoint, nil)
+// useCoreVersion は以降のリクエストで使うコアのバージョンを設定します。
+// 指定したバージョンがエンジンに無い場合はエラーを返します。
+// /core_versions が無い古いエンジンでは警告を出して指定を無視します
+func (c *Client) useCoreVersion(version string) error {
+	versions, err := c.CoreVersions()
 	if err != nil {
-		return nil, fmt.Errorf("リクエストの作成に失敗しました: %v", err)
+		if isNotFound(err) {
+			logWarn("このエンジンはコアバージョンの指定に対応していないため、--core-version '%s' を無視します", version)
+			return nil
+		}
+		return err
+	}
+
+	for _, v := range versions {
+		if v == version {
+			c.CoreVersion = version
+			return nil
+		}
 	}
-	req.URL.RawQuery = params.Encode()
+	return fmt.Errorf("コアバージョン '%s' はこのエンジンにありません (利用可能: %s)", version, strings.Join(versions, ", "))
+}
 
-	httpClient := &http.Client{}
-	resp, err := httpClient.Do(req)
+// listCoreVersions はエンジンに搭載されているコアのバージョン一覧を表示します
+func (c *Client) listCoreVersions() error {
+	versions, err := c.CoreVersions()
 	if err != nil {
-		return nil, fmt.Errorf("audio_queryリクエストに失敗しました: %v", err)
+		if isNotFound(err) {
+			return fmt.Errorf("このエンジンは対応していません (/core_versions がありません)")
+		}
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf(
-			"audio_queryの生成に失敗しました (ステータスコード: %d)\nエラー詳細: %s",
-			resp.StatusCode,
-			string(body),
-		)
+	fmt.Println("--- 利用可能なコアバージョン ---")
+	for _, v := range versions {
+		fmt.Println(v)
 	}
+	fmt.Println("--------------------------------")
+	fmt.Println("CLIでコアを指定する際は `--core-version <バージョン>` のように指定してください。")
+	return nil
+}
 
-	var query AudioQuery
-	if err := json.NewDecoder(resp.Body).Decode(&query); err != nil {
-		return nil, fmt.Errorf("audio_queryのデコードに失敗しました: %v", err)
+// findPreset は指定したIDのプリセットを取得します
+func (c *Client) findPreset(id int) (*Preset, error) {
+	presets, err := c.Presets()
+	if err != nil {
+		return nil, err
 	}
-	return &query, nil
+	for i := range presets {
+		if presets[i].ID == id {
+			return &presets[i], nil
+		}
+	}
+	return nil, fmt.Errorf("プリセット ID %d はエンジンに登録されていません (--list-presets で一覧を確認してください)", id)
 }
 
-// synthesis はクエリからWAVデータを生成します
-func (c *Client) synthesis(query *AudioQuery, speakerID int) ([]byte, error) {
-	queryJSON, err := json.Marshal(query)
+// listPresets はエンジンに登録済みのプリセット一覧を表示します
+func (c *Client) listPresets() error {
+	presets, err := c.Presets()
 	if err != nil {
-		return nil, fmt.Errorf("クエリのJSON変換に失敗しました: %v", err)
+		return err
 	}
 
-	synthesisURL := fmt.Sprintf("%s/synthesis?speaker=%d", c.BaseURL, speakerID)
-	resp, err := http.Post(synthesisURL, "application/json", bytes.NewBuffer(queryJSON))
+	fmt.Println("--- 登録済みのプリセット ---")
+	if len(presets) == 0 {
+		fmt.Println("(プリセットはありません)")
+	}
+	for _, p := range presets {
+		fmt.Printf("ID: %-4d %s (スタイルID: %d)\n", p.ID, p.Name, p.StyleID)
+		fmt.Printf("         話速 %g / 音高 %g / 抑揚 %g / 音量 %g / 前後の無音 %g・%g 秒\n",
+			p.SpeedScale, p.PitchScale, p.IntonationScale, p.VolumeScale, p.PrePhonemeLength, p.PostPhonemeLength)
+	}
+	fmt.Println("----------------------------")
+	fmt.Println("CLIでプリセットを使う際は `--preset-id <ID>` のように指定してください。")
+	return nil
+}
+
+// checkSpeakerVersion は話者のバージョンを、コアのバージョン (--core-version 指定時) またはエンジンのバージョンと比べ、
+// メジャー・マイナーバージョンが異なる場合に警告します。--verbose の場合は話者のバージョンも表示します
+func (c *Client) checkSpeakerVersion(selection *SpeakerSelection) {
+	speaker := selection.Speaker
+	if speaker.Version != "" {
+		logDebug("話者 '%s' (version %s)", speaker.Name, speaker.Version)
+	}
+
+	target, what := c.CoreVersion, "コア"
+	if target == "" {
+		version, err := c.Version()
+		if err != nil {
+			// バージョンの確認は補助的なものなので、取得できなくても合成は続けます
+			return
+		}
+		target, what = version, "エンジン"
+	}
+	if versionMismatch(speaker.Version, target) {
+		logWarn("話者 '%s' のバージョン (%s) が%sのバージョン (%s) と異なります。読みやアクセントが変わっている場合があります",
+			speaker.Name, speaker.Version, what, target)
+	}
+}
+
+// showDevices はエンジンのデバイス対応状況を表示します
+func (c *Client) showDevices() error {
+	devices, err := c.SupportedDevices()
 	if err != nil {
-		return nil, fmt.Errorf("synthesisリクエストに失敗しました: %v", err)
+		return err
+	}
+
+	mark := func(ok bool) string {
+		if ok {
+			return "対応"
+		}
+		return "非対応"
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf(
-			"音声合成に失敗しました (ステータスコード: %d)\nエラー詳細: %s",
-			resp.StatusCode,
-			string(body),
-		)
+	fmt.Println("--- エンジンのデバイス対応状況 ---")
+	fmt.Printf("CPU          : %s\n", mark(devices.CPU))
+	fmt.Printf("CUDA (NVIDIA): %s\n", mark(devices.CUDA))
+	fmt.Printf("DirectML     : %s\n", mark(devices.DML))
+	fmt.Println("----------------------------------")
+	if devices.CUDA || devices.DML {
+		fmt.Println("GPUモードで利用できます。合成が遅い場合はエンジンがGPUモードで起動しているか確認してください。")
+	} else {
+		fmt.Println("このエンジンはCPUモードでのみ動作します。")
 	}
 
-	wavData, err := io.ReadAll(resp.Body)
+	return nil
+}
+
+// engineFeatureNames は supported_features の主なキーの表示名です
+var engineFeatureNames = map[string]string{
+	"adjust_mora_pitch":       "モーラごとの音高の調整",
+	"adjust_phoneme_length":   "音素ごとの長さの調整",
+	"adjust_speed_scale":      "話速の調整",
+	"adjust_pitch_scale":      "音高の調整",
+	"adjust_intonation_scale": "抑揚の調整",
+	"adjust_volume_scale":     "音量の調整",
+	"interrogative_upspeak":   "疑問文の語尾の自動調整",
+	"synthesis_morphing":      "モーフィング",
+	"sing":                    "歌唱",
+	"manage_library":          "音声ライブラリの管理",
+	"return_resource_url":     "リソースのURLでの取得",
+}
+
+// showEngineInfo はエンジンの名前・バージョン・対応機能を表示します
+func (c *Client) showEngineInfo() error {
+	manifest, err := c.EngineManifest()
 	if err != nil {
-		return nil, fmt.Errorf("WAVデータの読み込みに失敗しました: %v", err)
+		return err
 	}
-	return wavData, nil
+
+	fmt.Println("--- エンジンの情報 ---")
+	fmt.Printf("名前       : %s\n", manifest.Name)
+	fmt.Printf("ブランド名 : %s\n", manifest.BrandName)
+	fmt.Printf("バージョン : %s\n", manifest.Version)
+	if manifest.URL != "" {
+		fmt.Printf("URL        : %s\n", manifest.URL)
+	}
+	if manifest.DefaultSamplingRate > 0 {
+		fmt.Printf("サンプリングレート: %d Hz\n", manifest.DefaultSamplingRate)
+	}
+
+	features := make([]string, 0, len(manifest.SupportedFeatures))
+	for name := range manifest.SupportedFeatures {
+		features = append(features, name)
+	}
+	sort.Strings(features)
+	fmt.Println("対応機能:")
+	for _, name := range features {
+		mark := "非対応"
+		if manifest.Supports(name) {
+			mark = "対応"
+		}
+		label := name
+		if display, ok := engineFeatureNames[name]; ok {
+			label = fmt.Sprintf("%s (%s)", display, name)
+		}
+		fmt.Printf("  - %s: %s\n", label, mark)
+	}
+	fmt.Println("----------------------")
+	return nil
+}
+
+// headerFlag は --header "Key: Value" を複数回指定できるようにする flag.Value です
+type headerFlag http.Header
+
+func (f headerFlag) String() string {
+	var parts []string
+	for key, values := range f {
+		for _, v := range values {
+			parts = append(parts, key+": "+v)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Set は "Key: Value" 形式のヘッダーを解析して追加します
+func (f *headerFlag) Set(value string) error {
+	key, v, ok := strings.Cut(value, ":")
+	if !ok || strings.TrimSpace(key) == "" {
+		return fmt.Errorf("'%s' は \"Key: Value\" の形式で指定してください", value)
+	}
+	if *f == nil {
+		*f = headerFlag{}
+	}
+	http.Header(*f).Add(strings.TrimSpace(key), strings.TrimSpace(v))
+	return nil
 }
 
 // --- メイン処理 ---
 
+// parseInterspersed は位置引数の後ろに置かれたフラグも解析し、位置引数のみを返します
+// (例: --concat a.wav b.wav -o all.wav)
+func parseInterspersed(fs *flag.FlagSet) []string {
+	var positional []string
+	args := fs.Args()
+	for len(args) > 0 {
+		positional = append(positional, args[0])
+		fs.Parse(args[1:])
+		args = fs.Args()
+	}
+	return positional
+}
+
 func main() {
-	// === コマンドライン引数の定義 ===
-	// 基本設定
-	inputFile := flag.String("i", "", "入力テキストファイルのパス (必須)")
-	outputFile := flag.String("o", "", "出力WAVファイルのパス (必須)")
-	actorName := flag.String("actor", "ずんだもん", "話者の名前")
-	port := flag.Int("port", 50021, "VOICEVOXエンジンのポート番号")
-	showActors := flag.Bool("list-actors", false, "利用可能な話者の一覧を表示")
-
-	// 音声パラメータ設定
-	speed := flag.Float64("speed", 1.0, "話速")
-	pitch := flag.Float64("pitch", 0.0, "音高（±0.15程度が推奨）")
-	intonation := flag.Float64("intonation", 1.0, "抑揚")
-	volume := flag.Float64("volume", 1.0, "音量")
-	prePhoneme := flag.Float64("pre-phoneme", -1.0, "音声の前の無音時間 (秒)。-1でAPIのデフォルト値を使用")
-	postPhoneme := flag.Float64("post-phoneme", -1.0, "音声の後の無音時間 (秒)。-1でAPIのデフォルト値を使用")
-	
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "使用法: %s [オプション]\n\n", os.Args[0])
-		fmt.Fprintln(os.Stderr, "必須オプション:")
-		fmt.Fprintln(os.Stderr, "  -i string\n    \t入力テキストファイルのパス")
-		fmt.Fprintln(os.Stderr, "  -o string\n    \t出力WAVファイルのパス")
-		fmt.Fprintln(os.Stderr, "\nその他のオプション:")
-		flag.PrintDefaults()
+	os.Exit(run())
+}
+
+// fail はエラーを標準エラー出力に表示し、エラーの種類に応じた終了コードを返します。
+// --progress-json 指定時は error イベントとして出力します
+func fail(err error) int {
+	if errors.Is(err, context.Canceled) {
+		err = errInterrupted
 	}
+	code := exitCode(err)
+	if progressEvents != nil {
+		progressEvents.emit("error", map[string]interface{}{"message": errorMessage(err), "exit_code": code})
+		return code
+	}
+	logError(err)
+	return code
+}
 
+// run はCLIの処理本体です。終了コードを返します
+func run() int {
+	o := defineFlags()
 	flag.Parse()
+	var args []string
+	var dict *dictCommand
+	if flag.Arg(0) == "dict" {
+		// dict の操作は独自のオプションを持つため、専用のフラグセットで解析します
+		var err error
+		if dict, err = parseDictCommand(flag.Args()[1:]); err != nil {
+			return fail(err)
+		}
+	} else {
+		args = parseInterspersed(flag.CommandLine)
+	}
+	if len(args) > 0 && args[0] == "config" {
+		if err := runConfigCommand(args[1:], *o.configPath, *o.forceOverwrite); err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+	if len(args) == 1 && args[0] == "serve" {
+		// serve サブコマンドは --serve と同じです
+		*o.serveMode = true
+		args = nil
+	}
+	if len(args) > 0 && args[0] == "cache" {
+		if err := runCacheCommand(args[1:]); err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+	// プリセット・環境変数・設定ファイルの値は、コマンドラインで指定しなかったオプションの既定値にします
+	if err := loadDefaults(flag.CommandLine, *o.configPath, *o.presetName, os.Getenv); err != nil {
+		return fail(err)
+	}
+	// 明示的に指定されたパラメータだけをクエリに上書きします
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	if err := o.validate(explicit); err != nil {
+		return fail(err)
+	}
+	o.actors.addList(*o.actorList)
+	actorNames := o.actors.list()
+	// --format を指定した場合は、拡張子の無い -o にフォーマットの拡張子を付けます
+	*o.outputFile = pathWithFormat(*o.outputFile, *o.outputFormat)
+	customPlayer = *o.player
+
+	if err := setupLogger(*o.logFormat, *o.quiet, *o.verbose); err != nil {
+		return fail(err)
+	}
+	if *o.logFormat == "json" {
+		// JSONのログと混ざらないよう、プログレスバーは表示しません
+		*o.quiet = true
+	}
+	if *o.watchMode {
+		switch {
+		case *o.inputFile == "" || *o.inputFile == stdioPath:
+			return fail(fmt.Errorf("--watch には -i で監視する入力ファイルを指定してください"))
+		case dict != nil || len(args) > 0 || *o.serveMode || *o.interactiveMode || *o.manifest != "" || *o.concat:
+			return fail(fmt.Errorf("--watch はサブコマンドや --serve / --interactive / --manifest / --concat と同時に指定できません"))
+		}
+		return runWatch(*o.inputFile, os.Args[1:], *o.noClobber)
+	}
+
+	// -o - で音声を標準出力に書き出す場合は、人間向けの表示を標準エラー出力に回します
+	audioOut := os.Stdout
+	if *o.outputFile == stdioPath {
+		if err := checkStdout(audioOut); err != nil {
+			return fail(err)
+		}
+		os.Stdout = os.Stderr
+	}
+	// --dry-run-json のJSONと混ざらないよう、人間向けの表示を標準エラー出力に回します
+	queryOut := os.Stdout
+	if *o.dryRunJSON {
+		os.Stdout = os.Stderr
+	}
+	if *o.progressJSON {
+		// 人間向けの表示は標準出力に書いているため、標準出力ごと捨てます
+		if devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0); err == nil {
+			os.Stdout = devNull
+		}
+		progressEvents = &progressEmitter{out: os.Stderr}
+		*o.quiet = true
+	}
+
+	overwrite := overwriteAsk
+	switch {
+	case *o.noClobber:
+		overwrite = overwriteNever
+	case *o.forceOverwrite:
+		overwrite = overwriteAlways
+	}
+	// 確認プロンプトは標準エラー出力に表示するため、両方が端末の場合だけ対話的とみなします
+	interactive := isTerminal(os.Stdin) && isTerminal(os.Stderr) && !*o.progressJSON
+
+	if *o.concat {
+		if len(args) < 2 || *o.outputFile == "" {
+			return fail(fmt.Errorf("--concat には2つ以上のWAVファイルと -o の指定が必要です"))
+		}
+		format, err := resolveFormat(*o.outputFile, *o.outputFormat)
+		if err != nil {
+			return fail(err)
+		}
+		if !confirmOverwrite(*o.outputFile, overwrite, interactive) {
+			return exitOK
+		}
+		logInfo("%d 個のWAVファイルを結合しています...", len(args))
+		wavData, err := concatWAVFiles(args, time.Duration(*o.gap*float64(time.Second)))
+		if err != nil {
+			return fail(err)
+		}
+		encoded, err := encodeOutput(wavData, format)
+		if err != nil {
+			return fail(err)
+		}
+		if err := writeOutput(*o.outputFile, encoded, !*o.noMkdir, audioOut); err != nil {
+			return fail(err)
+		}
+		if *o.outputFile != stdioPath {
+			logInfo("結合した音声を '%s' に保存しました。", *o.outputFile)
+		}
+		return exitOK
+	}
+
+	if *o.compare != "" && len(args) > 0 {
+		baseline, err := os.ReadFile(*o.compare)
+		if err != nil {
+			return fail(&FileError{Msg: "基準のWAVファイルの読み込みに失敗しました", Err: err})
+		}
+		var failed error
+		for _, path := range args {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fail(&FileError{Msg: "WAVファイルの読み込みに失敗しました", Err: err})
+			}
+			diff, err := compareWAV(baseline, data)
+			if err != nil {
+				return fail(&FileError{Msg: fmt.Sprintf("'%s' と '%s' を比較できませんでした", *o.compare, path), Err: err})
+			}
+			printWAVDiff(*o.compare, path, diff)
+			if err := checkWAVDiff(diff, *o.compareThreshold); err != nil && failed == nil {
+				failed = fmt.Errorf("%s: %v", path, err)
+			}
+		}
+		if failed != nil {
+			return fail(failed)
+		}
+		return exitOK
+	}
+
+	if *o.analyze && len(args) > 0 {
+		for _, path := range args {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fail(&FileError{Msg: "WAVファイルの読み込みに失敗しました", Err: err})
+			}
+			stats, err := analyzeWAV(data)
+			if err != nil {
+				return fail(&FileError{Msg: fmt.Sprintf("'%s' を解析できませんでした", path), Err: err})
+			}
+			printWAVStats(path, stats)
+		}
+		return exitOK
+	}
+
+	if *o.silence > 0 {
+		if *o.outputFile == "" {
+			return fail(fmt.Errorf("--silence には -o の指定が必要です"))
+		}
+		format, err := resolveFormat(*o.outputFile, *o.outputFormat)
+		if err != nil {
+			return fail(err)
+		}
+		if !confirmOverwrite(*o.outputFile, overwrite, interactive) {
+			return exitOK
+		}
+		encoded, err := encodeOutput(generateSilence(*o.silence, *o.silenceRate, *o.silenceStereo), format)
+		if err != nil {
+			return fail(err)
+		}
+		if err := writeOutput(*o.outputFile, encoded, !*o.noMkdir, audioOut); err != nil {
+			return fail(err)
+		}
+		if *o.outputFile != stdioPath {
+			logInfo("%g 秒の無音を '%s' に保存しました。", *o.silence, *o.outputFile)
+		}
+		return exitOK
+	}
 
 	// APIクライアントを作成
-	client := NewClient(*port)
+	client := NewClient(*o.port)
+	if *o.host != "" {
+		u, err := hostURL(*o.host, *o.port)
+		if err != nil {
+			return fail(err)
+		}
+		*o.baseURL = u
+	}
+	var auth *url.Userinfo
+	if *o.baseURL != "" {
+		u, err := url.Parse(*o.baseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fail(fmt.Errorf("--base-url '%s' が不正です (http:// または https:// で始まるURLを指定してください)", *o.baseURL))
+		}
+		// URL に含めた認証情報は、エラーメッセージなどに表示しないよう、URL から外してヘッダーで送ります
+		auth, u.User = u.User, nil
+		client.BaseURL = strings.TrimRight(u.String(), "/")
+	}
+	if o.headers != nil {
+		client.Headers = http.Header(o.headers)
+	}
+	if *o.basicAuth != "" {
+		user, password, ok := strings.Cut(*o.basicAuth, ":")
+		if !ok {
+			password = os.Getenv(envPassword)
+		}
+		auth = url.UserPassword(user, password)
+	}
+	if auth != nil {
+		password, _ := auth.Password()
+		client.SetBasicAuth(auth.Username(), password)
+	}
+	if *o.timeout > 0 {
+		if !explicit["connect-timeout"] {
+			*o.connectTimeout = *o.timeout
+		}
+		if !explicit["synthesis-timeout"] {
+			*o.synthesisTimeout = *o.timeout
+		}
+	}
+	client.Retries = *o.retries
+	client.OnRetry = func(attempt int, err error, wait time.Duration) {
+		msg, _, _ := strings.Cut(err.Error(), "\n")
+		logWarn("%s (%v 後に再試行します %d/%d)", msg, wait.Round(time.Millisecond), attempt, *o.retries)
+	}
+	client.Doer = loggingDoer{newHTTPClient(*o.connectTimeout, *o.insecure)}
+	client.SynthesisDoer = loggingDoer{newHTTPClient(*o.synthesisTimeout, *o.insecure)}
+	if *o.autoPort {
+		candidates := defaultPortCandidates
+		if *o.portRange != "" {
+			var err error
+			if candidates, err = parsePortCandidates(*o.portRange); err != nil {
+				return fail(err)
+			}
+		}
+		found, version, err := client.discoverPort(candidates, *o.insecure)
+		if err != nil {
+			return fail(err)
+		}
+		client.BaseURL = fmt.Sprintf("http://localhost:%d", found)
+		logDebug("ポート %d のエンジン (バージョン: %s) に接続します。", found, version)
+	}
+	client.StyleType = *o.styleType
+	client.Style = *o.styleName
+	if err := client.useAliases(); err != nil {
+		return fail(err)
+	}
+
+	if len(args) > 0 && args[0] == "completion" {
+		if err := runCompletion(client, args[1:]); err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+	if dict != nil {
+		if err := dict.run(client, *o.jsonOutput, *o.forceOverwrite); err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+
+	if *o.showActors {
+		opts := SpeakerListOptions{Filter: *o.actorFilter, FilterStyle: *o.styleFilter, StyleType: *o.styleType, Sort: *o.actorSort, JSON: *o.jsonOutput}
+		if err := client.listSpeakers(opts); err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+
+	if *o.showEngineInfo {
+		if err := client.showEngineInfo(); err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+
+	if *o.showDevices {
+		if err := client.showDevices(); err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+
+	if *o.actorInfo != "" {
+		info, err := client.showSpeakerInfo(*o.actorInfo)
+		if err != nil {
+			return fail(err)
+		}
+		if *o.savePortrait != "" {
+			portrait, err := base64.StdEncoding.DecodeString(info.Portrait)
+			if err != nil {
+				return fail(fmt.Errorf("立ち絵画像のデコードに失敗しました: %w", err))
+			}
+			if confirmOverwrite(*o.savePortrait, overwrite, interactive) {
+				if err := writeOutputFile(*o.savePortrait, portrait, !*o.noMkdir); err != nil {
+					return fail(err)
+				}
+				logInfo("立ち絵を '%s' に保存しました。", *o.savePortrait)
+			}
+		}
+		return exitOK
+	}
+
+	if *o.showCoreVersions {
+		if err := client.listCoreVersions(); err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+
+	if *o.showAliases {
+		if err := listAliases(); err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
 
-	if *showActors {
-		if err := client.listSpeakers(); err != nil {
-			fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
-			os.Exit(1)
+	if *o.showProfiles {
+		if err := listProfiles(); err != nil {
+			return fail(err)
 		}
-		os.Exit(0)
+		return exitOK
 	}
 
-	if *inputFile == "" || *outputFile == "" {
+	if *o.showPresets {
+		if err := listNamedPresets(); err != nil {
+			return fail(err)
+		}
+		if err := client.listPresets(); err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+
+	params := SynthesisParams{
+		Speed:       *o.speed,
+		Pitch:       *o.pitch,
+		Intonation:  *o.intonation,
+		Volume:      *o.volume,
+		PrePhoneme:  *o.prePhoneme,
+		PostPhoneme: *o.postPhoneme,
+		Explicit:    explicit,
+	}
+	for _, name := range relativeParamNames {
+		if *o.relativeFlags[name] == "" {
+			continue
+		}
+		rel, err := parseRelative(name, *o.relativeFlags[name])
+		if err != nil {
+			return fail(err)
+		}
+		params.setRelative(name, rel)
+	}
+	if *o.profileName != "" {
+		profile, err := findProfile(*o.profileName)
+		if err != nil {
+			return fail(err)
+		}
+		params = applyProfile(params, profile)
+	}
+	if *o.saveProfileName != "" {
+		path, err := saveProfile(*o.saveProfileName, params)
+		if err != nil {
+			return fail(err)
+		}
+		logInfo("プロファイル '%s' を '%s' に保存しました。", *o.saveProfileName, path)
+		if *o.inputFile == "" && !explicit["text"] && *o.manifest == "" && *o.queryFile == "" {
+			return exitOK
+		}
+	}
+	var loaded *SynthesisMeta
+	if *o.loadQuery != "" {
+		var err error
+		if loaded, err = loadSidecar(*o.loadQuery); err != nil {
+			return fail(err)
+		}
+		// コマンドラインで明示的に指定したものは、サイドカーの内容より優先します
+		params = applyProfile(params, Profile(loaded.Params))
+		for name, spec := range loaded.RelativeParams {
+			if explicit[name] || explicit[name+"-rel"] {
+				continue
+			}
+			rel, err := parseRelative(name, spec)
+			if err != nil {
+				return fail(&FileError{Msg: fmt.Sprintf("サイドカーファイル '%s' の相対指定が不正です", *o.loadQuery), Err: err})
+			}
+			params.setRelative(name, rel)
+		}
+		switch {
+		case explicit["actor"] || explicit["actors"] || explicit["speaker-id"]:
+		case loaded.Actor == "":
+			// --speaker-id で合成したサイドカーには話者名がありません
+			*o.styleID = loaded.StyleID
+		default:
+			actorNames = []string{loaded.Actor}
+		}
+		if loaded.PresetID != nil && !explicit["preset-id"] {
+			*o.presetID = *loaded.PresetID
+		}
+		if !explicit["max-chunk-chars"] && !explicit["max-chars"] {
+			*o.maxChunkChars = loaded.MaxChunkChars
+		}
+		if !explicit["split-on"] {
+			*o.splitOn = loaded.SplitOn
+		}
+		if !explicit["gap"] {
+			*o.gap = loaded.Gap
+		}
+		*o.kanaMode = *o.kanaMode || loaded.Kana
+		*o.markup = *o.markup || loaded.Markup
+		*o.split = *o.split || loaded.Split
+		*o.inputFile = loaded.Input
+	}
+	splitRules := defaultSplitRules
+	if *o.splitOn != "" {
+		rules, err := parseSplitOn(*o.splitOn)
+		if err != nil {
+			return fail(err)
+		}
+		splitRules = rules
+	}
+	vars := mergeTextVars(builtinTextVars(time.Now()), o.textVars)
+	post := PostProcess{Resample: *o.resample, Normalize: *o.normalize, TargetDB: *o.targetDB, FadeIn: *o.fadeIn, FadeOut: *o.fadeOut}
+	if *o.targetLUFS != 0 {
+		post.TargetLUFS, post.TruePeak = *o.targetLUFS, *o.truePeak
+	}
+	if *o.echo {
+		post.EchoDelay, post.EchoDecay = *o.echoDelay, *o.echoDecay
+	}
+	switch {
+	case *o.toStereo:
+		post.Channels = 2
+	case *o.toMono:
+		post.Channels = 1
+	}
+	if *o.bitDepth != "" {
+		var err error
+		if post.BitDepth, post.Float, err = parseBitDepth(*o.bitDepth); err != nil {
+			return fail(err)
+		}
+	}
+
+	if !*o.noCache {
+		resultCache = newSynthCache(client)
+	}
+	if *o.tempDict != "" {
+		removeDict, err := registerTempDict(client, *o.tempDict)
+		if err != nil {
+			return fail(err)
+		}
+		defer removeDict()
+	}
+	if *o.serveMode {
+		if *o.coreVersion != "" {
+			if err := client.useCoreVersion(*o.coreVersion); err != nil {
+				return fail(err)
+			}
+		}
+		err := serve(client, newSpeakerCache(client, *o.exactActor), ServerOptions{
+			Listen:        *o.listen,
+			Workers:       *o.workers,
+			MetricsListen: *o.metricsListen,
+			DefaultActor:  actorNames[0],
+			Params:        params,
+			Post:          post,
+			MaxChunkChars: *o.maxChunkChars,
+		})
+		if err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+
+	if *o.interactiveMode {
+		if err := checkNumberMode(*o.numberMode); err != nil {
+			return fail(err)
+		}
+		if *o.coreVersion != "" {
+			if err := client.useCoreVersion(*o.coreVersion); err != nil {
+				return fail(err)
+			}
+		}
+		err := runInteractive(client, newSpeakerCache(client, *o.exactActor), InteractiveOptions{
+			Actor:    actorNames[0],
+			Params:   params,
+			KanaMode: *o.kanaMode,
+			Text:     TextOptions{Rules: o.replaceRules, NumberMode: *o.numberMode, ExpandSymbols: *o.expandSymbols, RomajiToKana: *o.romajiKana, Ruby: *o.ruby},
+			Post:     post,
+		})
+		if err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+
+	// ここから先の合成は、Ctrl+C で送信中のリクエストを中断して終了できるようにします
+	ctx, stopInterrupt := interruptContext()
+	defer stopInterrupt()
+	client.ctx = ctx
+
+	if *o.manifest != "" {
+		entries, err := loadManifest(*o.manifest)
+		if err != nil {
+			return fail(err)
+		}
+		if *o.coreVersion != "" {
+			if err := client.useCoreVersion(*o.coreVersion); err != nil {
+				return fail(err)
+			}
+		}
+		var cp *checkpoint
+		if *o.checkpointFile != "" {
+			if cp, err = openCheckpoint(*o.checkpointFile, *o.restart); err != nil {
+				return fail(err)
+			}
+			if n := cp.count(); n > 0 {
+				logInfo("チェックポイント '%s' から再開します (完了済み: %d 件)", *o.checkpointFile, n)
+			}
+		}
+		logInfo("マニフェスト '%s' の %d 件を処理しています...", *o.manifest, len(entries))
+		results := runManifest(client, newSpeakerCache(client, *o.exactActor), entries, ManifestOptions{
+			Path:               *o.manifest,
+			DefaultActor:       actorNames[0],
+			Params:             params,
+			KanaMode:           *o.kanaMode,
+			Post:               post,
+			Mkdir:              !*o.noMkdir,
+			Overwrite:          overwrite,
+			Checkpoint:         cp,
+			Vars:               vars,
+			AllowUndefinedVars: *o.undefinedVar == "empty",
+			Format:             *o.outputFormat,
+		})
+		reportCacheHits()
+		if err := printBatchReport(results); err != nil {
+			return fail(err)
+		}
+		if ctx.Err() != nil {
+			return fail(errInterrupted)
+		}
+		return exitOK
+	}
+
+	if (*o.inputFile == "" && !explicit["text"] && loaded == nil && *o.queryFile == "") || (*o.outputFile == "" && *o.filenameTemplate == "" && !*o.play && !*o.analyze && *o.compare == "" && !*o.dryRun && !*o.dryRunQuery && !*o.dryRunJSON && !*o.estimate && !*o.estimateQuery) {
 		flag.Usage()
-		os.Exit(1)
+		return exitFailure
 	}
 
-	speakerID, err := client.findSpeakerID(*actorName)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
-		os.Exit(1)
+	if err := o.validateSynthesis(explicit); err != nil {
+		return fail(err)
+	}
+	chunkJobs = *o.jobs
+	// 合成してからプレイヤーが無いと分からないよう、再生できるかを先に確認しておきます
+	if *o.play {
+		if _, err := playerCommand(""); err != nil {
+			return fail(err)
+		}
 	}
 
-	fmt.Printf("'%s' を読み込んでいます...\n", *inputFile)
-	textBytes, err := os.ReadFile(*inputFile)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "エラー: ファイルの読み込みに失敗しました: %v\n", err)
-		os.Exit(1)
+	// 出力フォーマットは --format か -o の拡張子から判定し、ffmpeg が必要なら合成前に確認しておきます
+	format := "wav"
+	if *o.outputFile != "" {
+		var err error
+		if format, err = resolveFormat(*o.outputFile, *o.outputFormat); err != nil {
+			return fail(err)
+		}
+		if format != "wav" && *o.stream {
+			return fail(fmt.Errorf("--stream はWAVでのみ出力できます"))
+		}
+		if err := checkEncoder(format, post.BitDepth); err != nil {
+			return fail(err)
+		}
+	}
+
+	if *o.coreVersion != "" {
+		if err := client.useCoreVersion(*o.coreVersion); err != nil {
+			return fail(err)
+		}
+	}
+
+	multiActors := len(actorNames) > 1
+	if multiActors {
+		if err := checkActorsOutput(*o.outputFile); err != nil {
+			return fail(err)
+		}
+		if *o.queryFile != "" || *o.subtitles != "" || *o.phonemes != "" || *o.resume {
+			return fail(fmt.Errorf("複数の話者を指定した場合は --query-file / --subtitles / --phonemes / --resume は使用できません"))
+		}
+		if *o.play || *o.dryRun || *o.dryRunQuery || *o.dryRunJSON || *o.estimate || *o.estimateQuery || *o.targetDuration > 0 || *o.stream || *o.splitLinesMode || *o.dialogueMode || *o.ssmlMode {
+			return fail(fmt.Errorf("複数の話者を指定した場合は --play / --dry-run / --estimate / --target-duration / --stream / --split-lines / --dialogue / --ssml は使用できません"))
+		}
 	}
 
-	fmt.Println("音声合成クエリを作成中...")
-	query, err := client.createAudioQuery(string(textBytes), speakerID)
+	// 複数の話者を指定した場合は、テキストの準備が済んでから話者ごとに解決します
+	var selection *SpeakerSelection
+	var speakerID int
+	var err error
+	if *o.styleID >= 0 {
+		// 話者の一覧は問い合わせないため、話者名とスタイル名は分かりません
+		selection = &SpeakerSelection{Style: SpeakerStyle{ID: *o.styleID}}
+		speakerID = *o.styleID
+	} else if !multiActors {
+		selection, err = client.findSpeaker(actorNames[0], *o.exactActor)
+		if err != nil {
+			return fail(err)
+		}
+		if loaded != nil && !explicit["actor"] && !explicit["style-type"] && !explicit["style"] {
+			// サイドカーに記録されたスタイルを使います
+			for _, style := range selection.Speaker.Styles {
+				if style.ID == loaded.StyleID {
+					selection.Style = style
+				}
+			}
+		}
+		speakerID = selection.Style.ID
+		client.checkSpeakerVersion(selection)
+	}
+
+	var preset *Preset
+	if *o.presetID >= 0 {
+		if preset, err = client.findPreset(*o.presetID); err != nil {
+			return fail(err)
+		}
+		// 複数の話者を指定した場合は、話者ごとに合成するときに確認します
+		if selection != nil {
+			if err := preset.CheckStyle(speakerID); err != nil {
+				return fail(err)
+			}
+		}
+		logInfo("プリセット '%s' (ID: %d) を使用します。", preset.Name, preset.ID)
+	}
+
+	var text string
+	var dialogue []DialogueLine
+	var voiceTags bool
+	var textOpts TextOptions
+	if loaded != nil {
+		// サイドカーのテキストは前処理を済ませたものなので、そのまま使います
+		logInfo("'%s' の内容で再合成します。", *o.loadQuery)
+		text = loaded.Text
+	} else if *o.queryFile != "" {
+		logInfo("'%s' の audio_query で合成します。", *o.queryFile)
+	} else {
+		decoded := *o.directText
+		if !explicit["text"] {
+			if *o.inputFile == stdioPath {
+				logInfo("標準入力を読み込んでいます...")
+			} else {
+				logInfo("'%s' を読み込んでいます...", *o.inputFile)
+			}
+			textBytes, err := readInputFile(*o.inputFile)
+			if err != nil {
+				return fail(err)
+			}
+			if decoded, err = decodeText(textBytes, *o.textEncoding); err != nil {
+				return fail(&FileError{Msg: fmt.Sprintf("'%s' の文字コードの変換に失敗しました", *o.inputFile), Err: err})
+			}
+		}
+		if decoded, err = expandTextVars(decoded, vars); err != nil && *o.undefinedVar == "error" {
+			return fail(err)
+		}
+		if !*o.kanaMode && !*o.ssmlMode {
+			// SSMLはタグの英字を数えてしまうため確認しません
+			warnLatinText(decoded)
+		}
+		textOpts = TextOptions{
+			Rules:         o.replaceRules,
+			NumberMode:    *o.numberMode,
+			ExpandSymbols: *o.expandSymbols,
+			RomajiToKana:  *o.romajiKana,
+			Markup:        *o.markup,
+			Ruby:          *o.ruby,
+		}
+		// [voice:] タグは --dialogue の台本と同じく、話者ごとに区切ってから前処理します
+		voiceTags = !*o.dialogueMode && !*o.ssmlMode && !*o.kanaMode && hasVoiceTags(decoded)
+		if voiceTags && (multiActors || *o.sidecar) {
+			return fail(fmt.Errorf("[voice:] タグで話者を切り替えるテキストは、複数の話者や --sidecar と同時に指定できません"))
+		}
+		if *o.dialogueMode || voiceTags {
+			// 話者名は置換や読みの変換の対象にしないよう、セリフだけを前処理します
+			if voiceTags {
+				dialogue = parseVoiceTags(decoded)
+			} else {
+				dialogue = parseDialogue(decoded)
+			}
+			for i := range dialogue {
+				dialogue[i].Text = preprocessText(dialogue[i].Text, textOpts)
+			}
+		} else if *o.ssmlMode {
+			// タグや実体参照を壊さないよう、前処理は parseSSML で解析した後のテキストごとに行います
+			text = decoded
+		} else {
+			text = preprocessText(decoded, textOpts)
+		}
+	}
+	if *o.kanaMode && !*o.markup {
+		// kanaの記法の誤りは、分割する前に入力全体で検証して行・位置を報告します
+		if _, err := prepareKana(text); err != nil {
+			return fail(err)
+		}
+	}
+
+	segments := []Segment{{Text: text}}
+	switch {
+	case *o.queryFile != "":
+		segments, err = loadQueryFile(*o.queryFile)
+	case *o.dialogueMode || voiceTags:
+		segments, err = dialogueSegments(dialogue, *o.markup, *o.markupStrict)
+	case *o.ssmlMode:
+		segments, err = parseSSML(text, textOpts)
+	case *o.markup:
+		segments, err = parseMarkup(text, *o.markupStrict)
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
-		os.Exit(1)
+		return fail(err)
 	}
+	if *o.split {
+		splitFn := func(t string) []string { return splitText(t, splitRules, *o.maxChunkChars) }
+		if *o.kanaMode {
+			splitFn = splitLines
+		}
+		segments = splitSegments(segments, splitFn)
+	}
+	if *o.splitLinesMode {
+		segments = splitSegments(segments, splitLines)
+	}
+	if len(segments) == 0 {
+		return fail(fmt.Errorf("入力テキストが空です"))
+	}
+	// 1チャンクだけの合成は、変わったチャンクだけを合成し直すことが無いため、キャッシュを使わずにエンジンへの問い合わせを省きます
+	if len(segments) == 1 {
+		resultCache = nil
+	}
+	if *o.gap > 0 {
+		segments = insertGaps(segments, time.Duration(*o.gap*float64(time.Second)))
+	}
+
+	params.Preset = preset
+	logDebug("上書きするパラメータ: %s", params.describe())
 
-	// === パラメータを上書き ===
-	fmt.Println("パラメータを調整しています...")
-	query.SpeedScale = *speed
-	query.PitchScale = *pitch
-	query.IntonationScale = *intonation
-	query.VolumeScale = *volume
-	if *prePhoneme != -1.0 {
-		query.PrePhonemeLength = *prePhoneme
+	if multiActors {
+		logInfo("%d 人の話者で合成しています...", len(actorNames))
+		results, err := synthesizeActors(client, actorNames, segments, ActorsOptions{
+			Exact:       *o.exactActor,
+			Input:       *o.inputFile,
+			Output:      *o.outputFile,
+			Format:      format,
+			KanaMode:    *o.kanaMode,
+			Params:      params,
+			Post:        post,
+			Mkdir:       !*o.noMkdir,
+			Overwrite:   overwrite,
+			Interactive: interactive,
+			Quiet:       *o.quiet,
+		})
+		if err != nil {
+			return fail(err)
+		}
+		reportCacheHits()
+		if err := printBatchReport(results); err != nil {
+			return fail(err)
+		}
+		if ctx.Err() != nil {
+			return fail(errInterrupted)
+		}
+		return exitOK
 	}
-	if *postPhoneme != -1.0 {
-		query.PostPhonemeLength = *postPhoneme
+
+	// 台本の話者は、コマンドラインの話者と合わせて一度ずつ解決します
+	speakers := newSpeakerCache(client, *o.exactActor)
+	speakers.remember(actorNames[0], selection)
+	if err := resolveSegmentSpeakers(speakers, segments); err != nil {
+		return fail(err)
 	}
 
+	if *o.estimate || *o.estimateQuery {
+		if err := printEstimate(client, speakerID, segments, params, *o.kanaMode, *o.estimateQuery); err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
 
-	fmt.Println("音声合成を実行中...")
+	if *o.dryRunJSON {
+		if err := printDryRunJSON(queryOut, client, selection, segments, params, *o.kanaMode); err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+
+	if *o.dryRun || *o.dryRunQuery {
+		if err := printDryRun(client, selection, segments, params, *o.kanaMode, *o.dryRunQuery); err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+
+	if *o.splitLinesMode {
+		tmpl := *o.filenameTemplate
+		if tmpl == "" {
+			tmpl = defaultLineTemplate(*o.outputFile)
+		}
+		tmpl = pathWithFormat(tmpl, *o.outputFormat)
+		if err := checkOutputTemplate(lineOutputName(tmpl, 1, ""), *o.strictOutputName); err != nil {
+			return fail(err)
+		}
+		if lineFormat, err := resolveFormat(tmpl, *o.outputFormat); err != nil {
+			return fail(err)
+		} else if err := checkEncoder(lineFormat, post.BitDepth); err != nil {
+			return fail(err)
+		} else if *o.export != "" && lineFormat != "wav" {
+			return fail(fmt.Errorf("--export は動画編集ソフトで読み込めるよう、WAVで出力する場合に指定してください"))
+		}
+		logInfo("%d 行をそれぞれ合成しています...", len(segments))
+		entries := lineManifestEntries(segments, tmpl)
+		results := runManifest(client, speakers, entries, ManifestOptions{
+			Path:         *o.inputFile,
+			DefaultActor: actorNames[0],
+			Params:       params,
+			KanaMode:     *o.kanaMode,
+			Post:         post,
+			Mkdir:        !*o.noMkdir,
+			Overwrite:    overwrite,
+			// 変数は読み込んだときに展開済みです
+			AllowUndefinedVars: true,
+			Format:             *o.outputFormat,
+			Export:             *o.export,
+		})
+		if *o.export != "" {
+			if err := writeTimeline(entries, results, actorNames[0]); err != nil {
+				return fail(err)
+			}
+		}
+		reportCacheHits()
+		if err := printBatchReport(results); err != nil {
+			return fail(err)
+		}
+		if ctx.Err() != nil {
+			return fail(errInterrupted)
+		}
+		return exitOK
+	}
+
+	// 既存ファイルを上書きしない場合は、合成する前に分かるよう先に出力先を確認します
 	startTime := time.Now()
-	wavData, err := client.synthesis(query, speakerID)
+	outputPath := ""
+	if *o.outputFile != "" {
+		outputPath = expandOutputName(*o.outputFile, NameContext{
+			Input:     *o.inputFile,
+			Actor:     selection.Speaker.Name,
+			Style:     selection.Style.Name,
+			SpeakerID: speakerID,
+			Time:      startTime,
+		})
+		if !confirmOverwrite(outputPath, overwrite, interactive) {
+			if !*o.play {
+				return exitOK
+			}
+			outputPath = ""
+		}
+	}
+
+	hookVars := HookVars{Input: *o.inputFile, Output: outputPath}
+	if err := runHook(Hook{Name: "--pre-hook", Command: *o.preHook, Shell: *o.hookShell}, hookVars, *o.failOnHookError); err != nil {
+		return fail(err)
+	}
+
+	if *o.resume && outputPath != "" {
+		store, err := openChunkStore(outputPath)
+		if err != nil {
+			return fail(err)
+		}
+		if n := store.cp.count(); n > 0 {
+			logInfo("'%s' から再開します (保存済みのチャンク: %d 個)", store.dir, n)
+		}
+		resumeStore = store
+	}
+
+	logInfo("音声合成を実行中...")
+	if *o.stream {
+		// --play の場合は、合成できたチャンクから順に、後続のチャンクの合成と並行して再生します
+		var sw *wavStream
+		if outputPath != "" {
+			var err error
+			if sw, err = newWAVStream(outputPath, post, !*o.noMkdir, audioOut); err != nil {
+				return fail(err)
+			}
+		}
+		var player *chunkPlayer
+		if *o.play {
+			player = newChunkPlayer(len(segments))
+		}
+		timings := make([]ChunkTiming, len(segments))
+		failures, err := synthesizeEach(client, segments, speakerID, *o.kanaMode, params, *o.quiet, *o.tolerateFailures, func(i int, seg Segment, wav []byte) error {
+			timings[i] = chunkTiming(seg, wav)
+			if player != nil {
+				item := playItem{pause: seg.Break}
+				if seg.Break <= 0 {
+					played, err := post.apply(wav)
+					if err != nil {
+						return err
+					}
+					item.wav = played
+				}
+				player.play(item)
+			}
+			if sw == nil {
+				return nil
+			}
+			return sw.write(seg, wav)
+		})
+		if err == nil && sw != nil {
+			err = sw.close()
+		}
+		if err != nil {
+			if sw != nil {
+				if *o.keepPartial && ctx.Err() != nil && sw.size > 0 {
+					path := partialPath(outputPath)
+					if err := sw.keep(path); err != nil {
+						logWarn("不完全な音声を保存できませんでした: %v", err)
+					} else {
+						logWarn("不完全な音声です。中断されるまでに合成した音声を '%s' に保存しました", path)
+					}
+				}
+				sw.abort()
+			}
+			if player != nil {
+				player.stop()
+			}
+			return fail(err)
+		}
+		duration := time.Since(startTime)
+		if sw != nil {
+			logInfo("✨ 完了！ (処理時間: %s, 音声の長さ: %.2f 秒)", duration, sw.duration().Seconds())
+		} else {
+			logInfo("✨ 完了！ (処理時間: %s)", duration)
+		}
+		printChunkFailures(failures)
+		if outputPath != "" && outputPath != stdioPath {
+			logInfo("音声を '%s' に保存しました。", outputPath)
+		}
+		if *o.subtitles != "" {
+			if err := writeSubtitles(*o.subtitles, segments, timings, !*o.noMkdir); err != nil {
+				return fail(err)
+			}
+		}
+		if *o.phonemes != "" {
+			if err := writePhonemes(*o.phonemes, timings, !*o.noMkdir); err != nil {
+				return fail(err)
+			}
+		}
+		if player != nil {
+			logInfo("残りの音声の再生が終わるまで待っています...")
+			if err := player.wait(); err != nil {
+				return fail(err)
+			}
+		}
+		if err := runHook(Hook{Name: "--post-hook", Command: *o.postHook, Shell: *o.hookShell}, hookVars, *o.failOnHookError); err != nil {
+			return fail(err)
+		}
+		if resumeStore != nil {
+			if resumeStore.reused > 0 {
+				logInfo("%d 個のチャンクは前回の合成結果を使いました。", resumeStore.reused)
+			}
+			resumeStore.remove()
+		}
+		reportCacheHits()
+		progressEvents.emit("done", map[string]interface{}{"duration_ms": duration.Milliseconds(), "output": outputPath})
+		return exitOK
+	}
+
+	var failures []ChunkFailure
+	var timings []ChunkTiming
+	synth := func(p SynthesisParams) ([]byte, error) {
+		var wav []byte
+		wav, timings, failures, err = synthesizeSegmentsTolerant(client, segments, speakerID, *o.kanaMode, p, *o.quiet, *o.tolerateFailures)
+		return wav, err
+	}
+	var wavData []byte
+	if *o.targetDuration > 0 {
+		wavData, params, err = fitDuration(time.Duration(*o.targetDuration*float64(time.Second)), params, *o.quiet, synth)
+	} else {
+		wavData, err = synth(params)
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
-		os.Exit(1)
+		if (*o.savePartial || (*o.keepPartial && ctx.Err() != nil)) && outputPath != "" {
+			savePartialAudio(outputPath, err, !*o.noMkdir)
+		}
+		return fail(err)
+	}
+
+	// 解析と比較は16bit PCMが対象のため、ビット深度の変換はその後に行います
+	if wavData, err = post.applyPCM16(wavData); err != nil {
+		return fail(err)
 	}
 	duration := time.Since(startTime)
 
-	err = os.WriteFile(*outputFile, wavData, 0644)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "エラー: ファイルの保存に失敗しました: %v\n", err)
-		os.Exit(1)
+	logInfo("✨ 完了！ (処理時間: %s)", duration)
+	printChunkFailures(failures)
+
+	if *o.analyze {
+		stats, err := analyzeWAV(wavData)
+		if err != nil {
+			return fail(fmt.Errorf("合成結果を解析できませんでした: %w", err))
+		}
+		printWAVStats("合成結果", stats)
+	}
+	if *o.compare != "" {
+		if err := compareWithBaseline(*o.compare, wavData, *o.compareThreshold, !*o.noMkdir); err != nil {
+			return fail(err)
+		}
+	}
+	// 無音の検出は16bit PCMが対象のため、ビット深度の変換より前に分割します
+	var parts [][]byte
+	if *o.splitSilence && outputPath != "" {
+		if parts, err = splitBySilence(wavData, *o.minSilenceMs, *o.silenceThreshold); err == nil {
+			parts, err = mergeShortChunks(parts, *o.minChunkMs)
+		}
+		if err != nil {
+			return fail(fmt.Errorf("無音区間での分割に失敗しました: %w", err))
+		}
+	}
+	if wavData, err = post.convertFormat(wavData); err != nil {
+		return fail(err)
 	}
 
-	fmt.Printf("\n✨ 完了！ (処理時間: %s)\n", duration)
-	fmt.Printf("音声を '%s' に保存しました。\n", *outputFile)
+	if parts != nil {
+		for i, part := range parts {
+			path := numberedPath(outputPath, i+1)
+			if !confirmOverwrite(path, overwrite, interactive) {
+				continue
+			}
+			if part, err = post.convertFormat(part); err != nil {
+				return fail(err)
+			}
+			encoded, err := encodeOutput(part, format)
+			if err != nil {
+				return fail(err)
+			}
+			if err := writeOutputFile(path, encoded, !*o.noMkdir); err != nil {
+				return fail(err)
+			}
+			logInfo("音声を '%s' に保存しました。", path)
+			if err := runHook(Hook{Name: "--post-hook", Command: *o.postHook, Shell: *o.hookShell}, HookVars{Input: *o.inputFile, Output: path}, *o.failOnHookError); err != nil {
+				return fail(err)
+			}
+		}
+		logInfo("無音区間で %d 個に分割しました。", len(parts))
+	} else if outputPath != "" {
+		encoded, err := encodeOutput(wavData, format)
+		if err != nil {
+			return fail(err)
+		}
+		if err := writeOutput(outputPath, encoded, !*o.noMkdir, audioOut); err != nil {
+			return fail(err)
+		}
+		if outputPath != stdioPath {
+			logInfo("音声を '%s' に保存しました。", outputPath)
+		}
+		if *o.sidecar {
+			meta := SynthesisMeta{
+				Input:          *o.inputFile,
+				Output:         outputPath,
+				Text:           text,
+				Actor:          selection.Speaker.Name,
+				Style:          selection.Style.Name,
+				StyleID:        speakerID,
+				Kana:           *o.kanaMode,
+				Markup:         *o.markup,
+				Split:          *o.split,
+				MaxChunkChars:  *o.maxChunkChars,
+				SplitOn:        *o.splitOn,
+				Gap:            *o.gap,
+				Params:         params.overrideValues(),
+				RelativeParams: params.relativeSpecs(),
+				CoreVersion:    client.CoreVersion,
+				CreatedAt:      startTime,
+			}
+			if preset != nil {
+				meta.PresetID = &preset.ID
+			}
+			// バージョンは補助的な情報なので、取得できなくても保存は続けます
+			meta.EngineVersion, _ = client.Version()
+			if err := writeSidecar(outputPath, meta); err != nil {
+				return fail(err)
+			}
+		}
+		if err := runHook(Hook{Name: "--post-hook", Command: *o.postHook, Shell: *o.hookShell}, hookVars, *o.failOnHookError); err != nil {
+			return fail(err)
+		}
+	}
+	if *o.subtitles != "" {
+		if err := writeSubtitles(*o.subtitles, segments, timings, !*o.noMkdir); err != nil {
+			return fail(err)
+		}
+	}
+	if *o.phonemes != "" {
+		if err := writePhonemes(*o.phonemes, timings, !*o.noMkdir); err != nil {
+			return fail(err)
+		}
+	}
+	if resumeStore != nil {
+		if resumeStore.reused > 0 {
+			logInfo("%d 個のチャンクは前回の合成結果を使いました。", resumeStore.reused)
+		}
+		resumeStore.remove()
+	}
+	reportCacheHits()
+	progressEvents.emit("done", map[string]interface{}{"duration_ms": duration.Milliseconds(), "output": outputPath})
+
+	if *o.play {
+		logInfo("音声を再生しています...")
+		if err := playWAV(wavData); err != nil {
+			return fail(err)
+		}
+	}
+	return exitOK
 }
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ManifestEntry はバッチ処理のマニフェストの1件を表します。
+// Actor と Speed が空の場合はコマンドラインの指定を使います
+type ManifestEntry struct {
+	Text   string            `json:"text"`
+	Actor  string            `json:"actor"`
+	Speed  *float64          `json:"speed"`
+	Output string            `json:"output"`
+	Vars   map[string]string `json:"vars"` // テキストの変数。--var より優先します
+	Index  int               `json:"-"`    // 1始まりのエントリ番号 (CSVでは行番号)
+}
+
+// loadManifest はマニフェストを読み込みます。拡張子が .json ならJSON配列、.csv ならCSVとして解釈します。
+// CSVの列は「テキスト, 話者, speed, 出力名」の順で、5列目以降には "名前=値" の形式で変数を指定できます。
+// 先頭行が text で始まる場合は見出しとして読み飛ばします
+func loadManifest(path string) ([]ManifestEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, &FileError{Msg: "マニフェストの読み込みに失敗しました", Err: err}
+	}
+	defer f.Close()
+
+	var entries []ManifestEntry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		entries, err = parseManifestJSON(f)
+	case ".csv":
+		entries, err = parseManifestCSV(f)
+	default:
+		return nil, fmt.Errorf("マニフェストは .csv か .json のファイルを指定してください: %s", path)
+	}
+	if err != nil {
+		return nil, &FileError{Msg: fmt.Sprintf("マニフェスト '%s' の解析に失敗しました", path), Err: err}
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("マニフェスト '%s' にエントリがありません", path)
+	}
+	return entries, nil
+}
+
+// parseManifestJSON はJSON配列のマニフェストを解析します
+func parseManifestJSON(r io.Reader) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		entries[i].Index = i + 1
+	}
+	return entries, nil
+}
+
+// parseManifestCSV はCSVのマニフェストを解析します
+func parseManifestCSV(r io.Reader) ([]ManifestEntry, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	var entries []ManifestEntry
+	for line := 1; ; line++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "text") {
+			continue
+		}
+		if len(record) < 4 {
+			return nil, fmt.Errorf("%d 行目: 「テキスト, 話者, speed, 出力名」の4列が必要です", line)
+		}
+
+		entry := ManifestEntry{
+			Text:   record[0],
+			Actor:  strings.TrimSpace(record[1]),
+			Output: strings.TrimSpace(record[3]),
+			Index:  line,
+		}
+		if s := strings.TrimSpace(record[2]); s != "" {
+			speed, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%d 行目: speed '%s' が数値ではありません", line, s)
+			}
+			entry.Speed = &speed
+		}
+		for _, field := range record[4:] {
+			if strings.TrimSpace(field) == "" {
+				continue
+			}
+			name, value, err := parseTextVar(field)
+			if err != nil {
+				return nil, fmt.Errorf("%d 行目: %v", line, err)
+			}
+			if entry.Vars == nil {
+				entry.Vars = map[string]string{}
+			}
+			entry.Vars[name] = value
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// speakerCache は話者名の解決結果を保持し、同じ話者の重複した問い合わせを避けます。
+// サーバーモードでは複数のリクエストから同時に使うため、mu で保護します
+type speakerCache struct {
+	mu         sync.Mutex
+	client     *Client
+	exact      bool
+	selections map[string]*SpeakerSelection
+	errs       map[string]error
+}
+
+func newSpeakerCache(client *Client, exact bool) *speakerCache {
+	return &speakerCache{
+		client:     client,
+		exact:      exact,
+		selections: map[string]*SpeakerSelection{},
+		errs:       map[string]error{},
+	}
+}
+
+// remember は解決済みの話者を登録し、同じ名前で問い合わせ直さないようにします
+func (c *speakerCache) remember(name string, sel *SpeakerSelection) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.selections[name] = sel
+}
+
+// find は話者名を解決します。一度解決した名前（見つからなかった名前を含む）はキャッシュを返します
+func (c *speakerCache) find(name string) (*SpeakerSelection, error) {
+	return c.findStyle(name, "")
+}
+
+// findStyle は話者名とスタイル名を解決します。style が空の場合は find と同じです
+func (c *speakerCache) findStyle(name, style string) (*SpeakerSelection, error) {
+	key := name
+	if style != "" {
+		key = name + "/" + style
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if sel, ok := c.selections[key]; ok {
+		return sel, nil
+	}
+	if err, ok := c.errs[key]; ok {
+		return nil, err
+	}
+	sel, err := c.client.findSpeakerStyle(name, style, c.exact)
+	if err != nil {
+		var connErr *ConnectionError
+		if !errors.As(err, &connErr) {
+			// 接続エラーは一時的なこともあるため、キャッシュしません
+			c.errs[key] = err
+		}
+		return nil, err
+	}
+	c.selections[key] = sel
+	return sel, nil
+}
+
+// ManifestOptions はマニフェストの各エントリに共通する設定です
+type ManifestOptions struct {
+	Path               string // マニフェストのパス ({input} の展開に使います)
+	DefaultActor       string
+	Params             SynthesisParams
+	KanaMode           bool
+	Post               PostProcess
+	Mkdir              bool
+	Overwrite          OverwritePolicy   // バッチ処理では確認せず、overwriteAsk は上書きとして扱います
+	Checkpoint         *checkpoint       // nil でない場合、完了済みのエントリを飛ばし、完了したエントリを記録します
+	Vars               map[string]string // テキストの変数 (組み込みの変数と --var)。エントリの vars で上書きします
+	AllowUndefinedVars bool              // true なら定義されていない変数を空文字に置き換えます
+	Format             string            // --format の指定。空でない場合は出力名の拡張子より優先します
+	Export             string            // --export の形式。空でない場合は音声の隣にセリフの .txt などを保存します
+}
+
+// runManifest はマニフェストの各エントリを順に合成して保存します。
+// 失敗したエントリがあっても続行し、全エントリの結果を返します
+func runManifest(client *Client, speakers *speakerCache, entries []ManifestEntry, opts ManifestOptions) []BatchResult {
+	results := make([]BatchResult, len(entries))
+	for i, entry := range entries {
+		label := strconv.Itoa(entry.Index)
+		key := manifestEntryKey(entry)
+		if output, ok := opts.Checkpoint.completed(key); ok {
+			results[i] = BatchResult{Label: label, Output: output, Skipped: true, Reason: "チェックポイントで完了済み"}
+			continue
+		}
+
+		if client.requestContext().Err() != nil {
+			results[i] = BatchResult{Label: label, Skipped: true, Reason: "中断したため処理していません"}
+			continue
+		}
+
+		logInfo("[%d/%d] %s", i+1, len(entries), preview(entry.Text, 30))
+		output, skipped, err := synthesizeManifestEntry(client, speakers, entry, opts)
+		if errors.Is(err, context.Canceled) {
+			err = errInterrupted
+		}
+		results[i] = BatchResult{Label: label, Output: output, Skipped: skipped, Err: err}
+		if skipped {
+			results[i].Reason = "既に存在します"
+		}
+		if err == nil && !skipped {
+			rec := checkpointRecord{Key: key, Index: entry.Index, Output: output, CompletedAt: time.Now()}
+			if err := opts.Checkpoint.record(rec); err != nil {
+				logWarn("%v", err)
+			}
+		}
+	}
+	return results
+}
+
+// synthesizeManifestEntry はマニフェストの1件を合成し、保存したファイルのパスを返します。
+// 既存ファイルを上書きしない場合は合成せずに skipped を true で返します
+func synthesizeManifestEntry(client *Client, speakers *speakerCache, entry ManifestEntry, opts ManifestOptions) (path string, skipped bool, err error) {
+	text, err := expandTextVars(entry.Text, mergeTextVars(opts.Vars, entry.Vars))
+	if err != nil && !opts.AllowUndefinedVars {
+		return "", false, err
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", false, fmt.Errorf("テキストが空です")
+	}
+	if entry.Output == "" {
+		return "", false, fmt.Errorf("出力名が指定されていません")
+	}
+	output := pathWithFormat(entry.Output, opts.Format)
+	format, err := resolveFormat(output, opts.Format)
+	if err != nil {
+		return "", false, err
+	}
+
+	actor := entry.Actor
+	if actor == "" {
+		actor = opts.DefaultActor
+	}
+	selection, err := speakers.find(actor)
+	if err != nil {
+		return "", false, err
+	}
+
+	path = expandOutputName(output, NameContext{
+		Input:     opts.Path,
+		Actor:     selection.Speaker.Name,
+		Style:     selection.Style.Name,
+		SpeakerID: selection.Style.ID,
+		Time:      time.Now(),
+	})
+	if !confirmOverwrite(path, opts.Overwrite, false) {
+		return path, true, nil
+	}
+
+	params := opts.Params
+	if entry.Speed != nil {
+		params = Segment{Overrides: map[string]float64{"speed": *entry.Speed}}.params(params)
+	}
+	wavData, query, err := synthesizeLine(client, text, selection.Style.ID, opts.KanaMode, params)
+	if err != nil {
+		return "", false, err
+	}
+	if wavData, err = opts.Post.apply(wavData); err != nil {
+		return "", false, err
+	}
+	encoded, err := encodeOutput(wavData, format)
+	if err != nil {
+		return "", false, err
+	}
+
+	if err := writeOutputFile(path, encoded, opts.Mkdir); err != nil {
+		return "", false, err
+	}
+	if opts.Export != "" {
+		if err := writeLineCompanions(path, text, wavData, query, opts.Export); err != nil {
+			return "", false, err
+		}
+	}
+	return path, false, nil
+}
+
+// synthesizeLine は1行のテキストを合成し、合成結果とクエリを返します。キャッシュに同じ内容の合成結果があれば、それを使います
+func synthesizeLine(client *Client, text string, speakerID int, kanaMode bool, params SynthesisParams) ([]byte, *AudioQuery, error) {
+	key := ""
+	if resultCache != nil {
+		key = resultCache.key(Segment{Text: text}, speakerID, kanaMode, params)
+		if wav, query, ok := resultCache.load(key); ok {
+			return wav, query, nil
+		}
+	}
+	query, err := buildQuery(client, text, speakerID, kanaMode, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	wav, err := client.Synthesis(query, speakerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resultCache != nil {
+		if err := resultCache.save(key, wav, query); err != nil {
+			logWarn("合成結果をキャッシュに保存できませんでした: %v", err)
+		}
+	}
+	return wav, query, nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Segment は合成の単位となる1区間を表します。Break が正の場合はその長さの無音区間です
+type Segment struct {
+	Text      string
+	Break     time.Duration
+	Overrides map[string]float64       // タグで部分的に指定されたパラメータ ("speed" など)
+	Relative  map[string]RelativeValue // タグで部分的に指定された相対値 ([speed=+10%] など)
+	Actor     string                   // --dialogue の台本や [voice:] タグで指定された話者名。空の場合はコマンドラインの話者です
+	Style     string                   // Actor のスタイル名。空の場合は --style (未指定なら話者の既定のスタイル) です
+	Speaker   *SpeakerSelection        // Actor を解決した話者。nil の場合はコマンドラインの話者です
+	Query     *AudioQuery              // --query-file で読み込んだ音声合成クエリ。nil の場合は Text から作成します (合成後の区間では合成に使ったクエリです)
+}
+
+// styleID は区間の話者が解決済みならそのスタイルIDを、そうでなければ defaultID を返します
+func (s Segment) styleID(defaultID int) int {
+	if s.Speaker != nil {
+		return s.Speaker.Style.ID
+	}
+	return defaultID
+}
+
+// params は基本のパラメータに区間ごとの指定を上書きしたパラメータを返します
+func (s Segment) params(base SynthesisParams) SynthesisParams {
+	if len(s.Overrides) == 0 && len(s.Relative) == 0 {
+		return base
+	}
+	p := base
+	for name, v := range s.Overrides {
+		p.set(name, v)
+	}
+	for name, rel := range s.Relative {
+		p.setRelative(name, rel)
+	}
+	return p
+}
+
+// markupParamTags はマークアップで区間のパラメータを変更できるタグです
+var markupParamTags = map[string]bool{"speed": true, "pitch": true, "intonation": true, "volume": true}
+
+// markupTagPattern はマークアップのタグ (<speed=1.5>, </speed>, <break time="500ms"/> など) に一致します
+var markupTagPattern = regexp.MustCompile(`<(/?)([a-zA-Z]+)(?:=("?)([^"\s/>]*)("?))?((?:\s+[a-zA-Z]+="[^"]*")*)\s*(/?)>`)
+
+// markupBracketPattern は角括弧のタグ ([speed=1.3], [/speed], [pause=0.5] など) に一致します。
+// 「[注]」のような文章中の角括弧と区別するため、対応しているタグ名だけを対象にします
+var markupBracketPattern = regexp.MustCompile(`(?i)\[(/?)(speed|pitch|intonation|volume|pause|break)(?:=([^\]\s]*))?\]`)
+
+// markupAttrPattern はタグの属性 (time="500ms") に一致します
+var markupAttrPattern = regexp.MustCompile(`([a-zA-Z]+)="([^"]*)"`)
+
+// markupTag はテキスト中のマークアップのタグです
+type markupTag struct {
+	start, end  int // テキスト中のバイト位置
+	closing     bool
+	name        string // 小文字にしたタグ名
+	value       string // = の後の値
+	attrs       map[string]string
+	selfClosing bool
+}
+
+// findMarkupTags は山括弧のタグと角括弧のタグを、テキスト中の順に返します。
+// 山括弧のタグの属性の中など、ほかのタグと重なる角括弧のタグは数えません
+func findMarkupTags(text string) []markupTag {
+	var tags []markupTag
+	for _, m := range markupTagPattern.FindAllStringSubmatchIndex(text, -1) {
+		tag := markupTag{
+			start:       m[0],
+			end:         m[1],
+			closing:     text[m[2]:m[3]] == "/",
+			name:        strings.ToLower(text[m[4]:m[5]]),
+			attrs:       map[string]string{},
+			selfClosing: text[m[14]:m[15]] == "/",
+		}
+		if m[8] >= 0 {
+			tag.value = text[m[8]:m[9]]
+		}
+		for _, a := range markupAttrPattern.FindAllStringSubmatch(text[m[12]:m[13]], -1) {
+			tag.attrs[strings.ToLower(a[1])] = a[2]
+		}
+		tags = append(tags, tag)
+	}
+	for _, m := range markupBracketPattern.FindAllStringSubmatchIndex(text, -1) {
+		tag := markupTag{start: m[0], end: m[1], closing: text[m[2]:m[3]] == "/", name: strings.ToLower(text[m[4]:m[5]])}
+		if m[6] >= 0 {
+			tag.value = text[m[6]:m[7]]
+		}
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].start < tags[j].start })
+
+	result := tags[:0]
+	end := 0
+	for _, tag := range tags {
+		if tag.start < end {
+			continue
+		}
+		result = append(result, tag)
+		end = tag.end
+	}
+	return result
+}
+
+// parseMarkupValue はパラメータのタグの値を解析します。+0.05 のように + を付けるか、-10% のように % を付けると、
+// クエリの値に対する相対値になります (- だけの値は、これまでどおり音高などの負の値として扱います)
+func parseMarkupValue(name, raw, value string) (float64, *RelativeValue, error) {
+	if strings.HasPrefix(value, "+") || strings.HasSuffix(value, "%") {
+		rel, err := parseRelative(name, value)
+		if err != nil {
+			return 0, nil, fmt.Errorf("%s の値 '%s' が不正です (+0.05 や -10%% のように指定してください)", raw, value)
+		}
+		return 0, &rel, nil
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%s の値 '%s' が数値ではありません", raw, value)
+	}
+	return v, nil, nil
+}
+
+// MarkupError はマークアップの誤りを、テキスト中の位置とともに表します
+type MarkupError struct {
+	Offset int // 1始まりの文字位置
+	Msg    string
+}
+
+func (e *MarkupError) Error() string {
+	return fmt.Sprintf("マークアップの解析に失敗しました (%d文字目): %s", e.Offset, e.Msg)
+}
+
+// parseMarkup は <speed=1.5>急いで</speed> や <break time="500ms"/>、[speed=+10%]急いで[/speed] や [pause=0.5] のような
+// 簡易タグを解析し、タグの境界で区切った区間の並びを返します。strict が true の場合、未対応のタグはエラーにします（false なら無視します）
+func parseMarkup(text string, strict bool) ([]Segment, error) {
+	type openTag struct {
+		name  string
+		raw   string
+		value float64
+		rel   *RelativeValue // 相対値の場合は nil 以外です
+	}
+	var stack []openTag
+	var segments []Segment
+
+	runeOffset := func(byteOffset int) int {
+		return len([]rune(text[:byteOffset])) + 1
+	}
+
+	// 未対応のタグを無視した場合はテキストを区切らないよう、境界まで溜めてから区間にします
+	var pending strings.Builder
+	flush := func() {
+		s := strings.TrimSpace(pending.String())
+		pending.Reset()
+		if s == "" {
+			return
+		}
+		seg := Segment{Text: s}
+		// 入れ子のタグは内側の指定を優先します。内側が相対値の場合は、外側の値に対して調整します
+		for _, t := range stack {
+			switch v, ok := seg.Overrides[t.name]; {
+			case t.rel == nil:
+				if seg.Overrides == nil {
+					seg.Overrides = map[string]float64{}
+				}
+				seg.Overrides[t.name] = t.value
+				delete(seg.Relative, t.name)
+			case ok:
+				seg.Overrides[t.name] = t.rel.adjust(t.name, v)
+			default:
+				if seg.Relative == nil {
+					seg.Relative = map[string]RelativeValue{}
+				}
+				seg.Relative[t.name] = *t.rel
+			}
+		}
+		segments = append(segments, seg)
+	}
+
+	pos := 0
+	for _, tag := range findMarkupTags(text) {
+		pending.WriteString(text[pos:tag.start])
+		pos = tag.end
+		raw := text[tag.start:tag.end]
+		name, value := tag.name, tag.value
+		offset := runeOffset(tag.start)
+
+		switch {
+		case (name == "break" || name == "pause") && !tag.closing:
+			if value == "" {
+				value = tag.attrs["time"]
+			}
+			d, err := parseBreakDuration(value)
+			if err != nil {
+				return nil, &MarkupError{Offset: offset, Msg: err.Error()}
+			}
+			flush()
+			segments = append(segments, Segment{Break: d})
+		case markupParamTags[name] && tag.closing:
+			if len(stack) == 0 || stack[len(stack)-1].name != name {
+				return nil, &MarkupError{Offset: offset, Msg: fmt.Sprintf("対応する開始タグが無い %s があります", raw)}
+			}
+			flush()
+			stack = stack[:len(stack)-1]
+		case markupParamTags[name] && !tag.selfClosing:
+			v, rel, err := parseMarkupValue(name, raw, value)
+			if err != nil {
+				return nil, &MarkupError{Offset: offset, Msg: err.Error()}
+			}
+			flush()
+			stack = append(stack, openTag{name: name, raw: raw, value: v, rel: rel})
+		default:
+			if strict {
+				return nil, &MarkupError{Offset: offset, Msg: fmt.Sprintf("未対応のタグです: %s", raw)}
+			}
+		}
+	}
+	pending.WriteString(text[pos:])
+	flush()
+
+	if len(stack) > 0 {
+		return nil, &MarkupError{Offset: runeOffset(len(text)), Msg: fmt.Sprintf("%s が閉じられていません", stack[len(stack)-1].raw)}
+	}
+	return segments, nil
+}
+
+// parseBreakDuration は break (pause) タグの長さ ("500ms", "1.5s", 単位なしは秒) を解析します
+func parseBreakDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, fmt.Errorf("<break> に長さ (time=\"500ms\" など) が指定されていません")
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		value = fmt.Sprintf("%gs", seconds)
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("<break> の長さ '%s' が不正です", value)
+	}
+	return d, nil
+}
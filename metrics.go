@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// durationBuckets は synthesis_duration_seconds のヒストグラムのバケットの上限 (秒) です
+var durationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// metricLabels はカウンタを区別するラベルです
+type metricLabels struct {
+	Actor  string
+	Status int
+}
+
+// histogram はレイテンシの分布です。counts[i] は durationBuckets[i] 以下だった回数です (累積ではありません)
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// serverMetrics はサーバーモードの合成回数・失敗回数・レイテンシを集計し、Prometheusのテキスト形式で公開します
+type serverMetrics struct {
+	mu        sync.Mutex
+	total     map[metricLabels]uint64
+	errors    map[metricLabels]uint64
+	durations map[string]*histogram
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		total:     map[metricLabels]uint64{},
+		errors:    map[metricLabels]uint64{},
+		durations: map[string]*histogram{},
+	}
+}
+
+// observe は1回の合成リクエストの結果を記録します。status が 400 以上の場合は失敗として数えます
+func (m *serverMetrics) observe(actor string, status int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	labels := metricLabels{Actor: actor, Status: status}
+	m.total[labels]++
+	if status >= http.StatusBadRequest {
+		m.errors[labels]++
+	}
+
+	h, ok := m.durations[actor]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(durationBuckets))}
+		m.durations[actor] = h
+	}
+	seconds := d.Seconds()
+	for i, le := range durationBuckets {
+		if seconds <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// ServeHTTP は GET /metrics に、集計したメトリクスをPrometheusのテキスト形式で返します
+func (m *serverMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
+
+// write はメトリクスをPrometheusのテキスト形式で書き出します。出力が安定するよう、ラベルの順に並べます
+func (m *serverMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeCounter(w, "synthesis_total", "合成リクエストの数", m.total)
+	writeCounter(w, "synthesis_errors_total", "失敗した合成リクエストの数", m.errors)
+
+	fmt.Fprintln(w, "# HELP synthesis_duration_seconds 合成リクエストの処理時間")
+	fmt.Fprintln(w, "# TYPE synthesis_duration_seconds histogram")
+	actors := make([]string, 0, len(m.durations))
+	for actor := range m.durations {
+		actors = append(actors, actor)
+	}
+	sort.Strings(actors)
+	for _, actor := range actors {
+		h := m.durations[actor]
+		label := fmt.Sprintf(`actor="%s"`, escapeLabelValue(actor))
+		var cumulative uint64
+		for i, le := range durationBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "synthesis_duration_seconds_bucket{%s,le=\"%s\"} %d\n", label, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(w, "synthesis_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", label, h.count)
+		fmt.Fprintf(w, "synthesis_duration_seconds_sum{%s} %g\n", label, h.sum)
+		fmt.Fprintf(w, "synthesis_duration_seconds_count{%s} %d\n", label, h.count)
+	}
+}
+
+// writeCounter は話者・ステータスコード別のカウンタを書き出します
+func writeCounter(w io.Writer, name, help string, values map[metricLabels]uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	labels := make([]metricLabels, 0, len(values))
+	for l := range values {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].Actor != labels[j].Actor {
+			return labels[i].Actor < labels[j].Actor
+		}
+		return labels[i].Status < labels[j].Status
+	})
+	for _, l := range labels {
+		fmt.Fprintf(w, "%s{actor=\"%s\",status=\"%d\"} %d\n", name, escapeLabelValue(l.Actor), l.Status, values[l])
+	}
+}
+
+// escapeLabelValue はPrometheusのラベル値に使えない文字 (\ " 改行) をエスケープします
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// oggCRCTable は Ogg のページのチェックサム (多項式 0x04c11db7、ビットの反転なし) の表です
+var oggCRCTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return table
+}()
+
+// oggCRC は Ogg のページのチェックサムを計算します
+func oggCRC(b []byte) uint32 {
+	var crc uint32
+	for _, c := range b {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^c]
+	}
+	return crc
+}
+
+// oggPageTarget はページを区切る目安のデータ量 (バイト) です
+const oggPageTarget = 4096
+
+// oggWriter は1つの論理ストリームのパケットを Ogg のページに詰めて書き出します
+type oggWriter struct {
+	out       bytes.Buffer
+	serial    uint32
+	seq       uint32
+	segments  []byte // 書き出し前のページのセグメントテーブル
+	data      []byte
+	granule   int64 // このページで完結したパケットのうち最後のもののグラニュール位置。無ければ -1
+	continued bool  // ページが前のページから続くパケットの途中から始まる
+}
+
+func newOggWriter(serial uint32) *oggWriter {
+	return &oggWriter{serial: serial, granule: -1}
+}
+
+// packet はパケットを追加します。granule はこのパケットまでを復号したときのサンプル数です
+func (w *oggWriter) packet(p []byte, granule int64) {
+	// 最後のパケットが必ず flush(true) のページに入るよう、ページの区切りは次のパケットを追加するときに判断します
+	if len(w.data) >= oggPageTarget {
+		w.flush(false)
+	}
+	for first := true; ; first = false {
+		n := min(len(p), 255)
+		if len(w.segments) == 255 {
+			// セグメントテーブルが埋まったら、パケットの途中でもページを区切ります
+			w.flush(false)
+			w.continued = !first
+		}
+		w.segments = append(w.segments, byte(n))
+		w.data = append(w.data, p[:n]...)
+		p = p[n:]
+		if n < 255 {
+			break
+		}
+	}
+	w.granule = granule
+}
+
+// flush は追加済みのパケットをページとして書き出します。eos が true の場合はストリームの最後のページにします
+func (w *oggWriter) flush(eos bool) {
+	if len(w.segments) == 0 && !eos {
+		return
+	}
+	var flags byte
+	if w.continued {
+		flags |= 0x01
+	}
+	if w.seq == 0 {
+		flags |= 0x02
+	}
+	if eos {
+		flags |= 0x04
+	}
+	header := make([]byte, 27, 27+len(w.segments))
+	copy(header, "OggS")
+	header[5] = flags
+	binary.LittleEndian.PutUint64(header[6:], uint64(w.granule))
+	binary.LittleEndian.PutUint32(header[14:], w.serial)
+	binary.LittleEndian.PutUint32(header[18:], w.seq)
+	header[26] = byte(len(w.segments))
+	page := append(append(header, w.segments...), w.data...)
+	binary.LittleEndian.PutUint32(page[22:], oggCRC(page))
+	w.out.Write(page)
+
+	w.seq++
+	w.segments, w.data = w.segments[:0], w.data[:0]
+	w.granule = -1
+	w.continued = false
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stdioPath は -i / -o で標準入力・標準出力を表すパスです
+const stdioPath = "-"
+
+// NameContext は出力ファイル名のテンプレート展開に使う情報を表します
+type NameContext struct {
+	Input     string // 入力ファイルのパス。--text で指定した場合は空です
+	Actor     string // 話者名
+	Style     string // スタイル名
+	SpeakerID int    // スタイルID
+	Time      time.Time
+}
+
+// placeholderPattern は出力ファイル名テンプレートのプレースホルダ ({name}) に一致します
+var placeholderPattern = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// placeholderValue はプレースホルダ名に対応する値を返します。未知の名前の場合は false を返します
+func placeholderValue(name string, ctx NameContext) (string, bool) {
+	switch name {
+	case "input":
+		switch ctx.Input {
+		case stdioPath:
+			return "stdin", true
+		case "":
+			return "text", true
+		}
+		base := filepath.Base(ctx.Input)
+		return strings.TrimSuffix(base, filepath.Ext(base)), true
+	case "actor", "style":
+		// --speaker-id で指定した場合は話者名とスタイル名が分からないため、スタイルIDを使います
+		value := ctx.Actor
+		if name == "style" {
+			value = ctx.Style
+		}
+		if value == "" {
+			return strconv.Itoa(ctx.SpeakerID), true
+		}
+		return value, true
+	case "id":
+		return strconv.Itoa(ctx.SpeakerID), true
+	case "date":
+		return ctx.Time.Format("20060102"), true
+	case "time":
+		return ctx.Time.Format("150405"), true
+	}
+	return "", false
+}
+
+// expandOutputName は出力ファイル名テンプレートのプレースホルダを置換します。
+// 利用できるプレースホルダは {input} {actor} {style} {id} {date} {time} で、未知のものはそのまま残します
+func expandOutputName(tmpl string, ctx NameContext) string {
+	return placeholderPattern.ReplaceAllStringFunc(tmpl, func(m string) string {
+		value, ok := placeholderValue(m[1:len(m)-1], ctx)
+		if !ok {
+			return m
+		}
+		// 値にパス区切り文字が含まれていても、ディレクトリとして解釈されないようにします
+		return strings.NewReplacer("/", "_", "\\", "_").Replace(value)
+	})
+}
+
+// unknownPlaceholders はテンプレート中の未知のプレースホルダを返します
+func unknownPlaceholders(tmpl string) []string {
+	var unknown []string
+	for _, m := range placeholderPattern.FindAllStringSubmatch(tmpl, -1) {
+		if _, ok := placeholderValue(m[1], NameContext{}); !ok {
+			unknown = append(unknown, m[0])
+		}
+	}
+	return unknown
+}
+
+// readInputFile は入力ファイルを読み込みます。path が "-" の場合は標準入力から読み込みます
+func readInputFile(path string) ([]byte, error) {
+	if path == stdioPath {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, &FileError{Msg: "標準入力の読み込みに失敗しました", Err: err}
+		}
+		return data, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &FileError{Msg: "ファイルの読み込みに失敗しました", Err: err}
+	}
+	return data, nil
+}
+
+// writeOutput は出力を書き込みます。path が "-" の場合はファイルではなく stdout に書き出します
+func writeOutput(path string, data []byte, mkdir bool, stdout io.Writer) error {
+	if path != stdioPath {
+		return writeOutputFile(path, data, mkdir)
+	}
+	if _, err := stdout.Write(data); err != nil {
+		return &FileError{Msg: "標準出力への書き込みに失敗しました", Err: err}
+	}
+	return nil
+}
+
+// checkStdout は -o - のとき、標準出力が端末でないことを確認します。音声のバイト列で端末が乱れるのを防ぎます
+func checkStdout(stdout *os.File) error {
+	if isTerminal(stdout) {
+		return fmt.Errorf("-o - で音声を標準出力に書き出すには、パイプかリダイレクトで出力先を指定してください (例: -o - | ffplay -nodisp -autoexit -)")
+	}
+	return nil
+}
+
+// writeOutputFile は出力ファイルを書き込みます。
+// mkdir が true の場合、出力先のディレクトリが存在しなければ作成します
+func writeOutputFile(path string, data []byte, mkdir bool) error {
+	if err := prepareOutputDir(path, mkdir); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		msg := fmt.Sprintf("ファイル '%s' の保存に失敗しました", path)
+		if errors.Is(err, fs.ErrPermission) {
+			msg += " (書き込み権限を確認してください)"
+		}
+		return &FileError{Msg: msg, Err: err}
+	}
+	return nil
+}
+
+// prepareOutputDir は出力先のディレクトリを確認し、mkdir が true の場合は存在しなければ作成します
+func prepareOutputDir(path string, mkdir bool) error {
+	dir := filepath.Dir(path)
+	if mkdir {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			msg := fmt.Sprintf("出力ディレクトリ '%s' を作成できませんでした", dir)
+			if errors.Is(err, fs.ErrPermission) {
+				msg += " (書き込み権限を確認してください)"
+			}
+			return &FileError{Msg: msg, Err: err}
+		}
+	} else if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return &FileError{Msg: fmt.Sprintf("出力ディレクトリ '%s' が存在しません (--no-mkdir が指定されているため作成しません)", dir), Err: err}
+	}
+	return nil
+}
+
+// OverwritePolicy は出力ファイルが既に存在する場合の扱いを表します
+type OverwritePolicy int
+
+const (
+	overwriteAsk    OverwritePolicy = iota // 対話的な実行なら確認し、そうでなければ上書きします
+	overwriteNever                         // 上書きせずにスキップします (--no-clobber)
+	overwriteAlways                        // 確認せずに上書きします (--force-overwrite)
+)
+
+// confirmOverwrite は path に書き込んでよいかを返します。ファイルが無いか、標準出力 ("-") の場合は常に true です。
+// interactive が true で policy が overwriteAsk の場合は、標準エラー出力で確認します。
+// 上書きしない場合は、その旨を標準エラー出力に表示します
+func confirmOverwrite(path string, policy OverwritePolicy, interactive bool) bool {
+	if path == stdioPath {
+		return true
+	}
+	if _, err := os.Stat(path); err != nil {
+		return true
+	}
+
+	switch policy {
+	case overwriteAlways:
+		return true
+	case overwriteNever:
+		logInfo("'%s' は既に存在するため、上書きせずにスキップします (--no-clobber)", path)
+		return false
+	}
+	if !interactive {
+		return true
+	}
+
+	fmt.Fprintf(os.Stderr, "'%s' は既に存在します。上書きしますか？ [y/N]: ", path)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	logInfo("'%s' の上書きをスキップしました", path)
+	return false
+}
+
+// checkOutputTemplate は strict が true のとき、テンプレートに未知のプレースホルダがあればエラーを返します
+func checkOutputTemplate(tmpl string, strict bool) error {
+	if !strict {
+		return nil
+	}
+	if unknown := unknownPlaceholders(tmpl); len(unknown) > 0 {
+		return fmt.Errorf("出力ファイル名に未知のプレースホルダがあります: %s\n利用できるプレースホルダ: {input} {actor} {style} {id} {date} {time}", strings.Join(unknown, " "))
+	}
+	return nil
+}
+
+// numberedPath は出力ファイル名に連番を付けたパス (out.wav の 1番目なら out_001.wav) を返します
+func numberedPath(path string, n int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s_%03d%s", strings.TrimSuffix(path, ext), n, ext)
+}
+
+// partialPath は --save-partial で不完全な音声を保存するパス (out.mp3 なら out.partial.wav) を返します。
+// 途中で切れた音声はエンコードせず、常にWAVで保存します
+func partialPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".partial.wav"
+}
+
+// savePartialAudio は err が受信の中断による PartialAudioError の場合に、受信済みの音声を partialPath に保存します。
+// 保存できたかどうかにかかわらず、元のエラーは呼び出し元で報告します
+func savePartialAudio(path string, err error, mkdir bool) {
+	var partial *PartialAudioError
+	if !errors.As(err, &partial) {
+		return
+	}
+	path = partialPath(path)
+	if err := writeOutputFile(path, partial.Data, mkdir); err != nil {
+		logWarn("不完全な音声を保存できませんでした: %v", err)
+		return
+	}
+	logWarn("不完全な音声です。中断されるまでに受信した音声を '%s' に保存しました", path)
+}
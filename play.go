@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// customPlayer は --player で指定した再生コマンドです。空の場合は実行環境の標準プレイヤーを探します
+var customPlayer string
+
+// linuxPlayers は Linux で順に探すプレイヤーと、WAVファイルのパスの前に付ける引数です
+var linuxPlayers = [][]string{
+	{"aplay"},
+	{"paplay"},
+	{"pw-play"},
+	{"ffplay", "-nodisp", "-autoexit", "-loglevel", "error"},
+}
+
+// playerCommand は実行環境の標準プレイヤーでWAVファイルを再生するコマンドを返します。
+// --player を指定した場合は、そのコマンドの引数の最後にWAVファイルのパスを付けて実行します
+func playerCommand(path string) (*exec.Cmd, error) {
+	if fields := strings.Fields(customPlayer); len(fields) > 0 {
+		p, err := exec.LookPath(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("--player で指定したプレイヤー '%s' が見つかりません", fields[0])
+		}
+		return exec.Command(p, append(fields[1:], path)...), nil
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("afplay", path), nil
+	case "windows":
+		// SoundPlayer.PlaySync は再生が終わるまで戻らないため、一時ファイルを安全に削除できます
+		script := fmt.Sprintf("(New-Object Media.SoundPlayer '%s').PlaySync()", path)
+		return exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script), nil
+	default:
+		for _, player := range linuxPlayers {
+			if p, err := exec.LookPath(player[0]); err == nil {
+				return exec.Command(p, append(player[1:], path)...), nil
+			}
+		}
+		return nil, fmt.Errorf("再生に使えるプレイヤーが見つかりません (aplay / paplay / pw-play / ffplay のいずれかをインストールするか、--player で指定してください)")
+	}
+}
+
+// playWAV はWAVデータを一時ファイルに書き出し、OS標準のプレイヤーで再生します
+func playWAV(wav []byte) error {
+	tmp, err := os.CreateTemp("", "text2voicevox-*.wav")
+	if err != nil {
+		return &FileError{Msg: "一時ファイルの作成に失敗しました", Err: err}
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(wav); err != nil {
+		tmp.Close()
+		return &FileError{Msg: "一時ファイルへの書き込みに失敗しました", Err: err}
+	}
+	if err := tmp.Close(); err != nil {
+		return &FileError{Msg: "一時ファイルへの書き込みに失敗しました", Err: err}
+	}
+
+	cmd, err := playerCommand(tmp.Name())
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("音声の再生に失敗しました: %v", err)
+	}
+	return nil
+}
+
+// playItem は chunkPlayer で再生する1区間です。wav が nil の場合は pause だけ待ちます
+type playItem struct {
+	wav   []byte
+	pause time.Duration
+}
+
+// chunkPlayer は --stream --play で、合成できたチャンクを後続のチャンクの合成と並行して順に再生します
+type chunkPlayer struct {
+	queue  chan playItem
+	done   chan error
+	cancel chan struct{}
+}
+
+// newChunkPlayer は再生を始めます。size は再生待ちにできる区間の数で、合成を止めないよう区間の総数を指定します
+func newChunkPlayer(size int) *chunkPlayer {
+	p := &chunkPlayer{queue: make(chan playItem, size), done: make(chan error, 1), cancel: make(chan struct{})}
+	go func() {
+		var err error
+		for item := range p.queue {
+			select {
+			case <-p.cancel:
+				continue
+			default:
+			}
+			if err != nil {
+				continue
+			}
+			if item.wav == nil {
+				time.Sleep(item.pause)
+				continue
+			}
+			err = playWAV(item.wav)
+		}
+		p.done <- err
+	}()
+	return p
+}
+
+// play は区間を再生待ちに追加します。再生の終了は待ちません
+func (p *chunkPlayer) play(item playItem) {
+	p.queue <- item
+}
+
+// wait は再生待ちの区間をすべて再生し終えるまで待ち、再生のエラーを返します
+func (p *chunkPlayer) wait() error {
+	close(p.queue)
+	return <-p.done
+}
+
+// stop は再生待ちの区間を捨て、再生中の区間が終わるまで待ちます
+func (p *chunkPlayer) stop() {
+	close(p.cancel)
+	p.wait()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// presetKeys はプリセットに書けるオプションです
+var presetKeys = []string{"actor", "style", "speed", "pitch", "intonation", "volume", "pre-phoneme", "post-phoneme"}
+
+// presetExtensions はプリセットのファイルの拡張子です。同じ名前のファイルがある場合は先のものを使います
+var presetExtensions = []string{".yaml", ".yml", ".toml"}
+
+// presetsDir はプリセットを置くディレクトリ (Linuxなら ~/.config/text2voicevox/presets) を返します
+func presetsDir() (string, error) {
+	return configFilePath("presets")
+}
+
+// findPresetFile はプリセットのファイルを名前で探します
+func findPresetFile(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", fmt.Errorf("プリセット名 '%s' は使えません", name)
+	}
+	dir, err := presetsDir()
+	if err != nil {
+		return "", err
+	}
+	for _, ext := range presetExtensions {
+		path := filepath.Join(dir, name+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("プリセット '%s' が見つかりません ('%s' に %s.yaml を置いてください。--list-presets で一覧を確認できます)", name, dir, name)
+}
+
+// loadPreset はプリセットのファイルを読み込みます
+func loadPreset(path string) ([]ConfigEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &FileError{Msg: fmt.Sprintf("プリセット '%s' の読み込みに失敗しました", path), Err: err}
+	}
+	entries, err := parseConfig(data, strings.EqualFold(filepath.Ext(path), ".toml"))
+	if err != nil {
+		return nil, fmt.Errorf("プリセット '%s' の解析に失敗しました: %v", path, err)
+	}
+	for _, e := range entries {
+		if !isPresetKey(e.Key) {
+			return nil, fmt.Errorf("プリセット '%s' の %d 行目: '%s' はプリセットに書けません (書けるもの: %s)", path, e.Line, e.Key, strings.Join(presetKeys, ", "))
+		}
+	}
+	return entries, nil
+}
+
+func isPresetKey(key string) bool {
+	for _, k := range presetKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// applyPreset は名前で指定したプリセットの値を、コマンドラインで指定していないオプションに設定します
+func applyPreset(fset *flag.FlagSet, name string) error {
+	path, err := findPresetFile(name)
+	if err != nil {
+		return err
+	}
+	entries, err := loadPreset(path)
+	if err != nil {
+		return err
+	}
+	return applyConfig(fset, entries, path)
+}
+
+// listNamedPresets は presets ディレクトリのプリセットの一覧を表示します
+func listNamedPresets() error {
+	dir, err := presetsDir()
+	if err != nil {
+		return err
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return &FileError{Msg: fmt.Sprintf("プリセットのディレクトリ '%s' の読み込みに失敗しました", dir), Err: err}
+	}
+	seen := map[string]bool{}
+	var names []string
+	paths := map[string]string{}
+	for _, ext := range presetExtensions {
+		for _, f := range files {
+			name := strings.TrimSuffix(f.Name(), ext)
+			if f.IsDir() || !strings.HasSuffix(f.Name(), ext) || seen[name] {
+				continue
+			}
+			seen[name] = true
+			names = append(names, name)
+			paths[name] = filepath.Join(dir, f.Name())
+		}
+	}
+	sort.Strings(names)
+
+	fmt.Println("--- 名前付きのプリセット ---")
+	if len(names) == 0 {
+		fmt.Printf("(プリセットはありません。'%s' に <名前>.yaml を置くと使えます)\n", dir)
+	}
+	for _, name := range names {
+		entries, err := loadPreset(paths[name])
+		if err != nil {
+			fmt.Printf("%s: (読み込めません: %v)\n", name, err)
+			continue
+		}
+		parts := make([]string, len(entries))
+		for i, e := range entries {
+			parts[i] = fmt.Sprintf("%s=%s", e.Key, strings.Join(e.Values, ","))
+		}
+		fmt.Printf("%s: %s\n", name, strings.Join(parts, " "))
+	}
+	fmt.Println("----------------------------")
+	fmt.Println("CLIでプリセットを使う際は `--preset <名前>` のように指定してください。")
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Profile は名前を付けて保存した音声パラメータのセットです。キーは "speed" "pre-phoneme" などのフラグ名です
+type Profile map[string]float64
+
+// configFilePath は設定ディレクトリ (Linuxなら ~/.config/text2voicevox) にあるファイルのパスを返します
+func configFilePath(name string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("設定ディレクトリが分かりません: %v", err)
+	}
+	return filepath.Join(dir, "text2voicevox", name), nil
+}
+
+// profilesPath はプロファイルを保存するJSONファイルのパスを返します
+func profilesPath() (string, error) {
+	return configFilePath("profiles.json")
+}
+
+// loadProfiles は保存済みのプロファイルを読み込みます。ファイルが無い場合は空の一覧を返します
+func loadProfiles() (map[string]Profile, error) {
+	path, err := profilesPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]Profile{}, nil
+	}
+	if err != nil {
+		return nil, &FileError{Msg: "プロファイルの読み込みに失敗しました", Err: err}
+	}
+	profiles := map[string]Profile{}
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, &FileError{Msg: fmt.Sprintf("プロファイル '%s' の解析に失敗しました", path), Err: err}
+	}
+	return profiles, nil
+}
+
+// saveProfile は現在のパラメータのうち明示的に指定されたものを、name のプロファイルとして保存します。
+// 同じ名前のプロファイルがあれば置き換えます
+func saveProfile(name string, params SynthesisParams) (string, error) {
+	profiles, err := loadProfiles()
+	if err != nil {
+		return "", err
+	}
+	profile := Profile{}
+	for _, p := range paramNames {
+		if params.Explicit[p] {
+			profile[p] = params.value(p)
+		}
+	}
+	if len(profile) == 0 {
+		return "", fmt.Errorf("保存するパラメータがありません (--speed などを指定してください)")
+	}
+	profiles[name] = profile
+
+	data, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("プロファイルのJSON変換に失敗しました: %v", err)
+	}
+	path, err := profilesPath()
+	if err != nil {
+		return "", err
+	}
+	if err := writeOutputFile(path, append(data, '\n'), true); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// applyProfile はプロファイルの値をパラメータに適用します。
+// コマンドラインで明示的に指定されたパラメータは、プロファイルより優先します
+func applyProfile(params SynthesisParams, profile Profile) SynthesisParams {
+	for _, name := range paramNames {
+		if v, ok := profile[name]; ok && !params.Explicit[name] {
+			params.set(name, v)
+		}
+	}
+	return params
+}
+
+// findProfile は保存済みのプロファイルを名前で探します
+func findProfile(name string) (Profile, error) {
+	profiles, err := loadProfiles()
+	if err != nil {
+		return nil, err
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("プロファイル '%s' は保存されていません (--list-profiles で一覧を確認してください)", name)
+	}
+	return profile, nil
+}
+
+// listProfiles は保存済みのプロファイルの一覧を表示します
+func listProfiles() error {
+	profiles, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Println("--- 保存済みのプロファイル ---")
+	if len(names) == 0 {
+		fmt.Println("(プロファイルはありません。--save-profile で保存できます)")
+	}
+	for _, name := range names {
+		var parts []string
+		for _, p := range paramNames {
+			if v, ok := profiles[name][p]; ok {
+				parts = append(parts, fmt.Sprintf("%s=%g", p, v))
+			}
+		}
+		fmt.Printf("%s: %s\n", name, strings.Join(parts, " "))
+	}
+	fmt.Println("------------------------------")
+	fmt.Println("CLIでプロファイルを使う際は `--profile \"<名前>\"` のように指定してください。")
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// progressBarWidth はプログレスバーの棒部分の文字数です
+const progressBarWidth = 30
+
+// progressBar は全チャンク数に対する完了数を簡易的なバーで描画し、経過時間・残り時間の目安・処理速度 (文字/秒) を添えます。
+// 残り時間は完了した文字数の割合から見積もります。
+// 完了数はatomicに数えるため、複数のgoroutineから increment を呼んでも正しく更新されます
+type progressBar struct {
+	total      int
+	totalChars int
+	doneChars  int
+	start      time.Time
+	done       atomic.Int64
+	out        io.Writer
+	enabled    bool       // 端末にバーを描画します
+	log        bool       // 端末でない場合に、完了したチャンクごとに1行ずつ標準出力に表示します
+	lastLen    int        // 前回描画した行の文字数
+	mu         sync.Mutex // 描画が混ざらないようにします
+}
+
+// newProgressBar は total 件、合わせて totalChars 文字分のプログレスバーを作成します。
+// quiet 指定時は何も表示せず、標準エラー出力が端末でない場合はバーの代わりに1行ずつ表示します
+func newProgressBar(total, totalChars int, quiet bool) *progressBar {
+	enabled := !quiet && isTerminal(os.Stderr)
+	return &progressBar{
+		total:      total,
+		totalChars: totalChars,
+		start:      time.Now(),
+		out:        os.Stderr,
+		enabled:    enabled,
+		log:        !quiet && !enabled,
+	}
+}
+
+// isTerminal はファイルが端末（キャラクタデバイス）かどうかを返します
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// increment は完了数を1つ増やし、バーを再描画します。text は完了したチャンクのテキストで、無音区間では空にします
+func (p *progressBar) increment(text string) {
+	done := p.done.Add(1)
+	p.mu.Lock()
+	p.doneChars += utf8.RuneCountInString(text)
+	p.mu.Unlock()
+	if p.log && text != "" {
+		logInfo("[%d/%d] %s (%s)", done, p.total, preview(text, 30), p.stats())
+	}
+	p.draw(int(done))
+}
+
+// draw は現在の完了数でバーを描画します
+func (p *progressBar) draw(done int) {
+	if !p.enabled || p.total <= 0 {
+		return
+	}
+	filled := progressBarWidth * done / p.total
+	stats := p.stats()
+	line := fmt.Sprintf("[%s%s] %d/%d %s", strings.Repeat("#", filled), strings.Repeat("-", progressBarWidth-filled), done, p.total, stats)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// 前回の表示より短くなった場合に前の文字が残らないよう、空白で上書きします。
+	// 行の長さが変わるのは数字の桁だけのため、文字数の差で足ります
+	n := utf8.RuneCountInString(line)
+	fmt.Fprintf(p.out, "\r%s%s", line, strings.Repeat(" ", max(p.lastLen-n, 0)))
+	p.lastLen = n
+}
+
+// stats は経過時間と、完了した文字数から見積もった残り時間・処理速度を返します
+func (p *progressBar) stats() string {
+	p.mu.Lock()
+	doneChars := p.doneChars
+	p.mu.Unlock()
+	elapsed := time.Since(p.start)
+	s := "経過 " + formatClock(elapsed)
+	if doneChars == 0 || elapsed <= 0 {
+		return s
+	}
+	rate := float64(doneChars) / elapsed.Seconds()
+	remaining := time.Duration(float64(p.totalChars-doneChars) / rate * float64(time.Second))
+	return fmt.Sprintf("%s / 残り約 %s / %.1f 文字/秒", s, formatClock(max(remaining, 0)), rate)
+}
+
+// formatClock は時間を 1:05 や 1:02:03 のような時計の形式にします
+func formatClock(d time.Duration) string {
+	sec := int(d.Round(time.Second).Seconds())
+	if sec >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", sec/3600, sec/60%60, sec%60)
+	}
+	return fmt.Sprintf("%d:%02d", sec/60, sec%60)
+}
+
+// finish はバーの描画を終了し、改行します
+func (p *progressBar) finish() {
+	if !p.enabled {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintln(p.out)
+}
+
+// progressEmitter は進捗イベントを1行1つのJSON (NDJSON) で書き出します。
+// GUIなどの親プロセスが進捗を表示するためのもので、nil の場合は何も出力しません
+type progressEmitter struct {
+	out io.Writer
+	mu  sync.Mutex
+}
+
+// progressEvents は --progress-json 指定時のイベントの出力先です
+var progressEvents *progressEmitter
+
+// emit はイベント名と追加のフィールドを1行のJSONとして書き出します
+func (e *progressEmitter) emit(event string, fields map[string]interface{}) {
+	if e == nil {
+		return
+	}
+	// 読みやすさのため、event を先頭のキーにします
+	name, _ := json.Marshal(event)
+	line := `{"event":` + string(name) + `}`
+	if len(fields) > 0 {
+		rest, err := json.Marshal(fields)
+		if err != nil {
+			return
+		}
+		line = `{"event":` + string(name) + `,` + string(rest[1:])
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fmt.Fprintln(e.out, line)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// loadQueryFile は --query-file で指定した audio_query のJSONを読み込み、合成する区間にします。
+// --dry-run-json と同じく、audio_query 1つか、QueryChunk の配列を受け付けます。
+// 配列の要素に speaker_id がある場合は、その区間だけコマンドラインの話者の代わりに使います
+func loadQueryFile(path string) ([]Segment, error) {
+	data, err := readInputFile(path)
+	if err != nil {
+		return nil, err
+	}
+	invalid := func(err error) error {
+		return &FileError{Msg: fmt.Sprintf("'%s' を audio_query として読み込めませんでした", path), Err: err}
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		var query AudioQuery
+		if err := json.Unmarshal(data, &query); err != nil {
+			return nil, invalid(err)
+		}
+		if query.AccentPhrases == nil {
+			return nil, invalid(fmt.Errorf("accent_phrases がありません"))
+		}
+		return []Segment{{Text: query.Kana, Query: &query}}, nil
+	}
+
+	var chunks []QueryChunk
+	if err := json.Unmarshal(data, &chunks); err != nil {
+		return nil, invalid(err)
+	}
+	segments := make([]Segment, 0, len(chunks))
+	for i, chunk := range chunks {
+		switch {
+		case chunk.Break > 0:
+			segments = append(segments, Segment{Break: time.Duration(chunk.Break * float64(time.Second))})
+			continue
+		case chunk.Query == nil || chunk.Query.AccentPhrases == nil:
+			return nil, invalid(fmt.Errorf("%d 番目の要素に query (accent_phrases) も break もありません", i+1))
+		}
+		seg := Segment{Text: chunk.Text, Query: chunk.Query}
+		if seg.Text == "" {
+			seg.Text = chunk.Query.Kana
+		}
+		if chunk.SpeakerID != nil {
+			seg.Speaker = &SpeakerSelection{Style: SpeakerStyle{ID: *chunk.SpeakerID}}
+		}
+		segments = append(segments, seg)
+	}
+	if len(segments) == 0 {
+		return nil, invalid(fmt.Errorf("要素がありません"))
+	}
+	return segments, nil
+}
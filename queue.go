@@ -0,0 +1,165 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// synthJob はサーバーモードの合成ジョブです
+type synthJob struct {
+	priority int
+	seq      uint64 // 同じ優先度のジョブを受け付けた順に処理するための番号
+	enqueued time.Time
+	run      func()
+	started  bool
+	done     chan struct{}
+	index    int // jobHeap 内の位置 (heap.Remove に使います)
+}
+
+// jobHeap は優先度の高い順、同じ優先度なら受け付けた順にジョブを取り出す container/heap の実装です
+type jobHeap []*synthJob
+
+func (h jobHeap) Len() int { return len(h) }
+
+func (h jobHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h jobHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *jobHeap) Push(x interface{}) {
+	job := x.(*synthJob)
+	job.index = len(*h)
+	*h = append(*h, job)
+}
+
+func (h *jobHeap) Pop() interface{} {
+	old := *h
+	job := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	job.index = -1
+	return job
+}
+
+// jobQueue は合成ジョブを優先度順に、決まった数のワーカーで処理するキューです。
+// 長い合成が短いリクエストをブロックしないよう、優先度の高いジョブを先に取り出します
+type jobQueue struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	jobs      jobHeap
+	seq       uint64
+	workers   int
+	busy      int
+	closed    bool
+	processed uint64
+	totalWait time.Duration
+}
+
+// newJobQueue は workers 個のワーカーを起動したキューを返します
+func newJobQueue(workers int) *jobQueue {
+	q := &jobQueue{workers: workers}
+	q.cond = sync.NewCond(&q.mu)
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q
+}
+
+// do は run をキューに入れ、処理が終わるまで待ちます。
+// 処理が始まる前に ctx が終了した場合 (クライアントの切断など) はキューから取り除き、ctx のエラーを返します
+func (q *jobQueue) do(ctx context.Context, priority int, run func()) error {
+	q.mu.Lock()
+	q.seq++
+	job := &synthJob{priority: priority, seq: q.seq, enqueued: time.Now(), run: run, done: make(chan struct{})}
+	heap.Push(&q.jobs, job)
+	q.cond.Signal()
+	q.mu.Unlock()
+
+	select {
+	case <-job.done:
+		return nil
+	case <-ctx.Done():
+	}
+	q.mu.Lock()
+	if !job.started {
+		heap.Remove(&q.jobs, job.index)
+		q.mu.Unlock()
+		return ctx.Err()
+	}
+	q.mu.Unlock()
+	// 処理が始まったジョブは中断できないため、終わるまで待ちます
+	<-job.done
+	return nil
+}
+
+// work はキューからジョブを取り出して処理します。close されてキューが空になると終了します
+func (q *jobQueue) work() {
+	for {
+		q.mu.Lock()
+		for len(q.jobs) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if len(q.jobs) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		job := heap.Pop(&q.jobs).(*synthJob)
+		job.started = true
+		q.busy++
+		q.processed++
+		q.totalWait += time.Since(job.enqueued)
+		q.mu.Unlock()
+
+		job.run()
+
+		q.mu.Lock()
+		q.busy--
+		q.mu.Unlock()
+		close(job.done)
+	}
+}
+
+// close はキューに残ったジョブを処理し終えたらワーカーを終了させます
+func (q *jobQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+// QueueStatus は GET /status で返すキューの状態です
+type QueueStatus struct {
+	Workers            int     `json:"workers"`
+	Busy               int     `json:"busy"`
+	Queued             int     `json:"queued"`
+	OldestWaitSeconds  float64 `json:"oldest_wait_seconds"`  // 待機中で最も古いジョブの待ち時間
+	AverageWaitSeconds float64 `json:"average_wait_seconds"` // 処理を始めたジョブの平均の待ち時間
+	Processed          uint64  `json:"processed"`
+}
+
+// status はキューの現在の状態を返します
+func (q *jobQueue) status() QueueStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	st := QueueStatus{Workers: q.workers, Busy: q.busy, Queued: len(q.jobs), Processed: q.processed}
+	now := time.Now()
+	for _, job := range q.jobs {
+		if wait := now.Sub(job.enqueued).Seconds(); wait > st.OldestWaitSeconds {
+			st.OldestWaitSeconds = wait
+		}
+	}
+	if q.processed > 0 {
+		st.AverageWaitSeconds = q.totalWait.Seconds() / float64(q.processed)
+	}
+	return st
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitQueued は待機中のジョブが n 個になるまで待ちます
+func waitQueued(t *testing.T, q *jobQueue, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for q.status().Queued != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("queued = %d, want %d", q.status().Queued, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// blockWorker はワーカーを塞ぐジョブを入れ、処理が始まるまで待ちます。返した関数でジョブを終わらせます
+func blockWorker(t *testing.T, q *jobQueue) func() {
+	t.Helper()
+	started := make(chan struct{})
+	gate := make(chan struct{})
+	go q.do(context.Background(), 0, func() {
+		close(started)
+		<-gate
+	})
+	<-started
+	return func() { close(gate) }
+}
+
+func TestJobQueuePriorityOrder(t *testing.T) {
+	q := newJobQueue(1)
+	defer q.close()
+	release := blockWorker(t, q)
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	jobs := []struct {
+		name     string
+		priority int
+	}{
+		{"low", -1},
+		{"normal-1", 0},
+		{"high", 10},
+		{"normal-2", 0},
+		{"mid", 5},
+	}
+	for i, job := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := q.do(context.Background(), job.priority, func() {
+				mu.Lock()
+				order = append(order, job.name)
+				mu.Unlock()
+			})
+			if err != nil {
+				t.Errorf("%s: %v", job.name, err)
+			}
+		}()
+		// 同じ優先度のジョブの順序を確かめるため、1つずつキューに入ったことを確認します
+		waitQueued(t, q, i+1)
+	}
+	if st := q.status(); st.Busy != 1 || st.Queued != len(jobs) {
+		t.Errorf("status = %+v, want 1 busy and %d queued", st, len(jobs))
+	}
+
+	release()
+	wg.Wait()
+	want := []string{"high", "mid", "normal-1", "normal-2", "low"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+	if st := q.status(); st.Processed != uint64(len(jobs)+1) || st.Queued != 0 {
+		t.Errorf("status = %+v, want %d processed", st, len(jobs)+1)
+	}
+}
+
+func TestJobQueueCancelWhileQueued(t *testing.T) {
+	q := newJobQueue(1)
+	defer q.close()
+	release := blockWorker(t, q)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ran := false
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- q.do(ctx, 0, func() { ran = true })
+	}()
+	waitQueued(t, q, 1)
+
+	cancel()
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Errorf("do = %v, want context.Canceled", err)
+	}
+	if st := q.status(); st.Queued != 0 {
+		t.Errorf("queued = %d after cancel, want 0", st.Queued)
+	}
+
+	// 取り除いたジョブは、ワーカーが空いても実行しません
+	release()
+	if err := q.do(context.Background(), 0, func() {}); err != nil {
+		t.Fatal(err)
+	}
+	if ran {
+		t.Error("canceled job ran")
+	}
+}
+
+func TestJobQueueCancelAfterStart(t *testing.T) {
+	q := newJobQueue(1)
+	defer q.close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	finished := false
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- q.do(ctx, 0, func() {
+			close(started)
+			time.Sleep(20 * time.Millisecond)
+			finished = true
+		})
+	}()
+	<-started
+	cancel()
+
+	// 処理が始まったジョブは中断せず、終わるまで待ちます
+	if err := <-errCh; err != nil {
+		t.Errorf("do = %v, want nil", err)
+	}
+	if !finished {
+		t.Error("do returned before the job finished")
+	}
+}
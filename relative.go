@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// relativeParamNames は相対指定 (--speed-rel など) で調整できるパラメータ名の一覧です
+var relativeParamNames = []string{"speed", "pitch", "intonation", "volume"}
+
+// RelativeValue は --speed-rel +20% や --pitch-rel -0.05 のような相対指定を表します
+type RelativeValue struct {
+	Value   float64
+	Percent bool // true なら Value はパーセント、false なら加算する値です
+}
+
+// parseRelative は相対指定を解析します。"+20%" のように % を付けるとパーセント、付けなければ加算する値として扱います
+func parseRelative(name, spec string) (RelativeValue, error) {
+	s := strings.TrimSpace(spec)
+	rel := RelativeValue{}
+	if strings.HasSuffix(s, "%") {
+		rel.Percent = true
+		s = strings.TrimSuffix(s, "%")
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return rel, fmt.Errorf("--%s-rel の値 '%s' が不正です (+20%% や -0.05 のように指定してください)", name, spec)
+	}
+	if rel.Percent && v <= -100 {
+		return rel, fmt.Errorf("--%s-rel に -100%% 以下は指定できません", name)
+	}
+	rel.Value = v
+	return rel, nil
+}
+
+// String は相対指定を "+20%" や "-0.05" の形式で返します
+func (r RelativeValue) String() string {
+	s := strconv.FormatFloat(r.Value, 'g', -1, 64)
+	if r.Value >= 0 {
+		s = "+" + s
+	}
+	if r.Percent {
+		s += "%"
+	}
+	return s
+}
+
+// adjust は base に相対指定を適用した値を返します。
+// 音高はクエリの値が 0 を中心とする対数の値のため、パーセントは周波数の変化の割合として換算します
+func (r RelativeValue) adjust(name string, base float64) float64 {
+	if !r.Percent {
+		return base + r.Value
+	}
+	if name == "pitch" {
+		return base + math.Log2(1+r.Value/100)
+	}
+	return base * (1 + r.Value/100)
+}
+
+// setRelative は相対指定を設定します
+func (p *SynthesisParams) setRelative(name string, rel RelativeValue) {
+	// 呼び出し元と map を共有しないよう複製してから追加します
+	relative := make(map[string]RelativeValue, len(p.Relative)+1)
+	for k, v := range p.Relative {
+		relative[k] = v
+	}
+	relative[name] = rel
+	p.Relative = relative
+}
+
+// relativeSpecs は相対指定を、パラメータ名をキーにして "+20%" の形式で返します
+func (p SynthesisParams) relativeSpecs() map[string]string {
+	if len(p.Relative) == 0 {
+		return nil
+	}
+	specs := map[string]string{}
+	for name, rel := range p.Relative {
+		specs[name] = rel.String()
+	}
+	return specs
+}
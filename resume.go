@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// chunkCheckpointName は --resume で完了したチャンクを記録するファイルの名前です
+const chunkCheckpointName = "checkpoint.jsonl"
+
+// chunkStore は --resume で合成できたチャンクの音声とクエリを出力先の隣のディレクトリに保存し、
+// 再実行時に同じ内容のチャンクを合成し直さずに読み込みます。完了したチャンクは checkpoint に記録します
+type chunkStore struct {
+	dir    string
+	cp     *checkpoint
+	mu     sync.Mutex // --jobs で並行して合成したチャンクを記録するため
+	reused int        // 前回の合成結果を使ったチャンクの数
+}
+
+// resumeStore は --resume で使うチャンクの保存先です。nil の場合は保存しません
+var resumeStore *chunkStore
+
+// chunkDir は出力ファイルに対応するチャンクの保存先 (out.wav なら out.chunks) を返します
+func chunkDir(outputPath string) string {
+	return strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".chunks"
+}
+
+// openChunkStore は出力ファイルに対応するチャンクの保存先を作成し、前回までに完了したチャンクを読み込みます
+func openChunkStore(outputPath string) (*chunkStore, error) {
+	dir := chunkDir(outputPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, &FileError{Msg: fmt.Sprintf("チャンクの保存先 '%s' を作成できませんでした", dir), Err: err}
+	}
+	cp, err := openCheckpoint(filepath.Join(dir, chunkCheckpointName), false)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkStore{dir: dir, cp: cp}, nil
+}
+
+// chunkKey はチャンクを識別するキーを返します。テキスト・話者・パラメータなど、合成結果に関わる内容が変わったチャンクは別のものとして扱います。
+// engine はエンジンのバージョンなど、チャンクの外で合成結果に関わる情報です
+func chunkKey(seg Segment, speakerID int, kanaMode bool, params SynthesisParams, coreVersion, engine string) string {
+	p := seg.params(params)
+	preset := ""
+	if p.Preset != nil {
+		preset = strconv.Itoa(p.Preset.ID)
+	}
+	query := ""
+	if seg.Query != nil {
+		// クエリは構造体をJSONにしたものなので、変換に失敗することはありません
+		data, _ := json.Marshal(seg.Query)
+		query = string(data)
+	}
+	fields := []string{seg.Text, strconv.Itoa(seg.styleID(speakerID)), strconv.FormatBool(kanaMode), p.describe(), preset, query, coreVersion, engine}
+	h := sha256.New()
+	for _, field := range fields {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// load は key のチャンクが保存済みであれば、その音声とクエリを返します。ファイルが読めない場合は未完了として扱います
+func (s *chunkStore) load(key string) ([]byte, *AudioQuery, bool) {
+	s.mu.Lock()
+	path, ok := s.cp.completed(key)
+	s.mu.Unlock()
+	if !ok {
+		return nil, nil, false
+	}
+	wav, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, false
+	}
+	if _, err := parseWAV(wav); err != nil {
+		return nil, nil, false
+	}
+	var query *AudioQuery
+	if data, err := os.ReadFile(strings.TrimSuffix(path, ".wav") + ".json"); err == nil {
+		json.Unmarshal(data, &query)
+	}
+
+	s.mu.Lock()
+	s.reused++
+	s.mu.Unlock()
+	return wav, query, true
+}
+
+// save は合成できたチャンクの音声とクエリを保存し、完了したチャンクとして記録します
+func (s *chunkStore) save(key string, index int, wav []byte, query *AudioQuery) error {
+	path := filepath.Join(s.dir, key+".wav")
+	if query != nil {
+		data, err := json.Marshal(query)
+		if err != nil {
+			return fmt.Errorf("チャンクのクエリのJSON変換に失敗しました: %v", err)
+		}
+		if err := writeOutputFile(strings.TrimSuffix(path, ".wav")+".json", data, false); err != nil {
+			return err
+		}
+	}
+	if err := writeOutputFile(path, wav, false); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cp.record(checkpointRecord{Key: key, Index: index, Output: path, CompletedAt: time.Now()})
+}
+
+// remove は出力ファイルを保存した後に、チャンクの保存先を削除します
+func (s *chunkStore) remove() {
+	if err := os.RemoveAll(s.dir); err != nil {
+		logWarn("チャンクの保存先 '%s' を削除できませんでした: %v", s.dir, err)
+	}
+}
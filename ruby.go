@@ -0,0 +1,22 @@
+package main
+
+import "regexp"
+
+// rubyPattern は --ruby のルビ記法に一致します。
+// 「|親文字《よみ》」「|親文字{よみ}」は | (全角の ｜ も可) から括弧までを、
+// 「漢字《よみ》」「漢字{よみ}」は括弧の直前に続く漢字を親文字とします
+var rubyPattern = regexp.MustCompile(`[|｜]([^|｜《》{}\n]+?)(?:《([^《》\n]+)》|\{([^{}\n]+)\})|([\p{Han}々〆ヶ]+)(?:《([^《》\n]+)》|\{([^{}\n]+)\})`)
+
+// expandRuby はルビ記法の親文字と括弧を、括弧の中の読みに置き換えます。
+// その箇所だけ読みを指定するためのもので、同じ語のほかの箇所は変わりません
+func expandRuby(text string) string {
+	return rubyPattern.ReplaceAllStringFunc(text, func(m string) string {
+		sub := rubyPattern.FindStringSubmatch(m)
+		for _, reading := range []string{sub[2], sub[3], sub[5], sub[6]} {
+			if reading != "" {
+				return reading
+			}
+		}
+		return m
+	})
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// maxRequestBody は POST /synthesize と POST /tts で受け付けるリクエストボディの上限 (バイト) です
+const maxRequestBody = 1 << 20
+
+// statusClientClosed は合成を待つ間や合成中にクライアントが切断したリクエストを、ログとメトリクスに記録するステータスコードです
+const statusClientClosed = 499
+
+// shutdownTimeout は終了時に処理中のリクエストを待つ時間です
+const shutdownTimeout = 30 * time.Second
+
+// SynthesizeRequest は POST /synthesize と POST /tts のリクエストボディを表します。
+// 省略したパラメータはサーバー起動時のコマンドラインの指定（無ければAPIのデフォルト値）を使います
+type SynthesizeRequest struct {
+	Text        string   `json:"text"`
+	Actor       string   `json:"actor"`
+	Style       string   `json:"style"` // 省略時は --style の指定 (無ければ最初のスタイル) を使います
+	PresetID    *int     `json:"preset_id"`
+	Kana        bool     `json:"kana"`
+	Speed       *float64 `json:"speed"`
+	Pitch       *float64 `json:"pitch"`
+	Intonation  *float64 `json:"intonation"`
+	Volume      *float64 `json:"volume"`
+	PrePhoneme  *float64 `json:"pre_phoneme"`
+	PostPhoneme *float64 `json:"post_phoneme"`
+	Priority    int      `json:"priority"` // 大きいほど先に合成します (省略時は 0)
+}
+
+// params はリクエストで指定されたパラメータを base に上書きしたパラメータを返します
+func (r SynthesizeRequest) params(base SynthesisParams) SynthesisParams {
+	p := base
+	for name, v := range map[string]*float64{
+		"speed":        r.Speed,
+		"pitch":        r.Pitch,
+		"intonation":   r.Intonation,
+		"volume":       r.Volume,
+		"pre-phoneme":  r.PrePhoneme,
+		"post-phoneme": r.PostPhoneme,
+	} {
+		if v != nil {
+			p.set(name, *v)
+		}
+	}
+	return p
+}
+
+// ServerOptions はサーバーモードで全リクエストに共通する設定です
+type ServerOptions struct {
+	Listen        string
+	Workers       int    // 同時に合成するジョブの数
+	MetricsListen string // 空でない場合、このアドレスで GET /metrics (Prometheus形式) を公開します
+	DefaultActor  string
+	Params        SynthesisParams
+	Post          PostProcess
+	MaxChunkChars int // POST /tts で、この文字数を超える文をさらに分割します (0で無効)
+}
+
+// synthesisServer は常駐してHTTPで合成リクエストを受け付けるサーバーです。
+// Client と話者の解決結果を使い回すため、起動ごとの初期化を省けます
+type synthesisServer struct {
+	client   *Client
+	speakers *speakerCache
+	opts     ServerOptions
+	metrics  *serverMetrics // --metrics-listen を指定しない場合は nil です
+	queue    *jobQueue
+}
+
+// serve はサーバーを起動し、SIGINT/SIGTERM を受け取ると処理中のリクエストを待ってから終了します
+func serve(client *Client, speakers *speakerCache, opts ServerOptions) error {
+	s := &synthesisServer{client: client, speakers: speakers, opts: opts, queue: newJobQueue(opts.Workers)}
+	defer s.queue.close()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/synthesize", s.handleSynthesize(false))
+	mux.HandleFunc("/tts", s.handleSynthesize(true))
+	mux.HandleFunc("/status", s.handleStatus)
+	srv := &http.Server{Addr: opts.Listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 2)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+	logInfo("サーバーを %s で起動しました (POST /synthesize, POST /tts, GET /status, ワーカー数: %d)。Ctrl+C で終了します。", opts.Listen, opts.Workers)
+
+	var metricsSrv *http.Server
+	if opts.MetricsListen != "" {
+		s.metrics = newServerMetrics()
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", s.metrics)
+		metricsSrv = &http.Server{Addr: opts.MetricsListen, Handler: metricsMux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			errCh <- metricsSrv.ListenAndServe()
+		}()
+		logInfo("メトリクスを %s で公開しました (GET /metrics)。", opts.MetricsListen)
+	}
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("サーバーを起動できませんでした: %v", err)
+	case <-ctx.Done():
+	}
+
+	logInfo("サーバーを終了しています...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("サーバーの終了に失敗しました: %v", err)
+	}
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(shutdownCtx); err != nil {
+			return fmt.Errorf("メトリクスのサーバーの終了に失敗しました: %v", err)
+		}
+	}
+	return nil
+}
+
+// handleSynthesize は POST /synthesize (split が false) と POST /tts (split が true) を処理し、合成したWAVを返します。
+// POST /tts はCLIの --split と同じように文ごとに分けて合成するため、長い文章も受け付けます。
+// ログの出力とメトリクスの記録は、すべてのリクエストについてここで行います
+func (s *synthesisServer) handleSynthesize(split bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		status, actor := s.synthesize(w, r, split)
+		elapsed := time.Since(start)
+		logger.Info(r.Method+" "+r.URL.Path, "status", status, "elapsed_ms", elapsed.Milliseconds())
+		if s.metrics != nil {
+			s.metrics.observe(actor, status, elapsed)
+		}
+	}
+}
+
+// synthesize はリクエストを処理してレスポンスを書き込み、返したステータスコードと話者名を返します。
+// 話者名はエンジン上の名前で、話者を解決する前に失敗した場合は空です。
+// メトリクスのラベルに使うため、リクエストの任意の文字列は返しません
+func (s *synthesisServer) synthesize(w http.ResponseWriter, r *http.Request, split bool) (int, string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		return writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("POST で呼び出してください")), ""
+	}
+
+	var req SynthesizeRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody)).Decode(&req); err != nil {
+		return writeJSONError(w, http.StatusBadRequest, fmt.Errorf("リクエストのJSONが不正です: %v", err)), ""
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		return writeJSONError(w, http.StatusBadRequest, fmt.Errorf("text が空です")), ""
+	}
+
+	actor := req.Actor
+	if actor == "" {
+		actor = s.opts.DefaultActor
+	}
+	selection, err := s.speakers.findStyle(actor, req.Style)
+	if err != nil {
+		return writeJSONError(w, errorStatus(err), err), ""
+	}
+	actor = selection.Speaker.Name
+	params := req.params(s.opts.Params)
+	if req.PresetID != nil {
+		if params.Preset, err = s.client.findPreset(*req.PresetID); err != nil {
+			status := errorStatus(err)
+			if status == http.StatusInternalServerError {
+				// エンジンに登録されていないプリセットIDは、リクエストの誤りとして扱います
+				status = http.StatusBadRequest
+			}
+			return writeJSONError(w, status, err), actor
+		}
+		if err := params.Preset.CheckStyle(selection.Style.ID); err != nil {
+			return writeJSONError(w, http.StatusBadRequest, err), actor
+		}
+	}
+
+	// 合成はキューに入れ、優先度の高いジョブから --workers 個ずつ処理します
+	var wav []byte
+	var synthErr error
+	status := http.StatusOK
+	// クライアントが切断した場合は、エンジンへのリクエストも中断します
+	client := s.client.withContext(r.Context())
+	err = s.queue.do(r.Context(), req.Priority, func() {
+		var err error
+		if split && !req.Kana {
+			// 文ごとの合成結果はキャッシュするため、同じ文を含むリクエストは変わった文だけを合成します
+			var segments []Segment
+			for _, text := range splitText(req.Text, defaultSplitRules, s.opts.MaxChunkChars) {
+				segments = append(segments, Segment{Text: text})
+			}
+			wav, err = synthesizeSegments(client, segments, selection.Style.ID, false, params, true)
+		} else {
+			wav, _, err = synthesizeLine(client, req.Text, selection.Style.ID, req.Kana, params)
+		}
+		if err != nil {
+			status, synthErr = errorStatus(err), err
+			return
+		}
+		if wav, err = s.opts.Post.apply(wav); err != nil {
+			status, synthErr = http.StatusInternalServerError, err
+		}
+	})
+	// 合成中に切断した場合は中断したリクエストのエラーになるため、エンジンの失敗としては扱いません
+	if err != nil || r.Context().Err() != nil {
+		return statusClientClosed, actor
+	}
+	if synthErr != nil {
+		return writeJSONError(w, status, synthErr), actor
+	}
+
+	w.Header().Set("Content-Type", "audio/wav")
+	w.Write(wav)
+	return http.StatusOK, actor
+}
+
+// handleStatus は GET /status に、合成ジョブのキューの状態をJSONで返します
+func (s *synthesisServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("GET で呼び出してください"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(s.queue.status())
+}
+
+// errorStatus はエラーの種類に応じてクライアントに返すステータスコードを選びます
+func errorStatus(err error) int {
+	var kanaErr *KanaError
+	switch exitCode(err) {
+	case exitSpeakerNotFound:
+		return http.StatusNotFound
+	case exitConnection:
+		return http.StatusServiceUnavailable
+	case exitSynthesis:
+		return http.StatusBadGateway
+	}
+	if errors.As(err, &kanaErr) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// writeJSONError はエラーを {"error": "..."} の形式で返します
+func writeJSONError(w http.ResponseWriter, status int, err error) int {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	return status
+}
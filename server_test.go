@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Pikka2048/text2voicevox/voicevox"
+)
+
+// TestSynthesizeClientDisconnect は、合成が始まった後にクライアントが切断した場合も
+// エンジンの失敗 (5xx) ではなく statusClientClosed として記録することを確かめます
+func TestSynthesizeClientDisconnect(t *testing.T) {
+	started := make(chan struct{})
+	engine := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/speakers":
+			io.WriteString(w, `[{"name": "ずんだもん", "speaker_uuid": "uuid", "styles": [{"name": "ノーマル", "id": 3}]}]`)
+		case "/audio_query":
+			// 中断されるまで応答しません
+			close(started)
+			<-r.Context().Done()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer engine.Close()
+
+	client := &Client{Client: voicevox.NewClientWithDoer(engine.URL, engine.Client())}
+	s := &synthesisServer{
+		client:   client,
+		speakers: newSpeakerCache(client, false),
+		opts:     ServerOptions{DefaultActor: "ずんだもん"},
+		queue:    newJobQueue(1),
+	}
+	defer s.queue.close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req := httptest.NewRequest(http.MethodPost, "/synthesize", strings.NewReader(`{"text": "こんにちは"}`)).WithContext(ctx)
+	done := make(chan int, 1)
+	go func() {
+		status, _ := s.synthesize(httptest.NewRecorder(), req, false)
+		done <- status
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("synthesis did not start")
+	}
+	cancel()
+	select {
+	case status := <-done:
+		if status != statusClientClosed {
+			t.Errorf("status = %d, want %d", status, statusClientClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("synthesize did not return after the client disconnected")
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// SynthesisMeta は合成に使った情報です。--sidecar で出力ファイルの隣に保存し、--load-query で読み込んで再合成できます
+type SynthesisMeta struct {
+	Input          string             `json:"input,omitempty"`
+	Output         string             `json:"output"`
+	Text           string             `json:"text"` // 置換や数字の読みの変換を済ませた後のテキスト
+	Actor          string             `json:"actor"`
+	Style          string             `json:"style"`
+	StyleID        int                `json:"style_id"`
+	Kana           bool               `json:"kana,omitempty"`
+	Markup         bool               `json:"markup,omitempty"`
+	Split          bool               `json:"split,omitempty"`
+	MaxChunkChars  int                `json:"max_chunk_chars,omitempty"`
+	SplitOn        string             `json:"split_on,omitempty"`        // --split で区切る種類。空の場合は句点・感嘆符・疑問符と改行です
+	Gap            float64            `json:"gap,omitempty"`             // 区間の間に挟んだ無音 (秒)
+	Params         map[string]float64 `json:"params"`                    // 明示的に指定したパラメータ。無いものはAPIのデフォルト値です
+	RelativeParams map[string]string  `json:"relative_params,omitempty"` // 相対指定 ("+20%" など)。Params を適用した後のクエリの値に対して調整します
+	PresetID       *int               `json:"preset_id,omitempty"`
+	EngineVersion  string             `json:"engine_version,omitempty"`
+	CoreVersion    string             `json:"core_version,omitempty"`
+	CreatedAt      time.Time          `json:"created_at"`
+}
+
+// sidecarPath は出力ファイルに対応するサイドカーファイルのパス (out.wav なら out.wav.json) を返します
+func sidecarPath(outputPath string) string {
+	return outputPath + ".json"
+}
+
+// writeSidecar は合成に使った情報を、出力ファイルの隣のサイドカーファイルに書き出します
+func writeSidecar(outputPath string, meta SynthesisMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("サイドカーのJSON変換に失敗しました: %v", err)
+	}
+	return writeOutputFile(sidecarPath(outputPath), append(data, '\n'), false)
+}
+
+// loadSidecar はサイドカーファイルを読み込みます
+func loadSidecar(path string) (*SynthesisMeta, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &FileError{Msg: "サイドカーファイルの読み込みに失敗しました", Err: err}
+	}
+	var meta SynthesisMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, &FileError{Msg: fmt.Sprintf("サイドカーファイル '%s' の解析に失敗しました", path), Err: err}
+	}
+	if meta.Text == "" {
+		return nil, &FileError{Msg: fmt.Sprintf("サイドカーファイル '%s' を再合成に使えません", path), Err: fmt.Errorf("text が必要です")}
+	}
+	return &meta, nil
+}
+
+// overrideValues は明示的に指定されたパラメータの値を、パラメータ名をキーにして返します
+func (p SynthesisParams) overrideValues() map[string]float64 {
+	values := map[string]float64{}
+	for _, name := range p.overrides() {
+		values[name] = p.value(name)
+	}
+	return values
+}
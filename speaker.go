@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// matchSpeakers は名前が完全一致しない場合の候補として、前方一致、無ければ部分一致する話者を返します
+func matchSpeakers(speakers []Speaker, name string) []Speaker {
+	var prefix, contains []Speaker
+	for _, speaker := range speakers {
+		switch {
+		case strings.HasPrefix(speaker.Name, name):
+			prefix = append(prefix, speaker)
+		case strings.Contains(speaker.Name, name):
+			contains = append(contains, speaker)
+		}
+	}
+	if len(prefix) > 0 {
+		return prefix
+	}
+	return contains
+}
+
+// suggestSpeakers は編集距離が近い順に、名前の候補を最大 limit 件返します
+func suggestSpeakers(speakers []Speaker, name string, limit int) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+	// 名前の長さの半分程度までの違いを「似ている」とみなします
+	maxDistance := len([]rune(name))/2 + 1
+
+	var candidates []candidate
+	for _, speaker := range speakers {
+		if d := levenshtein(name, speaker.Name); d <= maxDistance {
+			candidates = append(candidates, candidate{speaker.Name, d})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+
+	var names []string
+	for i := 0; i < len(candidates) && i < limit; i++ {
+		names = append(names, candidates[i].name)
+	}
+	return names
+}
+
+// speakerNames は話者名の一覧を返します
+func speakerNames(speakers []Speaker) []string {
+	names := make([]string, len(speakers))
+	for i, speaker := range speakers {
+		names[i] = speaker.Name
+	}
+	return names
+}
+
+// levenshtein は2つの文字列の編集距離を文字 (rune) 単位で計算します
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// SpeakerListOptions は話者一覧の絞り込みと並べ替えの指定です
+type SpeakerListOptions struct {
+	Filter      string // 話者名の部分一致で絞り込みます
+	FilterStyle string // スタイル名の部分一致で絞り込みます (一致したスタイルだけを残します)
+	StyleType   string // スタイルのタイプで絞り込みます。タイプを返さない古いエンジンのスタイルは常に残します
+	Sort        string // "name" (話者名順) または "id" (スタイルID順)。空の場合はエンジンの順序のままです
+	JSON        bool   // JSONで出力します
+}
+
+// styleTypes は --style-type で指定できるスタイルのタイプです
+var styleTypes = []string{"talk", "singing_teacher", "frame_decode", "sing"}
+
+// defaultStyleType は --style-type を指定しない場合に優先するスタイルのタイプです
+const defaultStyleType = "talk"
+
+// checkStyleType は --style-type の指定が正しいかを確認します
+func checkStyleType(styleType string) error {
+	if styleType == "" {
+		return nil
+	}
+	for _, t := range styleTypes {
+		if t == styleType {
+			return nil
+		}
+	}
+	return fmt.Errorf("--style-type には %s のいずれかを指定してください: %s", strings.Join(styleTypes, ", "), styleType)
+}
+
+// matchStyleType はスタイルが指定したタイプに一致するかを返します。
+// タイプが未指定の場合と、タイプを返さない古いエンジンのスタイルは常に一致します
+func matchStyleType(style SpeakerStyle, styleType string) bool {
+	return styleType == "" || style.Type == "" || style.Type == styleType
+}
+
+// selectStyle は話者のスタイルから、指定したタイプの最初のスタイルを選びます。
+// タイプが未指定の場合は talk を優先し、無ければ先頭のスタイルを使います。
+// どのスタイルもタイプを持たない古いエンジンでは、タイプに関わらず先頭のスタイルを使います
+func selectStyle(styles []SpeakerStyle, styleType string) (SpeakerStyle, bool) {
+	want := styleType
+	if want == "" {
+		want = defaultStyleType
+	}
+	typed := false
+	for _, st := range styles {
+		if st.Type == want {
+			return st, true
+		}
+		typed = typed || st.Type != ""
+	}
+	if styleType == "" || !typed {
+		return styles[0], true
+	}
+	return SpeakerStyle{}, false
+}
+
+// findStyle は話者のスタイルから、名前で指定したスタイルを選びます。
+// 完全一致するスタイルが無ければ、ひらがなとカタカナ、英字の大文字と小文字を区別せずに比べ、
+// 一致・前方一致・部分一致の順に一意に決まるスタイルを使います。styleType に一致しないタイプのスタイルは選びません
+func findStyle(speaker Speaker, name, styleType string) (SpeakerStyle, error) {
+	var styles, named []SpeakerStyle
+	for _, st := range speaker.Styles {
+		if !matchStyleType(st, styleType) {
+			continue
+		}
+		styles = append(styles, st)
+		if st.Name == name {
+			named = append(named, st)
+		}
+	}
+	if len(named) > 0 {
+		// 同じ名前のスタイルがタイプ違いで複数ある場合は、selectStyle と同じく talk を優先します
+		style, _ := selectStyle(named, styleType)
+		return style, nil
+	}
+
+	key := foldStyleName(name)
+	var equal, prefix, contains []SpeakerStyle
+	for _, st := range styles {
+		folded := foldStyleName(st.Name)
+		switch {
+		case folded == key:
+			equal = append(equal, st)
+		case strings.HasPrefix(folded, key):
+			prefix = append(prefix, st)
+		case strings.Contains(folded, key):
+			contains = append(contains, st)
+		}
+	}
+	matches := equal
+	if len(matches) == 0 {
+		matches = prefix
+	}
+	if len(matches) == 0 {
+		matches = contains
+	}
+	switch names := styleNames(matches); len(names) {
+	case 0:
+		return SpeakerStyle{}, &SpeakerNotFoundError{Name: speaker.Name, Style: name, Styles: styleNames(styles)}
+	case 1:
+		style, _ := selectStyle(matches, styleType)
+		logInfo("'%s' に一致したスタイル '%s' を使用します。", name, style.Name)
+		return style, nil
+	default:
+		return SpeakerStyle{}, &SpeakerNotFoundError{Name: speaker.Name, Style: name, Candidates: names}
+	}
+}
+
+// styleNames はスタイル名の一覧を、重複を除いて返します
+func styleNames(styles []SpeakerStyle) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, st := range styles {
+		if !seen[st.Name] {
+			seen[st.Name] = true
+			names = append(names, st.Name)
+		}
+	}
+	return names
+}
+
+// foldStyleName はスタイル名を比べるために、カタカナをひらがなに、英字を小文字にそろえます
+func foldStyleName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'ァ' && r <= 'ヶ' {
+			return r - 'ァ' + 'ぁ'
+		}
+		return unicode.ToLower(r)
+	}, name)
+}
+
+// speakerSortKeys は --sort で指定できる並べ替えの種類です
+var speakerSortKeys = []string{"name", "id"}
+
+// checkSpeakerSort は --sort の指定が正しいかを確認します
+func checkSpeakerSort(key string) error {
+	if key == "" {
+		return nil
+	}
+	for _, k := range speakerSortKeys {
+		if k == key {
+			return nil
+		}
+	}
+	return fmt.Errorf("--sort には %s のいずれかを指定してください: %s", strings.Join(speakerSortKeys, ", "), key)
+}
+
+// filterSpeakers は話者一覧を絞り込み、並べ替えた結果を返します。元のスライスは変更しません
+func filterSpeakers(speakers []Speaker, opts SpeakerListOptions) []Speaker {
+	filter := strings.ToLower(opts.Filter)
+	filterStyle := strings.ToLower(opts.FilterStyle)
+
+	var result []Speaker
+	for _, sp := range speakers {
+		if filter != "" && !strings.Contains(strings.ToLower(sp.Name), filter) {
+			continue
+		}
+		if filterStyle != "" || opts.StyleType != "" {
+			var styles []SpeakerStyle
+			for _, st := range sp.Styles {
+				if strings.Contains(strings.ToLower(st.Name), filterStyle) && matchStyleType(st, opts.StyleType) {
+					styles = append(styles, st)
+				}
+			}
+			if len(styles) == 0 {
+				continue
+			}
+			sp.Styles = styles
+		}
+		result = append(result, sp)
+	}
+
+	switch opts.Sort {
+	case "name":
+		sort.SliceStable(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	case "id":
+		for i := range result {
+			styles := append([]SpeakerStyle(nil), result[i].Styles...)
+			sort.Slice(styles, func(a, b int) bool { return styles[a].ID < styles[b].ID })
+			result[i].Styles = styles
+		}
+		sort.SliceStable(result, func(i, j int) bool { return minStyleID(result[i]) < minStyleID(result[j]) })
+	}
+	return result
+}
+
+// minStyleID は話者のスタイルIDの最小値を返します
+func minStyleID(sp Speaker) int {
+	id := math.MaxInt
+	for _, st := range sp.Styles {
+		id = min(id, st.ID)
+	}
+	return id
+}
+
+// majorMinor はバージョン文字列 ("0.14.5" など) のメジャー・マイナー部分 ("0.14") を返します
+func majorMinor(version string) string {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) < 2 {
+		return parts[0]
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// versionMismatch は2つのバージョンのメジャー・マイナー部分が異なるかどうかを返します。
+// どちらかが空の場合は判定できないため false を返します
+func versionMismatch(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	return majorMinor(a) != majorMinor(b)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// sentenceTerminators は文の終わりとみなす文字です
+const sentenceTerminators = "。．！？!?"
+
+// openingBrackets は中の文末記号で文を区切らない括弧の始まりです
+const openingBrackets = "「『（(【"
+
+// closingBrackets は文末記号の直後にあれば同じ文に含める閉じ括弧です
+const closingBrackets = "」』）)】"
+
+// quoteParticles は閉じ括弧の直後にあれば、括弧の中を引用として同じ文に含める助詞 (と、って) の始まりです
+const quoteParticles = "とっ"
+
+// ellipsisMarks は文末記号の直後にあれば同じ文に含める三点リーダーです
+const ellipsisMarks = "…‥"
+
+// splitOnKinds は --split-on で指定できる区切りの種類と、文の終わりとみなす文字です (newline は改行)
+var splitOnKinds = map[string]string{
+	"period":      "。．",
+	"exclamation": "！？!?",
+	"ellipsis":    ellipsisMarks,
+	"comma":       "、，",
+	"newline":     "",
+}
+
+// splitOnNames は --split-on のヘルプやエラーに表示する区切りの種類です
+var splitOnNames = []string{"period", "exclamation", "ellipsis", "comma", "newline"}
+
+// SplitRules は --split でテキストを文に区切る規則です
+type SplitRules struct {
+	Terminators string // 文の終わりとみなす文字
+	Newline     bool   // 改行で区切るか。false の場合、改行は無視して前後をつなげます
+}
+
+// defaultSplitRules は --split-on を指定しない場合の規則です。句点・感嘆符・疑問符と改行で区切ります
+var defaultSplitRules = SplitRules{Terminators: sentenceTerminators, Newline: true}
+
+// parseSplitOn は --split-on の値 ("period,exclamation,newline" など) を区切りの規則にします
+func parseSplitOn(spec string) (SplitRules, error) {
+	var rules SplitRules
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		chars, ok := splitOnKinds[name]
+		if !ok {
+			return SplitRules{}, fmt.Errorf("--split-on には %s をカンマ区切りで指定してください: %s", strings.Join(splitOnNames, ", "), name)
+		}
+		if name == "newline" {
+			rules.Newline = true
+		}
+		rules.Terminators += chars
+	}
+	return rules, nil
+}
+
+// splitSentences はテキストを rules の文末記号と改行で文単位に分割します。空の文は除きます。
+// 「」などの括弧の中の文末記号では区切らず、「こんにちは。」と言った。のような文は1文として扱います
+func splitSentences(text string, rules SplitRules) []string {
+	var sentences []string
+	var current strings.Builder
+	depth := 0
+
+	flush := func() {
+		if s := strings.TrimSpace(current.String()); s != "" {
+			sentences = append(sentences, s)
+		}
+		current.Reset()
+	}
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == '\n' || r == '\r' {
+			if rules.Newline {
+				// 閉じ忘れた括弧で残りがすべて1文にならないよう、改行で括弧の対応を打ち切ります
+				depth = 0
+				flush()
+			}
+			continue
+		}
+		current.WriteRune(r)
+		switch {
+		case strings.ContainsRune(openingBrackets, r):
+			depth++
+		case strings.ContainsRune(closingBrackets, r) && depth > 0:
+			depth--
+			// 文末記号で終わる括弧は、「こんにちは。」と言った。のように引用の助詞が続く場合を除いて区切ります
+			if depth == 0 && i > 0 && strings.ContainsRune(rules.Terminators, runes[i-1]) &&
+				(i+1 == len(runes) || !strings.ContainsRune(quoteParticles, runes[i+1])) {
+				flush()
+			}
+		case strings.ContainsRune(rules.Terminators, r) && depth == 0:
+			// 「！？」や「！……」のような連続した文末記号・三点リーダーや閉じ括弧は同じ文に含めます
+			for i+1 < len(runes) && strings.ContainsRune(rules.Terminators+sentenceTerminators+ellipsisMarks+closingBrackets, runes[i+1]) {
+				i++
+				current.WriteRune(runes[i])
+			}
+			flush()
+		}
+	}
+	flush()
+
+	return sentences
+}
+
+// commaMarks は長い文を分割するときに優先して区切る読点です
+const commaMarks = "、，,"
+
+// chunkParticles は直後で区切ってもアクセントが崩れにくい助詞です
+const chunkParticles = "はがをにでとものへや"
+
+// defaultMinChunkChars は分割後のチャンクの最小文字数です。細かすぎるとアクセントが不自然になるため、これより短くは切りません
+const defaultMinChunkChars = 10
+
+// minMaxChunkChars は --max-chunk-chars に指定できる最小の文字数です。
+// これより小さいと前半と残りの両方を defaultMinChunkChars 文字以上にできず、句読点だけのチャンクができるためです
+const minMaxChunkChars = 2 * defaultMinChunkChars
+
+// splitText はテキストを rules に従って文単位に分割し、maxChars 文字を超える文はさらに自然な位置で分割します。
+// 区切る位置は読点、助詞の直後、空白の順に探し、見つからない極端に長い語は maxChars 文字以内で強制的に分割します。
+// maxChars が 0 以下の場合は文単位の分割のみ行い、minMaxChunkChars より小さい場合は minMaxChunkChars 文字とします
+func splitText(text string, rules SplitRules, maxChars int) []string {
+	sentences := splitSentences(text, rules)
+	if maxChars <= 0 {
+		return sentences
+	}
+	maxChars = max(maxChars, minMaxChunkChars)
+	minChars := defaultMinChunkChars
+
+	var chunks []string
+	for _, sentence := range sentences {
+		rest := []rune(sentence)
+		for len(rest) > maxChars {
+			cut := chunkBoundary(rest, maxChars, minChars)
+			if chunk := strings.TrimSpace(string(rest[:cut])); chunk != "" {
+				chunks = append(chunks, chunk)
+			}
+			rest = []rune(strings.TrimSpace(string(rest[cut:])))
+		}
+		if len(rest) > 0 {
+			chunks = append(chunks, string(rest))
+		}
+	}
+	return chunks
+}
+
+// chunkBoundary は runes の先頭 maxChars 文字以内で区切る位置（区切った前半の文字数）を返します。
+// 前半と残りのどちらも minChars 文字以上になる位置のうち、読点、助詞の直後、空白の順に最も後ろのものを選びます。
+// 句読点や閉じ括弧の直前では区切らず、前の文字と同じチャンクに含めます
+func chunkBoundary(runes []rune, maxChars, minChars int) int {
+	last := min(maxChars, len(runes)-minChars)
+	trailing := func(i int) bool {
+		return strings.ContainsRune(commaMarks+sentenceTerminators+ellipsisMarks+closingBrackets, runes[i])
+	}
+	isBoundary := []func(i int) bool{
+		func(i int) bool { return strings.ContainsRune(commaMarks, runes[i-1]) },
+		func(i int) bool {
+			return strings.ContainsRune(chunkParticles, runes[i-1]) && !unicode.Is(unicode.Hiragana, runes[i])
+		},
+		func(i int) bool { return unicode.IsSpace(runes[i-1]) },
+		// 区切りやすい位置が無い場合は、句読点の直前を避けて強制的に区切ります
+		func(i int) bool { return true },
+	}
+	for _, ok := range isBoundary {
+		for i := last; i >= minChars && i > 0; i-- {
+			if ok(i) && !trailing(i) {
+				return i
+			}
+		}
+	}
+	return last
+}
+
+// splitLines はテキストを行単位に分割します。空行は除きます
+func splitLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// splitSegments は各区間のテキストを splitFn で分割します。分割後の区間は元の区間のパラメータ指定と話者を引き継ぎます
+func splitSegments(segments []Segment, splitFn func(string) []string) []Segment {
+	var result []Segment
+	for _, seg := range segments {
+		if seg.Break > 0 {
+			result = append(result, seg)
+			continue
+		}
+		for _, text := range splitFn(seg.Text) {
+			part := seg
+			part.Text = text
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+// insertGaps は続けて読み上げる区間の間に、gap の長さの無音区間を挟みます。
+// 既に無音区間 (<break> タグなど) がある箇所には挟みません
+func insertGaps(segments []Segment, gap time.Duration) []Segment {
+	var result []Segment
+	for i, seg := range segments {
+		if i > 0 && seg.Break == 0 && segments[i-1].Break == 0 {
+			result = append(result, Segment{Break: gap})
+		}
+		result = append(result, seg)
+	}
+	return result
+}
+
+// preview はログ表示用にテキストの先頭を切り出します
+func preview(text string, maxRunes int) string {
+	runes := []rune(text)
+	if len(runes) <= maxRunes {
+		return text
+	}
+	return string(runes[:maxRunes]) + "…"
+}
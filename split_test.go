@@ -0,0 +1,204 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitSentences(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		rules SplitRules
+		want  []string
+	}{
+		{
+			name: "terminators",
+			text: "おはよう。元気？うん！",
+			want: []string{"おはよう。", "元気？", "うん！"},
+		},
+		{
+			name: "brackets",
+			text: "彼は「待って。行かないで！」と言った。（注：これは夢。）次の文。",
+			want: []string{"彼は「待って。行かないで！」と言った。", "（注：これは夢。）", "次の文。"},
+		},
+		{
+			name: "closing bracket ends sentence",
+			text: "「こんにちは。」「さようなら。」",
+			want: []string{"「こんにちは。」", "「さようなら。」"},
+		},
+		{
+			name: "quote particles",
+			text: "「本当に。」って聞いた。「はい。」とだけ答えた。",
+			want: []string{"「本当に。」って聞いた。", "「はい。」とだけ答えた。"},
+		},
+		{
+			name: "nested brackets",
+			text: "「『行く。』と言った。」そうだ。",
+			want: []string{"「『行く。』と言った。」", "そうだ。"},
+		},
+		{
+			name: "ellipsis and repeated marks",
+			text: "そうか……。本当に！？……嘘だろ。",
+			want: []string{"そうか……。", "本当に！？……", "嘘だろ。"},
+		},
+		{
+			name: "terminator followed by closing bracket",
+			text: "（笑）。はい。）終わり。",
+			want: []string{"（笑）。", "はい。）", "終わり。"},
+		},
+		{
+			name: "unclosed bracket stops at newline",
+			text: "「閉じ忘れ。まだ中。\n次の行。",
+			want: []string{"「閉じ忘れ。まだ中。", "次の行。"},
+		},
+		{
+			name: "blank lines and spaces",
+			text: "  一行目  \n\n\r\n二行目",
+			want: []string{"一行目", "二行目"},
+		},
+		{
+			name:  "joined lines without newline rule",
+			text:  "一行目の\n続き。二文目",
+			rules: SplitRules{Terminators: "。"},
+			want:  []string{"一行目の続き。", "二文目"},
+		},
+		{
+			name:  "ellipsis as terminator",
+			text:  "ええと…それで…。",
+			rules: SplitRules{Terminators: ellipsisMarks},
+			want:  []string{"ええと…", "それで…。"},
+		},
+		{
+			name:  "comma",
+			text:  "晴れ、ときどき曇り。",
+			rules: SplitRules{Terminators: "、。"},
+			want:  []string{"晴れ、", "ときどき曇り。"},
+		},
+		{
+			name: "empty",
+			text: " \n ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := tt.rules
+			if rules.Terminators == "" {
+				rules = defaultSplitRules
+			}
+			if got := splitSentences(tt.text, rules); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitSentences(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSplitOn(t *testing.T) {
+	rules, err := parseSplitOn("period, Exclamation,newline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (SplitRules{Terminators: "。．！？!?", Newline: true}); rules != want {
+		t.Errorf("parseSplitOn = %+v, want %+v", rules, want)
+	}
+	if _, err := parseSplitOn("period,semicolon"); err == nil || !strings.Contains(err.Error(), "semicolon") {
+		t.Errorf("parseSplitOn(semicolon) = %v, want an error naming it", err)
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		maxChars int
+		want     []string
+	}{
+		{
+			name:     "disabled",
+			text:     "とても長い文章で句点がなかなか来ないけれど、分割はしない。",
+			maxChars: 0,
+			want:     []string{"とても長い文章で句点がなかなか来ないけれど、分割はしない。"},
+		},
+		{
+			name:     "exactly max",
+			text:     strings.Repeat("あ", 20),
+			maxChars: 20,
+			want:     []string{strings.Repeat("あ", 20)},
+		},
+		{
+			name:     "comma",
+			text:     "今日は朝からずっと雨が降っていたので、散歩に行くのはやめておきました。",
+			maxChars: 30,
+			want:     []string{"今日は朝からずっと雨が降っていたので、", "散歩に行くのはやめておきました。"},
+		},
+		{
+			name:     "particle",
+			text:     "吾輩は猫である名前はまだ無いどこで生れたかとんと見当がつかぬ",
+			maxChars: 20,
+			want:     []string{"吾輩は猫である名前はまだ無いどこで", "生れたかとんと見当がつかぬ"},
+		},
+		{
+			name:     "space",
+			text:     "ABCDEFGHIJKLMN OPQRSTUVWXYZ ABCDEFGHIJ",
+			maxChars: 20,
+			want:     []string{"ABCDEFGHIJKLMN", "OPQRSTUVWXYZ", "ABCDEFGHIJ"},
+		},
+		{
+			name:     "forced",
+			text:     strings.Repeat("ア", 45),
+			maxChars: 20,
+			want:     []string{strings.Repeat("ア", 20), strings.Repeat("ア", 15), strings.Repeat("ア", 10)},
+		},
+		{
+			name:     "forced keeps punctuation with the chunk",
+			text:     strings.Repeat("ア", 19) + "。」" + strings.Repeat("イ", 10),
+			maxChars: 20,
+			// 句点と閉じ括弧は切り離さず、残りが10文字以上になる位置で切った後半に含めます
+			want: []string{strings.Repeat("ア", 11), strings.Repeat("ア", 8) + "。」", strings.Repeat("イ", 10)},
+		},
+		{
+			name:     "comma before closing bracket",
+			text:     "ねえ" + strings.Repeat("カ", 16) + "、」" + strings.Repeat("キ", 12),
+			maxChars: 20,
+			want:     []string{"ねえ" + strings.Repeat("カ", 16) + "、」", strings.Repeat("キ", 12)},
+		},
+		{
+			name:     "below minimum uses minimum",
+			text:     "あいうえお、かきくけこ、さしすせそ、たちつてと。",
+			maxChars: 3,
+			want:     []string{"あいうえお、かきくけこ、", "さしすせそ、たちつてと。"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitText(tt.text, defaultSplitRules, tt.maxChars)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitText(%q, %d) = %q, want %q", tt.text, tt.maxChars, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSplitTextChunkSizes は様々な最大文字数で、チャンクが最大文字数を超えず、
+// 句読点や閉じ括弧で始まらず、分割で文字が失われないことを確かめます
+func TestSplitTextChunkSizes(t *testing.T) {
+	text := "「ねえ、聞いて。」と彼女は言った……昨日の夜、駅前の古い喫茶店で、ずっと探していた本を見つけたのよ！" +
+		strings.Repeat("とても長い説明がつづく", 8) + "。"
+	for _, maxChars := range []int{20, 21, 25, 33, 50, 100} {
+		chunks := splitText(text, defaultSplitRules, maxChars)
+		for _, c := range chunks {
+			if n := utf8.RuneCountInString(c); n > maxChars {
+				t.Errorf("maxChars %d: chunk %q has %d chars", maxChars, c, n)
+			}
+			r, _ := utf8.DecodeRuneInString(c)
+			if strings.ContainsRune(commaMarks+sentenceTerminators+ellipsisMarks+closingBrackets, r) {
+				t.Errorf("maxChars %d: chunk %q starts with punctuation", maxChars, c)
+			}
+		}
+		if got := strings.Join(chunks, ""); got != text {
+			t.Errorf("maxChars %d: joined chunks = %q, want %q", maxChars, got, text)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ssmlBreakStrengths は <break strength="..."> の長さです
+var ssmlBreakStrengths = map[string]time.Duration{
+	"none":     0,
+	"x-weak":   100 * time.Millisecond,
+	"weak":     250 * time.Millisecond,
+	"medium":   500 * time.Millisecond,
+	"strong":   750 * time.Millisecond,
+	"x-strong": time.Second,
+}
+
+// ssmlRates は <prosody rate="..."> のキーワードに対応する話速の倍率です
+var ssmlRates = map[string]float64{"x-slow": 0.5, "slow": 0.75, "medium": 1, "default": 1, "fast": 1.25, "x-fast": 1.5}
+
+// ssmlPitches は <prosody pitch="..."> のキーワードに対応する周波数の変化 (%) です
+var ssmlPitches = map[string]float64{"x-low": -20, "low": -10, "medium": 0, "default": 0, "high": 10, "x-high": 20}
+
+// ssmlVolumes は <prosody volume="..."> のキーワードに対応する音量の倍率です
+var ssmlVolumes = map[string]float64{"silent": 0, "x-soft": 0.25, "soft": 0.5, "medium": 1, "default": 1, "loud": 1.5, "x-loud": 2}
+
+// SSMLError はSSMLの誤りを、入力中の行番号とともに表します
+type SSMLError struct {
+	Line int // 1始まりの行番号。不明な場合は 0 です
+	Msg  string
+}
+
+func (e *SSMLError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("SSMLの解析に失敗しました: %s", e.Msg)
+	}
+	return fmt.Sprintf("SSMLの解析に失敗しました (%d行目): %s", e.Line, e.Msg)
+}
+
+// parseSSML はSSMLの一部 (<speak> <break> <prosody> <p> <s> <voice> <sub>) を解析し、区間の並びを返します。
+// <prosody> は区間の相対値に、<voice name> は話者名 (Actor) に、<break> は無音区間にします。
+// 各区間のテキストは、実体参照やタグを壊さないよう解析した後に opts で前処理します。
+// 未対応の要素は中のテキストだけを読み上げ、要素名を警告します
+func parseSSML(text string, opts TextOptions) ([]Segment, error) {
+	if !strings.Contains(text, "<speak") {
+		// 断片だけの入力も受け付けるよう、<speak> で囲みます (改行を足さないため行番号は変わりません)
+		text = "<speak>" + text + "</speak>"
+	}
+
+	type frame struct {
+		name     string
+		actor    string
+		relative map[string]RelativeValue
+		skipText bool // <sub> の中のテキストは alias で置き換えるため読み上げません
+	}
+	stack := []frame{{}}
+	var segments []Segment
+	var pending strings.Builder
+	unsupported := map[string]bool{}
+
+	flush := func() {
+		s := strings.TrimSpace(pending.String())
+		pending.Reset()
+		if s == "" {
+			return
+		}
+		top := stack[len(stack)-1]
+		segments = append(segments, Segment{Text: preprocessText(s, opts), Actor: top.actor, Relative: top.relative})
+	}
+
+	d := xml.NewDecoder(strings.NewReader(text))
+	d.Entity = xml.HTMLEntity
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var syntaxErr *xml.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				return nil, &SSMLError{Line: syntaxErr.Line, Msg: syntaxErr.Msg}
+			}
+			return nil, &SSMLError{Msg: err.Error()}
+		}
+		line, _ := d.InputPos()
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			attrs := map[string]string{}
+			for _, a := range t.Attr {
+				attrs[a.Name.Local] = strings.TrimSpace(a.Value)
+			}
+			f := stack[len(stack)-1]
+			f.name = t.Name.Local
+			switch f.name {
+			case "speak":
+			case "p", "s":
+				flush()
+			case "break":
+				dur, err := ssmlBreakDuration(attrs)
+				if err != nil {
+					return nil, &SSMLError{Line: line, Msg: err.Error()}
+				}
+				flush()
+				if dur > 0 {
+					segments = append(segments, Segment{Break: dur})
+				}
+			case "prosody":
+				rel, err := ssmlProsody(attrs, f.relative)
+				if err != nil {
+					return nil, &SSMLError{Line: line, Msg: err.Error()}
+				}
+				flush()
+				f.relative = rel
+			case "voice":
+				if attrs["name"] == "" {
+					return nil, &SSMLError{Line: line, Msg: "<voice> に name (話者名) が指定されていません"}
+				}
+				flush()
+				f.actor = attrs["name"]
+			case "sub":
+				pending.WriteString(attrs["alias"])
+				f.skipText = true
+			default:
+				unsupported[f.name] = true
+			}
+			stack = append(stack, f)
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "p", "s", "prosody", "voice":
+				flush()
+			}
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			if !stack[len(stack)-1].skipText {
+				pending.Write(t)
+			}
+		}
+	}
+	flush()
+
+	if len(unsupported) > 0 {
+		names := make([]string, 0, len(unsupported))
+		for name := range unsupported {
+			names = append(names, "<"+name+">")
+		}
+		sort.Strings(names)
+		logWarn("SSMLの未対応の要素 %s は無視し、中のテキストだけを読み上げます", strings.Join(names, " "))
+	}
+	return segments, nil
+}
+
+// ssmlBreakDuration は <break> の time ("500ms", "1s") か strength から無音の長さを返します。どちらも無い場合は medium です
+func ssmlBreakDuration(attrs map[string]string) (time.Duration, error) {
+	if t := attrs["time"]; t != "" {
+		return parseBreakDuration(t)
+	}
+	strength := attrs["strength"]
+	if strength == "" {
+		strength = "medium"
+	}
+	d, ok := ssmlBreakStrengths[strength]
+	if !ok {
+		return 0, fmt.Errorf("<break> の strength '%s' が不正です", strength)
+	}
+	return d, nil
+}
+
+// ssmlProsody は <prosody> の rate / pitch / volume を、パーセントの相対値にして parent に重ねます。
+// 入れ子の <prosody> は外側の倍率に掛け合わせます
+func ssmlProsody(attrs map[string]string, parent map[string]RelativeValue) (map[string]RelativeValue, error) {
+	relative := make(map[string]RelativeValue, len(parent)+3)
+	for name, rel := range parent {
+		relative[name] = rel
+	}
+	add := func(name string, percent float64) {
+		if outer, ok := relative[name]; ok {
+			percent = ((1+outer.Value/100)*(1+percent/100) - 1) * 100
+		}
+		// 半音やdBから換算した値は端数が長くなるため、表示しやすいよう 0.01% 単位に丸めます
+		relative[name] = RelativeValue{Value: math.Round(percent*100) / 100, Percent: true}
+	}
+
+	if v := attrs["rate"]; v != "" {
+		percent, err := ssmlPercent(v, ssmlRates, nil)
+		if err != nil || percent <= -100 {
+			return nil, fmt.Errorf("<prosody> の rate '%s' が不正です (x-slow〜x-fast、120%%、+20%% などで指定してください)", v)
+		}
+		add("speed", percent)
+	}
+	if v := attrs["pitch"]; v != "" {
+		semitones := func(s string) (float64, bool) {
+			st, err := strconv.ParseFloat(strings.TrimSuffix(s, "st"), 64)
+			return (math.Pow(2, st/12) - 1) * 100, err == nil && strings.HasSuffix(s, "st")
+		}
+		percent, err := ssmlPercent(v, nil, semitones)
+		if p, ok := ssmlPitches[v]; ok {
+			percent, err = p, nil
+		}
+		if err != nil || percent <= -100 {
+			return nil, fmt.Errorf("<prosody> の pitch '%s' が不正です (x-low〜x-high、+10%%、-2st などで指定してください。Hz には対応していません)", v)
+		}
+		add("pitch", percent)
+	}
+	if v := attrs["volume"]; v != "" {
+		decibels := func(s string) (float64, bool) {
+			db, err := strconv.ParseFloat(strings.TrimSuffix(s, "dB"), 64)
+			return (math.Pow(10, db/20) - 1) * 100, err == nil && strings.HasSuffix(s, "dB")
+		}
+		percent, err := ssmlPercent(v, ssmlVolumes, decibels)
+		if err != nil || percent < -100 {
+			return nil, fmt.Errorf("<prosody> の volume '%s' が不正です (silent〜x-loud、+6dB、-10%% などで指定してください)", v)
+		}
+		add("volume", percent)
+	}
+	return relative, nil
+}
+
+// ssmlPercent は <prosody> の値を、既定値からの変化 (%) にします。
+// "+20%" "-20%" は変化の割合、"120%" や "1.2" は既定値に対する倍率、keywords は倍率のキーワードです。
+// unit は "-2st" や "+6dB" のような単位付きの値を変換します
+func ssmlPercent(v string, keywords map[string]float64, unit func(string) (float64, bool)) (float64, error) {
+	if m, ok := keywords[v]; ok {
+		return (m - 1) * 100, nil
+	}
+	if unit != nil {
+		if percent, ok := unit(v); ok {
+			return percent, nil
+		}
+	}
+	signed := strings.HasPrefix(v, "+") || strings.HasPrefix(v, "-")
+	isPercent := strings.HasSuffix(v, "%")
+	n, err := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+	if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("数値ではありません")
+	}
+	switch {
+	case signed && isPercent:
+		return n, nil
+	case signed:
+		return 0, fmt.Errorf("符号付きの値には %% を付けてください")
+	case isPercent:
+		return n - 100, nil
+	case keywords != nil:
+		return (n - 1) * 100, nil
+	}
+	return 0, fmt.Errorf("単位がありません")
+}
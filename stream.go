@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// streamUnknownSize は長さが分からないストリームのWAVヘッダに書くサイズです。多くのプレイヤーは終端まで読み込みます
+const streamUnknownSize = 0xFFFFFFFF
+
+// wavStream は --stream で、合成できたチャンクから順にWAVを書き出します。
+// ファイルへの出力は出力先と同じディレクトリの一時ファイルに追記し、close でヘッダのサイズを書き直してから出力先に移動します。
+// 標準出力 ("-") への出力はサイズを書き直せないため、ヘッダのサイズを streamUnknownSize にします
+type wavStream struct {
+	path    string
+	out     io.Writer
+	file    *os.File // ファイルへの出力の場合の一時ファイル
+	post    PostProcess
+	format  *WAVFormat
+	pending []time.Duration // フォーマットが決まる前に来た無音区間
+	size    int64           // 書き出したPCMデータのバイト数
+}
+
+// newWAVStream は path への書き出しを始めます。path が "-" の場合は stdout に書き出します。
+// post はチャンクごとに適用するため、全体を見る必要のある後処理 (正規化・フェード) を含めないでください
+func newWAVStream(path string, post PostProcess, mkdir bool, stdout io.Writer) (*wavStream, error) {
+	s := &wavStream{path: path, post: post}
+	if path == "-" {
+		s.out = stdout
+		return s, nil
+	}
+	if err := prepareOutputDir(path, mkdir); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.part")
+	if err != nil {
+		return nil, &FileError{Msg: "一時ファイルの作成に失敗しました", Err: err}
+	}
+	s.file, s.out = f, f
+	return s, nil
+}
+
+// write は1区間の合成結果を追記します。無音区間 (seg.Break が正) の場合、wav は使いません
+func (s *wavStream) write(seg Segment, wav []byte) error {
+	if seg.Break > 0 {
+		if s.format == nil {
+			s.pending = append(s.pending, seg.Break)
+			return nil
+		}
+		return s.writePCM(silencePCM(*s.format, seg.Break))
+	}
+
+	wav, err := s.post.apply(wav)
+	if err != nil {
+		return err
+	}
+	parsed, err := parseWAV(wav)
+	if err != nil {
+		return fmt.Errorf("合成結果の解析に失敗しました: %v", err)
+	}
+	if s.format == nil {
+		// 最初に合成できたチャンクのフォーマットでヘッダを書き、それまでの無音区間を埋めます
+		s.format = &parsed.Format
+		if err := s.writeHeader(); err != nil {
+			return err
+		}
+		for _, d := range s.pending {
+			if err := s.writePCM(silencePCM(*s.format, d)); err != nil {
+				return err
+			}
+		}
+		s.pending = nil
+	} else if parsed.Format != *s.format {
+		return fmt.Errorf("チャンクごとに音声の形式が異なるため結合できません")
+	}
+	return s.writePCM(parsed.Data)
+}
+
+// writeHeader はデータ長の入っていないWAVヘッダを書き出します
+func (s *wavStream) writeHeader() error {
+	header := encodeWAV(*s.format, nil)
+	if s.file == nil {
+		binary.LittleEndian.PutUint32(header[4:8], streamUnknownSize)
+		binary.LittleEndian.PutUint32(header[40:44], streamUnknownSize)
+	}
+	return s.writeRaw(header)
+}
+
+func (s *wavStream) writePCM(pcm []byte) error {
+	if err := s.writeRaw(pcm); err != nil {
+		return err
+	}
+	s.size += int64(len(pcm))
+	return nil
+}
+
+func (s *wavStream) writeRaw(b []byte) error {
+	if _, err := s.out.Write(b); err != nil {
+		return &FileError{Msg: fmt.Sprintf("'%s' への書き込みに失敗しました", s.path), Err: err}
+	}
+	return nil
+}
+
+// duration は書き出した音声の長さを返します
+func (s *wavStream) duration() time.Duration {
+	if s.format == nil {
+		return 0
+	}
+	return pcmDuration(*s.format, int(s.size))
+}
+
+// close は書き出しを終えます。ファイルへの出力の場合は、ヘッダのサイズを書き直して出力先に移動します
+func (s *wavStream) close() error {
+	if s.format == nil {
+		return fmt.Errorf("読み上げるテキストがありません")
+	}
+	if s.file == nil {
+		return nil
+	}
+	if s.size > streamUnknownSize-36 {
+		return &FileError{Msg: fmt.Sprintf("'%s' を保存できません", s.path), Err: fmt.Errorf("WAVファイルの上限 (4GiB) を超えています")}
+	}
+	var sizes [4]byte
+	binary.LittleEndian.PutUint32(sizes[:], uint32(36+s.size))
+	if _, err := s.file.WriteAt(sizes[:], 4); err != nil {
+		return &FileError{Msg: "WAVヘッダの更新に失敗しました", Err: err}
+	}
+	binary.LittleEndian.PutUint32(sizes[:], uint32(s.size))
+	if _, err := s.file.WriteAt(sizes[:], 40); err != nil {
+		return &FileError{Msg: "WAVヘッダの更新に失敗しました", Err: err}
+	}
+	if err := s.file.Chmod(0644); err != nil {
+		return &FileError{Msg: "一時ファイルの権限の変更に失敗しました", Err: err}
+	}
+	if err := s.file.Close(); err != nil {
+		return &FileError{Msg: fmt.Sprintf("ファイル '%s' の保存に失敗しました", s.path), Err: err}
+	}
+	if err := os.Rename(s.file.Name(), s.path); err != nil {
+		return &FileError{Msg: fmt.Sprintf("ファイル '%s' の保存に失敗しました", s.path), Err: err}
+	}
+	s.file = nil
+	return nil
+}
+
+// keep は中断した書き出しを、それまでに書き出した分だけの音声として path に保存します
+func (s *wavStream) keep(path string) error {
+	s.path = path
+	return s.close()
+}
+
+// abort は書き出しを中止し、一時ファイルを削除します
+func (s *wavStream) abort() {
+	if s.file != nil {
+		s.file.Close()
+		os.Remove(s.file.Name())
+		s.file = nil
+	}
+}
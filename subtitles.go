@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Cue は字幕の1つの表示区間です
+type Cue struct {
+	Start, End time.Duration
+	Text       string
+	Actor      string // 区間の話者名。WebVTT では <v> で話者を示します
+}
+
+// subtitleFormat は字幕ファイルの拡張子から形式 (srt, vtt) を判定します
+func subtitleFormat(path string) (string, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".srt", ".vtt":
+		return ext[1:], nil
+	}
+	return "", fmt.Errorf("--subtitles の拡張子は .srt か .vtt にしてください: %s", path)
+}
+
+// subtitleCues は区間のテキストと、結合した音声での区間ごとの長さ (timings) から字幕の表示区間を作ります。
+// 複数の文を含む区間は、文字数の割合で表示時間を分けます。無音区間は字幕を出さずに時間だけ進めます
+func subtitleCues(segments []Segment, timings []ChunkTiming) []Cue {
+	var cues []Cue
+	var pos time.Duration
+	for i, seg := range segments {
+		start, d := pos, timings[i].Duration
+		pos += d
+		if seg.Text == "" {
+			continue
+		}
+		actor := seg.Actor
+		if seg.Speaker != nil {
+			actor = seg.Speaker.Speaker.Name
+		}
+
+		sentences := splitSentences(seg.Text, defaultSplitRules)
+		total := 0
+		for _, s := range sentences {
+			total += utf8.RuneCountInString(s)
+		}
+		chars := 0
+		for j, s := range sentences {
+			cue := Cue{Start: start + time.Duration(float64(d)*float64(chars)/float64(total)), Text: s, Actor: actor}
+			chars += utf8.RuneCountInString(s)
+			cue.End = start + time.Duration(float64(d)*float64(chars)/float64(total))
+			if j == len(sentences)-1 {
+				cue.End = pos
+			}
+			cues = append(cues, cue)
+		}
+	}
+	return cues
+}
+
+// formatSubtitles は字幕を SRT か WebVTT の形式にします
+func formatSubtitles(cues []Cue, format string) []byte {
+	var b strings.Builder
+	sep := ","
+	if format == "vtt" {
+		b.WriteString("WEBVTT\n\n")
+		sep = "."
+	}
+	for i, cue := range cues {
+		text := cue.Text
+		if format == "vtt" && cue.Actor != "" {
+			text = fmt.Sprintf("<v %s>%s", cue.Actor, text)
+		}
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, formatCueTime(cue.Start, sep), formatCueTime(cue.End, sep), text)
+	}
+	return []byte(b.String())
+}
+
+// formatCueTime は字幕の時刻を 00:01:02,345 (WebVTT は 00:01:02.345) の形式にします
+func formatCueTime(d time.Duration, sep string) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+// writeSubtitles は区間ごとの長さに合わせた字幕を、path の拡張子の形式で保存します
+func writeSubtitles(path string, segments []Segment, timings []ChunkTiming, mkdir bool) error {
+	format, err := subtitleFormat(path)
+	if err != nil {
+		return err
+	}
+	if err := writeOutputFile(path, formatSubtitles(subtitleCues(segments, timings), format), mkdir); err != nil {
+		return err
+	}
+	logInfo("字幕を '%s' に保存しました。", path)
+	return nil
+}
@@ -0,0 +1,521 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// SynthesisParams はコマンドラインで指定された音声パラメータを表します
+type SynthesisParams struct {
+	Speed       float64
+	Pitch       float64
+	Intonation  float64
+	Volume      float64
+	PrePhoneme  float64 // -1 の場合はAPIのデフォルト値を使用
+	PostPhoneme float64 // -1 の場合はAPIのデフォルト値を使用
+
+	// Explicit は明示的に指定されたパラメータ名 ("speed" "pre-phoneme" など、フラグ名と同じ) の集合です。
+	// 含まれないパラメータはクエリ（APIのデフォルト値など）の値をそのまま使います
+	Explicit map[string]bool
+
+	// Relative は相対指定 (--speed-rel など) です。明示的な値やプリセットを適用した後のクエリの値に対して調整します
+	Relative map[string]RelativeValue
+
+	// Preset が nil でない場合、クエリをプリセットの値で生成してから明示的なパラメータを上書きします
+	Preset *Preset
+}
+
+// paramNames は上書きできるパラメータ名の一覧です
+var paramNames = []string{"speed", "pitch", "intonation", "volume", "pre-phoneme", "post-phoneme"}
+
+// value はパラメータ名に対応する値を返します
+func (p SynthesisParams) value(name string) float64 {
+	switch name {
+	case "speed":
+		return p.Speed
+	case "pitch":
+		return p.Pitch
+	case "intonation":
+		return p.Intonation
+	case "volume":
+		return p.Volume
+	case "pre-phoneme":
+		return p.PrePhoneme
+	case "post-phoneme":
+		return p.PostPhoneme
+	}
+	return 0
+}
+
+// set はパラメータ名に対応する値を設定し、明示的に指定されたものとして扱います
+func (p *SynthesisParams) set(name string, v float64) {
+	switch name {
+	case "speed":
+		p.Speed = v
+	case "pitch":
+		p.Pitch = v
+	case "intonation":
+		p.Intonation = v
+	case "volume":
+		p.Volume = v
+	case "pre-phoneme":
+		p.PrePhoneme = v
+	case "post-phoneme":
+		p.PostPhoneme = v
+	default:
+		return
+	}
+	// 呼び出し元と map を共有しないよう複製してから追加します
+	explicit := make(map[string]bool, len(p.Explicit)+1)
+	for k := range p.Explicit {
+		explicit[k] = true
+	}
+	explicit[name] = true
+	p.Explicit = explicit
+}
+
+// overrides は上書きの対象になるパラメータ名を返します
+func (p SynthesisParams) overrides() []string {
+	var names []string
+	for _, name := range paramNames {
+		if !p.Explicit[name] {
+			continue
+		}
+		// 無音時間は -1 が「APIのデフォルト値を使う」の意味です
+		if (name == "pre-phoneme" || name == "post-phoneme") && p.value(name) == -1.0 {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// describe は上書きするパラメータを "speed=1.2 pitch=0.1" の形式で返します
+func (p SynthesisParams) describe() string {
+	var parts []string
+	for _, name := range p.overrides() {
+		parts = append(parts, fmt.Sprintf("%s=%g", name, p.value(name)))
+	}
+	for _, name := range relativeParamNames {
+		if rel, ok := p.Relative[name]; ok {
+			parts = append(parts, fmt.Sprintf("%s%s", name, rel))
+		}
+	}
+	if len(parts) == 0 {
+		return "なし (クエリの値をそのまま使用)"
+	}
+	return strings.Join(parts, " ")
+}
+
+// apply は明示的に指定されたパラメータだけで音声合成クエリを上書きし、その後に相対指定を適用します
+func (p SynthesisParams) apply(query *AudioQuery) {
+	for _, name := range p.overrides() {
+		if field := queryField(query, name); field != nil {
+			*field = p.value(name)
+		}
+	}
+	for name, rel := range p.Relative {
+		if field := queryField(query, name); field != nil {
+			*field = rel.adjust(name, *field)
+		}
+	}
+}
+
+// queryField はパラメータ名に対応する音声合成クエリのフィールドを返します。未知の名前の場合は nil を返します
+func queryField(query *AudioQuery, name string) *float64 {
+	switch name {
+	case "speed":
+		return &query.SpeedScale
+	case "pitch":
+		return &query.PitchScale
+	case "intonation":
+		return &query.IntonationScale
+	case "volume":
+		return &query.VolumeScale
+	case "pre-phoneme":
+		return &query.PrePhonemeLength
+	case "post-phoneme":
+		return &query.PostPhonemeLength
+	}
+	return nil
+}
+
+// buildQuery はテキスト（kanaモードではkana）から音声合成クエリを生成し、パラメータを適用します
+func buildQuery(client *Client, text string, speakerID int, kanaMode bool, params SynthesisParams) (*AudioQuery, error) {
+	var query *AudioQuery
+	if kanaMode {
+		kana, err := prepareKana(text)
+		if err != nil {
+			return nil, err
+		}
+		query, err = client.KanaAudioQuery(kana, speakerID)
+		if err != nil {
+			return nil, locateKanaError(text, err)
+		}
+		if params.Preset != nil {
+			params.Preset.Apply(query)
+		}
+	} else if params.Preset != nil {
+		var err error
+		query, err = client.AudioQueryFromPreset(text, speakerID, params.Preset)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		query, err = client.AudioQuery(text, speakerID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	params.apply(query)
+	return query, nil
+}
+
+// buildSegmentQuery は区間の音声合成クエリを返します。--query-file で読み込んだクエリがある場合は
+// /audio_query を呼ばずに、そのコピーにプリセットと明示的に指定したパラメータだけを適用します
+func buildSegmentQuery(client *Client, seg Segment, speakerID int, kanaMode bool, params SynthesisParams) (*AudioQuery, error) {
+	if seg.Query == nil {
+		return buildQuery(client, seg.Text, seg.styleID(speakerID), kanaMode, seg.params(params))
+	}
+	query := *seg.Query
+	if params.Preset != nil {
+		params.Preset.Apply(&query)
+	}
+	seg.params(params).apply(&query)
+	return &query, nil
+}
+
+// ChunkFailure は --tolerate-failures で無音に置き換えたチャンクを表します
+type ChunkFailure struct {
+	Index int // 1始まりのチャンク番号
+	Text  string
+	Err   error
+}
+
+// chunkRetries は --tolerate-failures のとき、失敗したチャンクを再試行する回数です
+const chunkRetries = 2
+
+// chunkRetryDelay は失敗したチャンクを再試行するまでの待ち時間です
+const chunkRetryDelay = 500 * time.Millisecond
+
+// synthesizeSegments は区間ごとに音声合成を行い、1つのWAVに結合して返します。
+// 進捗は (quiet でなければ) プログレスバーと --progress-json のイベントで表示します
+func synthesizeSegments(client *Client, segments []Segment, speakerID int, kanaMode bool, params SynthesisParams, quiet bool) ([]byte, error) {
+	wav, _, _, err := synthesizeSegmentsTolerant(client, segments, speakerID, kanaMode, params, quiet, false)
+	return wav, err
+}
+
+// synthesizeSegmentsTolerant は synthesizeSegments と同様に合成します。tolerate が true の場合は、
+// 失敗したチャンクを chunkRetries 回まで再試行し、それでも失敗したチャンクは文字数から推定した長さの無音で埋めて、
+// 失敗したチャンクの一覧を返します。すべてのチャンクが失敗した場合はエラーを返します。
+// 字幕などのために、結合した音声での区間ごとの長さと合成に使ったクエリも返します
+func synthesizeSegmentsTolerant(client *Client, segments []Segment, speakerID int, kanaMode bool, params SynthesisParams, quiet, tolerate bool) ([]byte, []ChunkTiming, []ChunkFailure, error) {
+	// 失敗したチャンクを無音区間に置き換えるため、呼び出し元のスライスは変更しないようコピーします
+	joined := make([]Segment, len(segments))
+	wavs := make([][]byte, len(segments))
+	done := 0
+	failures, err := synthesizeEach(client, segments, speakerID, kanaMode, params, quiet, tolerate, func(i int, seg Segment, wav []byte) error {
+		joined[i], wavs[i] = seg, wav
+		done = i + 1
+		return nil
+	})
+	if err != nil {
+		var partial *PartialAudioError
+		if !errors.As(err, &partial) && errors.Is(err, context.Canceled) && done > 0 {
+			// チャンクの間で中断された場合も、それまでに合成できた区間を部分結果にします
+			if wav, joinErr := joinSegmentWAVs(joined[:done], wavs[:done]); joinErr == nil {
+				return nil, nil, failures, &PartialAudioError{Data: wav, Err: err}
+			}
+		} else if partial != nil {
+			// 中断されたチャンクの受信済みのデータを、それまでに合成できた区間の後ろに結合して部分結果にします
+			partial.Data = repairPartialWAV(partial.Data)
+			if wav, err := joinSegmentWAVs(append(joined[:done], Segment{}), append(wavs[:done], partial.Data)); err == nil {
+				partial.Data = wav
+			}
+		}
+		return nil, nil, failures, err
+	}
+	wav, err := joinSegmentWAVs(joined, wavs)
+	if err != nil {
+		return nil, nil, failures, err
+	}
+	timings := make([]ChunkTiming, len(joined))
+	for i, seg := range joined {
+		timings[i] = chunkTiming(seg, wavs[i])
+	}
+	return wav, timings, failures, nil
+}
+
+// ChunkTiming は結合した音声での区間の長さと、合成に使った音声合成クエリです。無音区間の Query は nil です
+type ChunkTiming struct {
+	Duration time.Duration
+	Query    *AudioQuery
+}
+
+// chunkTiming は synthesizeEach が emit に渡した区間と合成結果から、区間の長さとクエリを返します
+func chunkTiming(seg Segment, wav []byte) ChunkTiming {
+	if seg.Break > 0 {
+		return ChunkTiming{Duration: seg.Break}
+	}
+	// 合成結果は結合や書き出しの際に解析できているため、エラーにはなりません
+	d, _ := wavDuration(wav)
+	return ChunkTiming{Duration: d, Query: seg.Query}
+}
+
+// chunkJobs は --jobs で指定した、チャンクを同時に合成する数です
+var chunkJobs = 1
+
+// chunkResult は合成を始めたチャンクの結果です。done が閉じられた後に wav と err を読み出せます
+type chunkResult struct {
+	wav   []byte
+	query *AudioQuery
+	err   error
+	done  chan struct{}
+}
+
+// synthesizeEach は区間を合成し、先頭から順に1区間ごとに emit を呼び出します。無音区間は wav を nil にして呼び出します。
+// chunkJobs が2以上の場合は、emit を待つ区間の後ろの chunkJobs 個までのチャンクを並行して合成します。
+// tolerate の扱いは synthesizeSegmentsTolerant と同じで、無音で埋めたチャンクは無音区間として emit に渡します。
+// 合成できた区間は、合成に使った音声合成クエリを Query に設定して emit に渡します
+func synthesizeEach(client *Client, segments []Segment, speakerID int, kanaMode bool, params SynthesisParams, quiet, tolerate bool, emit func(i int, seg Segment, wav []byte) error) ([]ChunkFailure, error) {
+	progressEvents.emit("start", map[string]interface{}{"total": len(segments)})
+	totalChars := 0
+	for _, seg := range segments {
+		totalChars += utf8.RuneCountInString(seg.Text)
+	}
+	bar := newProgressBar(len(segments), totalChars, quiet || len(segments) == 1)
+	bar.draw(0)
+
+	// 先読みする範囲を限ることで、emit を待つ結果が溜まりすぎないようにします。
+	// エラーで途中で戻った場合、合成中のチャンクは結果を捨てます
+	pending := make([]*chunkResult, len(segments))
+	started := 0
+	startUntil := func(limit int) {
+		for ; started < len(segments) && started < limit; started++ {
+			i, seg := started, segments[started]
+			if seg.Break > 0 {
+				continue
+			}
+			res := &chunkResult{done: make(chan struct{})}
+			pending[i] = res
+			go func() {
+				defer close(res.done)
+				res.wav, res.query, res.err = synthesizeChunkRetrying(client, seg, i, len(segments), speakerID, kanaMode, params, tolerate)
+			}()
+		}
+	}
+
+	var failures []ChunkFailure
+	chunks := 0
+	for i, seg := range segments {
+		startUntil(i + max(chunkJobs, 1))
+		if seg.Break > 0 {
+			if err := emit(i, seg, nil); err != nil {
+				return nil, err
+			}
+			bar.increment("")
+			continue
+		}
+		chunks++
+		res := pending[i]
+		<-res.done
+		pending[i] = nil
+		wav, err := res.wav, res.err
+		text := seg.Text
+		seg.Query = res.query
+		if err != nil {
+			// 中断された場合は、無音で埋めずにそこで終えます
+			if !tolerate || errors.Is(err, context.Canceled) {
+				return nil, err
+			}
+			failures = append(failures, ChunkFailure{Index: i + 1, Text: seg.Text, Err: err})
+			progressEvents.emit("chunk_failed", map[string]interface{}{"chunk": i + 1, "total": len(segments), "message": err.Error()})
+			seg = Segment{Break: estimateFromText(seg.Text, seg.params(params).Speed)}
+		}
+		if err := emit(i, seg, wav); err != nil {
+			return nil, err
+		}
+		bar.increment(text)
+	}
+	bar.finish()
+
+	if len(failures) > 0 && len(failures) == chunks {
+		return failures, fmt.Errorf("すべてのチャンクの合成に失敗しました: %w", failures[0].Err)
+	}
+	return failures, nil
+}
+
+// synthesizeChunkRetrying は synthesizeChunk で合成し、tolerate が true の場合は失敗したチャンクを chunkRetries 回まで再試行します。
+// --resume の場合は、保存済みのチャンクを合成し直さずに使い、合成できたチャンクを保存します。キャッシュも同じように使います
+func synthesizeChunkRetrying(client *Client, seg Segment, i, total, speakerID int, kanaMode bool, params SynthesisParams, tolerate bool) ([]byte, *AudioQuery, error) {
+	key := ""
+	if resumeStore != nil {
+		key = chunkKey(seg, speakerID, kanaMode, params, client.CoreVersion, "")
+		if wav, query, ok := resumeStore.load(key); ok {
+			return wav, query, nil
+		}
+	}
+	cacheKey := ""
+	if resultCache != nil {
+		cacheKey = resultCache.key(seg, speakerID, kanaMode, params)
+		if wav, query, ok := resultCache.load(cacheKey); ok {
+			logDebug("チャンク %d はキャッシュの合成結果を使います", i+1)
+			return wav, query, nil
+		}
+	}
+	wav, query, err := synthesizeChunk(client, seg, i, total, speakerID, kanaMode, params)
+	for attempt := 1; err != nil && tolerate && !errors.Is(err, context.Canceled) && attempt <= chunkRetries; attempt++ {
+		time.Sleep(chunkRetryDelay)
+		wav, query, err = synthesizeChunk(client, seg, i, total, speakerID, kanaMode, params)
+	}
+	if err == nil && resumeStore != nil {
+		// 保存できなくても合成は続け、再開できないことだけを知らせます
+		if err := resumeStore.save(key, i+1, wav, query); err != nil {
+			logWarn("チャンクを保存できませんでした (--resume で再開できません): %v", err)
+		}
+	}
+	if err == nil && resultCache != nil {
+		if err := resultCache.save(cacheKey, wav, query); err != nil {
+			logWarn("合成結果をキャッシュに保存できませんでした: %v", err)
+		}
+	}
+	return wav, query, err
+}
+
+// synthesizeChunk は1つの区間の音声合成クエリを作成して合成し、合成結果とクエリを返します。i と total は進捗のイベントに使います
+func synthesizeChunk(client *Client, seg Segment, i, total, speakerID int, kanaMode bool, params SynthesisParams) ([]byte, *AudioQuery, error) {
+	progressEvents.emit("query", map[string]interface{}{"chunk": i + 1, "total": total})
+	query, err := buildSegmentQuery(client, seg, speakerID, kanaMode, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	progressEvents.emit("synthesis", map[string]interface{}{"chunk": i + 1, "total": total})
+	wav, err := client.Synthesis(query, seg.styleID(speakerID))
+	return wav, query, err
+}
+
+// printChunkFailures は無音で埋めたチャンクを、番号とテキストの冒頭とともに標準エラー出力に表示します
+func printChunkFailures(failures []ChunkFailure) {
+	if len(failures) == 0 {
+		return
+	}
+	logWarn("%d 個のチャンクの合成に失敗したため、無音で埋めました:", len(failures))
+	for _, f := range failures {
+		logWarn("  [%d] %s: %v", f.Index, preview(f.Text, 20), f.Err)
+	}
+}
+
+// joinSegmentWAVs は区間ごとの合成結果を1つのWAVに結合します。
+// 無音区間（Break が正の区間）は、合成された区間と同じフォーマットの無音で埋めます
+func joinSegmentWAVs(segments []Segment, wavs [][]byte) ([]byte, error) {
+	var format *WAVFormat
+	for i, seg := range segments {
+		if seg.Break > 0 {
+			continue
+		}
+		wav, err := parseWAV(wavs[i])
+		if err != nil {
+			return nil, fmt.Errorf("合成結果の解析に失敗しました: %v", err)
+		}
+		format = &wav.Format
+		break
+	}
+	if format == nil {
+		return nil, fmt.Errorf("読み上げるテキストがありません")
+	}
+
+	parts := make([][]byte, len(segments))
+	for i, seg := range segments {
+		if seg.Break > 0 {
+			parts[i] = encodeWAV(*format, silencePCM(*format, seg.Break))
+		} else {
+			parts[i] = wavs[i]
+		}
+	}
+	if len(parts) == 1 {
+		return parts[0], nil
+	}
+	return concatWAV(parts)
+}
+
+// PostProcess は合成した音声に掛ける後処理（再サンプリング、チャンネル変換、エコー、音量の正規化、フェード）の設定です
+type PostProcess struct {
+	Resample  int // 0 以外の場合、このサンプリングレート (Hz) に変換します
+	Channels  int // 1 ならモノラル、2 ならステレオに変換します。0 の場合は変換しません
+	Normalize bool
+	TargetDB  float64
+	FadeIn    int // ミリ秒
+	FadeOut   int // ミリ秒
+	BitDepth  int // 0 以外の場合、このビット深度に変換します
+	Float     bool
+	EchoDelay int // 0 以外の場合、この遅延 (ミリ秒) のエコーを掛けます
+	EchoDecay float64
+	// TargetLUFS が 0 以外の場合、統合ラウドネスがこの値 (LUFS) になるようゲインを掛け、
+	// トゥルーピークが TruePeak (dBTP) を超える部分をリミッタで抑えます
+	TargetLUFS float64
+	TruePeak   float64
+}
+
+// apply はWAVデータにすべての後処理を適用します
+func (p PostProcess) apply(wav []byte) ([]byte, error) {
+	wav, err := p.applyPCM16(wav)
+	if err != nil {
+		return nil, err
+	}
+	return p.convertFormat(wav)
+}
+
+// convertFormat はビット深度を変換します。16bit PCMを前提とする処理がすべて終わってから呼び出します
+func (p PostProcess) convertFormat(wav []byte) ([]byte, error) {
+	if p.BitDepth == 0 {
+		return wav, nil
+	}
+	converted, err := convertBitDepth(wav, p.BitDepth, p.Float)
+	if err != nil {
+		return nil, fmt.Errorf("ビット深度の変換に失敗しました: %v", err)
+	}
+	return converted, nil
+}
+
+// applyPCM16 は16bit PCMのまま行う後処理を、再サンプリング・チャンネル変換・エコー・正規化・フェードの順に適用します
+func (p PostProcess) applyPCM16(wav []byte) ([]byte, error) {
+	var err error
+	if p.Resample > 0 {
+		if wav, err = resampleWAV(wav, p.Resample); err != nil {
+			return nil, fmt.Errorf("再サンプリングに失敗しました: %v", err)
+		}
+	}
+	if p.Channels > 0 {
+		if wav, err = convertChannels(wav, p.Channels == 2); err != nil {
+			return nil, fmt.Errorf("チャンネル数の変換に失敗しました: %v", err)
+		}
+	}
+	// エコーで上がった音量も揃えられるよう、正規化より前に掛けます
+	if p.EchoDelay > 0 {
+		if wav, err = applyEcho(wav, p.EchoDelay, p.EchoDecay); err != nil {
+			return nil, fmt.Errorf("エコーの適用に失敗しました: %v", err)
+		}
+	}
+	if p.Normalize {
+		if wav, err = normalizeWAV(wav, p.TargetDB); err != nil {
+			return nil, fmt.Errorf("音量の正規化に失敗しました: %v", err)
+		}
+	}
+	if p.TargetLUFS != 0 {
+		if wav, err = normalizeLUFS(wav, p.TargetLUFS, p.TruePeak); err != nil {
+			return nil, fmt.Errorf("ラウドネスの正規化に失敗しました: %v", err)
+		}
+	}
+	if p.FadeIn > 0 || p.FadeOut > 0 {
+		if wav, err = applyFade(wav, p.FadeIn, p.FadeOut); err != nil {
+			return nil, fmt.Errorf("フェードの適用に失敗しました: %v", err)
+		}
+	}
+	return wav, nil
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// textEncodings は --encoding で指定できる文字コードです ("auto" は自動判定)
+var textEncodings = map[string]encoding.Encoding{
+	"utf-8":     unicode.UTF8,
+	"shift_jis": japanese.ShiftJIS,
+	"euc-jp":    japanese.EUCJP,
+}
+
+// utf8BOM はUTF-8のBOMです
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// decodeTextFile は入力ファイルの文字コードを判定してUTF-8の文字列に変換します。
+// BOMがあれば取り除き (UTF-16はBOMで判定します)、UTF-8として不正な場合はShift_JISとして変換します
+func decodeTextFile(data []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		return string(data[len(utf8BOM):]), nil
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}), bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return decodeWith(data, unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), "UTF-16")
+	case utf8.Valid(data):
+		return string(data), nil
+	}
+	text, err := decodeWith(data, japanese.ShiftJIS, "Shift_JIS")
+	if err != nil {
+		return "", fmt.Errorf("文字コードを判定できませんでした (--encoding で指定してください): %v", err)
+	}
+	return text, nil
+}
+
+// checkEncoding は --encoding に指定された文字コードが対応しているかを確認します
+func checkEncoding(name string) error {
+	name = strings.ToLower(name)
+	if _, ok := textEncodings[name]; !ok && name != "auto" {
+		return fmt.Errorf("未対応の文字コードです: %s (auto, utf-8, shift_jis, euc-jp のいずれかを指定してください)", name)
+	}
+	return nil
+}
+
+// decodeText は指定した文字コード ("auto" なら自動判定) で入力ファイルをUTF-8の文字列に変換します
+func decodeText(data []byte, name string) (string, error) {
+	name = strings.ToLower(name)
+	if name == "auto" {
+		return decodeTextFile(data)
+	}
+	if err := checkEncoding(name); err != nil {
+		return "", err
+	}
+	return decodeWith(bytes.TrimPrefix(data, utf8BOM), textEncodings[name], name)
+}
+
+// decodeWith は指定した文字コードでデータを変換します。変換できない文字があればエラーを返します
+func decodeWith(data []byte, enc encoding.Encoding, name string) (string, error) {
+	if enc == unicode.UTF8 {
+		if !utf8.Valid(data) {
+			return "", fmt.Errorf("%s として不正なバイト列があります", name)
+		}
+		return string(data), nil
+	}
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", fmt.Errorf("%s として変換できませんでした: %v", name, err)
+	}
+	// デコーダーは変換できないバイトを U+FFFD に置き換えるため、元のデータに無い U+FFFD は誤判定とみなします
+	if bytes.ContainsRune(decoded, utf8.RuneError) && !bytes.ContainsRune(data, utf8.RuneError) {
+		return "", fmt.Errorf("%s として変換できない文字があります", name)
+	}
+	return string(decoded), nil
+}
+
+// ReplaceRule は読み上げ前のテキストに適用する正規表現の置換ルールを表します
+type ReplaceRule struct {
+	Pattern     *regexp.Regexp
+	Replacement string // $1 などでキャプチャグループを参照できます
+}
+
+// replaceRulesFlag は --replace "pattern=>replacement" を複数回指定できるようにする flag.Value です
+type replaceRulesFlag []ReplaceRule
+
+func (f *replaceRulesFlag) String() string {
+	rules := make([]string, len(*f))
+	for i, r := range *f {
+		rules[i] = r.Pattern.String() + "=>" + r.Replacement
+	}
+	return strings.Join(rules, ", ")
+}
+
+// Set はルールを解析して追加します。正規表現が不正な場合は、何番目のどのルールかを含めたエラーを返します
+func (f *replaceRulesFlag) Set(value string) error {
+	pattern, replacement, ok := strings.Cut(value, "=>")
+	if !ok {
+		return fmt.Errorf("%d 番目のルール '%s' は 'pattern=>replacement' の形式で指定してください", len(*f)+1, value)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("%d 番目のルール '%s' の正規表現が不正です: %v", len(*f)+1, value, err)
+	}
+	*f = append(*f, ReplaceRule{Pattern: re, Replacement: replacement})
+	return nil
+}
+
+// TextOptions は読み上げ前のテキストの整形方法を表します
+type TextOptions struct {
+	Rules         []ReplaceRule // 指定順に適用する置換ルール
+	NumberMode    string        // 数字の読み方 ("digit": 桁読み, "kanji": 漢数字読み, 空: エンジンに任せる)
+	ExpandSymbols bool          // % や ℃ などの記号を読みの語に展開します
+	RomajiToKana  bool          // 英単語を簡易的にカタカナ読みに変換します
+	Markup        bool          // true の場合、マークアップのタグの中は数字・記号を変換しません
+	Ruby          bool          // |漢字《かんじ》 や 漢字{かんじ} のルビを読みに置き換えます
+}
+
+// numberModes は --number-mode で指定できる値です
+var numberModes = []string{"digit", "kanji"}
+
+// checkNumberMode は --number-mode の指定が正しいかを確認します
+func checkNumberMode(mode string) error {
+	if mode == "" {
+		return nil
+	}
+	for _, m := range numberModes {
+		if m == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("--number-mode には %s のいずれかを指定してください: %s", strings.Join(numberModes, ", "), mode)
+}
+
+// preprocessText は読み上げ前のテキストに置換ルールを指定順に適用し、数字・記号・英単語を読みやすく整形します
+func preprocessText(text string, opts TextOptions) string {
+	// ルビは置換ルールより先に、書いた箇所の読みに置き換えます
+	if opts.Ruby {
+		text = expandRuby(text)
+	}
+	for _, rule := range opts.Rules {
+		text = rule.Pattern.ReplaceAllString(text, rule.Replacement)
+	}
+	if opts.NumberMode == "" && !opts.ExpandSymbols && !opts.RomajiToKana {
+		return text
+	}
+	if !opts.Markup {
+		return normalizeReading(text, opts)
+	}
+
+	// タグの値 (<speed=1.5> など) を変換しないよう、タグ以外の部分だけを整形します
+	var b strings.Builder
+	pos := 0
+	for _, tag := range findMarkupTags(text) {
+		b.WriteString(normalizeReading(text[pos:tag.start], opts))
+		b.WriteString(text[tag.start:tag.end])
+		pos = tag.end
+	}
+	b.WriteString(normalizeReading(text[pos:], opts))
+	return b.String()
+}
+
+// fullWidthDigits は全角数字を半角数字に変換します
+var fullWidthDigits = strings.NewReplacer(
+	"０", "0", "１", "1", "２", "2", "３", "3", "４", "4",
+	"５", "5", "６", "6", "７", "7", "８", "8", "９", "9",
+)
+
+// numberPattern は数字列 (桁区切りのカンマと小数点を含む) に一致します
+var numberPattern = regexp.MustCompile(`[0-9]{1,3}(?:,[0-9]{3})+(?:\.[0-9]+)?|[0-9]+(?:\.[0-9]+)?`)
+
+// symbolReadings は --expand-symbols で展開する記号と読みです
+var symbolReadings = strings.NewReplacer(
+	"%", "パーセント", "％", "パーセント",
+	"℃", "度", "°C", "度",
+	"〜", "から", "～", "から",
+	"&", "アンド", "＆", "アンド",
+	"+", "プラス", "＋", "プラス",
+	"=", "イコール", "＝", "イコール",
+	"×", "かける", "÷", "わる",
+	"㎜", "ミリメートル", "㎝", "センチメートル", "㎞", "キロメートル",
+	"㎎", "ミリグラム", "㎏", "キログラム", "㎡", "平方メートル",
+	"￥", "円", "¥", "円",
+)
+
+// normalizeReading は数字を指定された読み方に変換し、記号を読みの語に、英単語をカタカナ読みに変換します
+func normalizeReading(text string, opts TextOptions) string {
+	if opts.NumberMode != "" {
+		text = fullWidthDigits.Replace(text)
+		text = numberPattern.ReplaceAllStringFunc(text, func(n string) string {
+			return readNumber(strings.ReplaceAll(n, ",", ""), opts.NumberMode)
+		})
+	}
+	if opts.ExpandSymbols {
+		text = symbolReadings.Replace(text)
+	}
+	if opts.RomajiToKana {
+		text = romajiToKana(text)
+	}
+	return text
+}
+
+// digitReadings は桁読みでの数字の読みです
+var digitReadings = []string{"ゼロ", "イチ", "ニ", "サン", "ヨン", "ゴ", "ロク", "ナナ", "ハチ", "キュウ"}
+
+// kanjiDigits は漢数字です
+var kanjiDigits = []string{"〇", "一", "二", "三", "四", "五", "六", "七", "八", "九"}
+
+// readNumber は数字列 ("123", "3.14") を、mode に応じた桁読み ("イチニサン") か漢数字 ("百二十三") に変換します
+func readNumber(n, mode string) string {
+	integer, fraction, hasFraction := strings.Cut(n, ".")
+	var b strings.Builder
+	if mode == "kanji" && (len(integer) == 1 || integer[0] != '0') && len(integer) <= 20 {
+		b.WriteString(kanjiNumber(integer))
+	} else {
+		// 先頭が0の数字列 (電話番号など) や桁数の多すぎる数字は、漢数字でも1桁ずつ読みます
+		b.WriteString(readDigits(integer, mode))
+	}
+	if hasFraction {
+		if mode == "kanji" {
+			b.WriteString("点")
+		} else {
+			b.WriteString("テン")
+		}
+		b.WriteString(readDigits(fraction, mode))
+	}
+	return b.String()
+}
+
+// readDigits は数字列を1桁ずつ読みます
+func readDigits(digits, mode string) string {
+	table := digitReadings
+	if mode == "kanji" {
+		table = kanjiDigits
+	}
+	var b strings.Builder
+	for _, d := range digits {
+		b.WriteString(table[d-'0'])
+	}
+	return b.String()
+}
+
+// kanjiNumber は20桁までの整数の数字列を漢数字 (例: "12005" → "一万二千五") に変換します
+func kanjiNumber(digits string) string {
+	if strings.Trim(digits, "0") == "" {
+		return "零"
+	}
+	largeUnits := []string{"", "万", "億", "兆", "京"}
+	smallUnits := []string{"", "十", "百", "千"}
+
+	var b strings.Builder
+	groups := (len(digits) + 3) / 4
+	for g := groups - 1; g >= 0; g-- {
+		end := len(digits) - g*4
+		start := max(end-4, 0)
+		group := digits[start:end]
+
+		wrote := false
+		for i, d := range group {
+			if d == '0' {
+				continue
+			}
+			unit := len(group) - 1 - i
+			// 十・百・千の前の「一」は省略します (「一千」ではなく「千」)
+			if d != '1' || unit == 0 {
+				b.WriteString(kanjiDigits[d-'0'])
+			}
+			b.WriteString(smallUnits[unit])
+			wrote = true
+		}
+		if wrote {
+			b.WriteString(largeUnits[g])
+		}
+	}
+	return b.String()
+}
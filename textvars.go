@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// textVarPattern は入力テキスト中の変数 ({{date}} や {{var:商品名}}) に一致します
+var textVarPattern = regexp.MustCompile(`\{\{\s*(?:var:)?([^{}]+?)\s*\}\}`)
+
+// undefinedVarModes は --undefined-var で指定できる値です (error: エラーにする, empty: 空文字に置き換える)
+var undefinedVarModes = []string{"error", "empty"}
+
+// weekdayNames は曜日の読みです
+var weekdayNames = []string{"日曜日", "月曜日", "火曜日", "水曜日", "木曜日", "金曜日", "土曜日"}
+
+// builtinTextVars は組み込みの変数 (date, time, weekday) を、読み上げやすい形で返します
+func builtinTextVars(now time.Time) map[string]string {
+	return map[string]string{
+		"date":    fmt.Sprintf("%d年%d月%d日", now.Year(), now.Month(), now.Day()),
+		"time":    fmt.Sprintf("%d時%d分", now.Hour(), now.Minute()),
+		"weekday": weekdayNames[now.Weekday()],
+	}
+}
+
+// UndefinedVarError は入力テキストに定義されていない変数があったことを表します
+type UndefinedVarError struct {
+	Names []string
+}
+
+func (e *UndefinedVarError) Error() string {
+	return fmt.Sprintf("テキストに定義されていない変数があります: %s (--var \"名前=値\" で定義してください)", strings.Join(e.Names, ", "))
+}
+
+// expandTextVars はテキスト中の {{name}} と {{var:name}} を vars の値に置き換えます。
+// 定義されていない変数は空文字に置き換え、その名前を並べた UndefinedVarError を置き換え後のテキストとともに返します。
+// エラーにするか空文字のまま使うかは呼び出し元で選びます
+func expandTextVars(text string, vars map[string]string) (string, error) {
+	undefined := map[string]bool{}
+	expanded := textVarPattern.ReplaceAllStringFunc(text, func(m string) string {
+		name := textVarPattern.FindStringSubmatch(m)[1]
+		value, ok := vars[name]
+		if !ok {
+			undefined[name] = true
+		}
+		return value
+	})
+	if len(undefined) == 0 {
+		return expanded, nil
+	}
+	names := make([]string, 0, len(undefined))
+	for name := range undefined {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return expanded, &UndefinedVarError{Names: names}
+}
+
+// checkUndefinedVarMode は --undefined-var の指定が正しいかを確認します
+func checkUndefinedVarMode(mode string) error {
+	for _, m := range undefinedVarModes {
+		if m == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("--undefined-var には %s のいずれかを指定してください: %s", strings.Join(undefinedVarModes, ", "), mode)
+}
+
+// mergeTextVars は base に overrides を重ねた変数を返します。同じ名前は overrides の値を使います
+func mergeTextVars(base, overrides map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(overrides))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
+}
+
+// parseTextVar は "名前=値" の形式の変数の定義を解析します
+func parseTextVar(s string) (name, value string, err error) {
+	name, value, ok := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return "", "", fmt.Errorf("変数 '%s' は '名前=値' の形式で指定してください", s)
+	}
+	return name, value, nil
+}
+
+// textVarsFlag は --var "名前=値" を複数回指定できるようにする flag.Value です
+type textVarsFlag map[string]string
+
+func (f textVarsFlag) String() string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + "=" + f[name]
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (f textVarsFlag) Set(value string) error {
+	name, v, err := parseTextVar(value)
+	if err != nil {
+		return err
+	}
+	f[name] = v
+	return nil
+}
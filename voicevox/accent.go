@@ -0,0 +1,143 @@
+package voicevox
+
+import "fmt"
+
+// Length はモーラの長さ (子音と母音の長さの合計、秒) を返します
+func (m *Mora) Length() float64 {
+	if m.ConsonantLength == nil {
+		return m.VowelLength
+	}
+	return *m.ConsonantLength + m.VowelLength
+}
+
+// Moras はすべてのアクセント句のモーラを順に並べて返します。句の後の無音 (PauseMora) は含みません。
+// 要素はクエリのモーラを指すため、書き換えるとクエリに反映されます
+func (q *AudioQuery) Moras() []*Mora {
+	var moras []*Mora
+	for i := range q.AccentPhrases {
+		phrase := &q.AccentPhrases[i]
+		for j := range phrase.Moras {
+			moras = append(moras, &phrase.Moras[j])
+		}
+	}
+	return moras
+}
+
+// mora は Moras の順で index 番目 (0始まり) のモーラを返します
+func (q *AudioQuery) mora(index int) (*Mora, error) {
+	moras := q.Moras()
+	if index < 0 || index >= len(moras) {
+		return nil, fmt.Errorf("モーラの番号 %d が範囲外です (0〜%d)", index, len(moras)-1)
+	}
+	return moras[index], nil
+}
+
+// phrase は index 番目 (0始まり) のアクセント句を返します
+func (q *AudioQuery) phrase(index int) (*AccentPhrase, error) {
+	if index < 0 || index >= len(q.AccentPhrases) {
+		return nil, fmt.Errorf("アクセント句の番号 %d が範囲外です (0〜%d)", index, len(q.AccentPhrases)-1)
+	}
+	return &q.AccentPhrases[index], nil
+}
+
+// SetMoraPitch は Moras の順で index 番目のモーラの音高を変更します。0 を指定すると無声化します
+func (q *AudioQuery) SetMoraPitch(index int, pitch float64) error {
+	m, err := q.mora(index)
+	if err != nil {
+		return err
+	}
+	m.Pitch = pitch
+	return nil
+}
+
+// ScaleMoraLength は Moras の順で index 番目のモーラの子音と母音の長さを scale 倍にします
+func (q *AudioQuery) ScaleMoraLength(index int, scale float64) error {
+	if scale <= 0 {
+		return fmt.Errorf("長さの倍率は正の値で指定してください")
+	}
+	m, err := q.mora(index)
+	if err != nil {
+		return err
+	}
+	if m.ConsonantLength != nil {
+		length := *m.ConsonantLength * scale
+		m.ConsonantLength = &length
+	}
+	m.VowelLength *= scale
+	return nil
+}
+
+// SetPause は phrase 番目 (0始まり) のアクセント句の後に seconds 秒の無音を入れます。
+// 既に無音がある場合は長さを変更し、0 を指定すると無音を取り除きます
+func (q *AudioQuery) SetPause(phrase int, seconds float64) error {
+	p, err := q.phrase(phrase)
+	if err != nil {
+		return err
+	}
+	switch {
+	case seconds < 0:
+		return fmt.Errorf("無音の長さは0以上の秒数で指定してください")
+	case seconds == 0:
+		p.PauseMora = nil
+	case p.PauseMora != nil:
+		p.PauseMora.VowelLength = seconds
+	default:
+		p.PauseMora = &Mora{Text: "、", Vowel: "pau", VowelLength: seconds}
+	}
+	return nil
+}
+
+// SetAccent は phrase 番目 (0始まり) のアクセント句のアクセント核の位置 (1始まりのモーラ番号) を変更します。
+// 合成に使われるのは各モーラの音高のため、変更後は Client.MoraPitch で音高を計算し直してください
+func (q *AudioQuery) SetAccent(phrase, accent int) error {
+	p, err := q.phrase(phrase)
+	if err != nil {
+		return err
+	}
+	if accent < 1 || accent > len(p.Moras) {
+		return fmt.Errorf("アクセントの位置 %d が範囲外です (1〜%d)", accent, len(p.Moras))
+	}
+	p.Accent = accent
+	return nil
+}
+
+// Phoneme は合成される音声での音素と、その開始・終了時刻 (音声の先頭からの秒) です
+type Phoneme struct {
+	Phoneme string  `json:"phoneme"` // 子音・母音 (a, k, N, cl など) か、無音の "pau" です
+	Start   float64 `json:"start"`
+	End     float64 `json:"end"`
+}
+
+// Phonemes は前の無音・各モーラの子音と母音・句の後の無音・後の無音の長さを話速 (speedScale) で割り、
+// 合成される音声での音素の時刻を順に返します
+func (q *AudioQuery) Phonemes() []Phoneme {
+	speed := q.SpeedScale
+	if speed <= 0 {
+		speed = 1
+	}
+	var phonemes []Phoneme
+	t := 0.0
+	add := func(phoneme string, length float64) {
+		if length <= 0 {
+			return
+		}
+		end := t + length/speed
+		phonemes = append(phonemes, Phoneme{Phoneme: phoneme, Start: t, End: end})
+		t = end
+	}
+
+	add("pau", q.PrePhonemeLength)
+	for _, phrase := range q.AccentPhrases {
+		for _, mora := range phrase.Moras {
+			if mora.Consonant != nil && mora.ConsonantLength != nil {
+				add(*mora.Consonant, *mora.ConsonantLength)
+			}
+			add(mora.Vowel, mora.VowelLength)
+		}
+		if phrase.PauseMora != nil {
+			add("pau", phrase.PauseMora.VowelLength)
+		}
+	}
+	add("pau", q.PostPhonemeLength)
+	return phonemes
+}
@@ -0,0 +1,253 @@
+package voicevox
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+// newAccentQuery は「コンニチワ、セカイ」の2つのアクセント句のクエリを作成します
+func newAccentQuery() *AudioQuery {
+	return &AudioQuery{
+		AccentPhrases: []AccentPhrase{
+			{
+				Moras: []Mora{
+					{Text: "コ", Consonant: ptr("k"), ConsonantLength: ptr(0.05), Vowel: "o", VowelLength: 0.1, Pitch: 5.5},
+					{Text: "ン", Vowel: "N", VowelLength: 0.08, Pitch: 5.8},
+					{Text: "ニ", Consonant: ptr("n"), ConsonantLength: ptr(0.04), Vowel: "i", VowelLength: 0.09, Pitch: 5.9},
+				},
+				Accent:    3,
+				PauseMora: &Mora{Text: "、", Vowel: "pau", VowelLength: 0.3},
+			},
+			{
+				Moras: []Mora{
+					{Text: "セ", Consonant: ptr("s"), ConsonantLength: ptr(0.06), Vowel: "e", VowelLength: 0.1, Pitch: 5.7},
+					{Text: "カ", Consonant: ptr("k"), ConsonantLength: ptr(0.05), Vowel: "a", VowelLength: 0.12, Pitch: 5.4},
+				},
+				Accent: 1,
+			},
+		},
+		SpeedScale:        1,
+		PrePhonemeLength:  0.1,
+		PostPhonemeLength: 0.2,
+	}
+}
+
+func TestSetMoraPitch(t *testing.T) {
+	tests := []struct {
+		index   int
+		pitch   float64
+		wantErr bool
+	}{
+		{index: 0, pitch: 6},
+		{index: 3, pitch: 4.2}, // 2つ目のアクセント句の最初のモーラ
+		{index: 4, pitch: 0},   // 無声化
+		{index: -1, wantErr: true},
+		{index: 5, wantErr: true},
+	}
+	for _, tt := range tests {
+		q := newAccentQuery()
+		err := q.SetMoraPitch(tt.index, tt.pitch)
+		if tt.wantErr {
+			if err == nil || !strings.Contains(err.Error(), "範囲外") {
+				t.Errorf("SetMoraPitch(%d) = %v, want an out of range error", tt.index, err)
+			}
+			if !reflect.DeepEqual(q, newAccentQuery()) {
+				t.Errorf("SetMoraPitch(%d) changed the query on error", tt.index)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("SetMoraPitch(%d): %v", tt.index, err)
+			continue
+		}
+		if got := q.Moras()[tt.index].Pitch; got != tt.pitch {
+			t.Errorf("SetMoraPitch(%d): pitch = %g, want %g", tt.index, got, tt.pitch)
+		}
+	}
+}
+
+func TestScaleMoraLength(t *testing.T) {
+	tests := []struct {
+		index         int
+		scale         float64
+		wantConsonant *float64
+		wantVowel     float64
+		wantErr       string
+	}{
+		{index: 0, scale: 2, wantConsonant: ptr(0.1), wantVowel: 0.2},
+		{index: 1, scale: 0.5, wantVowel: 0.04}, // 子音の無いモーラ
+		{index: 4, scale: 1.5, wantConsonant: ptr(0.075), wantVowel: 0.18},
+		{index: 0, scale: 0, wantErr: "正の値"},
+		{index: 0, scale: -1, wantErr: "正の値"},
+		{index: -1, scale: 2, wantErr: "範囲外"},
+		{index: 5, scale: 2, wantErr: "範囲外"},
+	}
+	for _, tt := range tests {
+		q := newAccentQuery()
+		err := q.ScaleMoraLength(tt.index, tt.scale)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ScaleMoraLength(%d, %g) = %v, want an error containing %q", tt.index, tt.scale, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ScaleMoraLength(%d, %g): %v", tt.index, tt.scale, err)
+			continue
+		}
+		m := q.Moras()[tt.index]
+		if (m.ConsonantLength == nil) != (tt.wantConsonant == nil) ||
+			(m.ConsonantLength != nil && math.Abs(*m.ConsonantLength-*tt.wantConsonant) > 1e-9) {
+			t.Errorf("ScaleMoraLength(%d, %g): consonant length = %v, want %v", tt.index, tt.scale, m.ConsonantLength, tt.wantConsonant)
+		}
+		if math.Abs(m.VowelLength-tt.wantVowel) > 1e-9 {
+			t.Errorf("ScaleMoraLength(%d, %g): vowel length = %g, want %g", tt.index, tt.scale, m.VowelLength, tt.wantVowel)
+		}
+	}
+
+	// 子音の長さは新しい値に置き換えるため、ポインタを共有する浅いコピーは変わりません
+	q := newAccentQuery()
+	shared := q.AccentPhrases[0].Moras[0].ConsonantLength
+	if err := q.ScaleMoraLength(0, 3); err != nil {
+		t.Fatal(err)
+	}
+	if *shared != 0.05 {
+		t.Errorf("ScaleMoraLength modified the shared consonant length: %g", *shared)
+	}
+}
+
+func TestSetPause(t *testing.T) {
+	tests := []struct {
+		name    string
+		phrase  int
+		seconds float64
+		want    *Mora
+		wantErr string
+	}{
+		{name: "change", phrase: 0, seconds: 0.5, want: &Mora{Text: "、", Vowel: "pau", VowelLength: 0.5}},
+		{name: "remove", phrase: 0, seconds: 0},
+		{name: "add", phrase: 1, seconds: 0.2, want: &Mora{Text: "、", Vowel: "pau", VowelLength: 0.2}},
+		{name: "remove none", phrase: 1, seconds: 0},
+		{name: "negative", phrase: 0, seconds: -0.1, wantErr: "0以上"},
+		{name: "negative index", phrase: -1, seconds: 0.1, wantErr: "範囲外"},
+		{name: "out of range", phrase: 2, seconds: 0.1, wantErr: "範囲外"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newAccentQuery()
+			err := q.SetPause(tt.phrase, tt.seconds)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("SetPause = %v, want an error containing %q", err, tt.wantErr)
+				}
+				if !reflect.DeepEqual(q, newAccentQuery()) {
+					t.Error("SetPause changed the query on error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := q.AccentPhrases[tt.phrase].PauseMora; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PauseMora = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetAccent(t *testing.T) {
+	tests := []struct {
+		phrase, accent int
+		wantErr        bool
+	}{
+		{phrase: 0, accent: 1},
+		{phrase: 0, accent: 3}, // 最後のモーラ
+		{phrase: 1, accent: 2},
+		{phrase: 0, accent: 0, wantErr: true},
+		{phrase: 0, accent: 4, wantErr: true},
+		{phrase: 1, accent: 3, wantErr: true},
+		{phrase: -1, accent: 1, wantErr: true},
+		{phrase: 2, accent: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		q := newAccentQuery()
+		err := q.SetAccent(tt.phrase, tt.accent)
+		if tt.wantErr {
+			if err == nil || !strings.Contains(err.Error(), "範囲外") {
+				t.Errorf("SetAccent(%d, %d) = %v, want an out of range error", tt.phrase, tt.accent, err)
+			}
+			if !reflect.DeepEqual(q, newAccentQuery()) {
+				t.Errorf("SetAccent(%d, %d) changed the query on error", tt.phrase, tt.accent)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("SetAccent(%d, %d): %v", tt.phrase, tt.accent, err)
+			continue
+		}
+		if got := q.AccentPhrases[tt.phrase].Accent; got != tt.accent {
+			t.Errorf("SetAccent(%d, %d): accent = %d", tt.phrase, tt.accent, got)
+		}
+	}
+}
+
+func TestPhonemes(t *testing.T) {
+	want := []struct {
+		phoneme string
+		length  float64
+	}{
+		{"pau", 0.1},
+		{"k", 0.05}, {"o", 0.1},
+		{"N", 0.08},
+		{"n", 0.04}, {"i", 0.09},
+		{"pau", 0.3},
+		{"s", 0.06}, {"e", 0.1},
+		{"k", 0.05}, {"a", 0.12},
+		{"pau", 0.2},
+	}
+	tests := []struct {
+		name  string
+		speed float64
+		scale float64 // 長さの倍率 (1 / 話速)
+	}{
+		{"normal", 1, 1},
+		{"fast", 2, 0.5},
+		{"zero speed", 0, 1}, // 話速が 0 以下のクエリは等速として扱います
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newAccentQuery()
+			q.SpeedScale = tt.speed
+			got := q.Phonemes()
+			if len(got) != len(want) {
+				t.Fatalf("len(Phonemes) = %d, want %d: %+v", len(got), len(want), got)
+			}
+			start := 0.0
+			for i, w := range want {
+				end := start + w.length*tt.scale
+				if got[i].Phoneme != w.phoneme || math.Abs(got[i].Start-start) > 1e-9 || math.Abs(got[i].End-end) > 1e-9 {
+					t.Errorf("Phonemes[%d] = %+v, want {%s %g %g}", i, got[i], w.phoneme, start, end)
+				}
+				start = end
+			}
+		})
+	}
+
+	// 長さが 0 の音素と、長さの無い子音は含めません
+	q := newAccentQuery()
+	q.PrePhonemeLength = 0
+	q.AccentPhrases[0].PauseMora = nil
+	q.AccentPhrases[1].Moras[0].ConsonantLength = nil
+	for _, p := range q.Phonemes() {
+		if p.Phoneme == "s" || p.End <= p.Start {
+			t.Errorf("unexpected phoneme %+v", p)
+		}
+	}
+	if got := q.Phonemes()[0]; got.Phoneme != "k" || got.Start != 0 {
+		t.Errorf("first phoneme = %+v, want k at 0", got)
+	}
+}
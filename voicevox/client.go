@@ -0,0 +1,488 @@
+// Package voicevox はVOICEVOXエンジンのREST APIのクライアントです。
+//
+//	client := voicevox.NewClient(50021)
+//	query, err := client.AudioQuery(ctx, "こんにちは", 3)
+//	...
+//	wav, err := client.Synthesis(ctx, query, 3)
+//
+// エンジンに接続できない場合は *ConnectionError、APIがエラーのステータスコードを返した場合は *APIError を返します。
+// ctx がキャンセルされた場合は、送信中のリクエストを中断して ctx.Err() を返します
+package voicevox
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Doer はHTTPリクエストを送信するインターフェースです。*http.Client はこれを満たします。
+// httptest.Server に向けたクライアントや自作のモックを差し込むことで、エンジン無しで Client を動かせます
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// 既定のタイムアウトです。合成は長文だと時間が掛かるため、既定では制限しません
+const (
+	DefaultConnectTimeout   = 10 * time.Second
+	DefaultSynthesisTimeout = 0
+)
+
+// 再試行の待ち時間です。待ち時間は再試行のたびに倍にしますが、maxRetryDelay を上限にします
+const (
+	DefaultRetryDelay = 500 * time.Millisecond
+	maxRetryDelay     = 30 * time.Second
+)
+
+// Client はVOICEVOX APIとの通信を管理します
+type Client struct {
+	BaseURL       string
+	Headers       http.Header // すべてのリクエストに付与するヘッダー (認証ヘッダーなど)
+	Doer          Doer        // 話者の取得やバージョン確認など、すぐに終わるリクエストに使います
+	SynthesisDoer Doer        // 音声合成 (/synthesis) に使います。nil の場合は Doer を使います
+	CoreVersion   string      // 空でない場合、合成系のリクエストに core_version として付与します
+	// Retries は接続エラー・タイムアウトと 5xx のレスポンスを再試行する回数です。0 なら再試行しません
+	Retries int
+	// RetryDelay は最初の再試行までの待ち時間です。再試行のたびに倍にし、ランダムな揺らぎを加えます
+	RetryDelay time.Duration
+	// OnRetry は nil でなければ、再試行の前に失敗の理由と待ち時間を渡して呼び出します
+	OnRetry func(attempt int, err error, wait time.Duration)
+}
+
+// NewClient は localhost の指定したポートで動くエンジンのAPIクライアントを作成します
+func NewClient(port int) *Client {
+	client := NewClientWithDoer(fmt.Sprintf("http://localhost:%d", port), NewHTTPClient(DefaultConnectTimeout, false))
+	client.SynthesisDoer = NewHTTPClient(DefaultSynthesisTimeout, false)
+	return client
+}
+
+// NewClientWithDoer は指定したURLのエンジンと、指定した Doer で通信するAPIクライアントを作成します
+func NewClientWithDoer(baseURL string, doer Doer) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Headers:    http.Header{},
+		Doer:       doer,
+		RetryDelay: DefaultRetryDelay,
+	}
+}
+
+// NewHTTPClient はタイムアウト (0 なら無制限) を設定したHTTPクライアントを作成します。
+// insecure が true の場合はTLS証明書の検証を省略します（自己署名証明書のエンジン向け）
+func NewHTTPClient(timeout time.Duration, insecure bool) *http.Client {
+	client := &http.Client{Timeout: timeout}
+	if insecure {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		client.Transport = transport
+	}
+	return client
+}
+
+// SetBasicAuth はすべてのリクエストにBasic認証のヘッダーを付与します
+func (c *Client) SetBasicAuth(username, password string) {
+	if c.Headers == nil {
+		c.Headers = http.Header{}
+	}
+	auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	c.Headers.Set("Authorization", "Basic "+auth)
+}
+
+// newRequest はAPIリクエストを作成し、共通のヘッダーを付与します。path にはクエリ文字列を含められます
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("リクエストの作成に失敗しました: %v", err)
+	}
+	for key, values := range c.Headers {
+		for _, v := range values {
+			req.Header.Add(key, v)
+		}
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// do はリクエストを送信します。エンジンに接続できなかった場合は ConnectionError を返します
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	return c.send(c.Doer, req)
+}
+
+// doSynthesis は音声合成のリクエストを、合成用の (タイムアウトの長い) Doer で送信します
+func (c *Client) doSynthesis(req *http.Request) (*http.Response, error) {
+	if c.SynthesisDoer == nil {
+		return c.do(req)
+	}
+	return c.send(c.SynthesisDoer, req)
+}
+
+// send は Doer でリクエストを送信し、失敗した場合は ConnectionError を返します。
+// 接続エラーと 5xx のレスポンスは、Retries 回まで待ち時間を延ばしながら再試行します。
+// リクエストの context がキャンセルされた場合は、再試行せずに context のエラーを返します
+func (c *Client) send(doer Doer, req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := doer.Do(req)
+		if ctxErr := req.Context().Err(); err != nil && ctxErr != nil {
+			return nil, ctxErr
+		}
+		if err != nil {
+			err = &ConnectionError{Err: err}
+		} else if resp.StatusCode >= http.StatusInternalServerError && attempt <= c.Retries {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			err = &APIError{Op: req.URL.Path + " へのリクエストに失敗しました", StatusCode: resp.StatusCode, Body: string(body)}
+		}
+		if err == nil || attempt > c.Retries {
+			return resp, err
+		}
+		if req.GetBody != nil {
+			body, berr := req.GetBody()
+			if berr != nil {
+				return nil, fmt.Errorf("再試行するリクエストの作成に失敗しました: %v", berr)
+			}
+			req.Body = body
+		}
+		wait := c.retryWait(attempt)
+		if c.OnRetry != nil {
+			c.OnRetry(attempt, err, wait)
+		}
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// retryWait は attempt 回目の再試行までの待ち時間です。RetryDelay を再試行ごとに倍にし、
+// 複数のチャンクが同時に再試行しないよう、その半分から等倍の間でランダムに揺らします
+func (c *Client) retryWait(attempt int) time.Duration {
+	if c.RetryDelay <= 0 {
+		return 0
+	}
+	wait := c.RetryDelay
+	for i := 1; i < attempt && wait < maxRetryDelay; i++ {
+		wait *= 2
+	}
+	wait = min(wait, maxRetryDelay)
+	return wait/2 + rand.N(wait/2+1)
+}
+
+// getJSON はエンドポイントにGETリクエストを送り、レスポンスのJSONを v にデコードします。
+// what はエラーメッセージに使う取得対象の説明です (例: "話者情報")
+func (c *Client) getJSON(ctx context.Context, path, what string, v interface{}) error {
+	req, err := c.newRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &APIError{Op: what + "の取得に失敗しました", StatusCode: resp.StatusCode}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%sのデコードに失敗しました: %v", what, err)
+	}
+	return nil
+}
+
+// Speakers はエンジンから利用可能な話者の一覧を取得します
+func (c *Client) Speakers(ctx context.Context) ([]Speaker, error) {
+	var speakers []Speaker
+	if err := c.getJSON(ctx, "/speakers", "話者情報", &speakers); err != nil {
+		return nil, err
+	}
+	return speakers, nil
+}
+
+// SpeakerInfo は話者のUUIDから、利用規約などの詳細情報を取得します
+func (c *Client) SpeakerInfo(ctx context.Context, uuid string) (*SpeakerInfo, error) {
+	var info SpeakerInfo
+	if err := c.getJSON(ctx, "/speaker_info?speaker_uuid="+url.QueryEscape(uuid), "話者の詳細情報", &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// SupportedDevices はエンジンが合成に利用できるデバイスの情報を取得します
+func (c *Client) SupportedDevices(ctx context.Context) (*SupportedDevices, error) {
+	var devices SupportedDevices
+	if err := c.getJSON(ctx, "/supported_devices", "デバイス情報", &devices); err != nil {
+		if IsNotFound(err) {
+			return nil, fmt.Errorf("このエンジンは対応していません (/supported_devices がありません)")
+		}
+		return nil, err
+	}
+	return &devices, nil
+}
+
+// EngineManifest はエンジンの名前・バージョン・対応機能を取得します
+func (c *Client) EngineManifest(ctx context.Context) (*EngineManifest, error) {
+	var manifest EngineManifest
+	if err := c.getJSON(ctx, "/engine_manifest", "エンジンの情報", &manifest); err != nil {
+		if IsNotFound(err) {
+			return nil, fmt.Errorf("このエンジンは対応していません (/engine_manifest がありません。VOICEVOX 0.12 以降のエンジンが必要です)")
+		}
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// CoreVersions はエンジンに搭載されているコアのバージョン一覧を取得します
+func (c *Client) CoreVersions(ctx context.Context) ([]string, error) {
+	var versions []string
+	if err := c.getJSON(ctx, "/core_versions", "コアバージョン一覧", &versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// Presets はエンジンに登録済みのプリセット一覧を取得します
+func (c *Client) Presets(ctx context.Context) ([]Preset, error) {
+	var presets []Preset
+	if err := c.getJSON(ctx, "/presets", "プリセット一覧", &presets); err != nil {
+		if IsNotFound(err) {
+			return nil, fmt.Errorf("このエンジンは対応していません (/presets がありません)")
+		}
+		return nil, err
+	}
+	return presets, nil
+}
+
+// Version はエンジンのバージョンを取得します
+func (c *Client) Version(ctx context.Context) (string, error) {
+	var version string
+	if err := c.getJSON(ctx, "/version", "エンジンのバージョン", &version); err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+// addCoreVersion はコアのバージョンが指定されていれば、クエリパラメータに追加します
+func (c *Client) addCoreVersion(params url.Values) {
+	if c.CoreVersion != "" {
+		params.Add("core_version", c.CoreVersion)
+	}
+}
+
+// InitializeSpeaker は話者のモデルを事前に読み込み、初回の合成を速くします。
+// /initialize_speaker が無い古いエンジンでは何もしません
+func (c *Client) InitializeSpeaker(ctx context.Context, speakerID int) error {
+	params := url.Values{}
+	params.Add("speaker", strconv.Itoa(speakerID))
+	params.Add("skip_reinit", "true")
+	c.addCoreVersion(params)
+	req, err := c.newRequest(ctx, "POST", "/initialize_speaker?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.doSynthesis(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return &APIError{Op: "話者の初期化に失敗しました", StatusCode: resp.StatusCode, Body: string(body)}
+}
+
+// AudioQuery はテキストから音声合成クエリを生成します
+func (c *Client) AudioQuery(ctx context.Context, text string, speakerID int) (*AudioQuery, error) {
+	params := url.Values{}
+	params.Add("text", text)
+	params.Add("speaker", strconv.Itoa(speakerID))
+	c.addCoreVersion(params)
+	return c.postAudioQuery(ctx, "/audio_query", params)
+}
+
+// AudioQueryFromPreset はテキストからプリセットの値を反映した音声合成クエリを生成します。
+// /audio_query_from_preset が無い古いエンジンでは、/audio_query のクエリにプリセットの値を反映します。
+// どちらの場合もクエリを speakerID のスタイルで生成するよう、プリセットのスタイルIDが speakerID と異なる場合はエラーにします
+func (c *Client) AudioQueryFromPreset(ctx context.Context, text string, speakerID int, preset *Preset) (*AudioQuery, error) {
+	if err := preset.CheckStyle(speakerID); err != nil {
+		return nil, err
+	}
+	params := url.Values{}
+	params.Add("text", text)
+	params.Add("preset_id", strconv.Itoa(preset.ID))
+	c.addCoreVersion(params)
+	query, err := c.postAudioQuery(ctx, "/audio_query_from_preset", params)
+	if err == nil || !IsNotFound(err) {
+		return query, err
+	}
+
+	query, err = c.AudioQuery(ctx, text, speakerID)
+	if err != nil {
+		return nil, err
+	}
+	preset.Apply(query)
+	return query, nil
+}
+
+// postAudioQuery は音声合成クエリを生成するエンドポイントにリクエストを送り、クエリをデコードします
+func (c *Client) postAudioQuery(ctx context.Context, path string, params url.Values) (*AudioQuery, error) {
+	req, err := c.newRequest(ctx, "POST", path+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &APIError{Op: "audio_queryの生成に失敗しました", StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var query AudioQuery
+	if err := json.NewDecoder(resp.Body).Decode(&query); err != nil {
+		return nil, fmt.Errorf("audio_queryのデコードに失敗しました: %v", err)
+	}
+	return &query, nil
+}
+
+// kanaQuerySamplingRate は KanaAudioQuery のクエリの出力サンプリングレートで、VOICEVOXエンジンの既定値です
+const kanaQuerySamplingRate = 24000
+
+// KanaAudioQuery はAquesTalk風記法のkanaから音声合成クエリを生成します。
+// /audio_query は kana を解釈しないため、is_kana=true で解釈させた /accent_phrases のアクセント句に、
+// /audio_query と同じ既定のパラメータを組み合わせます。リクエストは1回です
+func (c *Client) KanaAudioQuery(ctx context.Context, kana string, speakerID int) (*AudioQuery, error) {
+	params := url.Values{}
+	params.Add("text", kana)
+	params.Add("speaker", strconv.Itoa(speakerID))
+	params.Add("is_kana", "true")
+	c.addCoreVersion(params)
+
+	req, err := c.newRequest(ctx, "POST", "/accent_phrases?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &APIError{Op: "kanaの解析に失敗しました", StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var phrases []AccentPhrase
+	if err := json.NewDecoder(resp.Body).Decode(&phrases); err != nil {
+		return nil, fmt.Errorf("アクセント句のデコードに失敗しました: %v", err)
+	}
+	return &AudioQuery{
+		AccentPhrases:      phrases,
+		SpeedScale:         1,
+		PitchScale:         0,
+		IntonationScale:    1,
+		VolumeScale:        1,
+		PrePhonemeLength:   0.1,
+		PostPhonemeLength:  0.1,
+		OutputSamplingRate: kanaQuerySamplingRate,
+		Kana:               kana,
+	}, nil
+}
+
+// MoraPitch はアクセント句のアクセントの位置から、各モーラの音高を /mora_pitch で計算し直します。
+// AudioQuery.SetAccent でアクセントを変更した後に使います
+func (c *Client) MoraPitch(ctx context.Context, query *AudioQuery, speakerID int) error {
+	body, err := json.Marshal(query.AccentPhrases)
+	if err != nil {
+		return fmt.Errorf("アクセント句のJSON変換に失敗しました: %v", err)
+	}
+
+	params := url.Values{}
+	params.Add("speaker", strconv.Itoa(speakerID))
+	c.addCoreVersion(params)
+
+	req, err := c.newRequest(ctx, "POST", "/mora_pitch?"+params.Encode(), bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return &APIError{Op: "音高の計算に失敗しました", StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var phrases []AccentPhrase
+	if err := json.NewDecoder(resp.Body).Decode(&phrases); err != nil {
+		return fmt.Errorf("アクセント句のデコードに失敗しました: %v", err)
+	}
+	query.AccentPhrases = phrases
+	return nil
+}
+
+// Synthesis はクエリからWAVデータを生成します。
+// 受信が途中で中断された場合は、それまでに受信したデータを持つ *PartialAudioError を返します
+func (c *Client) Synthesis(ctx context.Context, query *AudioQuery, speakerID int) ([]byte, error) {
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("クエリのJSON変換に失敗しました: %v", err)
+	}
+
+	params := url.Values{}
+	params.Add("speaker", strconv.Itoa(speakerID))
+	c.addCoreVersion(params)
+
+	req, err := c.newRequest(ctx, "POST", "/synthesis?"+params.Encode(), bytes.NewBuffer(queryJSON))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.doSynthesis(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &APIError{Op: "音声合成に失敗しました", StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	// タイムアウトなどで中断された場合にそれまでのデータを返せるよう、受信した分をバッファに貯めながら読み込みます
+	var wav bytes.Buffer
+	if _, err := wav.ReadFrom(resp.Body); err != nil {
+		cause := error(&ConnectionError{Err: err})
+		if ctx.Err() != nil {
+			cause = ctx.Err()
+		}
+		if wav.Len() > 0 {
+			return nil, &PartialAudioError{Data: wav.Bytes(), Err: cause}
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("WAVデータの読み込みに失敗しました: %v", err)
+	}
+	return wav.Bytes(), nil
+}
@@ -0,0 +1,398 @@
+package voicevox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient は handler で応答する httptest.Server と、それに向けたクライアントを作成します
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	client := NewClientWithDoer(srv.URL, srv.Client())
+	client.RetryDelay = time.Millisecond
+	return client
+}
+
+func TestSpeakers(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/speakers" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Basic dXNlcjpwYXNz" {
+			t.Errorf("Authorization = %q", got)
+		}
+		io.WriteString(w, `[
+			{"name": "ずんだもん", "speaker_uuid": "uuid-zunda", "version": "0.14.0",
+			 "styles": [{"name": "ノーマル", "id": 3}, {"name": "あまあま", "id": 1, "type": "talk"}]},
+			{"name": "四国めたん", "speaker_uuid": "uuid-metan", "version": "0.14.0",
+			 "styles": [{"name": "ノーマル", "id": 2}]}
+		]`)
+	})
+	client.SetBasicAuth("user", "pass")
+
+	speakers, err := client.Speakers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(speakers) != 2 {
+		t.Fatalf("len(speakers) = %d, want 2", len(speakers))
+	}
+	zunda := speakers[0]
+	if zunda.Name != "ずんだもん" || zunda.SpeakerUUID != "uuid-zunda" || len(zunda.Styles) != 2 {
+		t.Errorf("speakers[0] = %+v", zunda)
+	}
+	if style := zunda.Styles[1]; style.Name != "あまあま" || style.ID != 1 || style.Type != "talk" {
+		t.Errorf("speakers[0].Styles[1] = %+v", style)
+	}
+}
+
+func TestSpeakersAPIError(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	_, err := client.Speakers(context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("err = %v, want *APIError with 404", err)
+	}
+	if !IsNotFound(err) {
+		t.Error("IsNotFound = false, want true")
+	}
+}
+
+func TestAudioQueryAndSynthesis(t *testing.T) {
+	wav := []byte("RIFF\x24\x00\x00\x00WAVEfmt ")
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/audio_query":
+			if r.Method != http.MethodPost || q.Get("text") != "こんにちは" || q.Get("speaker") != "3" || q.Get("core_version") != "0.15.0" {
+				t.Errorf("unexpected audio_query: %s %s", r.Method, r.URL)
+			}
+			io.WriteString(w, `{"accent_phrases": [{"moras": [{"text": "コ", "consonant": "k", "consonant_length": 0.05, "vowel": "o", "vowel_length": 0.1, "pitch": 5.5}], "accent": 1}],
+				"speedScale": 1, "pitchScale": 0, "intonationScale": 1, "volumeScale": 1,
+				"prePhonemeLength": 0.1, "postPhonemeLength": 0.1, "outputSamplingRate": 24000, "outputStereo": false, "kana": "コ'"}`)
+		case "/synthesis":
+			if q.Get("speaker") != "3" || r.Header.Get("Content-Type") != "application/json" {
+				t.Errorf("unexpected synthesis: %s", r.URL)
+			}
+			var query AudioQuery
+			if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+				t.Errorf("decode synthesis body: %v", err)
+			}
+			if query.SpeedScale != 1.5 {
+				t.Errorf("speedScale = %g, want 1.5", query.SpeedScale)
+			}
+			w.Header().Set("Content-Type", "audio/wav")
+			w.Write(wav)
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	})
+	client.CoreVersion = "0.15.0"
+
+	query, err := client.AudioQuery(context.Background(), "こんにちは", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(query.AccentPhrases) != 1 || query.AccentPhrases[0].Moras[0].Text != "コ" || query.OutputSamplingRate != 24000 {
+		t.Fatalf("query = %+v", query)
+	}
+	query.SpeedScale = 1.5
+	got, err := client.Synthesis(context.Background(), query, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, wav) {
+		t.Errorf("Synthesis = %q, want %q", got, wav)
+	}
+}
+
+func TestAudioQueryFromPreset(t *testing.T) {
+	preset := &Preset{ID: 1, Name: "ゆっくり", StyleID: 3, SpeedScale: 0.8, PitchScale: 0.01}
+	tests := []struct {
+		name       string
+		fromPreset bool // /audio_query_from_preset があるエンジンか
+		speakerID  int
+		wantPaths  []string
+		wantErr    bool
+	}{
+		{name: "from preset", fromPreset: true, speakerID: 3, wantPaths: []string{"/audio_query_from_preset"}},
+		{name: "old engine", speakerID: 3, wantPaths: []string{"/audio_query_from_preset", "/audio_query"}},
+		{name: "other style", fromPreset: true, speakerID: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths []string
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				paths = append(paths, r.URL.Path)
+				q := r.URL.Query()
+				switch {
+				case r.URL.Path == "/audio_query_from_preset" && tt.fromPreset:
+					if q.Get("preset_id") != "1" {
+						t.Errorf("preset_id = %q", q.Get("preset_id"))
+					}
+					io.WriteString(w, `{"accent_phrases": [], "speedScale": 0.8, "pitchScale": 0.01}`)
+				case r.URL.Path == "/audio_query":
+					if q.Get("speaker") != "3" {
+						t.Errorf("speaker = %q", q.Get("speaker"))
+					}
+					io.WriteString(w, `{"accent_phrases": [], "speedScale": 1, "pitchScale": 0}`)
+				default:
+					http.NotFound(w, r)
+				}
+			})
+
+			query, err := client.AudioQueryFromPreset(context.Background(), "こんにちは", tt.speakerID, preset)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "スタイルID 3 用") {
+					t.Errorf("err = %v, want a style mismatch error", err)
+				}
+				if len(paths) != 0 {
+					t.Errorf("requests = %v, want none", paths)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(paths, tt.wantPaths) {
+				t.Errorf("requests = %v, want %v", paths, tt.wantPaths)
+			}
+			if query.SpeedScale != 0.8 || query.PitchScale != 0.01 {
+				t.Errorf("query = %+v, want the preset values", query)
+			}
+		})
+	}
+}
+
+func TestKanaAudioQuery(t *testing.T) {
+	var requests atomic.Int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		q := r.URL.Query()
+		if r.URL.Path != "/accent_phrases" || q.Get("is_kana") != "true" || q.Get("text") != "コンニチワ'" || q.Get("speaker") != "3" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, `[{"moras": [{"text": "コ", "consonant": "k", "consonant_length": 0.05, "vowel": "o", "vowel_length": 0.1, "pitch": 5.5}], "accent": 5}]`)
+	})
+
+	query, err := client.KanaAudioQuery(context.Background(), "コンニチワ'", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("%d requests, want 1", n)
+	}
+	if len(query.AccentPhrases) != 1 || query.AccentPhrases[0].Accent != 5 || query.Kana != "コンニチワ'" {
+		t.Errorf("query = %+v", query)
+	}
+	want := AudioQuery{SpeedScale: 1, IntonationScale: 1, VolumeScale: 1, PrePhonemeLength: 0.1, PostPhonemeLength: 0.1, OutputSamplingRate: 24000}
+	got := *query
+	got.AccentPhrases, got.Kana = nil, ""
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("query parameters = %+v, want the /audio_query defaults %+v", got, want)
+	}
+}
+
+func TestSynthesisAPIErrorDetail(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		io.WriteString(w, `{"detail": [{"loc": ["body", "speedScale"], "msg": "field required"}]}`)
+	})
+	_, err := client.Synthesis(context.Background(), &AudioQuery{}, 3)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("err = %v, want *APIError with 422", err)
+	}
+	if !strings.Contains(err.Error(), "body.speedScale: field required") {
+		t.Errorf("err = %q, want the validation detail", err)
+	}
+}
+
+func TestSendRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		retries   int
+		failures  int // 503 を返す回数
+		wantCalls int
+		wantCode  int // 0 なら成功
+	}{
+		{name: "no retries", retries: 0, failures: 1, wantCalls: 1, wantCode: http.StatusServiceUnavailable},
+		{name: "recovers", retries: 2, failures: 2, wantCalls: 3},
+		{name: "exhausted", retries: 2, failures: 5, wantCalls: 3, wantCode: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				// 再試行でも同じボディを送り直していることを確かめます
+				body, _ := io.ReadAll(r.Body)
+				if !bytes.Contains(body, []byte(`"speedScale":1`)) {
+					t.Errorf("attempt %d: body = %q", calls.Load()+1, body)
+				}
+				if int(calls.Add(1)) <= tt.failures {
+					http.Error(w, "busy", http.StatusServiceUnavailable)
+					return
+				}
+				w.Write([]byte("RIFF"))
+			})
+			client.Retries = tt.retries
+			var waits []time.Duration
+			client.OnRetry = func(attempt int, err error, wait time.Duration) {
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+					t.Errorf("OnRetry err = %v, want *APIError with 503", err)
+				}
+				waits = append(waits, wait)
+			}
+
+			_, err := client.Synthesis(context.Background(), &AudioQuery{SpeedScale: 1}, 3)
+			if got := int(calls.Load()); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+			if len(waits) != tt.wantCalls-1 {
+				t.Errorf("OnRetry called %d times, want %d", len(waits), tt.wantCalls-1)
+			}
+			if tt.wantCode == 0 {
+				if err != nil {
+					t.Errorf("err = %v, want nil", err)
+				}
+				return
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.wantCode {
+				t.Errorf("err = %v, want *APIError with %d", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	c := &Client{RetryDelay: 100 * time.Millisecond}
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{20, maxRetryDelay},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if got := c.retryWait(tt.attempt); got < tt.max/2 || got > tt.max {
+				t.Errorf("retryWait(%d) = %v, want between %v and %v", tt.attempt, got, tt.max/2, tt.max)
+			}
+		}
+	}
+	if got := (&Client{}).retryWait(3); got != 0 {
+		t.Errorf("retryWait with RetryDelay 0 = %v, want 0", got)
+	}
+}
+
+func TestSendCanceledWhileWaiting(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+	})
+	client.Retries = 5
+	client.RetryDelay = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	client.OnRetry = func(int, error, time.Duration) { cancel() }
+
+	_, err := client.Version(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestConnectionError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	var retries int
+	client := NewClientWithDoer(url, &http.Client{})
+	client.Retries = 1
+	client.RetryDelay = time.Millisecond
+	client.OnRetry = func(int, error, time.Duration) { retries++ }
+
+	_, err := client.Speakers(context.Background())
+	var connErr *ConnectionError
+	if !errors.As(err, &connErr) {
+		t.Fatalf("err = %v, want *ConnectionError", err)
+	}
+	if retries != 1 {
+		t.Errorf("retries = %d, want 1", retries)
+	}
+	if !strings.Contains(err.Error(), "接続できませんでした") {
+		t.Errorf("err = %q", err)
+	}
+}
+
+func TestConnectionErrorTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+
+	client := NewClientWithDoer(srv.URL, NewHTTPClient(20*time.Millisecond, false))
+	_, err := client.Version(context.Background())
+	var connErr *ConnectionError
+	if !errors.As(err, &connErr) {
+		t.Fatalf("err = %v, want *ConnectionError", err)
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("err = %v, want a timeout", err)
+	}
+	if !connErr.Timeout() {
+		t.Error("Timeout() = false, want true")
+	}
+	if !strings.Contains(err.Error(), "タイムアウト") {
+		t.Errorf("err = %q, want a timeout message", err)
+	}
+	// ライブラリのメッセージには CLI のオプションを含めません
+	if strings.Contains(err.Error(), "--") {
+		t.Errorf("err = %q, want no command line flags", err)
+	}
+}
+
+func TestSynthesisPartialAudio(t *testing.T) {
+	partial := []byte("RIFF\x24\x10\x00\x00WAVEfmt data")
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		// Content-Length より短いボディで接続を閉じ、受信の途中で切断されたことにします
+		w.Header().Set("Content-Length", "4096")
+		w.Write(partial)
+	})
+
+	_, err := client.Synthesis(context.Background(), &AudioQuery{}, 3)
+	var partialErr *PartialAudioError
+	if !errors.As(err, &partialErr) {
+		t.Fatalf("err = %v, want *PartialAudioError", err)
+	}
+	if !bytes.Equal(partialErr.Data, partial) {
+		t.Errorf("Data = %q, want %q", partialErr.Data, partial)
+	}
+	var connErr *ConnectionError
+	if !errors.As(err, &connErr) {
+		t.Errorf("err = %v, want it to wrap *ConnectionError", err)
+	}
+}
@@ -0,0 +1,116 @@
+package voicevox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ConnectionError はVOICEVOXエンジンに接続できなかったことを表します
+type ConnectionError struct {
+	Err error
+}
+
+// Timeout は応答がタイムアウトしたことによるエラーかどうかを返します
+func (e *ConnectionError) Timeout() bool {
+	var netErr net.Error
+	return errors.As(e.Err, &netErr) && netErr.Timeout()
+}
+
+func (e *ConnectionError) Error() string {
+	if e.Timeout() {
+		return fmt.Sprintf("VOICEVOXエンジンからの応答がタイムアウトしました: %v", e.Err)
+	}
+	return fmt.Sprintf("VOICEVOXエンジンに接続できませんでした: %v\nエンジンが起動しているか、ポート番号が正しいか確認してください", e.Err)
+}
+
+func (e *ConnectionError) Unwrap() error { return e.Err }
+
+// PartialAudioError は音声合成のレスポンスの受信が途中で中断されたことを表します。
+// Data はそれまでに受信した (不完全な) WAVデータです
+type PartialAudioError struct {
+	Data []byte
+	Err  error
+}
+
+func (e *PartialAudioError) Error() string {
+	return fmt.Sprintf("WAVデータの受信が途中で中断されました (%d バイト受信済み): %v", len(e.Data), e.Err)
+}
+
+func (e *PartialAudioError) Unwrap() error { return e.Err }
+
+// APIError はVOICEVOX APIがエラーのステータスコードを返したことを表します
+type APIError struct {
+	Op         string // 失敗した処理の説明 (例: "音声合成に失敗しました")
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return e.Op + " " + formatAPIError(e.StatusCode, []byte(e.Body))
+}
+
+// formatAPIError はエラーのステータスコードとレスポンスボディを、人間が読める形に整形します。
+// VOICEVOXのエラーレスポンスの detail を解釈し、JSONでない場合はボディをそのまま表示します
+func formatAPIError(status int, body []byte) string {
+	msg := fmt.Sprintf("(ステータスコード: %d)", status)
+	if detail := formatErrorDetail(body); detail != "" {
+		if !strings.HasPrefix(detail, "\n") {
+			detail = " " + detail
+		}
+		msg += "\nエラー詳細:" + detail
+	}
+	return msg
+}
+
+// formatErrorDetail はエラーレスポンスの detail を整形します。
+// detail が配列 (Pydanticのバリデーションエラー) の場合は、各項目の loc と msg を1行ずつ列挙します
+func formatErrorDetail(body []byte) string {
+	raw := strings.TrimSpace(string(body))
+	var resp struct {
+		Detail json.RawMessage `json:"detail"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || len(resp.Detail) == 0 {
+		return raw
+	}
+
+	var text string
+	if err := json.Unmarshal(resp.Detail, &text); err == nil {
+		return text
+	}
+
+	var items []struct {
+		Loc []interface{} `json:"loc"`
+		Msg string        `json:"msg"`
+	}
+	if err := json.Unmarshal(resp.Detail, &items); err == nil && len(items) > 0 {
+		var lines []string
+		for _, item := range items {
+			loc := make([]string, len(item.Loc))
+			for i, l := range item.Loc {
+				loc[i] = fmt.Sprint(l)
+			}
+			lines = append(lines, fmt.Sprintf("  - %s: %s", strings.Join(loc, "."), item.Msg))
+		}
+		return "\n" + strings.Join(lines, "\n")
+	}
+
+	// kanaの解析エラーなど、text を持つオブジェクトの場合は text を表示します
+	var obj struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(resp.Detail, &obj); err == nil && obj.Text != "" {
+		return obj.Text
+	}
+	return raw
+}
+
+// IsNotFound はエラーがAPIの 404 Not Found によるものかどうかを返します。
+// 古いエンジンにエンドポイントが無い場合の判定に使います
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
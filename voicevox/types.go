@@ -0,0 +1,113 @@
+package voicevox
+
+import "fmt"
+
+// AudioQuery は /audio_query のレスポンスを表します
+type AudioQuery struct {
+	AccentPhrases      []AccentPhrase `json:"accent_phrases"`
+	SpeedScale         float64        `json:"speedScale"`
+	PitchScale         float64        `json:"pitchScale"`
+	IntonationScale    float64        `json:"intonationScale"`
+	VolumeScale        float64        `json:"volumeScale"`
+	PrePhonemeLength   float64        `json:"prePhonemeLength"`
+	PostPhonemeLength  float64        `json:"postPhonemeLength"`
+	OutputSamplingRate int            `json:"outputSamplingRate"`
+	OutputStereo       bool           `json:"outputStereo"`
+	Kana               string         `json:"kana"`
+}
+
+// AccentPhrase は音声合成クエリのアクセント句を表します
+type AccentPhrase struct {
+	Moras           []Mora `json:"moras"`
+	Accent          int    `json:"accent"`     // アクセント核の位置 (1始まりのモーラ番号)
+	PauseMora       *Mora  `json:"pause_mora"` // アクセント句の後の無音。無い場合は nil です
+	IsInterrogative bool   `json:"is_interrogative"`
+}
+
+// Mora はアクセント句を構成するモーラ（「こ」「ん」などの音の単位）を表します。
+// 長さは秒、音高は対数の周波数で、0 は無声化を表します
+type Mora struct {
+	Text            string   `json:"text"`
+	Consonant       *string  `json:"consonant"` // 母音だけのモーラでは nil です
+	ConsonantLength *float64 `json:"consonant_length"`
+	Vowel           string   `json:"vowel"`
+	VowelLength     float64  `json:"vowel_length"`
+	Pitch           float64  `json:"pitch"`
+}
+
+// Speaker は /speakers のレスポンスに含まれる話者情報を表します
+type Speaker struct {
+	Name        string         `json:"name"`
+	SpeakerUUID string         `json:"speaker_uuid"`
+	Styles      []SpeakerStyle `json:"styles"`
+	Version     string         `json:"version"`
+}
+
+// SpeakerStyle は話者のスタイル（ノーマル、あまあま等）を表します
+type SpeakerStyle struct {
+	Name string `json:"name"`
+	ID   int    `json:"id"`
+	Type string `json:"type,omitempty"` // "talk" や "singing_teacher" など。古いエンジンでは空です
+}
+
+// SpeakerInfo は /speaker_info のレスポンス（話者の利用規約や立ち絵）を表します
+type SpeakerInfo struct {
+	Policy   string `json:"policy"`
+	Portrait string `json:"portrait"` // base64エンコードされたPNG画像
+}
+
+// SupportedDevices は /supported_devices のレスポンス（エンジンが利用可能なデバイス）を表します
+type SupportedDevices struct {
+	CPU  bool `json:"cpu"`
+	CUDA bool `json:"cuda"`
+	DML  bool `json:"dml"`
+}
+
+// EngineManifest は /engine_manifest のレスポンス（エンジンの名前や対応機能）を表します
+type EngineManifest struct {
+	Name                string          `json:"name"`
+	BrandName           string          `json:"brand_name"`
+	UUID                string          `json:"uuid"`
+	URL                 string          `json:"url"`
+	Version             string          `json:"version"`
+	DefaultSamplingRate int             `json:"default_sampling_rate"`
+	SupportedFeatures   map[string]bool `json:"supported_features"`
+}
+
+// Supports はエンジンが機能 (supported_features のキー) に対応しているかを返します
+func (m *EngineManifest) Supports(feature string) bool {
+	return m.SupportedFeatures[feature]
+}
+
+// Preset は /presets のレスポンスに含まれる、エンジンに登録済みのプリセットを表します
+type Preset struct {
+	ID                int     `json:"id"`
+	Name              string  `json:"name"`
+	SpeakerUUID       string  `json:"speaker_uuid"`
+	StyleID           int     `json:"style_id"`
+	SpeedScale        float64 `json:"speedScale"`
+	PitchScale        float64 `json:"pitchScale"`
+	IntonationScale   float64 `json:"intonationScale"`
+	VolumeScale       float64 `json:"volumeScale"`
+	PrePhonemeLength  float64 `json:"prePhonemeLength"`
+	PostPhonemeLength float64 `json:"postPhonemeLength"`
+}
+
+// Apply はプリセットの値で音声合成クエリを上書きします
+func (p *Preset) Apply(query *AudioQuery) {
+	query.SpeedScale = p.SpeedScale
+	query.PitchScale = p.PitchScale
+	query.IntonationScale = p.IntonationScale
+	query.VolumeScale = p.VolumeScale
+	query.PrePhonemeLength = p.PrePhonemeLength
+	query.PostPhonemeLength = p.PostPhonemeLength
+}
+
+// CheckStyle はプリセットを styleID の合成に使えるかを確認します。
+// /audio_query_from_preset はプリセットのスタイルでクエリを生成するため、別のスタイルで合成するとアクセントや音素の長さが合いません
+func (p *Preset) CheckStyle(styleID int) error {
+	if p.StyleID != styleID {
+		return fmt.Errorf("プリセット '%s' (ID: %d) はスタイルID %d 用のため、スタイルID %d の合成には使えません", p.Name, p.ID, p.StyleID, styleID)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package voicevox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// WordTypes は単語を登録するときに指定できる品詞です
+var WordTypes = []string{"PROPER_NOUN", "COMMON_NOUN", "VERB", "ADJECTIVE", "SUFFIX"}
+
+// UserDictWord は /user_dict のレスポンスに含まれる、ユーザー辞書の単語を表します。
+// /import_user_dict で読み込めるよう、エンジンが返すフィールドをすべて持ちます
+type UserDictWord struct {
+	Surface               string `json:"surface"`
+	Priority              int    `json:"priority"`
+	ContextID             int    `json:"context_id"`
+	PartOfSpeech          string `json:"part_of_speech"`
+	PartOfSpeechDetail1   string `json:"part_of_speech_detail_1"`
+	PartOfSpeechDetail2   string `json:"part_of_speech_detail_2"`
+	PartOfSpeechDetail3   string `json:"part_of_speech_detail_3"`
+	InflectionalType      string `json:"inflectional_type"`
+	InflectionalForm      string `json:"inflectional_form"`
+	Stem                  string `json:"stem"`
+	Yomi                  string `json:"yomi"`
+	Pronunciation         string `json:"pronunciation"`
+	AccentType            int    `json:"accent_type"`
+	MoraCount             *int   `json:"mora_count,omitempty"`
+	AccentAssociativeRule string `json:"accent_associative_rule"`
+}
+
+// WordType は品詞の情報から、登録時に指定する品詞 (PROPER_NOUN など) を返します。判別できない場合は空です
+func (w UserDictWord) WordType() string {
+	switch {
+	case w.PartOfSpeech == "名詞" && w.PartOfSpeechDetail1 == "固有名詞":
+		return "PROPER_NOUN"
+	case w.PartOfSpeech == "名詞" && w.PartOfSpeechDetail1 == "接尾":
+		return "SUFFIX"
+	case w.PartOfSpeech == "名詞":
+		return "COMMON_NOUN"
+	case w.PartOfSpeech == "動詞":
+		return "VERB"
+	case w.PartOfSpeech == "形容詞":
+		return "ADJECTIVE"
+	}
+	return ""
+}
+
+// WordParams はユーザー辞書に単語を登録・更新するときの指定です
+type WordParams struct {
+	Surface       string // 表記
+	Pronunciation string // カタカナの読み
+	AccentType    int    // アクセント核の位置 (1始まりのモーラ番号。0 は平板型)
+	WordType      string // WordTypes のいずれか。空の場合はエンジンの既定値 (固有名詞) です
+	Priority      int    // 0〜10 の優先度。大きいほど優先されます (エンジンの既定値は 5)
+}
+
+// values は単語の指定をクエリパラメータにします
+func (p WordParams) values() url.Values {
+	params := url.Values{}
+	params.Add("surface", p.Surface)
+	params.Add("pronunciation", p.Pronunciation)
+	params.Add("accent_type", strconv.Itoa(p.AccentType))
+	if p.WordType != "" {
+		params.Add("word_type", p.WordType)
+	}
+	params.Add("priority", strconv.Itoa(p.Priority))
+	return params
+}
+
+// UserDict はユーザー辞書の単語を、単語のUUIDをキーにして返します
+func (c *Client) UserDict(ctx context.Context) (map[string]UserDictWord, error) {
+	req, err := c.newRequest(ctx, "GET", "/user_dict", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &APIError{Op: "ユーザー辞書の取得に失敗しました", StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var words map[string]UserDictWord
+	if err := json.NewDecoder(resp.Body).Decode(&words); err != nil {
+		return nil, fmt.Errorf("ユーザー辞書のデコードに失敗しました: %v", err)
+	}
+	return words, nil
+}
+
+// AddUserDictWord はユーザー辞書に単語を登録し、登録した単語のUUIDを返します
+func (c *Client) AddUserDictWord(ctx context.Context, word WordParams) (string, error) {
+	req, err := c.newRequest(ctx, "POST", "/user_dict_word?"+word.values().Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", &APIError{Op: fmt.Sprintf("単語 '%s' の登録に失敗しました", word.Surface), StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var uuid string
+	if err := json.NewDecoder(resp.Body).Decode(&uuid); err != nil {
+		return "", fmt.Errorf("登録した単語のUUIDのデコードに失敗しました: %v", err)
+	}
+	return uuid, nil
+}
+
+// UpdateUserDictWord はUUIDで指定したユーザー辞書の単語を更新します
+func (c *Client) UpdateUserDictWord(ctx context.Context, uuid string, word WordParams) error {
+	req, err := c.newRequest(ctx, "PUT", "/user_dict_word/"+url.PathEscape(uuid)+"?"+word.values().Encode(), nil)
+	if err != nil {
+		return err
+	}
+	return c.expectNoContent(req, fmt.Sprintf("単語 '%s' の更新に失敗しました", word.Surface))
+}
+
+// DeleteUserDictWord はUUIDで指定したユーザー辞書の単語を削除します
+func (c *Client) DeleteUserDictWord(ctx context.Context, uuid string) error {
+	req, err := c.newRequest(ctx, "DELETE", "/user_dict_word/"+url.PathEscape(uuid), nil)
+	if err != nil {
+		return err
+	}
+	return c.expectNoContent(req, "単語の削除に失敗しました")
+}
+
+// ImportUserDict はUUIDをキーにした単語を、ユーザー辞書にまとめて読み込みます。
+// override が true の場合は、同じUUIDの単語を読み込んだ単語で上書きします
+func (c *Client) ImportUserDict(ctx context.Context, words map[string]UserDictWord, override bool) error {
+	body, err := json.Marshal(words)
+	if err != nil {
+		return fmt.Errorf("ユーザー辞書のJSON変換に失敗しました: %v", err)
+	}
+	params := url.Values{}
+	params.Add("override", strconv.FormatBool(override))
+	req, err := c.newRequest(ctx, "POST", "/import_user_dict?"+params.Encode(), bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	return c.expectNoContent(req, "ユーザー辞書のインポートに失敗しました")
+}
+
+// expectNoContent はリクエストを送り、成功 (2xx) でなければ op を説明にした *APIError を返します
+func (c *Client) expectNoContent(req *http.Request, op string) error {
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return &APIError{Op: op, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return nil
+}
@@ -0,0 +1,816 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sort"
+)
+
+// ffmpeg が無い環境でもOGGで保存できるようにする、Ogg Vorbis の簡易なエンコーダです。
+// 長いブロック (2048サンプル) だけを使い、フロアの点の位置と符号帳の形は固定にして、
+// 符号長だけを1パス目で数えた出現回数から決めます。音声の読み上げを小さく保存するのが目的で、
+// 音楽向けの聴覚モデルや短いブロックへの切り替えは行いません
+const (
+	vorbisBlockExp   = 11 // 長いブロックのサイズ (2048) の指数
+	vorbisShortExp   = 8  // 短いブロックのサイズ (256) の指数。ヘッダに必要なだけで、使いません
+	vorbisRangeBits  = 10 // フロアのX座標のビット数 (ブロックの半分の1024まで)
+	vorbisFloorMult  = 2  // フロアのYの倍率
+	vorbisFloorRange = 128
+	vorbisPartSize   = 32 // 残差のパーティションの長さ
+	vorbisMaxCodeLen = 24 // 符号帳の符号長の上限
+	vorbisVendor     = "text2voicevox"
+)
+
+// vorbisStep は量子化の細かさで、フロア (量子化の幅) を周囲の係数の最大値の何倍にするかです
+const vorbisStep = 0.15
+
+// vorbisSilence はこれより小さい係数しか無いブロックを無音として、フロアを使わずに符号化する閾値です
+const vorbisSilence = 1.0 / 65536
+
+// vorbisFloorX はフロアの点のX座標です。最初の2点は規格で決まった両端で、
+// 残りは粗い点から順に並べ、後の点を前の点からの予測との差で符号化します
+var vorbisFloorX = []int{0, 1 << vorbisRangeBits,
+	512, 256, 768, 128, 384, 64, 192, 640, 896, 32, 96, 160, 320, 448, 576,
+	16, 48, 80, 112, 224, 8, 24, 40, 4, 12, 20, 56, 2}
+
+// vorbisFloorDim はフロアの1つのパーティションに含める点の数です
+const vorbisFloorDim = 2
+
+// vorbisResidueClasses は残差のパーティションの分類ごとに、表せる値の絶対値の最大とベクトルの次元です。
+// 分類 0 はすべて 0 のパーティションで、符号化しません
+var vorbisResidueClasses = []struct{ maxAbs, dim int }{
+	{0, 0}, {1, 4}, {2, 4}, {5, 2}, {15, 2}, {127, 1},
+}
+
+// 符号帳の番号です
+const (
+	vorbisFloorBook    = 0
+	vorbisClassBook    = 1
+	vorbisResidueBook0 = 2 // 分類 1 の符号帳。以降の分類は順に続きます
+)
+
+// floor1InverseDB は Vorbis のフロアの値 (0〜255) を振幅に変換します。規格の floor1_inverse_dB_table と同じ等比数列です
+func floor1InverseDB(i int) float64 {
+	return 1.0649863e-07 * math.Pow(1.0649863, float64(i))
+}
+
+// vorbisBitWriter はVorbisのパケットを、下位ビットから順に詰めて書き込みます
+type vorbisBitWriter struct {
+	buf []byte
+	bit uint // 最後のバイトで次に書き込むビットの位置
+}
+
+func (w *vorbisBitWriter) write(v uint64, n int) {
+	for i := 0; i < n; i++ {
+		if w.bit == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>uint(i)&1 != 0 {
+			w.buf[len(w.buf)-1] |= 1 << w.bit
+		}
+		w.bit = (w.bit + 1) & 7
+	}
+}
+
+func (w *vorbisBitWriter) writeBytes(s string) {
+	for i := 0; i < len(s); i++ {
+		w.write(uint64(s[i]), 8)
+	}
+}
+
+// ilog は v を表すのに必要なビット数を返します (規格の ilog)
+func ilog(v int) int {
+	n := 0
+	for ; v > 0; v >>= 1 {
+		n++
+	}
+	return n
+}
+
+// vorbisCodebook は符号帳です。lookup が true の場合はエントリ番号を dim 次元のベクトルに対応させます
+type vorbisCodebook struct {
+	dim     int
+	lengths []int
+	codes   []uint32
+	lookup  bool
+	values  int // 1次元あたりの値の数 (lookup type 1 の lookup_values)
+	minimum int // ベクトルの値の最小値。値は minimum から1ずつ増えます
+}
+
+// newVorbisCodebook は出現回数から符号長を決めた符号帳を作ります。出現しないエントリにも符号を割り当てます
+func newVorbisCodebook(counts []int, dim int) *vorbisCodebook {
+	lengths := huffmanLengths(counts, vorbisMaxCodeLen)
+	return &vorbisCodebook{dim: dim, lengths: lengths, codes: vorbisCodewords(lengths)}
+}
+
+// newVorbisVQCodebook は minimum から values 個の整数を各次元の値とする、dim 次元のベクトルの符号帳を作ります
+func newVorbisVQCodebook(counts []int, dim, values, minimum int) *vorbisCodebook {
+	book := newVorbisCodebook(counts, dim)
+	book.lookup, book.values, book.minimum = true, values, minimum
+	return book
+}
+
+// encode はエントリの符号を書き込みます。符号は先頭のビットから順に書き込みます
+func (b *vorbisCodebook) encode(w *vorbisBitWriter, entry int) {
+	code, length := b.codes[entry], b.lengths[entry]
+	for i := length - 1; i >= 0; i-- {
+		w.write(uint64(code>>uint(i)&1), 1)
+	}
+}
+
+// writeHeader は符号帳をセットアップヘッダの形式で書き込みます
+func (b *vorbisCodebook) writeHeader(w *vorbisBitWriter) {
+	w.write(0x564342, 24)
+	w.write(uint64(b.dim), 16)
+	w.write(uint64(len(b.lengths)), 24)
+	w.write(0, 1) // ordered
+	w.write(0, 1) // sparse
+	for _, l := range b.lengths {
+		w.write(uint64(l-1), 5)
+	}
+	if !b.lookup {
+		w.write(0, 4)
+		return
+	}
+	w.write(1, 4)
+	w.write(uint64(vorbisFloat(float64(b.minimum))), 32)
+	w.write(uint64(vorbisFloat(1)), 32)
+	bits := ilog(b.values - 1)
+	w.write(uint64(bits-1), 4)
+	w.write(0, 1) // sequence_p
+	for i := 0; i < b.values; i++ {
+		w.write(uint64(i), bits)
+	}
+}
+
+// vorbisFloat は整数の値を Vorbis の浮動小数点数の形式 (21bitの仮数と10bitの指数) にします
+func vorbisFloat(v float64) uint32 {
+	var sign uint32
+	if v < 0 {
+		sign, v = 0x80000000, -v
+	}
+	exp := 788
+	for v != 0 && v < 1<<20 {
+		v *= 2
+		exp--
+	}
+	for v >= 1<<21 {
+		v /= 2
+		exp++
+	}
+	return sign | uint32(exp)<<21 | uint32(v)
+}
+
+// huffmanLengths は出現回数からハフマン符号の符号長を求めます。
+// 出現回数が0のエントリにも符号を割り当て、符号長が maxLen を超える場合は回数の差を縮めて求め直します
+func huffmanLengths(counts []int, maxLen int) []int {
+	weights := make([]int, len(counts))
+	for i, c := range counts {
+		weights[i] = c + 1
+	}
+	for {
+		lengths := huffmanDepths(weights)
+		longest := 0
+		for _, l := range lengths {
+			longest = max(longest, l)
+		}
+		if longest <= maxLen {
+			return lengths
+		}
+		for i := range weights {
+			weights[i] = weights[i]/2 + 1
+		}
+	}
+}
+
+// huffmanDepths はハフマン木を作り、葉ごとの深さを返します
+func huffmanDepths(weights []int) []int {
+	type node struct {
+		weight int
+		parent int
+	}
+	nodes := make([]node, len(weights), 2*len(weights))
+	var active []int
+	for i, w := range weights {
+		nodes[i] = node{weight: w, parent: -1}
+		active = append(active, i)
+	}
+	for len(active) > 1 {
+		sort.Slice(active, func(i, j int) bool { return nodes[active[i]].weight < nodes[active[j]].weight })
+		a, b := active[0], active[1]
+		nodes = append(nodes, node{weight: nodes[a].weight + nodes[b].weight, parent: -1})
+		parent := len(nodes) - 1
+		nodes[a].parent, nodes[b].parent = parent, parent
+		active = append(active[2:], parent)
+	}
+	depths := make([]int, len(weights))
+	for i := range weights {
+		for p := nodes[i].parent; p >= 0; p = nodes[p].parent {
+			depths[i]++
+		}
+	}
+	return depths
+}
+
+// vorbisCodewords は符号長から、デコーダと同じ規則 (エントリ順に、空いている最も小さい符号) で符号を割り当てます
+func vorbisCodewords(lengths []int) []uint32 {
+	var marker [33]uint32
+	codes := make([]uint32, len(lengths))
+	for i, length := range lengths {
+		entry := marker[length]
+		codes[i] = entry
+		for j := length; j > 0; j-- {
+			if marker[j]&1 != 0 {
+				if j == 1 {
+					marker[1]++
+				} else {
+					marker[j] = marker[j-1] << 1
+				}
+				break
+			}
+			marker[j]++
+		}
+		for j := length + 1; j < 33; j++ {
+			if marker[j]>>1 != entry {
+				break
+			}
+			entry = marker[j]
+			marker[j] = marker[j-1] << 1
+		}
+	}
+	return codes
+}
+
+// vorbisMDCT は窓を掛けたブロックの MDCT を、FFT を使って計算します
+type vorbisMDCT struct {
+	n      int
+	window []float64
+	pre    []complex128 // FFT の前の回転に使う係数
+	post   []complex128 // FFT の後の回転に使う係数
+	fft    []complex128 // FFT の回転因子
+}
+
+func newVorbisMDCT(n int) *vorbisMDCT {
+	m := &vorbisMDCT{n: n, window: make([]float64, n)}
+	for i := range m.window {
+		s := math.Sin(math.Pi * (float64(i) + 0.5) / float64(n))
+		m.window[i] = math.Sin(math.Pi / 2 * s * s)
+	}
+	half := n / 2
+	m.pre = make([]complex128, half/2)
+	m.post = make([]complex128, half/2)
+	for i := range m.pre {
+		m.pre[i] = cmplx.Exp(complex(0, -math.Pi*float64(i)/float64(half)))
+		m.post[i] = cmplx.Exp(complex(0, -math.Pi*(float64(i)+0.25)/float64(half)))
+	}
+	m.fft = make([]complex128, half/4)
+	for i := range m.fft {
+		m.fft[i] = cmplx.Exp(complex(0, -2*math.Pi*float64(i)/float64(half/2)))
+	}
+	return m
+}
+
+// transform は n サンプルに窓を掛けて MDCT し、n/2 個の係数を返します。
+// 係数はデコーダの逆変換 (係数を掛けない MDCT の逆変換) で元の振幅に戻るよう 4/n 倍します
+func (m *vorbisMDCT) transform(in []float64) []float64 {
+	n, half := m.n, m.n/2
+	quarter := half / 2
+	z := make([]float64, n)
+	for i := range z {
+		z[i] = in[i] * m.window[i]
+	}
+	// (a, b, c, d) の MDCT は (-c_r-d, a-b_r) の DCT-IV と等しくなります (_r は逆順)
+	v := make([]float64, half)
+	for i := 0; i < quarter; i++ {
+		v[i] = -z[3*quarter-1-i] - z[3*quarter+i]
+		v[quarter+i] = z[i] - z[half-1-i]
+	}
+	// DCT-IV を長さ half/2 の複素FFTで計算します
+	c := make([]complex128, quarter)
+	for i := range c {
+		c[i] = complex(v[2*i], v[half-1-2*i]) * m.pre[i]
+	}
+	m.fftInPlace(c)
+	out := make([]float64, half)
+	scale := 4 / float64(n)
+	for k := range c {
+		y := c[k] * m.post[k]
+		out[2*k] = real(y) * scale
+		out[half-1-2*k] = -imag(y) * scale
+	}
+	return out
+}
+
+// fftInPlace は長さが2の累乗の複素数列を、その場でFFTします
+func (m *vorbisMDCT) fftInPlace(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j |= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := n / size
+		for start := 0; start < n; start += size {
+			for k := 0; k < size/2; k++ {
+				t := m.fft[k*step] * x[start+k+size/2]
+				x[start+k+size/2] = x[start+k] - t
+				x[start+k] += t
+			}
+		}
+	}
+}
+
+// vorbisFrame は1つのブロックの1チャンネル分の符号化する内容です
+type vorbisFrame struct {
+	used    bool  // false の場合はフロアを使わず、無音として符号化します
+	floorY  []int // フロアの点ごとの符号化する値 (最初の2点はそのままの値、以降は予測との差を表す値)
+	residue []int // 量子化した残差
+	classes []int // パーティションごとの分類
+}
+
+// vorbisEncoder はエンコードの状態です
+type vorbisEncoder struct {
+	channels int
+	mdct     *vorbisMDCT
+	// floorBins はフロアの点ごとに、周囲の係数の最大値を求める範囲 [lo, hi) です
+	floorBins [][2]int
+	books     []*vorbisCodebook
+}
+
+func newVorbisEncoder(channels int) *vorbisEncoder {
+	e := &vorbisEncoder{channels: channels, mdct: newVorbisMDCT(1 << vorbisBlockExp)}
+	half := 1 << (vorbisBlockExp - 1)
+	order := make([]int, len(vorbisFloorX))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return vorbisFloorX[order[i]] < vorbisFloorX[order[j]] })
+	e.floorBins = make([][2]int, len(vorbisFloorX))
+	for k, i := range order {
+		lo, hi := 0, half
+		if k > 0 {
+			lo = (vorbisFloorX[order[k-1]] + vorbisFloorX[i]) / 2
+		}
+		if k < len(order)-1 {
+			hi = (vorbisFloorX[i] + vorbisFloorX[order[k+1]]) / 2
+		}
+		e.floorBins[i] = [2]int{lo, min(max(hi, lo+1), half)}
+	}
+	return e
+}
+
+// floorNeighbors は規格の low_neighbor / high_neighbor で、i より前の点のうちX座標が直前・直後の点を返します
+func floorNeighbors(i int) (low, high int) {
+	low, high = 0, 1
+	for j := 2; j < i; j++ {
+		x := vorbisFloorX[j]
+		if x < vorbisFloorX[i] && x > vorbisFloorX[low] {
+			low = j
+		}
+		if x > vorbisFloorX[i] && x < vorbisFloorX[high] {
+			high = j
+		}
+	}
+	return low, high
+}
+
+// renderPoint は規格の render_point で、2点を結ぶ直線上の x の位置の値を整数で求めます
+func renderPoint(x0, y0, x1, y1, x int) int {
+	dy := y1 - y0
+	adx := x1 - x0
+	off := abs(dy) * (x - x0) / adx
+	if dy < 0 {
+		return y0 - off
+	}
+	return y0 + off
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// decodeFloorValue は規格の振幅の合成の手順で、予測値と符号化した値から点の値を求めます
+func decodeFloorValue(predicted, val int) int {
+	highroom := vorbisFloorRange - predicted
+	lowroom := predicted
+	room := 2 * min(highroom, lowroom)
+	switch {
+	case val == 0:
+		return predicted
+	case val >= room && highroom > lowroom:
+		return val - lowroom + predicted
+	case val >= room:
+		return predicted - val + highroom - 1
+	case val%2 == 1:
+		return predicted - (val+1)/2
+	default:
+		return predicted + val/2
+	}
+}
+
+// floorCurve はデコーダと同じ手順で、符号化した値からフロアの曲線 (係数ごとのフロアの値 0〜255) を求めます
+func floorCurve(coded []int, half int) []int {
+	n := len(vorbisFloorX)
+	final := make([]int, n)
+	step2 := make([]bool, n)
+	final[0], final[1] = coded[0], coded[1]
+	step2[0], step2[1] = true, true
+	for i := 2; i < n; i++ {
+		low, high := floorNeighbors(i)
+		predicted := renderPoint(vorbisFloorX[low], final[low], vorbisFloorX[high], final[high], vorbisFloorX[i])
+		final[i] = decodeFloorValue(predicted, coded[i])
+		if coded[i] != 0 {
+			step2[low], step2[high], step2[i] = true, true, true
+		}
+	}
+
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return vorbisFloorX[order[i]] < vorbisFloorX[order[j]] })
+	curve := make([]int, half)
+	lx, ly := 0, final[order[0]]*vorbisFloorMult
+	hx, hy := 0, 0
+	for _, i := range order[1:] {
+		if !step2[i] {
+			continue
+		}
+		hx, hy = vorbisFloorX[i], final[i]*vorbisFloorMult
+		renderLine(lx, ly, hx, hy, curve)
+		lx, ly = hx, hy
+	}
+	if hx < half {
+		renderLine(hx, hy, half, hy, curve)
+	}
+	return curve
+}
+
+// renderLine は規格の render_line で、2点を結ぶ直線を整数の演算で curve に描きます
+func renderLine(x0, y0, x1, y1 int, curve []int) {
+	dy := y1 - y0
+	adx := x1 - x0
+	ady := abs(dy)
+	base := dy / adx
+	sy := base + 1
+	if dy < 0 {
+		sy = base - 1
+	}
+	ady -= abs(base) * adx
+	y, err := y0, 0
+	if x0 < len(curve) {
+		curve[x0] = y
+	}
+	for x := x0 + 1; x < x1 && x < len(curve); x++ {
+		err += ady
+		if err >= adx {
+			err -= adx
+			y += sy
+		} else {
+			y += base
+		}
+		curve[x] = y
+	}
+}
+
+// analyze はブロックの1チャンネル分の係数から、フロアと残差を決めます
+func (e *vorbisEncoder) analyze(coefs []float64) vorbisFrame {
+	peak := 0.0
+	for _, c := range coefs {
+		peak = max(peak, math.Abs(c))
+	}
+	if peak < vorbisSilence {
+		return vorbisFrame{}
+	}
+
+	// 点の周囲の係数の最大値に vorbisStep を掛けた値を、その点のフロアの目標にします
+	n := len(vorbisFloorX)
+	target := make([]int, n)
+	for i, bins := range e.floorBins {
+		env := 0.0
+		for _, c := range coefs[bins[0]:bins[1]] {
+			env = max(env, math.Abs(c))
+		}
+		y := 0
+		if env > 0 {
+			idx := math.Log(env*vorbisStep/floor1InverseDB(0)) / math.Log(1.0649863)
+			y = int(math.Round(idx / vorbisFloorMult))
+		}
+		target[i] = min(max(y, 0), vorbisFloorRange-1)
+	}
+
+	// 予測との差が小さい点は符号化せず (値 0)、予測のままにします
+	coded := make([]int, n)
+	final := make([]int, n)
+	coded[0], coded[1] = target[0], target[1]
+	final[0], final[1] = target[0], target[1]
+	for i := 2; i < n; i++ {
+		low, high := floorNeighbors(i)
+		predicted := renderPoint(vorbisFloorX[low], final[low], vorbisFloorX[high], final[high], vorbisFloorX[i])
+		final[i] = predicted
+		if abs(target[i]-predicted) <= 1 {
+			continue
+		}
+		for val := 1; val < vorbisFloorRange; val++ {
+			if decodeFloorValue(predicted, val) == target[i] {
+				coded[i], final[i] = val, target[i]
+				break
+			}
+		}
+	}
+
+	curve := floorCurve(coded, len(coefs))
+	frame := vorbisFrame{used: true, floorY: coded, residue: make([]int, len(coefs))}
+	maxAbs := vorbisResidueClasses[len(vorbisResidueClasses)-1].maxAbs
+	for k, c := range coefs {
+		r := int(math.Round(c / floor1InverseDB(curve[k])))
+		frame.residue[k] = min(max(r, -maxAbs), maxAbs)
+	}
+	for start := 0; start < len(coefs); start += vorbisPartSize {
+		m := 0
+		for _, r := range frame.residue[start : start+vorbisPartSize] {
+			m = max(m, abs(r))
+		}
+		class := 0
+		for class < len(vorbisResidueClasses)-1 && vorbisResidueClasses[class].maxAbs < m {
+			class++
+		}
+		frame.classes = append(frame.classes, class)
+	}
+	return frame
+}
+
+// vorbisCounts は符号帳ごとのエントリの出現回数です
+type vorbisCounts [][]int
+
+func newVorbisCounts() vorbisCounts {
+	counts := vorbisCounts{make([]int, vorbisFloorRange), make([]int, len(vorbisResidueClasses))}
+	for _, rc := range vorbisResidueClasses[1:] {
+		counts = append(counts, make([]int, intPow(2*rc.maxAbs+1, rc.dim)))
+	}
+	return counts
+}
+
+func intPow(base, exp int) int {
+	v := 1
+	for i := 0; i < exp; i++ {
+		v *= base
+	}
+	return v
+}
+
+// residueVectors はパーティションの残差を、分類の符号帳の次元ごとのベクトルのエントリ番号にします
+func residueVectors(residue []int, class int) []int {
+	rc := vorbisResidueClasses[class]
+	values := 2*rc.maxAbs + 1
+	var entries []int
+	for i := 0; i < len(residue); i += rc.dim {
+		entry := 0
+		for j := rc.dim - 1; j >= 0; j-- {
+			entry = entry*values + residue[i+j] + rc.maxAbs
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// count はフレームで使う符号帳のエントリを数えます
+func (c vorbisCounts) count(frame vorbisFrame) {
+	if !frame.used {
+		return
+	}
+	for _, y := range frame.floorY[2:] {
+		c[vorbisFloorBook][y]++
+	}
+	for p, class := range frame.classes {
+		c[vorbisClassBook][class]++
+		if class == 0 {
+			continue
+		}
+		for _, entry := range residueVectors(frame.residue[p*vorbisPartSize:(p+1)*vorbisPartSize], class) {
+			c[vorbisResidueBook0+class-1][entry]++
+		}
+	}
+}
+
+// buildBooks は出現回数から符号帳を作ります
+func (e *vorbisEncoder) buildBooks(counts vorbisCounts) {
+	e.books = []*vorbisCodebook{
+		newVorbisCodebook(counts[vorbisFloorBook], 1),
+		newVorbisCodebook(counts[vorbisClassBook], 1),
+	}
+	for i, rc := range vorbisResidueClasses[1:] {
+		e.books = append(e.books, newVorbisVQCodebook(counts[vorbisResidueBook0+i], rc.dim, 2*rc.maxAbs+1, -rc.maxAbs))
+	}
+}
+
+// identificationHeader は識別ヘッダのパケットを作ります
+func (e *vorbisEncoder) identificationHeader(rate int) []byte {
+	var w vorbisBitWriter
+	w.write(1, 8)
+	w.writeBytes("vorbis")
+	w.write(0, 32)
+	w.write(uint64(e.channels), 8)
+	w.write(uint64(rate), 32)
+	w.write(0, 32) // bitrate_maximum
+	w.write(0, 32) // bitrate_nominal
+	w.write(0, 32) // bitrate_minimum
+	w.write(vorbisShortExp, 4)
+	w.write(vorbisBlockExp, 4)
+	w.write(1, 1)
+	return w.buf
+}
+
+// commentHeader はコメントヘッダのパケットを作ります
+func commentHeader() []byte {
+	var w vorbisBitWriter
+	w.write(3, 8)
+	w.writeBytes("vorbis")
+	w.write(uint64(len(vorbisVendor)), 32)
+	w.writeBytes(vorbisVendor)
+	w.write(0, 32)
+	w.write(1, 1)
+	return w.buf
+}
+
+// setupHeader はセットアップヘッダ (符号帳・フロア・残差・マッピング・モードの設定) のパケットを作ります
+func (e *vorbisEncoder) setupHeader() []byte {
+	var w vorbisBitWriter
+	w.write(5, 8)
+	w.writeBytes("vorbis")
+	w.write(uint64(len(e.books)-1), 8)
+	for _, b := range e.books {
+		b.writeHeader(&w)
+	}
+	w.write(0, 6) // 時間領域の変換 (1個、値は0)
+	w.write(0, 16)
+
+	// フロア: type 1、すべてのパーティションを同じ分類にし、点の値を vorbisFloorBook で符号化します
+	w.write(0, 6)
+	w.write(1, 16)
+	partitions := (len(vorbisFloorX) - 2) / vorbisFloorDim
+	w.write(uint64(partitions), 5)
+	for i := 0; i < partitions; i++ {
+		w.write(0, 4)
+	}
+	w.write(vorbisFloorDim-1, 3)
+	w.write(0, 2) // サブクラスなし
+	w.write(vorbisFloorBook+1, 8)
+	w.write(vorbisFloorMult-1, 2)
+	w.write(vorbisRangeBits, 4)
+	for _, x := range vorbisFloorX[2:] {
+		w.write(uint64(x), vorbisRangeBits)
+	}
+
+	// 残差: type 1、1024個の係数を vorbisPartSize ごとに分類して符号化します
+	w.write(0, 6)
+	w.write(1, 16)
+	w.write(0, 24)
+	w.write(1<<(vorbisBlockExp-1), 24)
+	w.write(vorbisPartSize-1, 24)
+	w.write(uint64(len(vorbisResidueClasses)-1), 6)
+	w.write(vorbisClassBook, 8)
+	for class := range vorbisResidueClasses {
+		cascade := 0
+		if class > 0 {
+			cascade = 1 // 1パス目だけを使います
+		}
+		w.write(uint64(cascade), 3)
+		w.write(0, 1)
+	}
+	for class := range vorbisResidueClasses[1:] {
+		w.write(uint64(vorbisResidueBook0+class), 8)
+	}
+
+	// マッピング: サブマップ1つ、チャンネルの結合なし
+	w.write(0, 6)
+	w.write(0, 16)
+	w.write(0, 1)
+	w.write(0, 1)
+	w.write(0, 2)
+	w.write(0, 8)
+	w.write(0, 8)
+	w.write(0, 8)
+
+	// モード: 長いブロックだけ
+	w.write(0, 6)
+	w.write(1, 1)
+	w.write(0, 16)
+	w.write(0, 16)
+	w.write(0, 8)
+
+	w.write(1, 1)
+	return w.buf
+}
+
+// audioPacket はブロックの全チャンネル分の音声パケットを作ります
+func (e *vorbisEncoder) audioPacket(frames []vorbisFrame) []byte {
+	var w vorbisBitWriter
+	w.write(0, 1)
+	w.write(1, 1) // 前のブロックも長いブロック
+	w.write(1, 1) // 次のブロックも長いブロック
+	for _, f := range frames {
+		if !f.used {
+			w.write(0, 1)
+			continue
+		}
+		w.write(1, 1)
+		yBits := ilog(vorbisFloorRange - 1)
+		w.write(uint64(f.floorY[0]), yBits)
+		w.write(uint64(f.floorY[1]), yBits)
+		for _, y := range f.floorY[2:] {
+			e.books[vorbisFloorBook].encode(&w, y)
+		}
+	}
+
+	// 残差は1パス目だけを使うため、パーティションごとに分類と残差を続けて書き込みます
+	partitions := (1 << (vorbisBlockExp - 1)) / vorbisPartSize
+	for p := 0; p < partitions; p++ {
+		for _, f := range frames {
+			if f.used {
+				e.books[vorbisClassBook].encode(&w, f.classes[p])
+			}
+		}
+		for _, f := range frames {
+			if !f.used || f.classes[p] == 0 {
+				continue
+			}
+			book := e.books[vorbisResidueBook0+f.classes[p]-1]
+			for _, entry := range residueVectors(f.residue[p*vorbisPartSize:(p+1)*vorbisPartSize], f.classes[p]) {
+				book.encode(&w, entry)
+			}
+		}
+	}
+	return w.buf
+}
+
+// encodeVorbis は16bit PCMのWAVを Ogg Vorbis にエンコードします
+func encodeVorbis(b []byte) ([]byte, error) {
+	wav, err := parsePCM16(b)
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg を使わずにOGGで保存できるのは16bit PCMのWAVだけです: %v", err)
+	}
+	channels := int(wav.Format.Channels)
+	if channels < 1 {
+		return nil, fmt.Errorf("チャンネル数が不正です")
+	}
+	samples := decodeSamples16(wav.Data)
+	length := len(samples) / channels
+	if length == 0 {
+		// 音声パケットを復号しても1サンプルも得られないストリームは、デコーダによっては読めないため作りません
+		return nil, fmt.Errorf("音声が空のため、OGGにエンコードできません")
+	}
+
+	e := newVorbisEncoder(channels)
+	n := 1 << vorbisBlockExp
+	half := n / 2
+	// ブロック k は [(k-1)*half, (k+1)*half) のサンプルで、k 番目のパケットを復号すると [(k-1)*half, k*half) が得られます
+	blocks := (length+half-1)/half + 1
+	analyze := func(k int) []vorbisFrame {
+		frames := make([]vorbisFrame, channels)
+		in := make([]float64, n)
+		for ch := range frames {
+			for i := range in {
+				t := (k-1)*half + i
+				in[i] = 0
+				if t >= 0 && t < length {
+					in[i] = float64(samples[t*channels+ch]) / (maxSample16 + 1)
+				}
+			}
+			frames[ch] = e.analyze(e.mdct.transform(in))
+		}
+		return frames
+	}
+
+	// 1パス目で符号帳のエントリの出現回数を数え、2パス目で符号化します
+	counts := newVorbisCounts()
+	for k := 0; k < blocks; k++ {
+		for _, f := range analyze(k) {
+			counts.count(f)
+		}
+	}
+	e.buildBooks(counts)
+
+	ogg := newOggWriter(0x74327676)
+	ogg.packet(e.identificationHeader(int(wav.Format.SampleRate)), 0)
+	ogg.flush(false)
+	ogg.packet(commentHeader(), 0)
+	ogg.packet(e.setupHeader(), 0)
+	ogg.flush(false)
+	for k := 0; k < blocks; k++ {
+		granule := int64(min(k*half, length))
+		ogg.packet(e.audioPacket(analyze(k)), granule)
+	}
+	ogg.flush(true)
+	return ogg.out.Bytes(), nil
+}
@@ -0,0 +1,1159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// このファイルのデコーダは、組み込みのエンコーダの出力を規格 (Vorbis I specification) どおりに読めるかを確かめるためのものです。
+// エンコーダの関数は使わず、規格の手順をそのまま実装しています。エンコーダが使う形式 (フロア type 1、残差 type 0/1、
+// 短いブロックを含むヘッダ) を読み、使わない機能 (フロア type 0、残差 type 2) は未対応としてエラーにします
+
+// testOggPackets は Ogg のページを検証しながらパケットを取り出し、最後のページのグラニュール位置を返します
+func testOggPackets(b []byte) ([][]byte, int64, error) {
+	var packets [][]byte
+	var pending []byte
+	granule := int64(-1)
+	for seq := uint32(0); len(b) > 0; seq++ {
+		if len(b) < 27 || string(b[:4]) != "OggS" || b[4] != 0 {
+			return nil, 0, fmt.Errorf("page %d: bad header", seq)
+		}
+		nsegs := int(b[26])
+		if len(b) < 27+nsegs {
+			return nil, 0, fmt.Errorf("page %d: truncated segment table", seq)
+		}
+		size := 27 + nsegs
+		for _, s := range b[27 : 27+nsegs] {
+			size += int(s)
+		}
+		if len(b) < size {
+			return nil, 0, fmt.Errorf("page %d: truncated body", seq)
+		}
+		page := append([]byte(nil), b[:size]...)
+		if got := binary.LittleEndian.Uint32(page[18:]); got != seq {
+			return nil, 0, fmt.Errorf("page %d: sequence number %d", seq, got)
+		}
+		want := binary.LittleEndian.Uint32(page[22:])
+		binary.LittleEndian.PutUint32(page[22:], 0)
+		if got := testOggCRC(page); got != want {
+			return nil, 0, fmt.Errorf("page %d: crc %08x, want %08x", seq, got, want)
+		}
+		flags := page[5]
+		if seq == 0 && flags&0x02 == 0 {
+			return nil, 0, fmt.Errorf("first page without BOS flag")
+		}
+		if (flags&0x01 != 0) != (len(pending) > 0) {
+			return nil, 0, fmt.Errorf("page %d: continuation flag does not match", seq)
+		}
+		granule = int64(binary.LittleEndian.Uint64(page[6:]))
+
+		body := page[27+nsegs:]
+		for _, s := range page[27 : 27+nsegs] {
+			pending = append(pending, body[:s]...)
+			body = body[s:]
+			if s < 255 {
+				packets = append(packets, pending)
+				pending = nil
+			}
+		}
+		b = b[size:]
+		if flags&0x04 != 0 {
+			if len(b) > 0 {
+				return nil, 0, fmt.Errorf("data after EOS page")
+			}
+			break
+		}
+		if len(b) == 0 {
+			return nil, 0, fmt.Errorf("stream ends without EOS page")
+		}
+	}
+	if len(pending) > 0 {
+		return nil, 0, fmt.Errorf("unterminated packet")
+	}
+	return packets, granule, nil
+}
+
+// testOggCRC は Ogg のチェックサムを1ビットずつ計算します
+func testOggCRC(b []byte) uint32 {
+	var crc uint32
+	for _, c := range b {
+		crc ^= uint32(c) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+var errTestEOP = errors.New("end of packet")
+
+// testBitReader はパケットを下位ビットから順に読みます
+type testBitReader struct {
+	b   []byte
+	pos int // 読んだビット数
+}
+
+func (r *testBitReader) read(n int) (uint32, error) {
+	var v uint32
+	for i := 0; i < n; i++ {
+		if r.pos>>3 >= len(r.b) {
+			return 0, errTestEOP
+		}
+		v |= uint32(r.b[r.pos>>3]>>(r.pos&7)&1) << i
+		r.pos++
+	}
+	return v, nil
+}
+
+// testReader は読み取りの最初のエラーを覚えておき、ヘッダの解析を読みやすくします
+type testReader struct {
+	testBitReader
+	err error
+}
+
+func (r *testReader) u(n int) int {
+	if r.err != nil {
+		return 0
+	}
+	v, err := r.read(n)
+	r.err = err
+	return int(v)
+}
+
+func (r *testReader) flag() bool { return r.u(1) == 1 }
+
+func testIlog(v int) int {
+	n := 0
+	for ; v > 0; v >>= 1 {
+		n++
+	}
+	return n
+}
+
+func testFloat32Unpack(x uint32) float64 {
+	mantissa := float64(x & 0x1fffff)
+	exponent := int(x&0x7fe00000) >> 21
+	if x&0x80000000 != 0 {
+		mantissa = -mantissa
+	}
+	return math.Ldexp(mantissa, exponent-788)
+}
+
+// testLookup1Values は規格の lookup1_values です
+func testLookup1Values(entries, dim int) int {
+	r := 0
+	for int(math.Pow(float64(r+1), float64(dim))) <= entries {
+		r++
+	}
+	return r
+}
+
+// testHuffNode はハフマン木の節です。leaf が 0 以上なら葉です
+type testHuffNode struct {
+	child [2]*testHuffNode
+	leaf  int
+}
+
+// insert は深さ depth の、最も左の空いている位置に葉を置きます
+func (n *testHuffNode) insert(depth, entry int) bool {
+	if n.leaf >= 0 {
+		return false
+	}
+	if depth == 0 {
+		if n.child[0] != nil || n.child[1] != nil {
+			return false
+		}
+		n.leaf = entry
+		return true
+	}
+	for i := range n.child {
+		if n.child[i] == nil {
+			n.child[i] = &testHuffNode{leaf: -1}
+		}
+		if n.child[i].insert(depth-1, entry) {
+			return true
+		}
+	}
+	return false
+}
+
+type testCodebook struct {
+	dim     int
+	entries int
+	root    *testHuffNode
+	single  int         // エントリが1つだけの符号帳で、そのエントリ (符号は0ビット)
+	vectors [][]float64 // lookup が無い場合は nil
+}
+
+func (b *testCodebook) decode(r *testBitReader) (int, error) {
+	if b.single >= 0 {
+		return b.single, nil
+	}
+	n := b.root
+	for n.leaf < 0 {
+		bit, err := r.read(1)
+		if err != nil {
+			return 0, err
+		}
+		if n = n.child[bit]; n == nil {
+			return 0, fmt.Errorf("undefined codeword")
+		}
+	}
+	return n.leaf, nil
+}
+
+func testReadCodebook(r *testReader) (*testCodebook, error) {
+	if r.u(24) != 0x564342 {
+		return nil, fmt.Errorf("bad codebook sync")
+	}
+	b := &testCodebook{dim: r.u(16), entries: r.u(24), root: &testHuffNode{leaf: -1}, single: -1}
+	lengths := make([]int, b.entries)
+	if r.flag() {
+		// ordered
+		length := r.u(5) + 1
+		for cur := 0; cur < b.entries && r.err == nil; length++ {
+			n := r.u(testIlog(b.entries - cur))
+			for i := 0; i < n && cur < b.entries; i++ {
+				lengths[cur] = length
+				cur++
+			}
+		}
+	} else {
+		sparse := r.flag()
+		for i := range lengths {
+			if !sparse || r.flag() {
+				lengths[i] = r.u(5) + 1
+			}
+		}
+	}
+	used := 0
+	for i, l := range lengths {
+		if l > 0 {
+			used++
+			b.single = i
+		}
+	}
+	if used != 1 {
+		b.single = -1
+		for i, l := range lengths {
+			if l > 0 && !b.root.insert(l, i) {
+				return nil, fmt.Errorf("overspecified codebook")
+			}
+		}
+	}
+
+	switch lookup := r.u(4); lookup {
+	case 0:
+	case 1, 2:
+		minimum := testFloat32Unpack(uint32(r.u(32)))
+		delta := testFloat32Unpack(uint32(r.u(32)))
+		bits := r.u(4) + 1
+		sequence := r.flag()
+		values := b.entries * b.dim
+		if lookup == 1 {
+			values = testLookup1Values(b.entries, b.dim)
+		}
+		mult := make([]int, values)
+		for i := range mult {
+			mult[i] = r.u(bits)
+		}
+		b.vectors = make([][]float64, b.entries)
+		for e := range b.vectors {
+			v := make([]float64, b.dim)
+			last, divisor := 0.0, 1
+			for d := range v {
+				off := e*b.dim + d
+				if lookup == 1 {
+					off = e / divisor % values
+					divisor *= values
+				}
+				v[d] = float64(mult[off])*delta + minimum + last
+				if sequence {
+					last = v[d]
+				}
+			}
+			b.vectors[e] = v
+		}
+	default:
+		return nil, fmt.Errorf("unknown lookup type %d", lookup)
+	}
+	return b, r.err
+}
+
+type testFloor struct {
+	partitionClass []int
+	classDim       []int
+	classSubs      []int
+	classMaster    []int
+	subBooks       [][]int
+	multiplier     int
+	xs             []int
+}
+
+type testResidue struct {
+	kind            int
+	begin, end      int
+	partitionSize   int
+	classifications int
+	classBook       int
+	books           [][8]int
+}
+
+type testMapping struct {
+	couplingMag, couplingAng []int
+	mux                      []int
+	floors, residues         []int
+}
+
+type testMode struct {
+	blockFlag bool
+	mapping   int
+}
+
+// testVorbisDecoder はヘッダから読んだ設定と、重ね合わせのために前のブロックの後半を持ちます
+type testVorbisDecoder struct {
+	channels   int
+	rate       int
+	blocksizes [2]int
+	books      []*testCodebook
+	floors     []*testFloor
+	residues   []*testResidue
+	mappings   []*testMapping
+	modes      []testMode
+
+	prev   [][]float64 // 前のブロックの窓を掛けた出力
+	prevN  int
+	output [][]float64
+}
+
+func (d *testVorbisDecoder) readHeaders(packets [][]byte) error {
+	if len(packets) < 3 {
+		return fmt.Errorf("missing headers")
+	}
+	for i, want := range []int{1, 3, 5} {
+		if len(packets[i]) < 7 || int(packets[i][0]) != want || string(packets[i][1:7]) != "vorbis" {
+			return fmt.Errorf("header %d: bad signature", i)
+		}
+	}
+
+	r := &testReader{testBitReader: testBitReader{b: packets[0], pos: 7 * 8}}
+	if r.u(32) != 0 {
+		return fmt.Errorf("unknown vorbis version")
+	}
+	d.channels, d.rate = r.u(8), r.u(32)
+	r.u(32)
+	r.u(32)
+	r.u(32)
+	d.blocksizes = [2]int{1 << r.u(4), 1 << r.u(4)}
+	if !r.flag() || r.err != nil || d.channels == 0 || d.rate == 0 || d.blocksizes[0] > d.blocksizes[1] {
+		return fmt.Errorf("bad identification header")
+	}
+
+	r = &testReader{testBitReader: testBitReader{b: packets[1], pos: 7 * 8}}
+	vendor := r.u(32)
+	for i := 0; i < vendor; i++ {
+		r.u(8)
+	}
+	comments := r.u(32)
+	for i := 0; i < comments; i++ {
+		n := r.u(32)
+		for j := 0; j < n; j++ {
+			r.u(8)
+		}
+	}
+	if !r.flag() || r.err != nil {
+		return fmt.Errorf("bad comment header")
+	}
+
+	return d.readSetup(&testReader{testBitReader: testBitReader{b: packets[2], pos: 7 * 8}})
+}
+
+func (d *testVorbisDecoder) readSetup(r *testReader) error {
+	for n := r.u(8) + 1; n > 0 && r.err == nil; n-- {
+		b, err := testReadCodebook(r)
+		if err != nil {
+			return err
+		}
+		d.books = append(d.books, b)
+	}
+	for n := r.u(6) + 1; n > 0; n-- {
+		if r.u(16) != 0 {
+			return fmt.Errorf("bad time domain transform")
+		}
+	}
+
+	for n := r.u(6) + 1; n > 0 && r.err == nil; n-- {
+		if kind := r.u(16); kind != 1 {
+			return fmt.Errorf("unsupported floor type %d", kind)
+		}
+		f := &testFloor{}
+		maxClass := -1
+		for p := r.u(5); p > 0; p-- {
+			c := r.u(4)
+			f.partitionClass = append(f.partitionClass, c)
+			maxClass = max(maxClass, c)
+		}
+		for c := 0; c <= maxClass; c++ {
+			f.classDim = append(f.classDim, r.u(3)+1)
+			subs := r.u(2)
+			f.classSubs = append(f.classSubs, subs)
+			master := -1
+			if subs > 0 {
+				master = r.u(8)
+			}
+			f.classMaster = append(f.classMaster, master)
+			var books []int
+			for s := 0; s < 1<<subs; s++ {
+				books = append(books, r.u(8)-1)
+			}
+			f.subBooks = append(f.subBooks, books)
+		}
+		f.multiplier = r.u(2) + 1
+		rangeBits := r.u(4)
+		f.xs = []int{0, 1 << rangeBits}
+		for _, c := range f.partitionClass {
+			for j := 0; j < f.classDim[c]; j++ {
+				f.xs = append(f.xs, r.u(rangeBits))
+			}
+		}
+		d.floors = append(d.floors, f)
+	}
+
+	for n := r.u(6) + 1; n > 0 && r.err == nil; n-- {
+		res := &testResidue{kind: r.u(16)}
+		if res.kind > 1 {
+			return fmt.Errorf("unsupported residue type %d", res.kind)
+		}
+		res.begin, res.end, res.partitionSize = r.u(24), r.u(24), r.u(24)+1
+		res.classifications, res.classBook = r.u(6)+1, r.u(8)
+		cascade := make([]int, res.classifications)
+		for i := range cascade {
+			cascade[i] = r.u(3)
+			if r.flag() {
+				cascade[i] |= r.u(5) << 3
+			}
+		}
+		res.books = make([][8]int, res.classifications)
+		for i := range res.books {
+			for j := 0; j < 8; j++ {
+				res.books[i][j] = -1
+				if cascade[i]>>j&1 != 0 {
+					res.books[i][j] = r.u(8)
+				}
+			}
+		}
+		d.residues = append(d.residues, res)
+	}
+
+	for n := r.u(6) + 1; n > 0 && r.err == nil; n-- {
+		if r.u(16) != 0 {
+			return fmt.Errorf("unsupported mapping type")
+		}
+		m := &testMapping{mux: make([]int, d.channels)}
+		submaps := 1
+		if r.flag() {
+			submaps = r.u(4) + 1
+		}
+		if r.flag() {
+			for steps := r.u(8) + 1; steps > 0; steps-- {
+				m.couplingMag = append(m.couplingMag, r.u(testIlog(d.channels-1)))
+				m.couplingAng = append(m.couplingAng, r.u(testIlog(d.channels-1)))
+			}
+		}
+		if r.u(2) != 0 {
+			return fmt.Errorf("bad mapping reserved bits")
+		}
+		if submaps > 1 {
+			for ch := range m.mux {
+				m.mux[ch] = r.u(4)
+			}
+		}
+		for s := 0; s < submaps; s++ {
+			r.u(8)
+			m.floors = append(m.floors, r.u(8))
+			m.residues = append(m.residues, r.u(8))
+		}
+		d.mappings = append(d.mappings, m)
+	}
+
+	for n := r.u(6) + 1; n > 0 && r.err == nil; n-- {
+		mode := testMode{blockFlag: r.flag()}
+		if r.u(16) != 0 || r.u(16) != 0 {
+			return fmt.Errorf("bad mode window or transform type")
+		}
+		mode.mapping = r.u(8)
+		d.modes = append(d.modes, mode)
+	}
+	if !r.flag() || r.err != nil {
+		return fmt.Errorf("bad setup header framing: %v", r.err)
+	}
+
+	for _, f := range d.floors {
+		for _, books := range f.subBooks {
+			for _, b := range books {
+				if b >= len(d.books) {
+					return fmt.Errorf("floor book %d out of range", b)
+				}
+			}
+		}
+	}
+	for _, res := range d.residues {
+		if res.classBook >= len(d.books) {
+			return fmt.Errorf("residue class book out of range")
+		}
+		for _, books := range res.books {
+			for _, b := range books {
+				if b >= len(d.books) || (b >= 0 && d.books[b].vectors == nil) {
+					return fmt.Errorf("residue book %d is not a VQ book", b)
+				}
+			}
+		}
+	}
+	for _, m := range d.mappings {
+		for s := range m.floors {
+			if m.floors[s] >= len(d.floors) || m.residues[s] >= len(d.residues) {
+				return fmt.Errorf("mapping refers to missing floor or residue")
+			}
+		}
+	}
+	for _, mode := range d.modes {
+		if mode.mapping >= len(d.mappings) {
+			return fmt.Errorf("mode refers to missing mapping")
+		}
+	}
+	return nil
+}
+
+// decodeFloor は規格の floor1 のパケットの復号で、点の値を読みます。フロアを使わないチャンネルは nil です
+func (d *testVorbisDecoder) decodeFloor(r *testBitReader, f *testFloor) ([]int, error) {
+	nonzero, err := r.read(1)
+	if err != nil || nonzero == 0 {
+		return nil, err
+	}
+	yBits := testIlog([]int{256, 128, 86, 64}[f.multiplier-1] - 1)
+	ys := make([]int, 2, len(f.xs))
+	for i := range ys {
+		v, err := r.read(yBits)
+		if err != nil {
+			return nil, err
+		}
+		ys[i] = int(v)
+	}
+	for _, class := range f.partitionClass {
+		cbits := f.classSubs[class]
+		csub := 1<<cbits - 1
+		cval := 0
+		if cbits > 0 {
+			if cval, err = d.books[f.classMaster[class]].decode(r); err != nil {
+				return nil, err
+			}
+		}
+		for j := 0; j < f.classDim[class]; j++ {
+			book := f.subBooks[class][cval&csub]
+			cval >>= cbits
+			y := 0
+			if book >= 0 {
+				if y, err = d.books[book].decode(r); err != nil {
+					return nil, err
+				}
+			}
+			ys = append(ys, y)
+		}
+	}
+	return ys, nil
+}
+
+func testRenderPoint(x0, y0, x1, y1, x int) int {
+	dy := y1 - y0
+	adx := x1 - x0
+	ady := dy
+	if ady < 0 {
+		ady = -ady
+	}
+	off := ady * (x - x0) / adx
+	if dy < 0 {
+		return y0 - off
+	}
+	return y0 + off
+}
+
+func testRenderLine(x0, y0, x1, y1 int, v []int) {
+	dy := y1 - y0
+	adx := x1 - x0
+	ady := dy
+	if ady < 0 {
+		ady = -ady
+	}
+	base := dy / adx
+	sy := base + 1
+	if dy < 0 {
+		sy = base - 1
+	}
+	absBase := base
+	if absBase < 0 {
+		absBase = -absBase
+	}
+	ady -= absBase * adx
+	y, e := y0, 0
+	if x0 < len(v) {
+		v[x0] = y
+	}
+	for x := x0 + 1; x < x1; x++ {
+		e += ady
+		if e >= adx {
+			e -= adx
+			y += sy
+		} else {
+			y += base
+		}
+		if x < len(v) {
+			v[x] = y
+		}
+	}
+}
+
+// synthesizeFloor は規格の floor1 の曲線の合成で、係数ごとの振幅を求めます
+func (d *testVorbisDecoder) synthesizeFloor(f *testFloor, ys []int, half int) []float64 {
+	rng := []int{256, 128, 86, 64}[f.multiplier-1]
+	n := len(f.xs)
+	final := make([]int, n)
+	step2 := make([]bool, n)
+	final[0], final[1] = ys[0], ys[1]
+	step2[0], step2[1] = true, true
+	for i := 2; i < n; i++ {
+		low, high := 0, 1
+		for j := 0; j < i; j++ {
+			if f.xs[j] < f.xs[i] && f.xs[j] > f.xs[low] {
+				low = j
+			}
+			if f.xs[j] > f.xs[i] && f.xs[j] < f.xs[high] {
+				high = j
+			}
+		}
+		predicted := testRenderPoint(f.xs[low], final[low], f.xs[high], final[high], f.xs[i])
+		val := ys[i]
+		highroom, lowroom := rng-predicted, predicted
+		room := 2 * lowroom
+		if highroom < lowroom {
+			room = 2 * highroom
+		}
+		if val == 0 {
+			final[i] = predicted
+			continue
+		}
+		step2[low], step2[high], step2[i] = true, true, true
+		switch {
+		case val >= room && highroom > lowroom:
+			final[i] = val - lowroom + predicted
+		case val >= room:
+			final[i] = predicted - val + highroom - 1
+		case val%2 == 1:
+			final[i] = predicted - (val+1)/2
+		default:
+			final[i] = predicted + val/2
+		}
+	}
+
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return f.xs[order[a]] < f.xs[order[b]] })
+	curve := make([]int, half)
+	lx, ly := 0, final[order[0]]*f.multiplier
+	hx, hy := 0, 0
+	for _, i := range order[1:] {
+		if step2[i] {
+			hx, hy = f.xs[i], final[i]*f.multiplier
+			testRenderLine(lx, ly, hx, hy, curve)
+			lx, ly = hx, hy
+		}
+	}
+	if hx < half {
+		testRenderLine(hx, hy, half, hy, curve)
+	}
+	out := make([]float64, half)
+	for i, y := range curve {
+		y = min(max(y, 0), 255)
+		out[i] = 1.0649863e-07 * math.Pow(1.0649863, float64(y))
+	}
+	return out
+}
+
+// decodeResidue は規格の residue 0/1 の復号で、vectors (チャンネルごとの係数) に残差を加えます
+func (d *testVorbisDecoder) decodeResidue(r *testBitReader, res *testResidue, vectors [][]float64, skip []bool) error {
+	half := len(vectors[0])
+	begin, end := min(res.begin, half), min(res.end, half)
+	partitions := (end - begin) / res.partitionSize
+	classBook := d.books[res.classBook]
+	perWord := classBook.dim
+	classes := make([][]int, len(vectors))
+	for ch := range classes {
+		classes[ch] = make([]int, partitions+perWord)
+	}
+
+	for pass := 0; pass < 8; pass++ {
+		for p := 0; p < partitions; {
+			if pass == 0 {
+				for ch := range vectors {
+					if skip[ch] {
+						continue
+					}
+					word, err := classBook.decode(r)
+					if err != nil {
+						return err
+					}
+					for i := perWord - 1; i >= 0; i-- {
+						classes[ch][p+i] = word % res.classifications
+						word /= res.classifications
+					}
+				}
+			}
+			for i := 0; i < perWord && p < partitions; i, p = i+1, p+1 {
+				for ch, v := range vectors {
+					if skip[ch] {
+						continue
+					}
+					bookNum := res.books[classes[ch][p]][pass]
+					if bookNum < 0 {
+						continue
+					}
+					book := d.books[bookNum]
+					off := begin + p*res.partitionSize
+					if res.kind == 0 {
+						step := res.partitionSize / book.dim
+						for j := 0; j < step; j++ {
+							e, err := book.decode(r)
+							if err != nil {
+								return err
+							}
+							for k, x := range book.vectors[e] {
+								v[off+j+k*step] += x
+							}
+						}
+						continue
+					}
+					for j := 0; j < res.partitionSize; {
+						e, err := book.decode(r)
+						if err != nil {
+							return err
+						}
+						for _, x := range book.vectors[e] {
+							v[off+j] += x
+							j++
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// imdct は規格の逆MDCT を定義どおりに (遅いが確実に) 計算します
+func testIMDCT(coefs []float64) []float64 {
+	half := len(coefs)
+	n := 2 * half
+	out := make([]float64, n)
+	for i := range out {
+		var s float64
+		for k, c := range coefs {
+			if c != 0 {
+				s += c * math.Cos(math.Pi/float64(n)*(2*float64(i)+1+float64(half))*(float64(k)+0.5))
+			}
+		}
+		out[i] = s
+	}
+	return out
+}
+
+// testWindow は規格のVorbisの窓です
+func testWindow(n, prevN, nextN int) []float64 {
+	w := make([]float64, n)
+	slope := func(x float64) float64 {
+		s := math.Sin(x)
+		return math.Sin(math.Pi / 2 * s * s)
+	}
+	lStart, lN := n/4-prevN/4, prevN/2
+	rStart, rN := n*3/4-nextN/4, nextN/2
+	for i := range w {
+		switch {
+		case i < lStart:
+		case i < lStart+lN:
+			w[i] = slope((float64(i-lStart) + 0.5) / float64(lN) * math.Pi / 2)
+		case i < rStart:
+			w[i] = 1
+		case i < rStart+rN:
+			w[i] = slope((float64(i-rStart)+0.5)/float64(rN)*math.Pi/2 + math.Pi/2)
+		}
+	}
+	return w
+}
+
+// decodePacket は音声パケットを復号し、得られたサンプルを output に追加します
+func (d *testVorbisDecoder) decodePacket(packet []byte) error {
+	r := &testBitReader{b: packet}
+	if t, err := r.read(1); err != nil || t != 0 {
+		return fmt.Errorf("not an audio packet")
+	}
+	modeNum, err := r.read(testIlog(len(d.modes) - 1))
+	if err != nil || int(modeNum) >= len(d.modes) {
+		return fmt.Errorf("bad mode number")
+	}
+	mode := d.modes[modeNum]
+	n := d.blocksizes[0]
+	prevN, nextN := n, n
+	if mode.blockFlag {
+		n = d.blocksizes[1]
+		prevN, nextN = d.blocksizes[0], d.blocksizes[0]
+		p, err1 := r.read(1)
+		q, err2 := r.read(1)
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("truncated window flags")
+		}
+		if p == 1 {
+			prevN = n
+		}
+		if q == 1 {
+			nextN = n
+		}
+	}
+	half := n / 2
+	m := d.mappings[mode.mapping]
+
+	floors := make([][]float64, d.channels)
+	skip := make([]bool, d.channels)
+	for ch := range floors {
+		f := d.floors[m.floors[m.mux[ch]]]
+		ys, err := d.decodeFloor(r, f)
+		if err != nil {
+			return fmt.Errorf("floor: %v", err)
+		}
+		if ys == nil {
+			skip[ch] = true
+			continue
+		}
+		floors[ch] = d.synthesizeFloor(f, ys, half)
+	}
+	for i := range m.couplingMag {
+		if !skip[m.couplingMag[i]] || !skip[m.couplingAng[i]] {
+			skip[m.couplingMag[i]], skip[m.couplingAng[i]] = false, false
+		}
+	}
+
+	residue := make([][]float64, d.channels)
+	for ch := range residue {
+		residue[ch] = make([]float64, half)
+	}
+	for s := range m.residues {
+		var vectors [][]float64
+		var subSkip []bool
+		for ch := range residue {
+			if m.mux[ch] == s {
+				vectors = append(vectors, residue[ch])
+				subSkip = append(subSkip, skip[ch])
+			}
+		}
+		if err := d.decodeResidue(r, d.residues[m.residues[s]], vectors, subSkip); err != nil {
+			return fmt.Errorf("residue: %v", err)
+		}
+	}
+
+	for i := len(m.couplingMag) - 1; i >= 0; i-- {
+		mag, ang := residue[m.couplingMag[i]], residue[m.couplingAng[i]]
+		for j := range mag {
+			M, A := mag[j], ang[j]
+			switch {
+			case M > 0 && A > 0:
+				mag[j], ang[j] = M, M-A
+			case M > 0:
+				mag[j], ang[j] = M+A, M
+			case A > 0:
+				mag[j], ang[j] = M, M+A
+			default:
+				mag[j], ang[j] = M-A, M
+			}
+		}
+	}
+
+	window := testWindow(n, prevN, nextN)
+	cur := make([][]float64, d.channels)
+	for ch := range cur {
+		coefs := make([]float64, half)
+		if floors[ch] != nil {
+			for i := range coefs {
+				coefs[i] = floors[ch][i] * residue[ch][i]
+			}
+		}
+		out := testIMDCT(coefs)
+		for i := range out {
+			out[i] *= window[i]
+		}
+		cur[ch] = out
+	}
+
+	// 前のブロックの中央から今のブロックの中央までを、重ね合わせて出力します。
+	// エンコーダは長いブロックしか使わないため、大きさの違うブロックの重ね合わせには対応しません
+	if d.prev != nil {
+		if n != d.prevN {
+			return fmt.Errorf("mixed block sizes are not supported")
+		}
+		for ch := range cur {
+			for i := 0; i < half; i++ {
+				d.output[ch] = append(d.output[ch], d.prev[ch][half+i]+cur[ch][i])
+			}
+		}
+	}
+	d.prev, d.prevN = cur, n
+	return nil
+}
+
+// decodeTestVorbis は Ogg Vorbis を復号し、チャンネルごとのサンプル (-1〜1) とサンプリングレートを返します
+func decodeTestVorbis(b []byte) ([][]float64, int, error) {
+	packets, granule, err := testOggPackets(b)
+	if err != nil {
+		return nil, 0, err
+	}
+	d := &testVorbisDecoder{}
+	if err := d.readHeaders(packets); err != nil {
+		return nil, 0, err
+	}
+	d.output = make([][]float64, d.channels)
+	for i, p := range packets[3:] {
+		if err := d.decodePacket(p); err != nil {
+			return nil, 0, fmt.Errorf("packet %d: %v", i, err)
+		}
+	}
+	for ch := range d.output {
+		if granule < 0 || int(granule) > len(d.output[ch]) {
+			return nil, 0, fmt.Errorf("granule position %d, decoded %d samples", granule, len(d.output[ch]))
+		}
+		d.output[ch] = d.output[ch][:granule]
+	}
+	return d.output, d.rate, nil
+}
+
+// testSignal は読み上げに近い、振幅の変わる複数の周波数の和です
+func testSignal(length, rate int, base float64) []float64 {
+	s := make([]float64, length)
+	for i := range s {
+		t := float64(i) / float64(rate)
+		env := 0.5 + 0.5*math.Sin(2*math.Pi*3*t)
+		s[i] = 0.4 * env * (math.Sin(2*math.Pi*base*t) + 0.5*math.Sin(2*math.Pi*base*3.1*t) + 0.25*math.Sin(2*math.Pi*base*7.3*t)) / 1.75
+	}
+	return s
+}
+
+func testPCMWAV(rate int, channels [][]float64) []byte {
+	length := len(channels[0])
+	samples := make([]int16, 0, length*len(channels))
+	for i := 0; i < length; i++ {
+		for _, ch := range channels {
+			samples = append(samples, int16(math.Round(ch[i]*maxSample16)))
+		}
+	}
+	return encodeWAV(pcm16Format(rate, len(channels) == 2), encodeSamples16(samples))
+}
+
+// snrDB は original に対する decoded の信号対雑音比 (dB) です
+func snrDB(original, decoded []float64) float64 {
+	var sig, noise float64
+	for i := range original {
+		sig += original[i] * original[i]
+		d := original[i] - decoded[i]
+		noise += d * d
+	}
+	if noise == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(sig/noise)
+}
+
+func TestEncodeVorbisRoundTrip(t *testing.T) {
+	const rate = 24000
+	tests := []struct {
+		name    string
+		signals [][]float64
+		minSNR  float64
+	}{
+		{"mono", [][]float64{testSignal(rate, rate, 220)}, 20},
+		{"stereo", [][]float64{testSignal(rate, rate, 220), testSignal(rate, rate, 330)}, 20},
+		{"short", [][]float64{testSignal(100, rate, 440)}, 10},
+		{"one block", [][]float64{testSignal(1024, rate, 440)}, 15},
+		{"silence", [][]float64{make([]float64, 3000)}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ogg, err := encodeVorbis(testPCMWAV(rate, tt.signals))
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, gotRate, err := decodeTestVorbis(ogg)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if gotRate != rate || len(decoded) != len(tt.signals) {
+				t.Fatalf("rate %d, %d channels; want %d, %d", gotRate, len(decoded), rate, len(tt.signals))
+			}
+			for ch, want := range tt.signals {
+				if len(decoded[ch]) != len(want) {
+					t.Fatalf("channel %d: %d samples, want %d", ch, len(decoded[ch]), len(want))
+				}
+				// 16bit に丸めた入力と比べます
+				original := make([]float64, len(want))
+				for i, v := range want {
+					original[i] = math.Round(v*maxSample16) / (maxSample16 + 1)
+				}
+				if tt.minSNR == 0 {
+					for i, v := range decoded[ch] {
+						if math.Abs(v) > 1e-6 {
+							t.Fatalf("channel %d: sample %d = %g, want silence", ch, i, v)
+						}
+					}
+					continue
+				}
+				if snr := snrDB(original, decoded[ch]); snr < tt.minSNR {
+					t.Errorf("channel %d: SNR %.1f dB, want at least %.0f dB", ch, snr, tt.minSNR)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeVorbisRejectsEmpty(t *testing.T) {
+	for _, stereo := range []bool{false, true} {
+		if _, err := encodeVorbis(encodeWAV(pcm16Format(24000, stereo), nil)); err == nil {
+			t.Errorf("stereo=%v: encodeVorbis of empty audio succeeded, want an error", stereo)
+		}
+	}
+}
+
+func TestEncodeVorbisRejectsNonPCM16(t *testing.T) {
+	format := pcm16Format(24000, false)
+	format.BitsPerSample = 8
+	format.BlockAlign = 1
+	format.ByteRate = 24000
+	if _, err := encodeVorbis(encodeWAV(format, bytes.Repeat([]byte{128}, 100))); err == nil {
+		t.Error("encodeVorbis of 8bit audio succeeded, want an error")
+	}
+}
+
+// decodeExternalVorbis は PATH にある ffmpeg か oggdec で Ogg Vorbis を復号し、インターリーブした16bitのサンプルを返します。
+// どちらも無い場合は decoder が空になります
+func decodeExternalVorbis(t *testing.T, ogg []byte) (samples []int16, decoder string) {
+	t.Helper()
+	var cmd *exec.Cmd
+	if path, err := exec.LookPath("ffmpeg"); err == nil {
+		decoder = "ffmpeg"
+		cmd = exec.Command(path, "-hide_banner", "-loglevel", "error", "-i", "pipe:0", "-f", "s16le", "-acodec", "pcm_s16le", "pipe:1")
+		cmd.Stdin = bytes.NewReader(ogg)
+	} else if path, err := exec.LookPath("oggdec"); err == nil {
+		decoder = "oggdec"
+		file := filepath.Join(t.TempDir(), "test.ogg")
+		if err := os.WriteFile(file, ogg, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cmd = exec.Command(path, "-Q", "-R", "-o", "-", file)
+	} else {
+		return nil, ""
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("%s: %v\n%s", decoder, err, stderr.String())
+	}
+	return decodeSamples16(stdout.Bytes()), decoder
+}
+
+// TestEncodeVorbisExternalDecoder は組み込みのエンコーダの出力を、テスト用のデコーダとは別に実装された
+// 実際のデコーダ (ffmpeg か oggdec) で復号し、長さと音量が元の音声と合うことを確かめます
+func TestEncodeVorbisExternalDecoder(t *testing.T) {
+	const rate = 24000
+	tests := []struct {
+		name    string
+		signals [][]float64
+	}{
+		{"mono", [][]float64{testSignal(rate, rate, 220)}},
+		{"stereo", [][]float64{testSignal(rate, rate, 220), testSignal(rate, rate, 330)}},
+		{"odd length", [][]float64{testSignal(rate/3+7, rate, 440)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ogg, err := encodeVorbis(testPCMWAV(rate, tt.signals))
+			if err != nil {
+				t.Fatal(err)
+			}
+			samples, decoder := decodeExternalVorbis(t, ogg)
+			if decoder == "" {
+				t.Skip("ffmpeg も oggdec も見つからないため、実際のデコーダでの確認を省略します")
+			}
+			channels := len(tt.signals)
+			if got, want := len(samples)/channels, len(tt.signals[0]); len(samples)%channels != 0 || got != want {
+				t.Fatalf("%s: %d samples (%d channels), want %d per channel", decoder, len(samples), channels, want)
+			}
+			for ch, want := range tt.signals {
+				original16 := make([]int16, len(want))
+				decoded16 := make([]int16, len(want))
+				original := make([]float64, len(want))
+				decoded := make([]float64, len(want))
+				for i, v := range want {
+					original16[i] = int16(math.Round(v * maxSample16))
+					decoded16[i] = samples[i*channels+ch]
+					original[i] = float64(original16[i]) / (maxSample16 + 1)
+					decoded[i] = float64(decoded16[i]) / (maxSample16 + 1)
+				}
+				_, wantRMS := peakAndRMS(original16)
+				_, gotRMS := peakAndRMS(decoded16)
+				if diff := math.Abs(toDBFS(gotRMS) - toDBFS(wantRMS)); diff > 1 {
+					t.Errorf("%s: channel %d: RMS %.1f dBFS, want %.1f dBFS", decoder, ch, toDBFS(gotRMS), toDBFS(wantRMS))
+				}
+				if snr := snrDB(original, decoded); snr < 15 {
+					t.Errorf("%s: channel %d: SNR %.1f dB, want at least 15 dB", decoder, ch, snr)
+				}
+			}
+		})
+	}
+}
+
+// TestDecodeVorbisFixture は、テスト用のデコーダが実際のデコーダと同じように読めることを確かめます。
+// testdata/vorbis_stereo.ogg は testSignal の0.5秒のステレオ (220Hz / 330Hz, 24000Hz) を encodeVorbis で保存したもので、
+// 別の実装のデコーダ (github.com/jfreymuth/oggvorbis v1.0.5) で 12000 サンプル、SNR 26.7 dB / 24.2 dB に復号できることを確認しています
+func TestDecodeVorbisFixture(t *testing.T) {
+	const rate = 24000
+	ogg, err := os.ReadFile(filepath.Join("testdata", "vorbis_stereo.ogg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, gotRate, err := decodeTestVorbis(ogg)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if gotRate != rate || len(decoded) != 2 {
+		t.Fatalf("rate %d, %d channels; want %d, 2", gotRate, len(decoded), rate)
+	}
+	for ch, base := range []float64{220, 330} {
+		want := testSignal(rate/2, rate, base)
+		if len(decoded[ch]) != len(want) {
+			t.Fatalf("channel %d: %d samples, want %d", ch, len(decoded[ch]), len(want))
+		}
+		original := make([]float64, len(want))
+		for i, v := range want {
+			original[i] = math.Round(v*maxSample16) / (maxSample16 + 1)
+		}
+		if snr := snrDB(original, decoded[ch]); snr < 20 {
+			t.Errorf("channel %d: SNR %.1f dB, want at least 20 dB", ch, snr)
+		}
+	}
+}
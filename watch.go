@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// watchInterval は --watch で入力ファイルの変更を確認する間隔です
+const watchInterval = 500 * time.Millisecond
+
+// fileStamp はファイルが保存されたかどうかを比べるための、更新時刻とサイズです
+type fileStamp struct {
+	modTime int64
+	size    int64
+}
+
+func statStamp(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime().UnixNano(), size: info.Size()}, nil
+}
+
+// runWatch は入力ファイルを監視し、保存されるたびに同じ引数 (--watch を除く) で自身を実行して合成し直します。
+// 合成の処理は実行ごとに状態を持つため、毎回別のプロセスで実行します。合成に失敗しても監視を続け、Ctrl+C で終了します。
+// 依存を増やさないよう、ファイルシステムの通知 (fsnotify など) ではなく更新時刻とサイズを watchInterval ごとに確認します。
+// 2回目からは前回の出力があるため、noClobber でなければ確認せずに上書きします
+func runWatch(path string, args []string, noClobber bool) int {
+	exe, err := os.Executable()
+	if err != nil {
+		return fail(fmt.Errorf("実行ファイルのパスを取得できませんでした: %v", err))
+	}
+	stamp, err := statStamp(path)
+	if err != nil {
+		return fail(&FileError{Msg: fmt.Sprintf("入力ファイル '%s' を開けませんでした", path), Err: err})
+	}
+	args = append(args, "--watch=false")
+	if !noClobber {
+		args = append(args, "--force-overwrite")
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		if runWatchOnce(exe, args, sig) {
+			return exitInterrupted
+		}
+		logInfo("'%s' の変更を待っています (Ctrl+C で終了)...", path)
+		pending := stamp
+		for {
+			select {
+			case <-sig:
+				return exitInterrupted
+			case <-ticker.C:
+			}
+			// エディタによっては保存の途中でファイルが消えたり短くなったりするため、
+			// 読めない間は待ち、次の確認でも変わっていないことを確かめてから合成します
+			next, err := statStamp(path)
+			if err != nil || next == stamp {
+				pending = stamp
+				continue
+			}
+			if next != pending {
+				pending = next
+				continue
+			}
+			stamp = next
+			break
+		}
+		logInfo("[%s] '%s' の変更を検出しました。合成し直します...", time.Now().Format("15:04:05"), path)
+	}
+}
+
+// runWatchOnce は自身を1回実行し、終わるまで待ちます。Ctrl+C や SIGTERM で中断した場合は true を返します
+func runWatchOnce(exe string, args []string, sig <-chan os.Signal) bool {
+	cmd := exec.Command(exe, args...)
+	// 標準入力を渡すと上書きの確認で止まるため、子プロセスには標準入力を渡しません
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		logError(fmt.Errorf("合成を開始できませんでした: %v", err))
+		return false
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	interrupted := false
+	for {
+		select {
+		case s := <-sig:
+			interrupted = true
+			// Ctrl+C は端末から子プロセスにも届くため、二重に送らないよう SIGTERM だけを転送します
+			if s == syscall.SIGTERM {
+				cmd.Process.Signal(s)
+			}
+		case err := <-done:
+			var exitErr *exec.ExitError
+			switch {
+			case interrupted:
+				return true
+			case errors.As(err, &exitErr) && exitErr.ExitCode() == exitInterrupted:
+				return true
+			case errors.As(err, &exitErr):
+				logWarn("合成に失敗しました (終了コード %d)。ファイルを保存し直すと、もう一度合成します", exitErr.ExitCode())
+			case err != nil:
+				logError(fmt.Errorf("合成を実行できませんでした: %v", err))
+			}
+			return false
+		}
+	}
+}
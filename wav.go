@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"time"
+)
+
+// WAVFormat はWAVファイルの fmt チャンクの内容を表します
+type WAVFormat struct {
+	AudioFormat   uint16
+	Channels      uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+}
+
+// WAV は解析済みのWAVファイル（フォーマットとPCMデータ）を表します
+type WAV struct {
+	Format WAVFormat
+	Data   []byte
+}
+
+// parseWAV はWAVデータのヘッダを解析し、フォーマットとPCMデータを取り出します
+func parseWAV(b []byte) (*WAV, error) {
+	if len(b) < 12 || string(b[0:4]) != "RIFF" || string(b[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("WAVファイルではありません (RIFF/WAVEヘッダが見つかりません)")
+	}
+
+	var wav WAV
+	foundFmt, foundData := false, false
+	pos := 12
+	for pos+8 <= len(b) {
+		id := string(b[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(b[pos+4 : pos+8]))
+		body := pos + 8
+		end := body + size
+		if end > len(b) {
+			// data チャンクのサイズが実データより大きい壊れたファイルは、ある分だけ読み込みます
+			if id != "data" {
+				return nil, fmt.Errorf("'%s' チャンクが途中で切れています", id)
+			}
+			end = len(b)
+		}
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, fmt.Errorf("fmtチャンクのサイズが不正です (%d バイト)", size)
+			}
+			f := b[body:end]
+			wav.Format = WAVFormat{
+				AudioFormat:   binary.LittleEndian.Uint16(f[0:2]),
+				Channels:      binary.LittleEndian.Uint16(f[2:4]),
+				SampleRate:    binary.LittleEndian.Uint32(f[4:8]),
+				ByteRate:      binary.LittleEndian.Uint32(f[8:12]),
+				BlockAlign:    binary.LittleEndian.Uint16(f[12:14]),
+				BitsPerSample: binary.LittleEndian.Uint16(f[14:16]),
+			}
+			foundFmt = true
+		case "data":
+			wav.Data = b[body:end]
+			foundData = true
+		}
+
+		// チャンクは2バイト境界に揃えられています
+		pos = end + size%2
+	}
+
+	if !foundFmt {
+		return nil, fmt.Errorf("fmtチャンクが見つかりません")
+	}
+	if !foundData {
+		return nil, fmt.Errorf("dataチャンクが見つかりません")
+	}
+	return &wav, nil
+}
+
+// encodeWAV はフォーマットとPCMデータから標準的な44バイトヘッダのWAVデータを生成します
+func encodeWAV(format WAVFormat, pcm []byte) []byte {
+	var buf bytes.Buffer
+	buf.Grow(44 + len(pcm))
+
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+len(pcm)))
+	buf.WriteString("WAVE")
+
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	binary.Write(&buf, binary.LittleEndian, format)
+
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(pcm)))
+	buf.Write(pcm)
+
+	return buf.Bytes()
+}
+
+// silencePCM はフォーマットに合わせた指定時間分の無音PCMデータを返します
+func silencePCM(format WAVFormat, d time.Duration) []byte {
+	frames := int(float64(format.SampleRate) * d.Seconds())
+	pcm := make([]byte, frames*int(format.BlockAlign))
+	if format.BitsPerSample == 8 {
+		// 8bit PCM は符号なしのため、無音は 128 です
+		for i := range pcm {
+			pcm[i] = 0x80
+		}
+	}
+	return pcm
+}
+
+// pcmDuration はフォーマットとPCMデータのバイト数から再生時間を返します
+func pcmDuration(format WAVFormat, size int) time.Duration {
+	if format.ByteRate == 0 {
+		return 0
+	}
+	return time.Duration(float64(size) / float64(format.ByteRate) * float64(time.Second))
+}
+
+// pcm16Format はサンプリングレートとチャンネル数から16bit PCMのフォーマットを作成します
+func pcm16Format(rate int, stereo bool) WAVFormat {
+	channels := uint16(1)
+	if stereo {
+		channels = 2
+	}
+	return WAVFormat{
+		AudioFormat:   1,
+		Channels:      channels,
+		SampleRate:    uint32(rate),
+		ByteRate:      uint32(rate) * uint32(channels) * 2,
+		BlockAlign:    channels * 2,
+		BitsPerSample: 16,
+	}
+}
+
+// generateSilence は指定した秒数・サンプリングレート・チャンネル数の無音WAV (16bit PCM) を生成します。
+// VOICEVOXの出力と同じ形式なので、合成結果とそのまま結合できます
+func generateSilence(seconds float64, rate int, stereo bool) []byte {
+	format := pcm16Format(rate, stereo)
+	return encodeWAV(format, silencePCM(format, time.Duration(seconds*float64(time.Second))))
+}
+
+// repairPartialWAV は受信が途中で中断されたWAVデータを、フレームの途中で切れた端数を除き、
+// 実際のデータ長に合わせたヘッダで作り直します。ヘッダを解析できない場合はそのまま返します
+func repairPartialWAV(b []byte) []byte {
+	wav, err := parseWAV(b)
+	if err != nil || wav.Format.BlockAlign == 0 {
+		return b
+	}
+	data := wav.Data[:len(wav.Data)-len(wav.Data)%int(wav.Format.BlockAlign)]
+	return encodeWAV(wav.Format, data)
+}
+
+// concatWAV は同一フォーマットの複数のWAVデータを1つに結合します
+func concatWAV(wavs [][]byte) ([]byte, error) {
+	if len(wavs) == 0 {
+		return nil, fmt.Errorf("結合するWAVデータがありません")
+	}
+
+	var format WAVFormat
+	var pcm bytes.Buffer
+	for i, b := range wavs {
+		wav, err := parseWAV(b)
+		if err != nil {
+			return nil, fmt.Errorf("%d 番目のWAVの解析に失敗しました: %v", i+1, err)
+		}
+		if i == 0 {
+			format = wav.Format
+		} else if err := checkSameFormat(format, wav.Format); err != nil {
+			return nil, fmt.Errorf("%d 番目のWAVのフォーマットが一致しません: %v", i+1, err)
+		}
+		pcm.Write(wav.Data)
+	}
+
+	return encodeWAV(format, pcm.Bytes()), nil
+}
+
+// concatWAVFiles は複数のWAVファイルを読み込み、1つのWAVデータに結合します。
+// gap が正の場合は、ファイルの間にその長さの無音を挟みます
+func concatWAVFiles(paths []string, gap time.Duration) ([]byte, error) {
+	wavs := make([][]byte, 0, len(paths))
+	var first WAVFormat
+	for i, path := range paths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, &FileError{Msg: "ファイルの読み込みに失敗しました", Err: err}
+		}
+		wav, err := parseWAV(b)
+		if err != nil {
+			return nil, &FileError{Msg: fmt.Sprintf("'%s' の解析に失敗しました", path), Err: err}
+		}
+		if i == 0 {
+			first = wav.Format
+		} else if err := checkSameFormat(first, wav.Format); err != nil {
+			return nil, &FileError{Msg: fmt.Sprintf("'%s' と '%s' は結合できません", paths[0], path), Err: err}
+		}
+		if i > 0 && gap > 0 {
+			wavs = append(wavs, encodeWAV(first, silencePCM(first, gap)))
+		}
+		wavs = append(wavs, b)
+	}
+
+	return concatWAV(wavs)
+}
+
+// checkSameFormat は2つのWAVフォーマットが結合可能か（同一か）を確認します
+func checkSameFormat(a, b WAVFormat) error {
+	switch {
+	case a.AudioFormat != b.AudioFormat:
+		return fmt.Errorf("音声フォーマットが異なります (%d と %d)", a.AudioFormat, b.AudioFormat)
+	case a.SampleRate != b.SampleRate:
+		return fmt.Errorf("サンプリングレートが異なります (%dHz と %dHz)", a.SampleRate, b.SampleRate)
+	case a.Channels != b.Channels:
+		return fmt.Errorf("チャンネル数が異なります (%d と %d)", a.Channels, b.Channels)
+	case a.BitsPerSample != b.BitsPerSample:
+		return fmt.Errorf("ビット深度が異なります (%dbit と %dbit)", a.BitsPerSample, b.BitsPerSample)
+	}
+	return nil
+}